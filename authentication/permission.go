@@ -0,0 +1,23 @@
+package authentication
+
+import (
+	"net/http"
+
+	"github.com/Teelevision/excommerce/model"
+)
+
+// RequirePermission returns a handler func that only calls next if the
+// authenticated user has the permission. It must be used after the
+// Authenticator's HandlerFunc, like so:
+//
+//	authenticator.HandlerFunc(RequirePermission(permission, next))
+func RequirePermission(permission model.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := AuthenticatedUser(r.Context())
+		if user == nil || !user.HasPermission(permission) {
+			w.WriteHeader(http.StatusForbidden) // 403
+			return
+		}
+		next(w, r)
+	}
+}
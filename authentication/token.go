@@ -0,0 +1,100 @@
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Teelevision/excommerce/model"
+)
+
+// ErrInvalidToken is returned if a token is malformed, not signed with the
+// secret or expired.
+var ErrInvalidToken = errors.New("invalid token")
+
+// AccessToken is the content of a signed access token. Access tokens are JSON
+// Web Tokens signed with HMAC-SHA256. Tokens of guests have no session.
+type AccessToken struct {
+	SessionID string
+	UserID    string
+	UserName  string
+	Roles     []model.Role
+	Guest     bool
+	ExpiresAt time.Time
+}
+
+type accessTokenClaims struct {
+	Subject   string       `json:"sub"`
+	Name      string       `json:"name"`
+	Roles     []model.Role `json:"roles,omitempty"`
+	SessionID string       `json:"sid,omitempty"`
+	Guest     bool         `json:"guest,omitempty"`
+	IssuedAt  int64        `json:"iat"`
+	ExpiresAt int64        `json:"exp"`
+}
+
+// the header is always the same, so it is only encoded once
+var accessTokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// SignAccessToken returns the signed access token.
+func (a *Authenticator) SignAccessToken(token AccessToken) string {
+	claims, err := json.Marshal(accessTokenClaims{
+		Subject:   token.UserID,
+		Name:      token.UserName,
+		Roles:     token.Roles,
+		SessionID: token.SessionID,
+		Guest:     token.Guest,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: token.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	payload := accessTokenHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + a.sign(payload)
+}
+
+// ParseAccessToken verifies the signed access token and returns its content.
+// ErrInvalidToken is returned if the token is malformed, not signed with the
+// secret or expired.
+func (a *Authenticator) ParseAccessToken(signed string) (*AccessToken, error) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 3 || parts[0] != accessTokenHeader {
+		return nil, ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(a.sign(payload))) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims accessTokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if !time.Now().Before(expiresAt) {
+		return nil, ErrInvalidToken
+	}
+	return &AccessToken{
+		SessionID: claims.SessionID,
+		UserID:    claims.Subject,
+		UserName:  claims.Name,
+		Roles:     claims.Roles,
+		Guest:     claims.Guest,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (a *Authenticator) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -4,15 +4,30 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/Teelevision/excommerce/model"
 	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/ratelimit"
 )
 
 // Authenticator authenticates users. If used as a middleware it requires that
-// the request is authenticated.
+// the request is authenticated, either by a bearer access token of a user or
+// guest or, if enabled, by basic auth with the user's id and password.
 type Authenticator struct {
-	UserRepository persistence.UserRepository
+	UserRepository    persistence.UserRepository
+	SessionRepository persistence.SessionRepository
+
+	// Secret is the key that access tokens are signed with.
+	Secret []byte
+	// BasicAuth enables authentication with the user's id and password. It is
+	// slow, because the password hash is checked on every request.
+	BasicAuth bool
+
+	// IPLimiter and AccountLimiter limit the failed basic auth attempts per
+	// IP address and per user. They are optional.
+	IPLimiter      *ratelimit.Limiter
+	AccountLimiter *ratelimit.Limiter
 }
 
 type userCtxKey struct{}
@@ -29,26 +44,103 @@ func AuthenticatedUser(ctx context.Context) *model.User {
 	if !ok {
 		return nil
 	}
+	user.Roles = append([]model.Role(nil), user.Roles...)
 	return &user
 }
 
+type sessionCtxKey struct{}
+
+// AuthenticatedSession returns the id of the login session in the context or
+// an empty string if the user is not authenticated by an access token.
+func AuthenticatedSession(ctx context.Context) string {
+	id, _ := ctx.Value(sessionCtxKey{}).(string)
+	return id
+}
+
 // HandlerFunc returns a handler func that authenticates the user making the
 // request and add that user to the context. Using this middleware enables the
 // usage of AuthenticatedUser to retrieve the user that made the request.
 func (a *Authenticator) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	basicAuth := a.basicAuthHandlerFunc(next)
+	basicAuth = a.AccountLimiter.Middleware(basicAuthID, http.StatusUnauthorized)(basicAuth)
+	basicAuth = a.IPLimiter.Middleware(ratelimit.RemoteIP, http.StatusUnauthorized)(basicAuth)
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		id, password, ok := r.BasicAuth()
-		if !ok {
+		ctx := r.Context()
+
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			token, err := a.ParseAccessToken(strings.TrimPrefix(header, "Bearer "))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized) // 401
+				return
+			}
+
+			// guests have no session, but are rejected once claimed by a user
+			if token.Guest {
+				_, err := a.UserRepository.FindGuestClaim(ctx, token.UserID)
+				switch {
+				case err == nil:
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					w.WriteHeader(http.StatusUnauthorized) // 401
+				case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+					w.WriteHeader(499) // client closed request
+				case errors.Is(err, persistence.ErrNotFound):
+					ctx = context.WithValue(ctx, userCtxKey{}, model.User{
+						ID:    token.UserID,
+						Guest: true,
+					})
+					next(w, r.WithContext(ctx))
+				default:
+					panic(err)
+				}
+				return
+			}
+
+			// the session is checked, so that revoked tokens are rejected
+			session, err := a.SessionRepository.FindSession(ctx, token.SessionID)
+			switch {
+			case errors.Is(err, persistence.ErrNotFound), err == nil && session.UserID != token.UserID:
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				w.WriteHeader(http.StatusUnauthorized) // 401
+			case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				w.WriteHeader(499) // client closed request
+			case err == nil:
+				ctx = context.WithValue(ctx, userCtxKey{}, model.User{
+					ID:    token.UserID,
+					Name:  token.UserName,
+					Roles: token.Roles,
+				})
+				ctx = context.WithValue(ctx, sessionCtxKey{}, session.ID)
+				next(w, r.WithContext(ctx))
+			default:
+				panic(err)
+			}
+			return
+		}
+
+		if _, _, ok := r.BasicAuth(); !ok || !a.BasicAuth {
+			w.Header().Set("WWW-Authenticate", "Bearer")
 			w.WriteHeader(http.StatusUnauthorized) // 401
 			return
 		}
+		basicAuth(w, r)
+	}
+}
 
+// basicAuthHandlerFunc returns a handler func that authenticates the user by
+// the basic auth of the request.
+func (a *Authenticator) basicAuthHandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
+		id, password, _ := r.BasicAuth()
 		user, err := a.UserRepository.FindUserByIDAndPassword(ctx, id, password)
 		switch {
 		case errors.Is(err, persistence.ErrNotFound):
 			w.WriteHeader(http.StatusUnauthorized) // 401
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			w.WriteHeader(499) // client closed request
 		case err == nil:
 			ctx = context.WithValue(ctx, userCtxKey{}, *user)
 			next(w, r.WithContext(ctx))
@@ -57,3 +149,9 @@ func (a *Authenticator) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
 		}
 	}
 }
+
+// basicAuthID returns the user id of the basic auth of the request.
+func basicAuthID(r *http.Request) string {
+	id, _, _ := r.BasicAuth()
+	return id
+}
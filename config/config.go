@@ -0,0 +1,309 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Teelevision/excommerce/logging"
+	"gopkg.in/yaml.v2"
+)
+
+// persistence backends
+const (
+	BackendInMemory = "inmemory"
+	BackendEmbedded = "embedded"
+	BackendPostgres = "postgres"
+)
+
+// Config is the configuration of the service. It is read from an optional
+// YAML file and env vars, which take precedence.
+type Config struct {
+	Server        Server        `yaml:"server"`
+	Persistence   Persistence   `yaml:"persistence"`
+	Auth          Auth          `yaml:"auth"`
+	Coupons       Coupons       `yaml:"coupons"`
+	Payment       Payment       `yaml:"payment"`
+	Notifications Notifications `yaml:"notifications"`
+	Taxes         Taxes         `yaml:"taxes"`
+	Shipping      Shipping      `yaml:"shipping"`
+	Logging       Logging       `yaml:"logging"`
+}
+
+// Server is the configuration of the http server.
+type Server struct {
+	Address        string   `yaml:"address"`
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	TLSCertFile    string   `yaml:"tlsCertFile"`
+	TLSKeyFile     string   `yaml:"tlsKeyFile"`
+	ReadTimeout    Duration `yaml:"readTimeout"`
+	WriteTimeout   Duration `yaml:"writeTimeout"`
+	IdleTimeout    Duration `yaml:"idleTimeout"`
+	// time between not being ready anymore and stopping to accept requests
+	// on shutdown, so that load balancers notice it
+	DrainDelay Duration `yaml:"drainDelay"`
+	// time that in-flight requests are given to finish on shutdown
+	ShutdownTimeout Duration `yaml:"shutdownTimeout"`
+}
+
+// TLS returns whether the server uses TLS.
+func (s *Server) TLS() bool {
+	return s.TLSCertFile != ""
+}
+
+// Persistence is the configuration of the persistence backend. If no backend
+// is set, it is derived from the other settings.
+type Persistence struct {
+	Backend        string `yaml:"backend"`
+	PostgresDSN    string `yaml:"postgresDSN"`
+	EmbeddedDBFile string `yaml:"embeddedDBFile"`
+}
+
+// Auth is the configuration of the authentication.
+type Auth struct {
+	TokenSecret           string   `yaml:"tokenSecret"`
+	AccessTokenLifetime   Duration `yaml:"accessTokenLifetime"`
+	RefreshTokenLifetime  Duration `yaml:"refreshTokenLifetime"`
+	GuestTokenLifetime    Duration `yaml:"guestTokenLifetime"`
+	PasswordResetLifetime Duration `yaml:"passwordResetLifetime"`
+	BasicAuth             bool     `yaml:"basicAuth"`
+	AdminName             string   `yaml:"adminName"`
+}
+
+// Coupons is the configuration of coupons.
+type Coupons struct {
+	DefaultLifetime Duration `yaml:"defaultLifetime"`
+}
+
+// Payment is the configuration of the fake payment provider. Its
+// authorizations are kept in memory if no file is set.
+type Payment struct {
+	FakeFile string `yaml:"fakeFile"`
+}
+
+// Notifications is the configuration of the notifications to users.
+type Notifications struct {
+	File string `yaml:"file"`
+}
+
+// Taxes is the configuration of the value added taxes. Without a file of tax
+// rates orders have no taxes.
+type Taxes struct {
+	File string `yaml:"file"`
+}
+
+// Shipping is the configuration of the shipping of orders. Without a file of
+// shipping methods orders are not shipped and have no shipping costs.
+type Shipping struct {
+	File string `yaml:"file"`
+}
+
+// Logging is the configuration of the logs.
+type Logging struct {
+	Level string `yaml:"level"`
+}
+
+// Duration is a time.Duration that is written like "10s", "2.5m" or "1h30m"
+// in YAML.
+type Duration time.Duration
+
+// UnmarshalYAML parses the duration.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf(`%w
+Use values like "10s", "2.5m" or "1h30m" to express a duration.`, err)
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Address: ":8080",
+			AllowedOrigins: []string{
+				"http://localhost:3000", // frontend
+			},
+			ReadTimeout:     Duration(10 * time.Second),
+			WriteTimeout:    Duration(30 * time.Second),
+			IdleTimeout:     Duration(2 * time.Minute),
+			DrainDelay:      Duration(5 * time.Second),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Auth: Auth{
+			AccessTokenLifetime:   Duration(15 * time.Minute),
+			RefreshTokenLifetime:  Duration(30 * 24 * time.Hour),
+			GuestTokenLifetime:    Duration(24 * time.Hour),
+			PasswordResetLifetime: Duration(time.Hour),
+			BasicAuth:             true,
+			AdminName:             "admin",
+		},
+		Coupons: Coupons{
+			DefaultLifetime: Duration(10 * time.Second),
+		},
+		Logging: Logging{
+			Level: "info",
+		},
+	}
+}
+
+// Load reads the configuration from the YAML file named by the CONFIG_FILE env
+// var, if set, and from the other env vars, which take precedence. The
+// configuration is validated. A random token secret is generated if none is
+// set.
+func Load() (*Config, error) {
+	c, err := load(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Duration(c.Coupons.DefaultLifetime) < time.Second {
+		log.Println("Notice: The default lifetime of coupons is less than a second.")
+	}
+
+	// tokens become invalid on restart without a secret
+	if c.Auth.TokenSecret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+		c.Auth.TokenSecret = hex.EncodeToString(secret)
+	}
+	return c, nil
+}
+
+// load reads and validates the configuration using the given env.
+func load(getenv func(string) string) (*Config, error) {
+	c := Default()
+
+	if file := getenv("CONFIG_FILE"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, fmt.Errorf("could not parse config file %s: %w", file, err)
+		}
+	}
+
+	if err := c.applyEnv(getenv); err != nil {
+		return nil, err
+	}
+
+	if c.Persistence.Backend == "" {
+		switch {
+		case c.Persistence.PostgresDSN != "" && c.Persistence.EmbeddedDBFile != "":
+			return nil, errors.New("only one of POSTGRES_DSN and EMBEDDED_DB_FILE can be set")
+		case c.Persistence.PostgresDSN != "":
+			c.Persistence.Backend = BackendPostgres
+		case c.Persistence.EmbeddedDBFile != "":
+			c.Persistence.Backend = BackendEmbedded
+		default:
+			c.Persistence.Backend = BackendInMemory
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error that lists all invalid settings, or nil if the
+// configuration is valid.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	// server
+	check(c.Server.Address != "", "The listen address must be set.")
+	for _, origin := range c.Server.AllowedOrigins {
+		check(origin == "*" || strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://"),
+			"The allowed origin %q must be * or start with http:// or https://.", origin)
+	}
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""),
+		"The TLS certificate and key files must be set together.")
+	for _, file := range []string{c.Server.TLSCertFile, c.Server.TLSKeyFile} {
+		if file != "" {
+			_, err := os.Stat(file)
+			check(err == nil, "The TLS file %s cannot be used: %s", file, err)
+		}
+	}
+	for _, timeout := range []struct {
+		name  string
+		value Duration
+	}{
+		{"read", c.Server.ReadTimeout},
+		{"write", c.Server.WriteTimeout},
+		{"idle", c.Server.IdleTimeout},
+	} {
+		check(timeout.value >= 0, "The %s timeout must not be negative.", timeout.name)
+	}
+	check(c.Server.DrainDelay >= 0, "The drain delay must not be negative.")
+	check(c.Server.ShutdownTimeout > 0, "The shutdown timeout must be positive.")
+
+	// persistence
+	switch c.Persistence.Backend {
+	case BackendInMemory:
+	case BackendEmbedded:
+		check(c.Persistence.EmbeddedDBFile != "", "The embedded backend requires the embedded database file.")
+	case BackendPostgres:
+		check(c.Persistence.PostgresDSN != "", "The postgres backend requires the PostgreSQL DSN.")
+	default:
+		check(false, "The persistence backend must be one of %s, %s and %s.",
+			BackendInMemory, BackendEmbedded, BackendPostgres)
+	}
+
+	// auth
+	check(c.Auth.TokenSecret == "" || len(c.Auth.TokenSecret) >= 32,
+		"The token secret must be at least 32 characters long.")
+	for _, lifetime := range []struct {
+		name  string
+		value Duration
+	}{
+		{"access tokens", c.Auth.AccessTokenLifetime},
+		{"refresh tokens", c.Auth.RefreshTokenLifetime},
+		{"guest tokens", c.Auth.GuestTokenLifetime},
+		{"password reset tokens", c.Auth.PasswordResetLifetime},
+	} {
+		check(time.Duration(lifetime.value) >= time.Second,
+			"The lifetime of %s must be at least a second.", lifetime.name)
+	}
+	check(c.Auth.RefreshTokenLifetime >= c.Auth.AccessTokenLifetime,
+		"The lifetime of refresh tokens must not be less than that of access tokens.")
+	l := utf8.RuneCountInString(c.Auth.AdminName)
+	check(l >= 1 && l <= 64, "The admin name must be 1 to 64 characters long.")
+
+	// coupons
+	check(c.Coupons.DefaultLifetime > 0, "The default lifetime of coupons must be positive.")
+
+	// payment, placed orders refer to authorizations that must not be lost
+	check(c.Persistence.Backend == BackendInMemory || c.Payment.FakeFile != "",
+		"The fake payment file must be set with a persistent backend.")
+
+	// logging
+	_, err := logging.ParseLevel(c.Logging.Level)
+	check(err == nil, "The log level must be one of debug, info, warn and error.")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
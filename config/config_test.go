@@ -0,0 +1,104 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestLoadDefault(t *testing.T) {
+	c, err := load(env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", c.Server.Address)
+	assert.Equal(t, []string{"http://localhost:3000"}, c.Server.AllowedOrigins)
+	assert.Equal(t, BackendInMemory, c.Persistence.Backend)
+	assert.True(t, c.Auth.BasicAuth)
+}
+
+func TestLoadFileAndEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+server:
+  address: ":9090"
+  allowedOrigins: [https://shop.example.com]
+  readTimeout: 5s
+persistence:
+  embeddedDBFile: shop.db
+payment:
+  fakeFile: payments.json
+auth:
+  basicAuth: false
+  accessTokenLifetime: 5m
+`), 0600))
+
+	c, err := load(env(map[string]string{
+		"CONFIG_FILE":     file,
+		"LISTEN_ADDRESS":  ":7070",
+		"ALLOWED_ORIGINS": "https://a.example.com, https://b.example.com",
+		"WRITE_TIMEOUT":   "1m",
+		"DRAIN_DELAY":     "0s",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, ":7070", c.Server.Address)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, c.Server.AllowedOrigins)
+	assert.Equal(t, Duration(5*time.Second), c.Server.ReadTimeout)
+	assert.Equal(t, Duration(time.Minute), c.Server.WriteTimeout)
+	assert.Equal(t, Duration(2*time.Minute), c.Server.IdleTimeout) // default
+	assert.Zero(t, c.Server.DrainDelay)
+	assert.Equal(t, BackendEmbedded, c.Persistence.Backend)
+	assert.Equal(t, "shop.db", c.Persistence.EmbeddedDBFile)
+	assert.Equal(t, "payments.json", c.Payment.FakeFile)
+	assert.False(t, c.Auth.BasicAuth)
+	assert.Equal(t, Duration(5*time.Minute), c.Auth.AccessTokenLifetime)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for name, vars := range map[string]map[string]string{
+		"unknown backend":       {"PERSISTENCE_BACKEND": "mysql"},
+		"postgres without dsn":  {"PERSISTENCE_BACKEND": "postgres"},
+		"two backends":          {"POSTGRES_DSN": "dsn", "EMBEDDED_DB_FILE": "file"},
+		"payments in memory":    {"EMBEDDED_DB_FILE": "file"},
+		"short token secret":    {"TOKEN_SECRET": "secret"},
+		"invalid duration":      {"READ_TIMEOUT": "10"},
+		"negative drain delay":  {"DRAIN_DELAY": "-1s"},
+		"short access lifetime": {"ACCESS_TOKEN_LIFETIME": "10ms"},
+		"invalid origin":        {"ALLOWED_ORIGINS": "localhost:3000"},
+		"tls without key":       {"TLS_CERT_FILE": "cert.pem"},
+		"invalid boolean":       {"BASIC_AUTH": "maybe"},
+		"missing config file":   {"CONFIG_FILE": "does-not-exist.yaml"},
+		"unknown log level":     {"LOG_LEVEL": "verbose"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(env(vars))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("server:\n  adress: \":9090\"\n"), 0600))
+
+	_, err = load(env(map[string]string{"CONFIG_FILE": file}))
+	assert.Error(t, err)
+}
+
+func TestExampleFile(t *testing.T) {
+	_, err := load(env(map[string]string{"CONFIG_FILE": "config.example.yaml"}))
+	assert.NoError(t, err)
+}
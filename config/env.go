@@ -1,36 +1,85 @@
 package config
 
 import (
-	"log"
-	"os"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// app-wide configuration
-var (
-	CouponDefaultLifetime = 10 * time.Second
-)
-
-// parse COUPON_DEFAULT_LIFETIME
-func init() {
-	value := os.Getenv("COUPON_DEFAULT_LIFETIME")
-	if value == "" {
-		return
+// applyEnv overrides the configuration with the env vars that are set.
+func (c *Config) applyEnv(getenv func(string) string) error {
+	// strings
+	for _, env := range []struct {
+		name  string
+		value *string
+	}{
+		{"LISTEN_ADDRESS", &c.Server.Address},
+		{"TLS_CERT_FILE", &c.Server.TLSCertFile},
+		{"TLS_KEY_FILE", &c.Server.TLSKeyFile},
+		{"PERSISTENCE_BACKEND", &c.Persistence.Backend},
+		{"POSTGRES_DSN", &c.Persistence.PostgresDSN},
+		{"EMBEDDED_DB_FILE", &c.Persistence.EmbeddedDBFile},
+		{"TOKEN_SECRET", &c.Auth.TokenSecret},
+		{"ADMIN_NAME", &c.Auth.AdminName},
+		{"FAKE_PAYMENT_FILE", &c.Payment.FakeFile},
+		{"NOTIFICATION_FILE", &c.Notifications.File},
+		{"TAX_FILE", &c.Taxes.File},
+		{"SHIPPING_FILE", &c.Shipping.File},
+		{"LOG_LEVEL", &c.Logging.Level},
+	} {
+		if value := getenv(env.name); value != "" {
+			*env.value = value
+		}
 	}
 
-	dur, err := time.ParseDuration(value)
-	if err != nil {
-		log.Fatalf(`Could not parse value %q of COUPON_DEFAULT_LIFETIME env: %s
-Use values like "10s", "2.5m" or "1h30m" to express a duration.`, value, err)
+	// lists
+	if value := getenv("ALLOWED_ORIGINS"); value != "" {
+		c.Server.AllowedOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.Server.AllowedOrigins = append(c.Server.AllowedOrigins, origin)
+			}
+		}
 	}
 
-	if dur == time.Duration(0) {
-		return
+	// durations
+	for _, env := range []struct {
+		name  string
+		value *Duration
+	}{
+		{"READ_TIMEOUT", &c.Server.ReadTimeout},
+		{"WRITE_TIMEOUT", &c.Server.WriteTimeout},
+		{"IDLE_TIMEOUT", &c.Server.IdleTimeout},
+		{"DRAIN_DELAY", &c.Server.DrainDelay},
+		{"SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout},
+		{"ACCESS_TOKEN_LIFETIME", &c.Auth.AccessTokenLifetime},
+		{"REFRESH_TOKEN_LIFETIME", &c.Auth.RefreshTokenLifetime},
+		{"GUEST_TOKEN_LIFETIME", &c.Auth.GuestTokenLifetime},
+		{"PASSWORD_RESET_LIFETIME", &c.Auth.PasswordResetLifetime},
+		{"COUPON_DEFAULT_LIFETIME", &c.Coupons.DefaultLifetime},
+	} {
+		value := getenv(env.name)
+		if value == "" {
+			continue
+		}
+		dur, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf(`could not parse value %q of %s env: %w
+Use values like "10s", "2.5m" or "1h30m" to express a duration.`, value, env.name, err)
+		}
+		*env.value = Duration(dur)
 	}
 
-	if dur < time.Second {
-		log.Println("Notice: The value of COUPON_DEFAULT_LIFETIME is less than a second.")
+	// booleans
+	if value := getenv("BASIC_AUTH"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf(`could not parse value %q of BASIC_AUTH env: %w
+Use "true" or "false".`, value, err)
+		}
+		c.Auth.BasicAuth = enabled
 	}
 
-	CouponDefaultLifetime = dur
+	return nil
 }
@@ -5,19 +5,21 @@ import (
 	"errors"
 
 	"github.com/Teelevision/excommerce/authentication"
+	"github.com/Teelevision/excommerce/logging"
 	"github.com/Teelevision/excommerce/model"
 	"github.com/Teelevision/excommerce/persistence"
 )
 
 // Cart is the controller that handles carts.
 type Cart struct {
-	CartRepository    persistence.CartRepository
-	ProductRepository persistence.ProductRepository
+	CartRepository      persistence.CartRepository
+	ProductRepository   persistence.ProductRepository
+	PromotionRepository persistence.PromotionRepository
 }
 
-// Get returns the cart with the given id with all prices calculated.
-// ErrNotFound is retuned if there is no cart with the id. ErrDeleted is
-// returned if the cart did exist but is deleted. ErrForbidden is returned if
+// Get returns the cart with the given id with all prices calculated in its
+// currency. ErrNotFound is retuned if there is no cart with the id. ErrDeleted
+// is returned if the cart did exist but is deleted. ErrForbidden is returned if
 // the cart exists, but the current user is not allowed to access it.
 func (c *Cart) Get(ctx context.Context, cartID string) (*model.Cart, error) {
 	cart, err := c.CartRepository.FindCartOfUser(ctx,
@@ -35,17 +37,54 @@ func (c *Cart) Get(ctx context.Context, cartID string) (*model.Cart, error) {
 		return nil, err
 	case err == nil:
 		// load products
+		if cart.Currency == "" {
+			// stored before carts had a currency
+			cart.Currency = model.DefaultCurrency
+		}
 		if err := c.loadProducts(ctx, cart); err != nil {
 			return nil, err
 		}
-		cart.Positions = generateOrderPositions(cart.Positions, nil)
+		promotions, err := findAllPromotions(ctx, c.PromotionRepository)
+		if err != nil {
+			return nil, err
+		}
+		cart.Positions = generateOrderPositions(cart.Positions, nil, promotions)
 		return cart, nil
 	default:
 		panic(err)
 	}
 }
 
-// GetAllUnlocked returns all unlocked carts of the current user.
+// Currency returns the currency of the cart with the given id. ErrNotFound is
+// returned if there is no cart with the id. ErrDeleted is returned if the cart
+// did exist but is deleted. ErrForbidden is returned if the cart exists, but the
+// current user is not allowed to access it.
+func (c *Cart) Currency(ctx context.Context, cartID string) (model.Currency, error) {
+	cart, err := c.CartRepository.FindCartOfUser(ctx,
+		authentication.AuthenticatedUser(ctx).ID,
+		cartID,
+	)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return "", ErrNotFound
+	case errors.Is(err, persistence.ErrDeleted):
+		return "", ErrDeleted
+	case errors.Is(err, persistence.ErrNotOwnedByUser):
+		return "", ErrForbidden
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "", err
+	case err == nil && cart.Currency == "":
+		// stored before carts had a currency
+		return model.DefaultCurrency, nil
+	case err == nil:
+		return cart.Currency, nil
+	default:
+		panic(err)
+	}
+}
+
+// GetAllUnlocked returns all unlocked carts of the current user with all
+// prices calculated in their currencies.
 func (c *Cart) GetAllUnlocked(ctx context.Context) ([]*model.Cart, error) {
 	carts, err := c.CartRepository.FindAllUnlockedCartsOfUser(ctx,
 		authentication.AuthenticatedUser(ctx).ID)
@@ -53,11 +92,19 @@ func (c *Cart) GetAllUnlocked(ctx context.Context) ([]*model.Cart, error) {
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
+		promotions, err := findAllPromotions(ctx, c.PromotionRepository)
+		if err != nil {
+			return nil, err
+		}
 		for _, cart := range carts {
+			if cart.Currency == "" {
+				// stored before carts had a currency
+				cart.Currency = model.DefaultCurrency
+			}
 			if err := c.loadProducts(ctx, cart); err != nil {
 				return nil, err
 			}
-			cart.Positions = generateOrderPositions(cart.Positions, nil)
+			cart.Positions = generateOrderPositions(cart.Positions, nil, promotions)
 		}
 		return carts, nil
 	default:
@@ -65,13 +112,16 @@ func (c *Cart) GetAllUnlocked(ctx context.Context) ([]*model.Cart, error) {
 	}
 }
 
-// CreateAndGet creates the given cart. ErrConflict is returned if a cart with
-// the same id already exists or existed. The cart is returned with all prices
-// already calculated.
+// CreateAndGet creates the given cart in its currency, which cannot be changed
+// afterwards. ErrConflict is returned if a cart with the same id already exists
+// or existed. The cart is returned with all prices already calculated. The
+// products of the positions are expected to have their prices in the currency
+// of the cart.
 func (c *Cart) CreateAndGet(ctx context.Context, cart *model.Cart) (*model.Cart, error) {
 	err := c.CartRepository.CreateCart(ctx,
 		authentication.AuthenticatedUser(ctx).ID,
 		cart.ID,
+		cart.Currency,
 		convertCartPositions(cart.Positions),
 	)
 	switch {
@@ -80,7 +130,13 @@ func (c *Cart) CreateAndGet(ctx context.Context, cart *model.Cart) (*model.Cart,
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
-		cart.Positions = generateOrderPositions(cart.Positions, nil)
+		logging.FromContext(ctx).Debug("cart stored", "cartId", cart.ID)
+		cartsStored.Inc()
+		promotions, err := findAllPromotions(ctx, c.PromotionRepository)
+		if err != nil {
+			return nil, err
+		}
+		cart.Positions = generateOrderPositions(cart.Positions, nil, promotions)
 		return cart, nil
 	default:
 		panic(err)
@@ -90,15 +146,20 @@ func (c *Cart) CreateAndGet(ctx context.Context, cart *model.Cart) (*model.Cart,
 // UpdateAndGet updates the given cart. ErrNotFound is returned if the cart with
 // the same id does not exist. ErrDeleted is returned if the cart did exist but
 // is deleted. ErrForbidden is returned if the cart exists, but updating it is
-// not allowed for the current user. The cart is returned with all prices
-// already calculated.
+// not allowed for the current user. ErrConflict is returned if the cart is in
+// another currency than the given one. The cart is returned with all prices
+// already calculated. The products of the positions are expected to have their
+// prices in the currency of the cart.
 func (c *Cart) UpdateAndGet(ctx context.Context, cart *model.Cart) (*model.Cart, error) {
 	err := c.CartRepository.UpdateCartOfUser(ctx,
 		authentication.AuthenticatedUser(ctx).ID,
 		cart.ID,
+		cart.Currency,
 		convertCartPositions(cart.Positions),
 	)
 	switch {
+	case errors.Is(err, persistence.ErrConflict):
+		return nil, ErrConflict
 	case errors.Is(err, persistence.ErrNotFound):
 		return nil, ErrNotFound
 	case errors.Is(err, persistence.ErrDeleted):
@@ -110,7 +171,13 @@ func (c *Cart) UpdateAndGet(ctx context.Context, cart *model.Cart) (*model.Cart,
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
-		cart.Positions = generateOrderPositions(cart.Positions, nil)
+		logging.FromContext(ctx).Debug("cart stored", "cartId", cart.ID)
+		cartsStored.Inc()
+		promotions, err := findAllPromotions(ctx, c.PromotionRepository)
+		if err != nil {
+			return nil, err
+		}
+		cart.Positions = generateOrderPositions(cart.Positions, nil, promotions)
 		return cart, nil
 	default:
 		panic(err)
@@ -146,15 +213,14 @@ func (c *Cart) Delete(ctx context.Context, cartID string) error {
 
 func (c *Cart) loadProducts(ctx context.Context, cart *model.Cart) error {
 	for i, position := range cart.Positions {
-		if product := getSpecialProduct(position.ProductID); product != nil {
-			cart.Positions[i].Product = product
-			continue
-		}
-		product, err := c.ProductRepository.FindProduct(ctx, position.ProductID)
+		product, err := findProduct(ctx, c.ProductRepository, c.PromotionRepository, position.ProductID, cart.Currency)
 		switch {
-		case errors.Is(err, persistence.ErrNotFound):
+		case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrDeleted):
 			cart.Positions[i].ProductID = ""
 			cart.Positions[i].Product = &model.Product{Name: "Product not available anymore."}
+		case errors.Is(err, ErrNoPrice):
+			cart.Positions[i].ProductID = ""
+			cart.Positions[i].Product = &model.Product{Name: "Product not available in " + string(cart.Currency) + "."}
 		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 			return err
 		case err == nil:
@@ -1,6 +1,9 @@
 package controller
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // controller errors
 var (
@@ -9,4 +12,44 @@ var (
 	ErrForbidden = errors.New("forbidden")
 	ErrDeleted   = errors.New("deleted")
 	ErrLocked    = errors.New("locked")
+
+	ErrInvalidTransition   = errors.New("invalid transition")
+	ErrPaymentDeclined     = errors.New("payment declined")
+	ErrPaymentFailed       = errors.New("payment failed")
+	ErrOutOfStock          = errors.New("out of stock")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrCouponNotApplicable = errors.New("coupon not applicable")
+	ErrNoPrice             = errors.New("no price in currency")
+	ErrNoShipping          = errors.New("shipping method not available")
 )
+
+// CouponError is returned if a coupon cannot be used for an order. It wraps
+// ErrCouponNotApplicable.
+type CouponError struct {
+	Code   string // of the coupon
+	Reason string // like "requires a subtotal of at least 20.00"
+}
+
+func (e *CouponError) Error() string {
+	return fmt.Sprintf("coupon %q %s", e.Code, e.Reason)
+}
+
+// Unwrap returns ErrCouponNotApplicable.
+func (e *CouponError) Unwrap() error {
+	return ErrCouponNotApplicable
+}
+
+// BundleItemError is returned if an item of a bundle is not an available
+// product. It wraps ErrNotFound.
+type BundleItemError struct {
+	ProductID string
+}
+
+func (e *BundleItemError) Error() string {
+	return fmt.Sprintf("bundle item %q is not an available product", e.ProductID)
+}
+
+// Unwrap returns ErrNotFound.
+func (e *BundleItemError) Unwrap() error {
+	return ErrNotFound
+}
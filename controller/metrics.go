@@ -0,0 +1,13 @@
+package controller
+
+import "github.com/Teelevision/excommerce/metrics"
+
+// business metrics
+var (
+	cartsStored       = metrics.NewCounter("excommerce_carts_stored_total", "Number of carts that were created or updated.")
+	ordersPrepared    = metrics.NewCounter("excommerce_orders_prepared_total", "Number of orders that were prepared.")
+	ordersPlaced      = metrics.NewCounter("excommerce_orders_placed_total", "Number of orders that were placed.")
+	ordersInvalidated = metrics.NewCounter("excommerce_orders_invalidated_total", "Number of orders that were deleted on placing, because their positions changed.")
+	couponsRedeemed   = metrics.NewCounter("excommerce_coupons_redeemed_total", "Number of coupons that were redeemed by placed orders.")
+	revenue           = metrics.NewCounterVec("excommerce_revenue_cents_total", "Sum of the prices of placed orders in cents by currency.", "currency")
+)
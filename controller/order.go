@@ -7,10 +7,16 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/Teelevision/excommerce/authentication"
+	"github.com/Teelevision/excommerce/logging"
 	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/payment"
 	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/promotion"
+	"github.com/Teelevision/excommerce/shipping"
+	"github.com/Teelevision/excommerce/tax"
 	"github.com/google/uuid"
 )
 
@@ -20,10 +26,23 @@ type Order struct {
 	CartRepository        persistence.CartRepository
 	ProductRepository     persistence.ProductRepository
 	CouponRepository      persistence.CouponRepository
+	PromotionRepository   persistence.PromotionRepository
 	PlacedOrderRepository persistence.PlacedOrderRepository
+	StockRepository       persistence.StockRepository
+	PaymentProvider       payment.Provider
+	TaxRates              *tax.Rates       // may be nil, then orders have no taxes
+	ShippingMethods       shipping.Methods // may be empty, then orders are not shipped
 }
 
-// CreateAndGet creates the given order. The order is returned with a unique id.
+// CreateAndGet creates the given order. The products of the cart are expected
+// to have their prices in the currency of the order. The order is returned with
+// a unique id. ErrOutOfStock is returned if not enough items of a product are
+// available. A *CouponError is returned if one of the coupons cannot be used,
+// because the cart does not reach its minimum subtotal, its redemptions are used
+// up or it cannot be used in the currency. The order is shipped with its chosen
+// shipping method, or the cheapest one if none is chosen. ErrNoShipping is
+// returned if the chosen method is not available for the order, or if none is
+// chosen and no method is available.
 func (c *Order) CreateAndGet(ctx context.Context, order *model.Order) (*model.Order, error) {
 	// create id
 	uuid, err := uuid.NewRandom()
@@ -32,11 +51,48 @@ func (c *Order) CreateAndGet(ctx context.Context, order *model.Order) (*model.Or
 	}
 	id := uuid.String()
 
+	// load promotions
+	promotions, err := findAllPromotions(ctx, c.PromotionRepository)
+	if err != nil {
+		return nil, err
+	}
+
 	// prepare positions
-	positions := generateOrderPositions(order.Cart.Positions, order.Coupons)
+	positions, shippingMethods, err := c.generatePositions(order, promotions)
+	if err != nil {
+		return nil, err
+	}
+
+	// check coupons
+	if err := checkCouponCurrency(order.Coupons, order.Currency); err != nil {
+		return nil, err
+	}
+	if err := checkCouponSubtotals(order.Coupons, order.Cart.Positions); err != nil {
+		return nil, err
+	}
+	if err := c.checkCouponLimits(ctx, order.Coupons); err != nil {
+		return nil, err
+	}
+
+	// check stock
+	for productID, quantity := range stockQuantities(positions, promotions) {
+		stock, err := c.StockRepository.FindStock(ctx, productID)
+		switch {
+		case errors.Is(err, persistence.ErrNotFound):
+			// not tracked
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return nil, err
+		case err == nil:
+			if stock.Available() < quantity {
+				return nil, ErrOutOfStock
+			}
+		default:
+			panic(err)
+		}
+	}
 
 	// hash
-	hash := hashPositions(positions)
+	hash := hashPositions(order.Currency, positions)
 
 	// coupon codes
 	couponCodes := make([]string, len(order.Coupons))
@@ -53,6 +109,9 @@ func (c *Order) CreateAndGet(ctx context.Context, order *model.Order) (*model.Or
 			Buyer:     persistence.OrderAddress(order.Buyer),
 			Recipient: persistence.OrderAddress(order.Recipient),
 			Coupons:   couponCodes,
+			Currency:  order.Currency,
+
+			ShippingMethodID: order.ShippingMethodID,
 		},
 	)
 	switch {
@@ -61,8 +120,11 @@ func (c *Order) CreateAndGet(ctx context.Context, order *model.Order) (*model.Or
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
+		logging.FromContext(ctx).Info("order prepared", "orderId", id, "cartId", order.CartID, "currency", order.Currency)
+		ordersPrepared.Inc()
 		return &model.Order{
 			ID:        id,
+			Status:    model.OrderStatusValid,
 			Hash:      hash,
 			Buyer:     order.Buyer,
 			Recipient: order.Recipient,
@@ -70,18 +132,31 @@ func (c *Order) CreateAndGet(ctx context.Context, order *model.Order) (*model.Or
 			CartID:    order.CartID,
 			Coupons:   order.Coupons,
 			Positions: positions,
+			Currency:  order.Currency,
 			Price:     calculatePositionSum(positions),
+
+			ShippingMethodID: order.ShippingMethodID,
+			ShippingMethods:  shippingMethods,
 		}, nil
 	default:
 		panic(err)
 	}
 }
 
-// Place places the order with the given id. ErrNotFound is returned if the
+// Place places the order with the given id. The price of the order is
+// authorized with the given payment source. ErrNotFound is returned if the
 // order does not exist. ErrDeleted is returned if the order used to exist, but
 // is deleted. ErrForbidden is returned if the order exists, but is not owned by
 // the current user. ErrLocked is returned if the order is already placed.
-func (c *Order) Place(ctx context.Context, orderID string) (*model.Order, error) {
+// ErrPaymentDeclined is returned if the payment was declined, and
+// ErrPaymentFailed if the payment provider failed otherwise. In both cases the
+// order and cart are unlocked again, so that placing can be retried. The items
+// of the order are taken out of stock when it is placed. If not enough items
+// are available, the order is deleted and ErrDeleted is returned.
+func (c *Order) Place(ctx context.Context, orderID, paymentSource string) (*model.Order, error) {
+	userID := authentication.AuthenticatedUser(ctx).ID
+	logger := logging.FromContext(ctx).With("orderId", orderID)
+
 	// First call checks and locks the order and cart. This ensures that the
 	// order did not change and the cart cannot be updated anymore.
 	_, err := c.preparePlace(ctx, orderID, false)
@@ -94,7 +169,36 @@ func (c *Order) Place(ctx context.Context, orderID string) (*model.Order, error)
 	// the order, like a product became unavailable.
 	order, err := c.preparePlace(ctx, orderID, true)
 	if err != nil {
+		// The order stays locked, see preparePlace, but the stock and coupons
+		// are released.
+		c.releaseStock(orderID)
+		c.releaseCouponRedemptions(orderID)
+		return nil, err
+	}
+
+	// Authorize the payment. From here on any failure must undo the locking
+	// and the authorization, so that the user is not stuck with a locked cart.
+	authorizationID, err := c.PaymentProvider.Authorize(ctx, payment.Payment{
+		OrderID:  order.ID,
+		Amount:   order.Price,
+		Currency: string(order.Currency),
+		Source:   paymentSource,
+	})
+	switch {
+	case errors.Is(err, payment.ErrDeclined):
+		logger.Info("payment declined", "price", order.Price, "currency", order.Currency)
+		c.rollbackPlace(userID, order, "")
+		return nil, ErrPaymentDeclined
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		logger.Info("placing order cancelled", "error", err)
+		c.rollbackPlace(userID, order, "")
 		return nil, err
+	case err == nil:
+		// authorized
+	default:
+		logger.Error("payment authorization failed", "error", err)
+		c.rollbackPlace(userID, order, "")
+		return nil, fmt.Errorf("%w: %s", ErrPaymentFailed, err)
 	}
 
 	// Place order. Just locking it is not enough, because there is the edge
@@ -102,60 +206,377 @@ func (c *Order) Place(ctx context.Context, orderID string) (*model.Order, error)
 	// which is why we have the second call above. Placing the order also saves
 	// a the current state of the cart and products, which we all got from the
 	// second call.
+	order.PlacedAt = time.Now()
+	order.Status = model.OrderStatusPlaced
+	order.StatusHistory = []model.OrderStatusChange{
+		{Status: model.OrderStatusPlaced, ChangedAt: order.PlacedAt},
+	}
 	placedOrder := persistence.PlacedOrder{
-		UserID:    authentication.AuthenticatedUser(ctx).ID,
+		ID:        order.ID,
+		UserID:    userID,
+		PlacedAt:  order.PlacedAt,
 		Buyer:     persistence.OrderAddress(order.Buyer),
 		Recipient: persistence.OrderAddress(order.Recipient),
 		Coupons:   make(map[string]persistence.OrderCoupon, len(order.Coupons)),
 		Products:  make(map[string]persistence.OrderProduct),
+		Currency:  order.Currency,
 		Price:     order.Price,
-		Positions: make([]persistence.OrderPosition, len(order.Positions)),
+		Positions: make([]persistence.OrderPosition, 0, len(order.Positions)),
+		Taxes:     make([]persistence.OrderTax, 0),
+
+		StatusHistory: order.StatusHistory,
+
+		PaymentAuthorization: authorizationID,
 	}
 	for _, coupon := range order.Coupons {
 		placedOrder.Coupons[coupon.Code] = persistence.OrderCoupon{
 			ProductID: coupon.ProductID,
 			Name:      coupon.Name,
 			Discount:  coupon.Discount,
+			Amount:    coupon.Amount,
 		}
 	}
-	for i, position := range order.Positions {
-		placedOrder.Positions[i] = persistence.OrderPosition{
+	for _, position := range order.Positions {
+		if position.Tax != nil {
+			// taxes are kept apart for invoicing
+			placedOrder.Taxes = append(placedOrder.Taxes, persistence.OrderTax(*position.Tax))
+			continue
+		}
+		placedPosition := persistence.OrderPosition{
 			ProductID:  position.ProductID,
 			CouponCode: position.CouponCode,
 			Quantity:   position.Quantity,
 			Price:      position.Price,
 		}
+		switch {
+		case position.Shipping != nil:
+			placedPosition.ShippingMethodID = position.Shipping.ID
+			placedPosition.Name = position.Shipping.Name
+		case position.ProductID == "" && position.CouponCode == "" && position.Product != nil:
+			placedPosition.Name = position.Product.Name
+		}
+		placedOrder.Positions = append(placedOrder.Positions, placedPosition)
 		if position.ProductID != "" {
 			placedOrder.Products[position.ProductID] = persistence.OrderProduct{
-				Name:  position.Product.Name,
-				Price: position.Product.Price,
+				Name:     position.Product.Name,
+				Price:    position.Product.Price,
+				TaxClass: position.Product.TaxClass,
 			}
 		}
 	}
 	err = c.PlacedOrderRepository.PlaceOrder(ctx, placedOrder)
 	switch {
+	case errors.Is(err, persistence.ErrConflict):
+		panic(err) // we locked the order, so nobody else could place it
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		logger.Info("placing order cancelled", "error", err)
+		c.rollbackPlace(userID, order, authorizationID)
 		return nil, err
 	case err == nil:
-		return order, nil
+		// placed
+	default:
+		c.rollbackPlace(userID, order, authorizationID)
+		panic(err)
+	}
+
+	// Take the reserved items out of stock. The order is placed already, so
+	// this must happen even if the request was cancelled.
+	if err := c.StockRepository.CommitStock(context.Background(), order.ID); err != nil {
+		panic(err)
+	}
+
+	logger.Info("order placed", "price", order.Price, "currency", order.Currency, "coupons", len(order.Coupons))
+	ordersPlaced.Inc()
+	couponsRedeemed.Add(float64(len(appliedCouponCodes(order.Positions))))
+	revenue.With(string(order.Currency)).Add(float64(order.Price))
+	return order, nil
+}
+
+// Undoes placing the order after it and its cart were locked. The payment
+// authorization is voided unless it is empty, and the stock reservation and
+// coupon redemptions are released. A background context is used, because the rollback must happen
+// even if the request was cancelled.
+func (c *Order) rollbackPlace(userID string, order *model.Order, authorizationID string) {
+	ctx := context.Background()
+	if authorizationID != "" {
+		if err := c.PaymentProvider.Void(ctx, authorizationID); err != nil {
+			panic(err)
+		}
+	}
+	c.releaseStock(order.ID)
+	c.releaseCouponRedemptions(order.ID)
+	c.unlock(userID, order)
+}
+
+// Unlocks the cart and the order. A background context is used, because it
+// must happen even if the request was cancelled.
+func (c *Order) unlock(userID string, order *model.Order) {
+	ctx := context.Background()
+	// Unlock the cart first. Otherwise placing the unlocked order again could
+	// find the cart still locked and delete the order.
+	if err := c.CartRepository.UnlockCartOfUser(ctx, userID, order.CartID); err != nil {
+		panic(err)
+	}
+	if err := c.OrderRepository.UnlockOrderOfUser(ctx, userID, order.ID); err != nil {
+		panic(err)
+	}
+}
+
+// GetAllPlaced returns all placed orders of the current user.
+func (c *Order) GetAllPlaced(ctx context.Context) ([]*model.Order, error) {
+	userID := authentication.AuthenticatedUser(ctx).ID
+	placedOrders, err := c.PlacedOrderRepository.FindAllPlacedOrdersOfUser(ctx, userID)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		orders := make([]*model.Order, len(placedOrders))
+		for i, placedOrder := range placedOrders {
+			orders[i] = convertPlacedOrder(placedOrder)
+		}
+		return orders, nil
+	default:
+		panic(err)
+	}
+}
+
+// GetPlaced returns the placed order with the given id. ErrNotFound is returned
+// if there is no placed order with the id. ErrForbidden is returned if the
+// placed order exists, but is not owned by the current user.
+func (c *Order) GetPlaced(ctx context.Context, orderID string) (*model.Order, error) {
+	userID := authentication.AuthenticatedUser(ctx).ID
+	placedOrder, err := c.PlacedOrderRepository.FindPlacedOrderOfUser(ctx, userID, orderID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, persistence.ErrNotOwnedByUser):
+		return nil, ErrForbidden
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return convertPlacedOrder(placedOrder), nil
+	default:
+		panic(err)
+	}
+}
+
+// orderStatusTransitions maps each status of a placed order to the statuses it
+// may change to. Cancelled and refunded orders cannot change anymore.
+var orderStatusTransitions = map[model.OrderStatus][]model.OrderStatus{
+	model.OrderStatusPlaced:    {model.OrderStatusPaid, model.OrderStatusCancelled},
+	model.OrderStatusPaid:      {model.OrderStatusPacked, model.OrderStatusRefunded},
+	model.OrderStatusPacked:    {model.OrderStatusShipped, model.OrderStatusRefunded},
+	model.OrderStatusShipped:   {model.OrderStatusDelivered, model.OrderStatusRefunded},
+	model.OrderStatusDelivered: {model.OrderStatusRefunded},
+}
+
+// ChangeStatus changes the status of the placed order with the given id
+// regardless of the user. Only the transitions of the order lifecycle are
+// allowed: placed, paid, packed, shipped, delivered. Placed orders can be
+// cancelled, and paid orders can be refunded. On success the placed order with
+// the new status is returned. The payment of the order is captured when it
+// becomes paid, voided when it is cancelled and refunded when it is refunded.
+// This happens after the status was changed, and the status is changed back if
+// it fails.
+// ErrNotFound is returned if there is no placed order with the id.
+// ErrInvalidTransition is returned if the order cannot change from its current
+// status to the given one. ErrConflict is returned if the status was changed
+// concurrently, or if the payment provider does not know the authorization of
+// the order or it is in another state. ErrPaymentFailed is returned if the
+// payment provider failed otherwise.
+func (c *Order) ChangeStatus(ctx context.Context, orderID string, status model.OrderStatus) (*model.Order, error) {
+	placedOrder, err := c.PlacedOrderRepository.FindPlacedOrder(ctx, orderID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		// found
 	default:
 		panic(err)
 	}
+	order := convertPlacedOrder(placedOrder)
+
+	// check transition
+	allowed := false
+	for _, next := range orderStatusTransitions[order.Status] {
+		allowed = allowed || next == status
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: from %q to %q", ErrInvalidTransition, order.Status, status)
+	}
+
+	// Change the status first, so that only one of concurrent changes gets to
+	// process the payment.
+	change := model.OrderStatusChange{Status: status, ChangedAt: time.Now()}
+	err = c.PlacedOrderRepository.UpdatePlacedOrderStatus(ctx, orderID, order.Status, change)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, persistence.ErrConflict):
+		return nil, ErrConflict
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		// changed
+	default:
+		panic(err)
+	}
+
+	err = c.processPayment(ctx, placedOrder.PaymentAuthorization, status)
+	if err != nil {
+		c.revertStatus(ctx, orderID, order.Status, status)
+	}
+	switch {
+	case errors.Is(err, payment.ErrInvalidState), errors.Is(err, payment.ErrNotFound):
+		logging.FromContext(ctx).Error("payment does not match the order status",
+			"orderId", orderID, "status", status, "error", err)
+		return nil, fmt.Errorf("%w: %s", ErrConflict, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		order.Status = status
+		order.StatusHistory = append(order.StatusHistory, change)
+		return order, nil
+	default:
+		logging.FromContext(ctx).Error("payment processing failed",
+			"orderId", orderID, "status", status, "error", err)
+		return nil, fmt.Errorf("%w: %s", ErrPaymentFailed, err)
+	}
+}
+
+// processPayment captures, voids or refunds the payment with the given
+// authorization depending on the new status of the order. Orders without an
+// authorization and other statuses need no processing.
+func (c *Order) processPayment(ctx context.Context, authorization string, status model.OrderStatus) error {
+	if authorization == "" {
+		return nil
+	}
+	switch status {
+	case model.OrderStatusPaid:
+		return c.PaymentProvider.Capture(ctx, authorization)
+	case model.OrderStatusCancelled:
+		return c.PaymentProvider.Void(ctx, authorization)
+	case model.OrderStatusRefunded:
+		return c.PaymentProvider.Refund(ctx, authorization)
+	default:
+		return nil
+	}
+}
+
+// revertStatus changes the status of the order back to the previous one after
+// processing the payment failed. The status history keeps both changes. This
+// must happen even if the request was cancelled, because the order must not
+// keep a status that its payment does not have.
+func (c *Order) revertStatus(ctx context.Context, orderID string, previous, status model.OrderStatus) {
+	change := model.OrderStatusChange{Status: previous, ChangedAt: time.Now()}
+	err := c.PlacedOrderRepository.UpdatePlacedOrderStatus(context.Background(), orderID, status, change)
+	if err != nil {
+		// changed concurrently, which only an admin can do
+		logging.FromContext(ctx).Error("order status not reverted after the payment failed",
+			"orderId", orderID, "status", status, "error", err)
+	}
+}
+
+// converts the placed order into an order with products and coupons as they
+// were at the time of placing
+func convertPlacedOrder(placedOrder *persistence.PlacedOrder) *model.Order {
+	order := model.Order{
+		ID:        placedOrder.ID,
+		Buyer:     model.Address(placedOrder.Buyer),
+		Recipient: model.Address(placedOrder.Recipient),
+		Coupons:   make([]*model.Coupon, 0, len(placedOrder.Coupons)),
+		Currency:  placedOrder.Currency,
+		Price:     placedOrder.Price,
+		Positions: make([]model.Position, len(placedOrder.Positions), len(placedOrder.Positions)+len(placedOrder.Taxes)),
+		Locked:    true,
+		PlacedAt:  placedOrder.PlacedAt,
+
+		Status:        model.OrderStatusPlaced,
+		StatusHistory: placedOrder.StatusHistory,
+	}
+	if n := len(order.StatusHistory); n > 0 {
+		order.Status = order.StatusHistory[n-1].Status
+	}
+	if order.Currency == "" {
+		// placed before orders had a currency
+		order.Currency = model.DefaultCurrency
+	}
+	coupons := make(map[string]*model.Coupon, len(placedOrder.Coupons))
+	for code, placedCoupon := range placedOrder.Coupons {
+		coupon := &model.Coupon{
+			Code:      code,
+			Name:      placedCoupon.Name,
+			ProductID: placedCoupon.ProductID,
+			Discount:  placedCoupon.Discount,
+			Amount:    placedCoupon.Amount,
+		}
+		coupons[code] = coupon
+		order.Coupons = append(order.Coupons, coupon)
+	}
+	sort.Slice(order.Coupons, func(i, j int) bool { return order.Coupons[i].Code < order.Coupons[j].Code })
+	for i, placedPosition := range placedOrder.Positions {
+		position := model.Position{
+			Quantity:   placedPosition.Quantity,
+			Price:      placedPosition.Price,
+			ProductID:  placedPosition.ProductID,
+			CouponCode: placedPosition.CouponCode,
+		}
+		switch {
+		case placedPosition.ProductID != "":
+			product := placedOrder.Products[placedPosition.ProductID]
+			position.Product = &model.Product{
+				ID:       placedPosition.ProductID,
+				Name:     product.Name,
+				Price:    product.Price,
+				TaxClass: product.TaxClass,
+			}
+		case placedPosition.CouponCode != "":
+			position.Coupon = coupons[placedPosition.CouponCode]
+			position.SavedPrice = -placedPosition.Price
+		case placedPosition.ShippingMethodID != "":
+			position.Shipping = &model.ShippingMethod{
+				ID:    placedPosition.ShippingMethodID,
+				Name:  placedPosition.Name,
+				Price: placedPosition.Price,
+			}
+			order.ShippingMethodID = placedPosition.ShippingMethodID
+		default:
+			position.Product = &model.Product{ // no id
+				Name:       placedPosition.Name,
+				Price:      placedPosition.Price,
+				SavedPrice: -placedPosition.Price,
+			}
+			position.SavedPrice = -placedPosition.Price
+		}
+		order.Positions[i] = position
+	}
+	for _, placedTax := range placedOrder.Taxes {
+		positionTax := model.Tax(placedTax)
+		position := model.Position{Quantity: 1, Tax: &positionTax}
+		if !positionTax.Included {
+			position.Price = positionTax.Amount
+		}
+		order.Positions = append(order.Positions, position)
+	}
+	return &order
 }
 
 // Must be called twice. First time it expects the order and cart to be
-// unlocked. It locks and returns both, including products. Second time it
-// expects the order and cart to be locked. Both times it checks that the order
-// did not change in any way, like containing a product that changed its price.
-// Both calls together ensure that the resources were locked and that we were
-// the caller that locked them. Worst case we do not place the order but lock it
-// and the cart. Not placing the order is correct, because something changed.
-// Locking the cart just means that the client has to store it under a new id.
-// But this is an edge case. Notice that in that case we would return ErrLocked
-// instead of ErrDeleted, because we cannot delete the order that we just
-// locked.
+// unlocked. It locks and returns both, including products, and reserves the
+// stock and redeems the coupons of the order. Second time it expects the order and cart to be locked.
+// Both times it checks that the order did not change in any way, like
+// containing a product that changed its price. Both calls together ensure that
+// the resources were locked and that we were the caller that locked them. Worst
+// case we do not place the order but lock it and the cart. Not placing the
+// order is correct, because something changed. Locking the cart just means that
+// the client has to store it under a new id. But this is an edge case. Notice
+// that in that case we would return ErrLocked instead of ErrDeleted, because we
+// cannot delete the order that we just locked.
 func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked bool) (*model.Order, error) {
 	userID := authentication.AuthenticatedUser(ctx).ID
+	logger := logging.FromContext(ctx).With("orderId", orderID)
 
 	// load order
 	order, err := c.OrderRepository.FindOrderOfUser(ctx, userID, orderID)
@@ -172,13 +593,19 @@ func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked b
 		if !expectLocked && order.Locked {
 			return nil, ErrLocked
 		}
+		if order.Currency == "" {
+			// prepared before orders had a currency
+			order.Currency = model.DefaultCurrency
+		}
 	default:
 		panic(err)
 	}
 
 	// if the cart changed somehow, we delete the outdated order
-	deleteOrder := func() error {
+	deleteOrder := func(reason string) error {
+		logger.Info("invalidating order", "reason", reason)
 		if err := c.Delete(ctx, orderID); err != nil {
+			logger.Warn("could not delete invalidated order", "error", err)
 			return err
 		}
 		return ErrDeleted
@@ -188,16 +615,16 @@ func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked b
 	order.Cart, err = c.CartRepository.FindCartOfUser(ctx, userID, order.CartID)
 	switch {
 	case errors.Is(err, persistence.ErrNotFound):
-		return nil, deleteOrder()
+		return nil, deleteOrder("cart not found")
 	case errors.Is(err, persistence.ErrDeleted):
-		return nil, deleteOrder()
+		return nil, deleteOrder("cart deleted")
 	case errors.Is(err, persistence.ErrNotOwnedByUser):
-		return nil, deleteOrder()
+		return nil, deleteOrder("cart not owned by user")
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
 		if !expectLocked && order.Cart.Locked {
-			return nil, deleteOrder()
+			return nil, deleteOrder("cart locked")
 		}
 	default:
 		panic(err)
@@ -205,14 +632,12 @@ func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked b
 
 	// load products
 	for i, position := range order.Cart.Positions {
-		if product := getSpecialProduct(position.ProductID); product != nil {
-			order.Cart.Positions[i].Product = product
-			continue
-		}
-		product, err := c.ProductRepository.FindProduct(ctx, position.ProductID)
+		product, err := findProduct(ctx, c.ProductRepository, c.PromotionRepository, position.ProductID, order.Currency)
 		switch {
-		case errors.Is(err, persistence.ErrNotFound):
-			return nil, deleteOrder()
+		case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrDeleted):
+			return nil, deleteOrder("product " + position.ProductID + " unavailable")
+		case errors.Is(err, ErrNoPrice):
+			return nil, deleteOrder("product " + position.ProductID + " has no price in " + string(order.Currency))
 		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 			return nil, err
 		case err == nil:
@@ -227,7 +652,7 @@ func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked b
 		coupon, err := c.CouponRepository.FindValidCoupon(ctx, coupon.Code)
 		switch {
 		case errors.Is(err, persistence.ErrNotFound):
-			return nil, deleteOrder()
+			return nil, deleteOrder("coupon invalid")
 		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 			return nil, err
 		case err == nil:
@@ -237,17 +662,38 @@ func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked b
 		}
 	}
 
+	// load promotions
+	promotions, err := findAllPromotions(ctx, c.PromotionRepository)
+	if err != nil {
+		return nil, err
+	}
+
 	// prepare positions
-	positions := generateOrderPositions(order.Cart.Positions, order.Coupons)
+	positions, _, err := c.generatePositions(order, promotions)
+	if err != nil {
+		return nil, deleteOrder("shipping method not available")
+	}
+
+	// check coupons, their limits are enforced when redeeming them below
+	if err := checkCouponCurrency(order.Coupons, order.Currency); err != nil {
+		return nil, deleteOrder("coupon not usable in currency")
+	}
+	if err := checkCouponSubtotals(order.Coupons, order.Cart.Positions); err != nil {
+		return nil, deleteOrder("coupon subtotal not reached")
+	}
 
 	// hash
-	hash := hashPositions(positions)
+	hash := hashPositions(order.Currency, positions)
 	if !bytes.Equal(hash, order.Hash) {
 		// The hash changed. This means that the cart changed, maybe indirectly,
 		// like a product that changed its price.
-		return nil, deleteOrder()
+		ordersInvalidated.Inc()
+		return nil, deleteOrder("positions changed")
 	}
 
+	order.Positions = positions
+	order.Price = calculatePositionSum(positions)
+
 	// second call ends here
 	if expectLocked {
 		return order, nil
@@ -259,13 +705,13 @@ func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked b
 	err = c.CartRepository.LockCartOfUser(ctx, userID, order.CartID)
 	switch {
 	case errors.Is(err, persistence.ErrNotFound):
-		return nil, deleteOrder()
+		return nil, deleteOrder("cart not found")
 	case errors.Is(err, persistence.ErrDeleted):
-		return nil, deleteOrder()
+		return nil, deleteOrder("cart deleted")
 	case errors.Is(err, persistence.ErrNotOwnedByUser):
-		return nil, deleteOrder()
+		return nil, deleteOrder("cart not owned by user")
 	case errors.Is(err, persistence.ErrLocked):
-		return nil, deleteOrder()
+		return nil, deleteOrder("cart locked")
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
@@ -293,6 +739,48 @@ func (c *Order) preparePlace(ctx context.Context, orderID string, expectLocked b
 		panic(err)
 	}
 
+	// Reserve stock after locking, so that only one caller can reserve for
+	// the order. An order that cannot be fulfilled is deleted like any other
+	// outdated order, which requires unlocking it first.
+	err = c.StockRepository.ReserveStock(ctx, orderID, stockQuantities(positions, promotions))
+	switch {
+	case errors.Is(err, persistence.ErrInsufficientStock):
+		c.unlock(userID, order)
+		return nil, deleteOrder("insufficient stock")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		c.unlock(userID, order)
+		return nil, err
+	case err == nil:
+		// reserved
+	default:
+		c.unlock(userID, order)
+		panic(err)
+	}
+
+	// Redeem the applied coupons after locking for the same reason. The
+	// redemption fails if a limit of a coupon was reached in the meantime.
+	err = c.CouponRepository.RedeemCoupons(ctx, orderID, userID, appliedCouponCodes(positions))
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		c.releaseStock(orderID)
+		c.unlock(userID, order)
+		return nil, deleteOrder("coupon invalid")
+	case errors.Is(err, persistence.ErrLimitReached):
+		c.releaseStock(orderID)
+		c.unlock(userID, order)
+		return nil, deleteOrder("coupon limit reached")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		c.releaseStock(orderID)
+		c.unlock(userID, order)
+		return nil, err
+	case err == nil:
+		// redeemed
+	default:
+		c.releaseStock(orderID)
+		c.unlock(userID, order)
+		panic(err)
+	}
+
 	return order, nil
 }
 
@@ -322,7 +810,13 @@ func (c *Order) Delete(ctx context.Context, orderID string) error {
 	}
 }
 
-func generateOrderPositions(positions []model.Position, coupons []*model.Coupon) []model.Position {
+// Generates the positions of an order. The coupons are expected to reach their
+// minimum subtotals, see checkCouponSubtotals. Coupons stack as follows: Each
+// product gets at most one coupon, the one that saves the most on it. Then the
+// promotions apply. At last at most one cart-wide coupon applies to the total
+// so far, again the one that saves the most. Coupons that save nothing are
+// skipped, and no coupon saves more than the price it applies to.
+func generateOrderPositions(positions []model.Position, coupons []*model.Coupon, promotions []*model.Promotion) []model.Position {
 	positions = consolidatePositions(positions)
 	positions = calculatePositionPrices(positions)
 
@@ -335,112 +829,228 @@ func generateOrderPositions(positions []model.Position, coupons []*model.Coupon)
 		i--
 	}
 
-	// get best coupons
-	productCoupons := make(map[string]*model.Coupon, len(coupons))
+	// sort coupons
+	productCoupons := make(map[string][]*model.Coupon, len(coupons))
+	var cartCoupons []*model.Coupon
 	for _, coupon := range coupons {
-		existingCoupon, ok := productCoupons[coupon.ProductID]
-		if !ok || coupon.Discount > existingCoupon.Discount {
-			productCoupons[coupon.ProductID] = coupon
+		if coupon.CartWide() {
+			cartCoupons = append(cartCoupons, coupon)
+		} else {
+			productCoupons[coupon.ProductID] = append(productCoupons[coupon.ProductID], coupon)
 		}
 	}
+
+	// best coupons of products
 	for i := 0; i < len(positions); i++ {
-		coupon, ok := productCoupons[positions[i].ProductID]
-		if !ok {
+		coupon, saving := bestCoupon(productCoupons[positions[i].ProductID], positions[i].Price)
+		if coupon == nil {
 			continue
 		}
-		// add position for coupon
-		price := -coupon.Discount * positions[i].Price / 100
-		couponPosition := model.Position{
-			Quantity:   1,
-			Price:      price,
-			Coupon:     coupon,
-			CouponCode: coupon.Code,
-			SavedPrice: -price,
-		}
 		positions = append(positions[:i+1],
-			append([]model.Position{couponPosition}, positions[i+1:]...)...)
+			append([]model.Position{couponPosition(coupon, saving)}, positions[i+1:]...)...)
 		i++
 	}
 
 	// non-coupon discounts
+	positions = promotion.Apply(positions, promotions)
 
-	// If >=7 apples, 10% discount on all apples.
-	for i, position := range positions {
-		if position.ProductID != "a6da78f8-2be6-49ff-b40a-32aa86a6a986" {
-			continue
+	// best coupon of the cart
+	if coupon, saving := bestCoupon(cartCoupons, calculatePositionSum(positions)); coupon != nil {
+		positions = append(positions, couponPosition(coupon, saving))
+	}
+
+	return positions
+}
+
+// Generates the positions of the order, see generateOrderPositions, and appends
+// a shipping position and the taxes in the country of the recipient as tax
+// positions. The shipping is priced on the discounted positions, so that
+// coupons count towards free shipping. The shipping methods available for the
+// order are returned, too. If the order has no chosen method, the cheapest one
+// is chosen and set on the order. ErrNoShipping is returned if the chosen
+// method is not available, or if none is available while there are shipping
+// methods at all.
+func (c *Order) generatePositions(order *model.Order, promotions []*model.Promotion) (
+	[]model.Position, []model.ShippingMethod, error) {
+	positions := generateOrderPositions(order.Cart.Positions, order.Coupons, promotions)
+
+	// shipping
+	available := c.ShippingMethods.Quote(positions, order.Currency, order.Recipient.Country)
+	if len(c.ShippingMethods) > 0 {
+		if order.ShippingMethodID == "" {
+			if len(available) == 0 {
+				return nil, nil, ErrNoShipping
+			}
+			order.ShippingMethodID = available[0].ID // cheapest
 		}
-		if position.Quantity < 7 {
-			continue
+		var chosen *model.ShippingMethod
+		for i := range available {
+			if available[i].ID == order.ShippingMethodID {
+				chosen = &available[i]
+			}
 		}
-		// insert positions for discount
-		price := -10 * position.Price / 100
-		discountPosition := model.Position{
-			Quantity:   1,
-			Price:      price,
-			SavedPrice: -price,
-			Product: &model.Product{ // no id
-				Name:       "10% off apples",
-				Price:      price,
-				SavedPrice: -price,
-			},
+		if chosen == nil {
+			return nil, nil, fmt.Errorf("%w: %q", ErrNoShipping, order.ShippingMethodID)
 		}
-		positions = append(positions[:i+1],
-			append([]model.Position{discountPosition}, positions[i+1:]...)...)
-		break
+		positions = append(positions, model.Position{Quantity: 1, Price: chosen.Price, Shipping: chosen})
 	}
 
-	// Sets of 4 pears and 2 bananas get a 30% discount.
-	pearPosition, bananaPosition, setPosition := -1, -1, -1
-	for i, position := range positions {
-		switch position.ProductID {
-		case "5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": // pear
-			pearPosition = i
-		case "b16088e1-9603-4676-a8df-130823cf15a5": // banana
-			bananaPosition = i
-		case "0de17a66-ea59-4032-9383-2603c6c77d25": // set
-			setPosition = i
-		}
-	}
-	var numSets int
-	if pearPosition >= 0 && bananaPosition >= 0 {
-		numSets = positions[pearPosition].Quantity / 4
-		if n := positions[bananaPosition].Quantity / 2; n < numSets {
-			numSets = n
-		}
-	}
-	if numSets > 0 {
-		// reduce pears and bananas
-		positions[pearPosition].Quantity -= numSets * 4
-		positions[pearPosition].Price = positions[pearPosition].Quantity * positions[pearPosition].Product.Price
-		if positions[pearPosition].Quantity == 0 {
-			positions = append(positions[:pearPosition], positions[pearPosition+1:]...)
-			if pearPosition < bananaPosition {
-				bananaPosition--
+	// taxes
+	positions = c.TaxRates.Apply(positions, order.Recipient.Country)
+
+	return positions, available, nil
+}
+
+// Returns the coupon that saves the most on the given price and its saving. Ties
+// are broken by code, so that the order of the coupons does not matter. No
+// coupon is returned if none saves anything.
+func bestCoupon(coupons []*model.Coupon, price int) (best *model.Coupon, saving int) {
+	for _, coupon := range coupons {
+		s := coupon.Saving(price)
+		if s > saving || (s == saving && s > 0 && coupon.Code < best.Code) {
+			best, saving = coupon, s
+		}
+	}
+	return best, saving
+}
+
+func couponPosition(coupon *model.Coupon, saving int) model.Position {
+	return model.Position{
+		Quantity:   1,
+		Price:      -saving,
+		Coupon:     coupon,
+		CouponCode: coupon.Code,
+		SavedPrice: saving,
+	}
+}
+
+// Returns the codes of the coupons that the positions apply.
+func appliedCouponCodes(positions []model.Position) []string {
+	var codes []string
+	for _, position := range positions {
+		if position.CouponCode != "" {
+			codes = append(codes, position.CouponCode)
+		}
+	}
+	return codes
+}
+
+// Checks that the products of the cart positions reach the minimum subtotal of
+// each coupon, see couponSubtotal. A *CouponError is returned for the first
+// coupon that does not.
+func checkCouponSubtotals(coupons []*model.Coupon, cartPositions []model.Position) error {
+	subtotal := couponSubtotal(cartPositions)
+	for _, coupon := range coupons {
+		if subtotal < coupon.MinSubtotal {
+			return &CouponError{
+				Code: coupon.Code,
+				Reason: fmt.Sprintf("requires a subtotal of at least %s %s",
+					model.Money{Amount: coupon.MinSubtotal, Currency: model.DefaultCurrency}, model.DefaultCurrency),
 			}
 		}
-		positions[bananaPosition].Quantity -= numSets * 2
-		positions[bananaPosition].Price = positions[bananaPosition].Quantity * positions[bananaPosition].Product.Price
-		if positions[bananaPosition].Quantity == 0 {
-			positions = append(positions[:bananaPosition], positions[bananaPosition+1:]...)
-		}
-		// update set quantity or add position for sets
-		set := getSpecialProduct("0de17a66-ea59-4032-9383-2603c6c77d25")
-		if setPosition >= 0 {
-			positions[setPosition].Quantity += numSets
-			positions[setPosition].Price += numSets * set.Price
-			positions[setPosition].SavedPrice += numSets * set.SavedPrice
-		} else {
-			positions = append(positions, model.Position{
-				Quantity:   numSets,
-				Price:      numSets * set.Price,
-				SavedPrice: numSets * set.SavedPrice,
-				ProductID:  "0de17a66-ea59-4032-9383-2603c6c77d25",
-				Product:    set,
-			})
+	}
+	return nil
+}
+
+// Returns the sum of the products of the cart positions before any discounts,
+// which the minimum subtotals of coupons refer to. Bundles count with the
+// prices of their items, so that the sum is the same whether the promotions
+// were applied to the positions or not.
+func couponSubtotal(cartPositions []model.Position) int {
+	subtotal := 0
+	for _, position := range calculatePositionPrices(cartPositions) {
+		if position.ProductID != "" {
+			subtotal += position.Price + position.SavedPrice
 		}
 	}
+	return subtotal
+}
 
-	return positions
+// Checks that the coupons can be used in the currency. Fixed amounts and
+// minimum subtotals of coupons are in the default currency, so such coupons
+// cannot be used in any other. A *CouponError is returned for the first coupon
+// that cannot.
+func checkCouponCurrency(coupons []*model.Coupon, currency model.Currency) error {
+	if currency == model.DefaultCurrency {
+		return nil
+	}
+	for _, coupon := range coupons {
+		if coupon.Amount > 0 || coupon.MinSubtotal > 0 {
+			return &CouponError{
+				Code:   coupon.Code,
+				Reason: "can only be used for orders in " + string(model.DefaultCurrency),
+			}
+		}
+	}
+	return nil
+}
+
+// Checks that the coupons were not redeemed as often as they may be, in total
+// and by the current user. A *CouponError is returned for the first coupon that
+// was.
+func (c *Order) checkCouponLimits(ctx context.Context, coupons []*model.Coupon) error {
+	userID := authentication.AuthenticatedUser(ctx).ID
+	for _, coupon := range coupons {
+		if coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions {
+			return &CouponError{Code: coupon.Code, Reason: "is used up"}
+		}
+		if coupon.MaxRedemptionsPerUser == 0 {
+			continue
+		}
+		count, err := c.CouponRepository.CountCouponRedemptionsOfUser(ctx, coupon.Code, userID)
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return err
+		case err == nil:
+			if count >= coupon.MaxRedemptionsPerUser {
+				return &CouponError{Code: coupon.Code, Reason: "was already used as often as allowed"}
+			}
+		default:
+			panic(err)
+		}
+	}
+	return nil
+}
+
+// Returns the quantities of stored products that the positions consist of.
+// Bundles are broken down into their products.
+func stockQuantities(positions []model.Position, promotions []*model.Promotion) map[string]int {
+	bundles := make(map[string]*model.Promotion)
+	for _, promotion := range promotions {
+		if promotion.Type == model.PromotionTypeBundle {
+			bundles[promotion.ID] = promotion
+		}
+	}
+	quantities := make(map[string]int)
+	for _, position := range positions {
+		if position.ProductID == "" {
+			continue // coupons and discounts
+		}
+		if bundle, ok := bundles[position.ProductID]; ok {
+			for productID, quantity := range bundle.Bundle {
+				quantities[productID] += position.Quantity * quantity
+			}
+			continue
+		}
+		quantities[position.ProductID] += position.Quantity
+	}
+	return quantities
+}
+
+// releases the stock reservation of the order, a background context is used,
+// because it must happen even if the request was cancelled
+func (c *Order) releaseStock(orderID string) {
+	if err := c.StockRepository.ReleaseStock(context.Background(), orderID); err != nil {
+		panic(err)
+	}
+}
+
+// releases the coupon redemptions of the order, a background context is used,
+// because it must happen even if the request was cancelled
+func (c *Order) releaseCouponRedemptions(orderID string) {
+	if err := c.CouponRepository.ReleaseCouponRedemptions(context.Background(), orderID); err != nil {
+		panic(err)
+	}
 }
 
 func calculatePositionSum(positions []model.Position) (sum int) {
@@ -450,21 +1060,30 @@ func calculatePositionSum(positions []model.Position) (sum int) {
 	return
 }
 
-func hashPositions(positions []model.Position) []byte {
-	entries := make(sort.StringSlice, len(positions))
+func hashPositions(currency model.Currency, positions []model.Position) []byte {
+	entries := make(sort.StringSlice, len(positions), len(positions)+1)
 	for i, position := range positions {
 		buf := new(bytes.Buffer)
 		fmt.Fprintf(buf, "%d,%d,", position.Quantity, position.Price)
 		switch {
+		case position.Tax != nil:
+			fmt.Fprintf(buf, "tax:%q,%d,%d,%d,%t", position.Tax.Class, position.Tax.Rate,
+				position.Tax.Net, position.Tax.Amount, position.Tax.Included)
+		case position.Shipping != nil:
+			fmt.Fprintf(buf, "shipping:%q,%q", position.Shipping.ID, position.Shipping.Name)
+		case position.Promotion != nil:
+			fmt.Fprintf(buf, "promotion:%s,%d", position.Promotion.ID, position.Promotion.Discount)
 		case position.Product != nil:
 			fmt.Fprintf(buf, "product:%s", position.Product.ID)
 		case position.Coupon != nil:
-			fmt.Fprintf(buf, "coupon:%s,%d,%q", position.Coupon.ProductID, position.Coupon.Discount, position.Coupon.Code)
+			fmt.Fprintf(buf, "coupon:%s,%d,%d,%q", position.Coupon.ProductID, position.Coupon.Discount,
+				position.Coupon.Amount, position.Coupon.Code)
 		default:
-			panic("position has no product and no coupon")
+			panic("position has no product, coupon, shipping or tax")
 		}
 		entries[i] = buf.String()
 	}
+	entries = append(entries, "currency:"+string(currency))
 	entries.Sort()
 	base := strings.Join(entries, "\n")
 	// TODO: choose hash algorithm
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	apple  = &model.Product{ID: "apple", Name: "Apple", Price: 49}
+	banana = &model.Product{ID: "banana", Name: "Banana", Price: 25}
+)
+
+func TestCheckCouponSubtotals(t *testing.T) {
+	bundle := &model.Promotion{ID: "9-bundle", Type: model.PromotionTypeBundle,
+		Bundle: map[string]int{"apple": 2, "banana": 1}, Discount: 15}
+	threshold := &model.Promotion{ID: "1-threshold", Type: model.PromotionTypeQuantityThreshold,
+		ProductID: "apple", Quantity: 3, Discount: 10}
+
+	for _, tt := range []struct {
+		name       string
+		cart       []model.Position
+		promotions []*model.Promotion
+		subtotal   int // before any discounts
+	}{{
+		name:     "no promotions",
+		cart:     []model.Position{{ProductID: "apple", Product: apple, Quantity: 2}},
+		subtotal: 98,
+	}, {
+		name: "bundle counts with its items",
+		cart: []model.Position{
+			{ProductID: "apple", Product: apple, Quantity: 2},
+			{ProductID: "banana", Product: banana, Quantity: 1},
+		},
+		promotions: []*model.Promotion{bundle},
+		subtotal:   123,
+	}, {
+		name:       "discount does not count",
+		cart:       []model.Position{{ProductID: "apple", Product: apple, Quantity: 3}},
+		promotions: []*model.Promotion{threshold},
+		subtotal:   147,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Placing checks the positions as stored, preparing checks them as
+			// returned by the cart controller, with the promotions applied.
+			stored := tt.cart
+			promoted := generateOrderPositions(tt.cart, nil, tt.promotions)
+			for name, positions := range map[string][]model.Position{"stored": stored, "promoted": promoted} {
+				reached := &model.Coupon{Code: "reached", Discount: 10, MinSubtotal: tt.subtotal}
+				assert.NoError(t, checkCouponSubtotals([]*model.Coupon{reached}, positions), name)
+
+				missed := &model.Coupon{Code: "missed", Discount: 10, MinSubtotal: tt.subtotal + 1}
+				err := checkCouponSubtotals([]*model.Coupon{reached, missed}, positions)
+				var couponErr *CouponError
+				if assert.True(t, errors.As(err, &couponErr), name) {
+					assert.Equal(t, "missed", couponErr.Code, name)
+				}
+			}
+		})
+	}
+}
@@ -2,66 +2,272 @@ package controller
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
+	"sort"
 	"time"
 
-	"github.com/Teelevision/excommerce/config"
+	"github.com/Teelevision/excommerce/logging"
 	"github.com/Teelevision/excommerce/model"
 	"github.com/Teelevision/excommerce/persistence"
 )
 
 // Product is the controller that handles products.
 type Product struct {
-	ProductRepository persistence.ProductRepository
-	CouponRepository  persistence.CouponRepository
+	ProductRepository   persistence.ProductRepository
+	CouponRepository    persistence.CouponRepository
+	PromotionRepository persistence.PromotionRepository
+	StockRepository     persistence.StockRepository
+	// the lifetime of coupons that are saved without an expiry date
+	CouponDefaultLifetime time.Duration
 }
 
-// GetAll gets all products.
-func (c *Product) GetAll(ctx context.Context) ([]*model.Product, error) {
-	products, err := c.ProductRepository.FindAllProducts(ctx)
+// ProductQuery selects, sorts and pages products. The zero value selects all
+// products sorted by name.
+type ProductQuery struct {
+	// Search matches products whose name, description or SKU contain it,
+	// ignoring case.
+	Search string
+	// Currency is the currency of the prices. Products without a price in it
+	// do not match. Empty means model.DefaultCurrency.
+	Currency model.Currency
+	// MinPrice and MaxPrice are the inclusive price range in cents. Nil means
+	// no limit.
+	MinPrice, MaxPrice *int
+	// Categories matches products that are in any of them.
+	Categories []string
+	// Sort is the order of the products. Empty means sorted by name.
+	Sort model.ProductSort
+	// After is the last product of the previous page. Only its id and the
+	// field that is sorted by are used. Nil means the first page.
+	After *model.Product
+	// Limit is the maximum number of products. Zero means no limit.
+	Limit int
+}
+
+// Query returns the products that match the query, in the order and page
+// defined by the query. The prices of the products are in the currency of the
+// query.
+func (c *Product) Query(ctx context.Context, query ProductQuery) ([]*model.Product, error) {
+	products, err := c.ProductRepository.QueryProducts(ctx, persistence.ProductQuery(query))
 	switch {
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
+		if query.Currency == "" || query.Currency == model.DefaultCurrency {
+			return products, nil
+		}
+		for i, product := range products {
+			// products without a price in the currency do not match
+			if products[i], err = productInCurrency(product, query.Currency); err != nil {
+				panic(err)
+			}
+		}
 		return products, nil
 	default:
 		panic(err)
 	}
 }
 
-// Get returns the requested product. ErrNotFound is returned if there is no
-// product with the given id.
-func (c *Product) Get(ctx context.Context, productID string) (*model.Product, error) {
-	if product := getSpecialProduct(productID); product != nil {
+// Get returns the requested product with its price in the given currency.
+// ErrNotFound is returned if there is no product with the given id. ErrDeleted
+// is returned if the product did exist but is deleted. ErrNoPrice is returned
+// if the product has no price in the currency.
+func (c *Product) Get(ctx context.Context, productID string, currency model.Currency) (*model.Product, error) {
+	product, err := findProduct(ctx, c.ProductRepository, c.PromotionRepository, productID, currency)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, persistence.ErrDeleted):
+		return nil, ErrDeleted
+	case errors.Is(err, ErrNoPrice):
+		return nil, ErrNoPrice
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
 		return product, nil
+	default:
+		panic(err)
+	}
+}
+
+// Create creates the given product. The product's name is expected to be 1 to
+// 100 runes long and the price must not be negative. ErrConflict is returned
+// if a product with the same id already exists or existed. On success the
+// product is returned.
+func (c *Product) Create(ctx context.Context, product *model.Product) (*model.Product, error) {
+	err := c.ProductRepository.CreateProduct(ctx, product.ID, convertProductAttributes(product))
+	switch {
+	case errors.Is(err, persistence.ErrConflict):
+		return nil, ErrConflict
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return product, nil
+	default:
+		panic(err)
+	}
+}
+
+// Update updates the name and price of the given product. The same
+// expectations as for Create apply. Orders that were prepared with a different
+// price become invalid and are deleted when they are placed. ErrNotFound is
+// returned if the product does not exist. ErrDeleted is returned if the
+// product did exist but is deleted. On success the product is returned.
+func (c *Product) Update(ctx context.Context, product *model.Product) (*model.Product, error) {
+	err := c.ProductRepository.UpdateProduct(ctx, product.ID, convertProductAttributes(product))
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, persistence.ErrDeleted):
+		return nil, ErrDeleted
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return product, nil
+	default:
+		panic(err)
+	}
+}
+
+// Delete deletes the product with the given id. Carts keep the product, but it
+// is not available anymore and orders containing it cannot be placed.
+// ErrNotFound is returned if the product does not exist. ErrDeleted is
+// returned if the product is already deleted.
+func (c *Product) Delete(ctx context.Context, productID string) error {
+	err := c.ProductRepository.DeleteProduct(ctx, productID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, persistence.ErrDeleted):
+		return ErrDeleted
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+		return nil
+	default:
+		panic(err)
+	}
+}
+
+// GetStock returns the stock of the product with the given id. ErrNotFound is
+// returned if the stock of the product is not tracked.
+func (c *Product) GetStock(ctx context.Context, productID string) (*model.Stock, error) {
+	stock, err := c.StockRepository.FindStock(ctx, productID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return stock, nil
+	default:
+		panic(err)
+	}
+}
+
+// SetStock sets the quantity in stock of the product with the given id and
+// starts tracking it. The quantity must not be negative. ErrNotFound is
+// returned if the product does not exist. ErrDeleted is returned if the
+// product did exist but is deleted. ErrConflict is returned if the quantity is
+// lower than the quantity reserved by orders that are being placed. On success
+// the stock is returned.
+func (c *Product) SetStock(ctx context.Context, productID string, quantity int) (*model.Stock, error) {
+	_, err := c.ProductRepository.FindProduct(ctx, productID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, persistence.ErrDeleted):
+		return nil, ErrDeleted
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		// exists
+	default:
+		panic(err)
+	}
+
+	err = c.StockRepository.SetStock(ctx, productID, quantity)
+	switch {
+	case errors.Is(err, persistence.ErrConflict):
+		return nil, ErrConflict
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return c.GetStock(ctx, productID)
+	default:
+		panic(err)
 	}
-	product, err := c.ProductRepository.FindProduct(ctx, productID)
+}
+
+// AdjustStock adds delta to the quantity in stock of the product with the
+// given id. A negative delta removes items. ErrNotFound is returned if the
+// stock of the product is not tracked. ErrConflict is returned if the quantity
+// would become lower than the quantity reserved by orders that are being
+// placed. On success the stock is returned.
+func (c *Product) AdjustStock(ctx context.Context, productID string, delta int) (*model.Stock, error) {
+	err := c.StockRepository.AdjustStock(ctx, productID, delta)
 	switch {
 	case errors.Is(err, persistence.ErrNotFound):
 		return nil, ErrNotFound
+	case errors.Is(err, persistence.ErrConflict):
+		return nil, ErrConflict
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
-		return &model.Product{
-			ID:    product.ID,
-			Name:  product.Name,
-			Price: product.Price,
-		}, nil
+		return c.GetStock(ctx, productID)
 	default:
 		panic(err)
 	}
 }
 
+// DeleteStock stops tracking the stock of the product with the given id. The
+// product can then be ordered in any quantity. ErrNotFound is returned if the
+// stock of the product is not tracked.
+func (c *Product) DeleteStock(ctx context.Context, productID string) error {
+	err := c.StockRepository.DeleteStock(ctx, productID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+		return nil
+	default:
+		panic(err)
+	}
+}
+
+func convertProductAttributes(product *model.Product) persistence.ProductAttributes {
+	return persistence.ProductAttributes{
+		Name:        product.Name,
+		Price:       product.Price,
+		Prices:      product.Prices,
+		TaxClass:    product.TaxClass,
+		Description: product.Description,
+		SKU:         product.SKU,
+		Categories:  product.Categories,
+		Attributes:  product.Attributes,
+		Images:      product.Images,
+	}
+}
+
 // SaveCoupon creates or updates the given coupon. The coupon's code is expected
 // to be 6 to 40 runes long, and the coupon's name 1 to 100. The coupon's
-// product is expected to exist and the coupon's discount is expected to be
-// between 1 and 100. On success the coupon is returned.
+// product is expected to exist, unless the coupon has no product and applies to
+// the whole cart. Either the coupon's discount is expected to be between 1 and
+// 100, or its amount to be positive. The minimum subtotal and limits are
+// expected not to be negative. On success the coupon is returned.
 func (c *Product) SaveCoupon(ctx context.Context, coupon *model.Coupon) (*model.Coupon, error) {
 	if coupon.ExpiresAt.IsZero() {
-		coupon.ExpiresAt = time.Now().Add(config.CouponDefaultLifetime)
+		coupon.ExpiresAt = time.Now().Add(c.CouponDefaultLifetime)
+	}
+	coupon.ProductID = ""
+	if coupon.Product != nil {
+		coupon.ProductID = coupon.Product.ID
 	}
 
-	err := c.CouponRepository.StoreCoupon(ctx, coupon.Code, coupon.Name, coupon.Product.ID, coupon.Discount, coupon.ExpiresAt)
+	err := c.CouponRepository.StoreCoupon(ctx, coupon.Code, convertCouponAttributes(coupon))
 	switch {
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
@@ -72,6 +278,130 @@ func (c *Product) SaveCoupon(ctx context.Context, coupon *model.Coupon) (*model.
 	}
 }
 
+// CouponCodeAlphabet are the runes of generated coupon codes. Runes that are
+// easily confused, like 0 and o or 1, i and l, are left out.
+const CouponCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// GenerateCoupons creates count coupons like the given one, but with random
+// codes. Each code starts with the prefix and is filled up to length runes with
+// runes of CouponCodeAlphabet. The coupon is expected to be valid like in
+// SaveCoupon, and the prefix to leave room for at least 4 random runes. Codes
+// that exist already are not reused. ErrConflict is returned if not enough
+// unused codes were found, in which case no coupons are created. On success the
+// coupons are returned ordered by code.
+func (c *Product) GenerateCoupons(ctx context.Context, coupon *model.Coupon, prefix string, length, count int) ([]*model.Coupon, error) {
+	if coupon.ExpiresAt.IsZero() {
+		coupon.ExpiresAt = time.Now().Add(c.CouponDefaultLifetime)
+	}
+	coupon.ProductID = ""
+	if coupon.Product != nil {
+		coupon.ProductID = coupon.Product.ID
+	}
+	attributes := convertCouponAttributes(coupon)
+
+	// All coupons are created at once. Codes that exist already are replaced
+	// by new ones and the creation is tried again.
+	const maxAttempts = 10
+	codes := make([]string, 0, count)
+	used := make(map[string]bool, count) // generated or existing codes
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		for len(codes) < count {
+			code, ok := "", false
+			for i := 0; i < maxAttempts && !ok; i++ {
+				code = prefix + randomCouponCode(length-len([]rune(prefix)))
+				ok = !used[code]
+			}
+			if !ok {
+				return nil, ErrConflict
+			}
+			used[code] = true
+			codes = append(codes, code)
+		}
+
+		err := c.CouponRepository.CreateCoupons(ctx, codes, attributes)
+		var conflict *persistence.CouponConflictError
+		switch {
+		case errors.As(err, &conflict):
+			existing := make(map[string]bool, len(conflict.Codes))
+			for _, code := range conflict.Codes {
+				existing[code] = true
+			}
+			available := codes[:0]
+			for _, code := range codes {
+				if !existing[code] {
+					available = append(available, code)
+				}
+			}
+			codes = available
+			continue
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return nil, err
+		case err == nil:
+		default:
+			panic(err)
+		}
+
+		sort.Strings(codes)
+		coupons := make([]*model.Coupon, len(codes))
+		for i, code := range codes {
+			generated := *coupon
+			generated.Code = code
+			coupons[i] = &generated
+		}
+		logging.FromContext(ctx).Info("coupons generated", "count", count, "prefix", prefix, "productId", coupon.ProductID)
+		return coupons, nil
+	}
+	return nil, ErrConflict
+}
+
+// returns n random runes of CouponCodeAlphabet
+func randomCouponCode(n int) string {
+	code := make([]byte, 0, n)
+	buf := make([]byte, n)
+	// bytes from the largest multiple of the alphabet size up are dropped, so
+	// that every rune is equally likely
+	limit := byte(256 - 256%len(CouponCodeAlphabet))
+	for len(code) < n {
+		if _, err := rand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, b := range buf {
+			if b < limit && len(code) < n {
+				code = append(code, CouponCodeAlphabet[int(b)%len(CouponCodeAlphabet)])
+			}
+		}
+	}
+	return string(code)
+}
+
+func convertCouponAttributes(coupon *model.Coupon) persistence.CouponAttributes {
+	return persistence.CouponAttributes{
+		Name:                  coupon.Name,
+		ProductID:             coupon.ProductID,
+		Discount:              coupon.Discount,
+		Amount:                coupon.Amount,
+		MinSubtotal:           coupon.MinSubtotal,
+		MaxRedemptions:        coupon.MaxRedemptions,
+		MaxRedemptionsPerUser: coupon.MaxRedemptionsPerUser,
+		NotBefore:             coupon.NotBefore,
+		ExpiresAt:             coupon.ExpiresAt,
+	}
+}
+
+// GetAllCoupons returns all coupons of products and carts, including the
+// expired ones, ordered by code.
+func (c *Product) GetAllCoupons(ctx context.Context) ([]*model.Coupon, error) {
+	coupons, err := c.CouponRepository.FindAllCoupons(ctx)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return coupons, nil
+	default:
+		panic(err)
+	}
+}
+
 // GetCoupon returns the valid coupon with the given code. ErrNotFound is
 // returned if there is no coupon with the given code or it is invalid.
 func (c *Product) GetCoupon(ctx context.Context, code string) (*model.Coupon, error) {
@@ -88,16 +418,68 @@ func (c *Product) GetCoupon(ctx context.Context, code string) (*model.Coupon, er
 	}
 }
 
-func getSpecialProduct(productID string) *model.Product {
-	switch productID {
-	case "0de17a66-ea59-4032-9383-2603c6c77d25": // set of 4 pears and 2 bananas
-		return &model.Product{
-			ID:         "0de17a66-ea59-4032-9383-2603c6c77d25",
-			Name:       "Set of 4 pears and 2 bananas (30% off)",
-			Price:      444,
-			SavedPrice: 190,
+// GetCouponsOfProduct returns the coupons of the product with the given id,
+// ordered by code. Active coupons are included if active is true, and expired
+// coupons if expired is true. The empty product id returns the cart-wide
+// coupons.
+func (c *Product) GetCouponsOfProduct(ctx context.Context, productID string, active, expired bool) ([]*model.Coupon, error) {
+	coupons, err := c.CouponRepository.FindCouponsOfProduct(ctx, productID)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		now := time.Now()
+		result := make([]*model.Coupon, 0, len(coupons))
+		for _, coupon := range coupons {
+			if isExpired := coupon.ExpiresAt.Before(now); (isExpired && expired) || (!isExpired && active) {
+				result = append(result, coupon)
+			}
 		}
+		return result, nil
 	default:
+		panic(err)
+	}
+}
+
+// GetCouponOfProduct returns the coupon with the given code of the product with
+// the given id, even if it is expired. The empty product id refers to cart-wide
+// coupons. ErrNotFound is returned if there is no coupon with the code for the
+// product.
+func (c *Product) GetCouponOfProduct(ctx context.Context, productID, code string) (*model.Coupon, error) {
+	coupon, err := c.CouponRepository.FindCoupon(ctx, code)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, ErrNotFound
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		if coupon.ProductID != productID {
+			return nil, ErrNotFound
+		}
+		return coupon, nil
+	default:
+		panic(err)
+	}
+}
+
+// DeleteCouponOfProduct deletes the coupon with the given code of the product
+// with the given id. The empty product id refers to cart-wide coupons. Orders
+// that use the coupon become invalid. ErrNotFound is returned if there is no
+// coupon with the code for the product.
+func (c *Product) DeleteCouponOfProduct(ctx context.Context, productID, code string) error {
+	if _, err := c.GetCouponOfProduct(ctx, productID, code); err != nil {
+		return err
+	}
+	err := c.CouponRepository.DeleteCoupon(ctx, code)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+		logging.FromContext(ctx).Info("coupon deleted", "code", code, "productId", productID)
 		return nil
+	default:
+		panic(err)
 	}
 }
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/promotion"
+)
+
+// Promotion is the controller that handles promotions.
+type Promotion struct {
+	PromotionRepository persistence.PromotionRepository
+	ProductRepository   persistence.ProductRepository
+}
+
+// GetAll gets all promotions.
+func (c *Promotion) GetAll(ctx context.Context) ([]*model.Promotion, error) {
+	return findAllPromotions(ctx, c.PromotionRepository)
+}
+
+// Save creates or updates the given promotion. The promotion's name is
+// expected to be 1 to 100 runes long, the discount to be between 1 and 100 and
+// all referenced products are expected to exist. On success the promotion is
+// returned. The items of bundles are checked here, because a bundle is a
+// virtual product itself: ErrConflict is returned if a bundle has the id of a
+// product, even a deleted one, as the product would shadow the bundle. A
+// *BundleItemError is returned if an item of a bundle is not an available
+// product, like another bundle.
+func (c *Promotion) Save(ctx context.Context, promotion *model.Promotion) (*model.Promotion, error) {
+	if promotion.Type == model.PromotionTypeBundle {
+		if err := c.checkBundle(ctx, promotion); err != nil {
+			return nil, err
+		}
+	}
+	err := c.PromotionRepository.StorePromotion(ctx, promotion.ID, persistence.PromotionAttributes{
+		Type:         promotion.Type,
+		Name:         promotion.Name,
+		ProductID:    promotion.ProductID,
+		Quantity:     promotion.Quantity,
+		FreeQuantity: promotion.FreeQuantity,
+		Bundle:       promotion.Bundle,
+		Discount:     promotion.Discount,
+	})
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return promotion, nil
+	default:
+		panic(err)
+	}
+}
+
+// Checks that the id of the bundle is not the id of a product and that all its
+// items are stored products, in the order of their ids.
+func (c *Promotion) checkBundle(ctx context.Context, bundle *model.Promotion) error {
+	_, err := c.ProductRepository.FindProduct(ctx, bundle.ID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		// no collision
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil, errors.Is(err, persistence.ErrDeleted):
+		return ErrConflict
+	default:
+		panic(err)
+	}
+
+	productIDs := make([]string, 0, len(bundle.Bundle))
+	for productID := range bundle.Bundle {
+		productIDs = append(productIDs, productID)
+	}
+	sort.Strings(productIDs)
+	for _, productID := range productIDs {
+		_, err := c.ProductRepository.FindProduct(ctx, productID)
+		switch {
+		case errors.Is(err, persistence.ErrNotFound), errors.Is(err, persistence.ErrDeleted):
+			return &BundleItemError{ProductID: productID}
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return err
+		case err == nil:
+			// stored product
+		default:
+			panic(err)
+		}
+	}
+	return nil
+}
+
+// Delete deletes the promotion with the given id. ErrNotFound is returned if
+// there is no promotion with the id.
+func (c *Promotion) Delete(ctx context.Context, promotionID string) error {
+	err := c.PromotionRepository.DeletePromotion(ctx, promotionID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return ErrNotFound
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+		return nil
+	default:
+		panic(err)
+	}
+}
+
+func findAllPromotions(ctx context.Context, r persistence.PromotionRepository) ([]*model.Promotion, error) {
+	promotions, err := r.FindAllPromotions(ctx)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return promotions, nil
+	default:
+		panic(err)
+	}
+}
+
+// findProduct returns the product with the given id with its price in the
+// given currency. Bundles of promotions are virtual products that are not
+// stored in the product repository, but are built from the products they
+// consist of. persistence.ErrNotFound is returned if there is neither a product
+// nor a bundle with the id, or any product of the bundle is not available.
+// persistence.ErrDeleted is returned if the product is deleted. ErrNoPrice is
+// returned if the product or any product of the bundle has no price in the
+// currency.
+func findProduct(ctx context.Context, products persistence.ProductRepository, promotions persistence.PromotionRepository, id string, currency model.Currency) (*model.Product, error) {
+	product, err := products.FindProduct(ctx, id)
+	if err == nil {
+		return productInCurrency(product, currency)
+	} else if !errors.Is(err, persistence.ErrNotFound) {
+		return nil, err
+	}
+
+	// look for a bundle
+	bundle, err := promotions.FindPromotion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]*model.Product, len(bundle.Bundle))
+	for productID := range bundle.Bundle {
+		product, err := products.FindProduct(ctx, productID)
+		if errors.Is(err, persistence.ErrDeleted) {
+			return nil, persistence.ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		if items[productID], err = productInCurrency(product, currency); err != nil {
+			return nil, err
+		}
+	}
+	product = promotion.BundleProduct(bundle, items)
+	if product == nil {
+		return nil, persistence.ErrNotFound
+	}
+	return product, nil
+}
+
+// productInCurrency returns a copy of the product with its price in the given
+// currency. ErrNoPrice is returned if the product has no price in the currency.
+func productInCurrency(product *model.Product, currency model.Currency) (*model.Product, error) {
+	price, ok := product.PriceIn(currency)
+	if !ok {
+		return nil, ErrNoPrice
+	}
+	converted := *product
+	converted.Price = price
+	return &converted, nil
+}
@@ -2,23 +2,71 @@ package controller
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Teelevision/excommerce/authentication"
+	"github.com/Teelevision/excommerce/logging"
 	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/notification"
 	"github.com/Teelevision/excommerce/persistence"
 	"github.com/google/uuid"
 )
 
-// User is the controller that creates a user.
+// User is the controller that creates users and guests, and manages their
+// login sessions and passwords.
 type User struct {
-	UserRepository persistence.UserRepository
+	UserRepository          persistence.UserRepository
+	SessionRepository       persistence.SessionRepository
+	CartRepository          persistence.CartRepository
+	OrderRepository         persistence.OrderRepository
+	PlacedOrderRepository   persistence.PlacedOrderRepository
+	PasswordResetRepository persistence.PasswordResetRepository
+	Authenticator           *authentication.Authenticator
+	Notifier                notification.Notifier
+	// lifetimes of the tokens and sessions
+	AccessTokenLifetime   time.Duration
+	RefreshTokenLifetime  time.Duration
+	GuestTokenLifetime    time.Duration
+	PasswordResetLifetime time.Duration
 }
 
 // Create creates the user. The name is expected to be 1 to 64 runes long, and
-// the password 8 to 64. ErrConflict is returned if the name is already taken.
-// On success the user is returned.
-func (c *User) Create(ctx context.Context, name, password string) (*model.User, error) {
+// the password 8 to 64. If a guest token is given, the carts and orders of the
+// guest are transferred to the user and the tokens of the guest become
+// invalid. ErrInvalidToken is returned if the guest token is invalid or
+// expired, or the guest was claimed by another user. ErrConflict is returned
+// if the name is already taken. On success the user is returned.
+func (c *User) Create(ctx context.Context, name, password, guestToken string) (*model.User, error) {
+	// check guest token
+	var guestID string
+	if guestToken != "" {
+		token, err := c.Authenticator.ParseAccessToken(guestToken)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+		}
+		if !token.Guest {
+			return nil, fmt.Errorf("%w: not a guest token", ErrInvalidToken)
+		}
+		guestID = token.UserID
+
+		_, err = c.UserRepository.FindGuestClaim(ctx, guestID)
+		switch {
+		case errors.Is(err, persistence.ErrNotFound):
+			// not claimed yet
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return nil, err
+		case err == nil:
+			return nil, fmt.Errorf("%w: guest was claimed", ErrInvalidToken)
+		default:
+			panic(err)
+		}
+	}
+
 	// create id
 	uuid, err := uuid.NewRandom()
 	if err != nil {
@@ -34,19 +82,100 @@ func (c *User) Create(ctx context.Context, name, password string) (*model.User,
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		return nil, err
 	case err == nil:
-		return &model.User{
-			ID:   id,
-			Name: name,
-		}, nil
 	default:
 		panic(err)
 	}
+
+	// Claim everything of the guest. The user exists already, so this must
+	// happen even if the request was cancelled. Only one of concurrent
+	// registrations gets the guest.
+	if guestID != "" {
+		err := c.UserRepository.ClaimGuest(context.Background(), guestID, id)
+		switch {
+		case errors.Is(err, persistence.ErrConflict):
+			logging.FromContext(ctx).Info("guest claimed concurrently", "userId", id, "guestId", guestID)
+			guestID = ""
+		case err != nil:
+			panic(err)
+		}
+	}
+	if guestID != "" {
+		if err := c.CartRepository.TransferCartsOfUser(context.Background(), guestID, id); err != nil {
+			panic(err)
+		}
+		if err := c.OrderRepository.TransferOrdersOfUser(context.Background(), guestID, id); err != nil {
+			panic(err)
+		}
+		if err := c.PlacedOrderRepository.TransferPlacedOrdersOfUser(context.Background(), guestID, id); err != nil {
+			panic(err)
+		}
+	}
+
+	logging.FromContext(ctx).Info("user registered", "userId", id, "guestId", guestID)
+	return &model.User{
+		ID:   id,
+		Name: name,
+	}, nil
 }
 
-// GetByNameAndPassword gets the user by name and password. ErrNotFound is
-// returned if there is no user with the name. On success the user is returned.
-func (c *User) GetByNameAndPassword(ctx context.Context, name, password string) (*model.User, error) {
-	user, err := c.UserRepository.FindUserByNameAndPassword(ctx, name, password)
+// CreateGuest creates a guest. Guests have no account, but can store carts and
+// place orders with their access token until it expires. The tokens of guests
+// have no refresh token.
+func (c *User) CreateGuest(ctx context.Context) *Tokens {
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		panic(err)
+	}
+	guest := model.User{
+		ID:    uuid.String(),
+		Guest: true,
+	}
+
+	expiresAt := time.Now().Add(c.GuestTokenLifetime)
+	return &Tokens{
+		User: &guest,
+		AccessToken: c.Authenticator.SignAccessToken(authentication.AccessToken{
+			UserID:    guest.ID,
+			Guest:     true,
+			ExpiresAt: expiresAt,
+		}),
+		AccessTokenExpiresAt: expiresAt,
+	}
+}
+
+// SetRoles replaces the roles of the user with the given id. All login
+// sessions of the user are revoked, so that the new roles apply to all tokens.
+// ErrNotFound is returned if there is no user with the id. On success the
+// user is returned.
+func (c *User) SetRoles(ctx context.Context, id string, roles []model.Role) (*model.User, error) {
+	// remove duplicates
+	unique := make([]model.Role, 0, len(roles))
+	seen := make(map[model.Role]bool, len(roles))
+	for _, role := range roles {
+		if !seen[role] {
+			seen[role] = true
+			unique = append(unique, role)
+		}
+	}
+
+	err := c.UserRepository.SetUserRoles(ctx, id, unique)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	// revoke sessions
+	err = c.SessionRepository.DeleteSessionsOfUser(context.Background(), id)
+	if err != nil {
+		panic(err)
+	}
+
+	user, err := c.UserRepository.FindUser(ctx, id)
 	switch {
 	case errors.Is(err, persistence.ErrNotFound):
 		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
@@ -58,3 +187,312 @@ func (c *User) GetByNameAndPassword(ctx context.Context, name, password string)
 		panic(err)
 	}
 }
+
+// Tokens are the tokens of a login session. The access token authenticates
+// requests. The refresh token can be used once to get new tokens.
+type Tokens struct {
+	User *model.User
+
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+// Login starts a login session of the user with the name and password.
+// ErrNotFound is returned if there is no user with the name and password. On
+// success the tokens of the session are returned.
+func (c *User) Login(ctx context.Context, name, password string) (*Tokens, error) {
+	user, err := c.UserRepository.FindUserByNameAndPassword(ctx, name, password)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	// create session
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		panic(err)
+	}
+	sessionID := uuid.String()
+	refreshToken := newRefreshToken(sessionID)
+	expiresAt := time.Now().Add(c.RefreshTokenLifetime)
+	err = c.SessionRepository.CreateSession(ctx, sessionID, user.ID, refreshToken, expiresAt)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return c.tokens(user, sessionID, refreshToken, expiresAt), nil
+	default:
+		panic(err)
+	}
+}
+
+// Refresh exchanges the refresh token for new tokens of the same session. The
+// refresh token cannot be used again. ErrNotFound is returned if the refresh
+// token is invalid or expired, or the session was revoked. Using a refresh
+// token again revokes the session, because the token was likely stolen.
+func (c *User) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	i := strings.LastIndexByte(refreshToken, '.')
+	if i < 0 {
+		return nil, fmt.Errorf("%w: malformed refresh token", ErrNotFound)
+	}
+	sessionID := refreshToken[:i]
+
+	session, err := c.SessionRepository.FindSession(ctx, sessionID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	user, err := c.UserRepository.FindUser(ctx, session.UserID)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	// rotate refresh token
+	newToken := newRefreshToken(sessionID)
+	expiresAt := time.Now().Add(c.RefreshTokenLifetime)
+	err = c.SessionRepository.RotateSession(ctx, sessionID, refreshToken, newToken, expiresAt)
+	switch {
+	case errors.Is(err, persistence.ErrConflict):
+		// revoke session on reuse of a refresh token
+		err := c.SessionRepository.DeleteSession(context.Background(), sessionID)
+		if err != nil && !errors.Is(err, persistence.ErrNotFound) {
+			panic(err)
+		}
+		return nil, fmt.Errorf("%w: refresh token was used before", ErrNotFound)
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return nil, err
+	case err == nil:
+		return c.tokens(user, sessionID, newToken, expiresAt), nil
+	default:
+		panic(err)
+	}
+}
+
+// Logout revokes the login session of the authenticated user. If all is true,
+// all sessions of the user are revoked. Without a session, like with basic
+// auth, only all sessions can be revoked.
+func (c *User) Logout(ctx context.Context, all bool) error {
+	var err error
+	if all {
+		err = c.SessionRepository.DeleteSessionsOfUser(ctx, authentication.AuthenticatedUser(ctx).ID)
+	} else if sessionID := authentication.AuthenticatedSession(ctx); sessionID != "" {
+		err = c.SessionRepository.DeleteSession(ctx, sessionID)
+	}
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return nil // already revoked
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+		return nil
+	default:
+		panic(err)
+	}
+}
+
+// ChangePassword replaces the password of the authenticated user. All login
+// sessions and password reset tokens of the user are revoked. ErrForbidden is
+// returned if the current password is wrong.
+func (c *User) ChangePassword(ctx context.Context, currentPassword, newPassword string) error {
+	user := authentication.AuthenticatedUser(ctx)
+	_, err := c.UserRepository.FindUserByIDAndPassword(ctx, user.ID, currentPassword)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return fmt.Errorf("%w: %s", ErrForbidden, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	err = c.UserRepository.SetUserPassword(ctx, user.ID, newPassword)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return fmt.Errorf("%w: %s", ErrForbidden, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	c.revokeCredentials(user.ID)
+	logging.FromContext(ctx).Info("password changed", "userId", user.ID)
+	return nil
+}
+
+// RequestPasswordReset sends a single-use token to reset the password to the
+// user with the given name. The token expires after a while. Nothing happens if
+// there is no user with the name, and no error is returned so that the names
+// of users cannot be guessed.
+func (c *User) RequestPasswordReset(ctx context.Context, name string) error {
+	user, err := c.UserRepository.FindUserByName(ctx, name)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		logging.FromContext(ctx).Info("password reset requested for unknown user")
+		return nil
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	// store token
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	expiresAt := time.Now().Add(c.PasswordResetLifetime)
+	err = c.PasswordResetRepository.CreatePasswordReset(ctx, token, user.ID, expiresAt)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	// send token
+	err = c.Notifier.Notify(ctx, notification.Notification{
+		UserID:   user.ID,
+		UserName: user.Name,
+		Subject:  "Reset your password",
+		Text: fmt.Sprintf("Use the following token to reset your password. "+
+			"It can be used once until %s.\n\n%s",
+			expiresAt.Format(time.RFC1123Z), token),
+	})
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+		logging.FromContext(ctx).Info("password reset requested", "userId", user.ID)
+		return nil
+	default:
+		panic(err)
+	}
+}
+
+// ResetPassword replaces the password of the user that the password reset
+// token was sent to. The token cannot be used again. All login sessions and
+// password reset tokens of the user are revoked. ErrInvalidToken is returned
+// if the token is invalid, expired or was used before.
+func (c *User) ResetPassword(ctx context.Context, token, password string) error {
+	userID, err := c.PasswordResetRepository.RedeemPasswordReset(ctx, token)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	// The token is redeemed, so the password must be set even if the request
+	// was cancelled.
+	err = c.UserRepository.SetUserPassword(context.Background(), userID, password)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	c.revokeCredentials(userID)
+	logging.FromContext(ctx).Info("password reset", "userId", userID)
+	return nil
+}
+
+// Delete deletes the user with the given id. Users can delete themselves, and
+// users with the manageUsers permission can delete anyone. All login sessions
+// and password reset tokens of the user are revoked. Carts and orders are
+// kept. ErrNotFound is returned if there is no user with the id. ErrForbidden
+// is returned if the current user may not delete the user.
+func (c *User) Delete(ctx context.Context, id string) error {
+	currentUser := authentication.AuthenticatedUser(ctx)
+	if currentUser.ID != id && !currentUser.HasPermission(model.PermissionManageUsers) {
+		return ErrForbidden
+	}
+
+	err := c.UserRepository.DeleteUser(ctx, id)
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		return fmt.Errorf("%w: %s", ErrNotFound, err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	c.revokeCredentials(id)
+	logging.FromContext(ctx).Info("user deleted", "userId", id, "by", currentUser.ID)
+	return nil
+}
+
+// revokeCredentials revokes all login sessions and password reset tokens of
+// the user. It ignores the context of the request, because it is called after
+// the change that requires it.
+func (c *User) revokeCredentials(userID string) {
+	err := c.SessionRepository.DeleteSessionsOfUser(context.Background(), userID)
+	if err != nil {
+		panic(err)
+	}
+	err = c.PasswordResetRepository.DeletePasswordResetsOfUser(context.Background(), userID)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// tokens returns the tokens of the session with a new access token.
+func (c *User) tokens(user *model.User, sessionID, refreshToken string, refreshTokenExpiresAt time.Time) *Tokens {
+	expiresAt := time.Now().Add(c.AccessTokenLifetime)
+	return &Tokens{
+		User: user,
+		AccessToken: c.Authenticator.SignAccessToken(authentication.AccessToken{
+			SessionID: sessionID,
+			UserID:    user.ID,
+			UserName:  user.Name,
+			Roles:     user.Roles,
+			ExpiresAt: expiresAt,
+		}),
+		AccessTokenExpiresAt:  expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}
+}
+
+// newRefreshToken returns a random refresh token. It is prefixed with the
+// session id, so that the session can be found.
+func newRefreshToken(sessionID string) string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(secret)
+}
@@ -176,11 +176,11 @@ export interface Order {
      */
     status: OrderStatusEnum;
     /**
-     * The total price of this order.
-     * @type {number}
+     * The total price of this order as decimal number.
+     * @type {string}
      * @memberof Order
      */
-    price: number;
+    price: string;
     /**
      * 
      * @type {Address}
@@ -235,17 +235,17 @@ export interface Position {
      */
     product: Product;
     /**
-     * The total price of this position.
-     * @type {number}
+     * The total price of this position as decimal number.
+     * @type {string}
      * @memberof Position
      */
-    price: number;
+    price: string;
     /**
-     * The total savings of this position.
-     * @type {number}
+     * The total savings of this position as decimal number.
+     * @type {string}
      * @memberof Position
      */
-    savedPrice: number;
+    savedPrice?: string;
 }
 /**
  * A product of the shop.
@@ -266,11 +266,60 @@ export interface Product {
      */
     name: string;
     /**
-     * The price of a single item of the product.
-     * @type {number}
+     * The price of a single item of the product as decimal number, like 12.30.
+     * @type {string}
+     * @memberof Product
+     */
+    price?: string;
+    /**
+     * The description of the product.
+     * @type {string}
+     * @memberof Product
+     */
+    description?: string;
+    /**
+     * The stock keeping unit of the product.
+     * @type {string}
+     * @memberof Product
+     */
+    sku?: string;
+    /**
+     * The unique names of the categories the product is in.
+     * @type {Array<string>}
+     * @memberof Product
+     */
+    categories?: Array<string>;
+    /**
+     * Arbitrary attributes of the product.
+     * @type {{ [key: string]: string; }}
      * @memberof Product
      */
-    price?: number;
+    attributes?: { [key: string]: string; };
+    /**
+     * The images of the product. The first one is the main image.
+     * @type {Array<Image>}
+     * @memberof Product
+     */
+    images?: Array<Image>;
+}
+/**
+ * An image of a product.
+ * @export
+ * @interface Image
+ */
+export interface Image {
+    /**
+     * The URL of the image. Either an absolute http(s) URL or an absolute path on this server.
+     * @type {string}
+     * @memberof Image
+     */
+    url: string;
+    /**
+     * The alternative text of the image.
+     * @type {string}
+     * @memberof Image
+     */
+    alt?: string;
 }
 /**
  * A user of the shop.
@@ -2,7 +2,42 @@ import { Store, ActionTree, ActionContext } from 'vuex'
 import createPersistedState from 'vuex-persistedstate'
 import { v4 as uuidv4 } from 'uuid'
 import { Product, Cart, Position, User, Order } from '~/models'
-import { ProductsApi, UsersApi, CartsApi, Configuration } from '~/client'
+import {
+  ProductsApi,
+  UsersApi,
+  CartsApi,
+  Configuration,
+  Product as ApiProduct,
+  Position as ApiPosition,
+  Order as ApiOrder
+} from '~/client'
+
+// The api has prices as exact decimal strings, the frontend only displays
+// them, so numbers are precise enough.
+
+export const convertProductIn = (product: ApiProduct): Product => ({
+  ...product,
+  price: product.price === undefined ? undefined : Number(product.price)
+})
+
+export const convertPositionIn = ({
+  quantity,
+  product,
+  price,
+  savedPrice
+}: ApiPosition): Position => ({
+  quantity,
+  product: convertProductIn(product),
+  price: Number(price),
+  savedPrice: savedPrice === undefined ? undefined : Number(savedPrice),
+  productId: product.id
+})
+
+export const convertOrderIn = (order: ApiOrder): Order => ({
+  ...order,
+  price: Number(order.price),
+  positions: order.positions.map(convertPositionIn)
+})
 
 interface State {
   products: Product[]
@@ -83,7 +118,9 @@ export const actions = <ActionTreeMutations>{
     const api = new ProductsApi()
     commit(
       'allProductsLoaded',
-      await api.getAllProducts().then((resp) => resp.data)
+      await api
+        .getAllProducts()
+        .then((resp) => resp.data.map(convertProductIn))
     )
   },
   updateCartPositions({ commit, dispatch }, positions: Position[]) {
@@ -126,22 +163,10 @@ export const actions = <ActionTreeMutations>{
           .map(({ quantity, productId }) => ({
             quantity,
             product: { id: productId || '', name: '' },
-            price: 0,
-            savedPrice: 0
+            price: '0'
           }))
       })
-      commit('updateCart', {
-        id,
-        positions: positions.map(
-          ({ quantity, product, price, savedPrice }) => ({
-            quantity,
-            product,
-            price,
-            savedPrice,
-            productId: product.id
-          })
-        )
-      })
+      commit('updateCart', { id, positions: positions.map(convertPositionIn) })
     } catch (e) {
       switch (e.response.status) {
         case 423:
@@ -166,15 +191,7 @@ export const actions = <ActionTreeMutations>{
       }
       commit('updateCart', {
         id: cart.id,
-        positions: cart.positions.map(
-          ({ quantity, product, price, savedPrice }) => ({
-            quantity,
-            product,
-            price,
-            savedPrice,
-            productId: product.id
-          })
-        )
+        positions: cart.positions.map(convertPositionIn)
       })
       break
     }
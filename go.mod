@@ -6,7 +6,10 @@ require (
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/handlers v1.4.2
 	github.com/gorilla/mux v1.7.4
+	github.com/lib/pq v1.7.0
 	github.com/pariz/gountries v0.0.0-20200430155801-1c6a393df9c7
 	github.com/stretchr/testify v1.5.1
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/crypto v0.0.0-20200429183012-4b2356b1ed79
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -23,6 +23,19 @@ type CartsAPIRouter interface {
 	StoreCart(http.ResponseWriter, *http.Request)
 }
 
+// CouponsAPIRouter defines the required methods for binding the api requests to a responses for the CouponsApi
+// The CouponsAPIRouter implementation should parse necessary information from the http request,
+// pass the data to a CouponsApiServicer to perform the required actions, then write the service results to the http response.
+type CouponsAPIRouter interface {
+	DeleteCoupon(http.ResponseWriter, *http.Request)
+	ExportCoupons(http.ResponseWriter, *http.Request)
+	GenerateCoupons(http.ResponseWriter, *http.Request)
+	GetAllCoupons(http.ResponseWriter, *http.Request)
+	GetCoupon(http.ResponseWriter, *http.Request)
+	ImportCoupons(http.ResponseWriter, *http.Request)
+	StoreCoupon(http.ResponseWriter, *http.Request)
+}
+
 // OrdersAPIRouter defines the required methods for binding the api requests to a responses for the OrdersApi
 // The OrdersAPIRouter implementation should parse necessary information from the http request,
 // pass the data to a OrdersApiServicer to perform the required actions, then write the service results to the http response.
@@ -35,14 +48,34 @@ type OrdersAPIRouter interface {
 // The ProductsAPIRouter implementation should parse necessary information from the http request,
 // pass the data to a ProductsApiServicer to perform the required actions, then write the service results to the http response.
 type ProductsAPIRouter interface {
+	DeleteCouponOfProduct(http.ResponseWriter, *http.Request)
+	GetAllCouponsOfProduct(http.ResponseWriter, *http.Request)
 	GetAllProducts(http.ResponseWriter, *http.Request)
+	GetCouponOfProduct(http.ResponseWriter, *http.Request)
 	StoreCouponForProduct(http.ResponseWriter, *http.Request)
 }
 
+// PromotionsAPIRouter defines the required methods for binding the api requests to a responses for the PromotionsApi
+// The PromotionsAPIRouter implementation should parse necessary information from the http request,
+// pass the data to a PromotionsApiServicer to perform the required actions, then write the service results to the http response.
+type PromotionsAPIRouter interface {
+	DeletePromotion(http.ResponseWriter, *http.Request)
+	GetAllPromotions(http.ResponseWriter, *http.Request)
+	StorePromotion(http.ResponseWriter, *http.Request)
+}
+
 // UsersAPIRouter defines the required methods for binding the api requests to a responses for the UsersApi
 // The UsersAPIRouter implementation should parse necessary information from the http request,
 // pass the data to a UsersApiServicer to perform the required actions, then write the service results to the http response.
 type UsersAPIRouter interface {
+	ChangePassword(http.ResponseWriter, *http.Request)
+	CreateGuest(http.ResponseWriter, *http.Request)
+	DeleteUser(http.ResponseWriter, *http.Request)
+	ForgotPassword(http.ResponseWriter, *http.Request)
 	Login(http.ResponseWriter, *http.Request)
+	Logout(http.ResponseWriter, *http.Request)
+	Refresh(http.ResponseWriter, *http.Request)
 	Register(http.ResponseWriter, *http.Request)
+	ResetPassword(http.ResponseWriter, *http.Request)
+	SetUserRoles(http.ResponseWriter, *http.Request)
 }
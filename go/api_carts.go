@@ -20,6 +20,7 @@ import (
 	"github.com/Teelevision/excommerce/authentication"
 	"github.com/Teelevision/excommerce/controller"
 	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/tax"
 	"github.com/gorilla/mux"
 )
 
@@ -157,6 +158,22 @@ func (c *CartsAPI) StoreCart(w http.ResponseWriter, r *http.Request) {
 		invalidInput("The cartId of the path is not a UUID.", uuidPattern.String(), w)
 		return
 	}
+	currency, ok := decodeCurrencyQuery(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("currency") == "" {
+		// existing carts keep their currency, new ones get the default one
+		stored, err := c.CartController.Currency(ctx, cartID)
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			w.WriteHeader(499) // client closed request
+			return
+		case err == nil:
+			currency = stored
+		}
+		// other errors are returned when storing the cart
+	}
 	input := &Cart{}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		invalidJSON(err, w)
@@ -177,16 +194,21 @@ func (c *CartsAPI) StoreCart(w http.ResponseWriter, r *http.Request) {
 	cartInput := model.Cart{
 		ID:        cartID,
 		Positions: make([]model.Position, len(input.Positions)),
+		Currency:  currency,
 	}
 	for i, position := range input.Positions {
 		cartInput.Positions[i].ProductID = position.Product.ID
 		cartInput.Positions[i].Quantity = int(position.Quantity)
 		// load product
-		product, err := c.ProductController.Get(ctx, position.Product.ID)
+		product, err := c.ProductController.Get(ctx, position.Product.ID, currency)
 		switch {
-		case errors.Is(err, controller.ErrNotFound):
+		case errors.Is(err, controller.ErrNotFound), errors.Is(err, controller.ErrDeleted):
 			failValidation("The product is not available.", fmt.Sprintf("/positions/%d/product/id", i), w)
 			return
+		case errors.Is(err, controller.ErrNoPrice):
+			failValidation(fmt.Sprintf("The product has no price in %s.", currency),
+				fmt.Sprintf("/positions/%d/product/id", i), w)
+			return
 		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 			w.WriteHeader(499) // client closed request
 			return
@@ -212,6 +234,11 @@ func (c *CartsAPI) StoreCart(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusGone) // 410
 	case errors.Is(err, controller.ErrLocked):
 		w.WriteHeader(http.StatusLocked) // 423
+	case errors.Is(err, controller.ErrConflict):
+		status := http.StatusConflict // 409
+		EncodeJSONResponse(map[string]string{
+			"message": fmt.Sprintf("The cart is not in %s. Its currency cannot be changed.", currency),
+		}, &status, w)
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 	case err == nil:
@@ -228,27 +255,51 @@ func (c *CartsAPI) StoreCart(w http.ResponseWriter, r *http.Request) {
 func convertCartOut(cart *model.Cart) *Cart {
 	return &Cart{
 		ID:        cart.ID,
-		Positions: convertPositionsOut(cart.Positions),
+		Positions: convertPositionsOut(cart.Positions, cart.Currency),
+		Currency:  string(cart.Currency),
 		Locked:    cart.Locked,
 	}
 }
 
-func convertPositionsOut(positions []model.Position) []Position {
+// converts the positions with their prices in the currency
+func convertPositionsOut(positions []model.Position, currency model.Currency) []Position {
+	money := func(amount int) string {
+		return model.Money{Amount: amount, Currency: currency}.String()
+	}
 	out := make([]Position, len(positions))
 	for i, position := range positions {
 		out[i].Quantity = int32(position.Quantity)
-		out[i].Price = float32(position.Price) / 100
-		out[i].SavedPrice = float32(position.SavedPrice) / 100
+		out[i].Price = money(position.Price)
+		if position.SavedPrice != 0 {
+			out[i].SavedPrice = money(position.SavedPrice)
+		}
 		switch {
 		case position.Product != nil:
 			out[i].Product.ID = position.ProductID
 			if position.Product != nil {
 				out[i].Product.Name = position.Product.Name
-				out[i].Product.Price = float32(position.Product.Price) / 100
+				out[i].Product.Price = money(position.Product.Price)
 			}
 		case position.Coupon != nil:
 			out[i].Product.Name = position.Coupon.Name
-			out[i].Product.Price = out[i].Price / float32(out[i].Quantity)
+			out[i].Product.Price = money(position.Price / position.Quantity)
+		case position.Shipping != nil:
+			out[i].Product.Name = position.Shipping.Name
+			out[i].Product.Price = money(position.Price)
+			out[i].ShippingMethod = position.Shipping.ID
+		case position.Tax != nil:
+			out[i].Product.Name = "VAT " + tax.FormatRate(position.Tax.Rate) + "%"
+			if position.Tax.Included {
+				out[i].Product.Name = "incl. " + out[i].Product.Name
+			}
+			out[i].Product.Price = money(position.Price)
+			out[i].Tax = &Tax{
+				Class:    position.Tax.Class,
+				Rate:     tax.FormatRate(position.Tax.Rate),
+				Net:      money(position.Tax.Net),
+				Amount:   money(position.Tax.Amount),
+				Included: position.Tax.Included,
+			}
 		}
 	}
 	return out
@@ -0,0 +1,106 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Teelevision/excommerce/authentication"
+	"github.com/Teelevision/excommerce/controller"
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/persistence/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUserID    = "7b2a3d52-1c67-4a6c-9b3e-6d0d5c0c1f11"
+	testProductID = "3f0e0a7e-8a2c-4d0f-9b61-2f5b3c1d4e21"
+)
+
+// returns a handler of the carts api with a user that can log in with basic
+// auth and a product with a price in EUR and USD
+func newCartsTestHandler(t *testing.T) http.Handler {
+	ctx := context.Background()
+	repo := inmemory.NewAdapter(inmemory.FastLessSecureHashingForTesting())
+	require.NoError(t, repo.CreateUser(ctx, testUserID, "test", "password"))
+	require.NoError(t, repo.CreateProduct(ctx, testProductID, persistence.ProductAttributes{
+		Name:   "Apple",
+		Price:  49,
+		Prices: map[model.Currency]int{"USD": 55},
+	}))
+
+	authenticator := &authentication.Authenticator{
+		UserRepository:    repo,
+		SessionRepository: repo,
+		BasicAuth:         true,
+	}
+	return NewRouter(&CartsAPI{
+		Authenticator: authenticator,
+		CartController: &controller.Cart{
+			CartRepository:      repo,
+			ProductRepository:   repo,
+			PromotionRepository: repo,
+		},
+		ProductController: &controller.Product{
+			ProductRepository:   repo,
+			PromotionRepository: repo,
+		},
+	})
+}
+
+// sends the request as the test user and returns the status and the cart of
+// the response
+func doCartRequest(t *testing.T, handler http.Handler, method, target, body string) (int, *Cart) {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.SetBasicAuth(testUserID, "password")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	var cart Cart
+	if w.Code < 300 {
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&cart))
+	}
+	return w.Code, &cart
+}
+
+func TestStoreCartCurrency(t *testing.T) {
+	handler := newCartsTestHandler(t)
+	const cartID = "c6a1e7d4-5b0f-4e8a-8f3c-1a2b3c4d5e6f"
+	path := "/beta/carts/" + cartID
+	body := func(quantity int) string {
+		return `{"id":"` + cartID + `","positions":[{"quantity":` + strconv.Itoa(quantity) +
+			`,"product":{"id":"` + testProductID + `"}}]}`
+	}
+
+	status, cart := doCartRequest(t, handler, http.MethodPut, path+"?currency=USD", body(1))
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "USD", cart.Currency)
+	assert.Equal(t, "0.55", cart.Positions[0].Price)
+
+	// updates without the currency keep the currency of the cart
+	status, cart = doCartRequest(t, handler, http.MethodPut, path, body(2))
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "USD", cart.Currency)
+	assert.Equal(t, "1.10", cart.Positions[0].Price)
+
+	// the currency of the cart cannot be changed
+	status, _ = doCartRequest(t, handler, http.MethodPut, path+"?currency=EUR", body(3))
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, cart = doCartRequest(t, handler, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "USD", cart.Currency)
+	assert.Equal(t, int32(2), cart.Positions[0].Quantity)
+
+	// new carts without the currency are in the default currency
+	const otherCartID = "0d9c8b7a-6f5e-4d3c-8b2a-1f0e9d8c7b6a"
+	status, cart = doCartRequest(t, handler, http.MethodPut, "/beta/carts/"+otherCartID,
+		`{"id":"`+otherCartID+`","positions":[]}`)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, string(model.DefaultCurrency), cart.Currency)
+}
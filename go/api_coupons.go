@@ -0,0 +1,508 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Teelevision/excommerce/authentication"
+	"github.com/Teelevision/excommerce/controller"
+	"github.com/Teelevision/excommerce/model"
+	"github.com/gorilla/mux"
+)
+
+var _ Router = (*CouponsAPI)(nil)
+
+// A CouponsAPI binds http requests to an api service and writes the service results to the http response
+type CouponsAPI struct {
+	Authenticator     *authentication.Authenticator
+	ProductController *controller.Product
+}
+
+// Routes returns all of the api route for the CouponsApiController
+func (c *CouponsAPI) Routes() Routes {
+	return Routes{
+		{
+			Name:        "DeleteCoupon",
+			Method:      "DELETE",
+			Path:        "/beta/coupons/{couponCode}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.DeleteCoupon)),
+		},
+		{
+			// before GetCoupon, so that export is not taken for a code
+			Name:        "ExportCoupons",
+			Method:      "GET",
+			Path:        "/beta/coupons/export",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.ExportCoupons)),
+		},
+		{
+			Name:        "GenerateCoupons",
+			Method:      "POST",
+			Path:        "/beta/coupons/generate",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.GenerateCoupons)),
+		},
+		{
+			Name:        "GetAllCoupons",
+			Method:      "GET",
+			Path:        "/beta/coupons",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.GetAllCoupons)),
+		},
+		{
+			Name:        "GetCoupon",
+			Method:      "GET",
+			Path:        "/beta/coupons/{couponCode}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.GetCoupon)),
+		},
+		{
+			Name:        "ImportCoupons",
+			Method:      "POST",
+			Path:        "/beta/coupons/import",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.ImportCoupons)),
+		},
+		{
+			Name:        "StoreCoupon",
+			Method:      "PUT",
+			Path:        "/beta/coupons/{couponCode}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.StoreCoupon)),
+		},
+	}
+}
+
+// DeleteCoupon - Delete a cart coupon
+func (c *CouponsAPI) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	couponCode := strings.ToLower(mux.Vars(r)["couponCode"])
+
+	// action
+	err := c.ProductController.DeleteCouponOfProduct(r.Context(), "", couponCode)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		panic(err)
+	}
+}
+
+// GetAllCoupons - Get all cart coupons
+func (c *CouponsAPI) GetAllCoupons(w http.ResponseWriter, r *http.Request) {
+	// input
+	active, expired, ok := decodeExpiredQuery(w, r)
+	if !ok {
+		return
+	}
+
+	// action
+	coupons, err := c.ProductController.GetCouponsOfProduct(r.Context(), "", active, expired)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		out := make([]*Coupon, len(coupons))
+		for i, coupon := range coupons {
+			out[i] = convertCouponOut(coupon, nil)
+		}
+		EncodeJSONResponse(out, nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// GetCoupon - Get a cart coupon
+func (c *CouponsAPI) GetCoupon(w http.ResponseWriter, r *http.Request) {
+	couponCode := strings.ToLower(mux.Vars(r)["couponCode"])
+
+	// action
+	coupon, err := c.ProductController.GetCouponOfProduct(r.Context(), "", couponCode)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertCouponOut(coupon, nil), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// StoreCoupon - Create cart coupon
+func (c *CouponsAPI) StoreCoupon(w http.ResponseWriter, r *http.Request) {
+	// input
+	couponInput, ok := decodeCoupon(w, r)
+	if !ok {
+		return
+	}
+	if couponInput.Code == "export" {
+		invalidInput("The coupon code export is reserved.", "", w)
+		return
+	}
+
+	// action
+	coupon, err := c.ProductController.SaveCoupon(r.Context(), couponInput)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertCouponOut(coupon, nil), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// the maximum number of coupons that can be generated or imported at once
+const maxCouponBatch = 10000
+
+// the minimum number of random runes of generated codes
+const minRandomCouponCodeLength = 4
+
+var couponPrefixPattern = regexp.MustCompile(`^[a-z0-9-]*$`)
+
+// GenerateCoupons - Generate coupons with random codes
+func (c *CouponsAPI) GenerateCoupons(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	input := &CouponBatch{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+	prefix := strings.ToLower(input.Prefix)
+
+	// validation
+	if !couponPrefixPattern.MatchString(prefix) {
+		failValidation("The prefix may only consist of letters, digits and hyphens.", "/prefix", w)
+		return
+	}
+	if input.Length < 6 || input.Length > 40 {
+		failValidation("The length must be any integer from 6 to 40.", "/length", w)
+		return
+	}
+	if int(input.Length)-len(prefix) < minRandomCouponCodeLength {
+		failValidation(fmt.Sprintf("The length must leave room for at least %d runes after the prefix.",
+			minRandomCouponCodeLength), "/length", w)
+		return
+	}
+	if input.Count < 1 || input.Count > maxCouponBatch {
+		failValidation(fmt.Sprintf("The count must be any integer from 1 to %d.", maxCouponBatch), "/count", w)
+		return
+	}
+	if input.ProductID != "" && !uuidPattern.MatchString(input.ProductID) {
+		failValidation("The productId is not a UUID.", "/productId", w)
+		return
+	}
+	couponInput, ok := convertCouponIn(w, "", &input.Coupon, "/coupon")
+	if !ok {
+		return
+	}
+
+	// load product
+	if input.ProductID != "" {
+		products := make(map[string]*model.Product)
+		if couponInput.Product, ok = c.loadProduct(w, r, products, input.ProductID, "/productId"); !ok {
+			return
+		}
+	}
+
+	// action
+	coupons, err := c.ProductController.GenerateCoupons(ctx, couponInput, prefix, int(input.Length), int(input.Count))
+	switch {
+	case errors.Is(err, controller.ErrConflict):
+		status := http.StatusConflict // 409
+		EncodeJSONResponse(map[string]string{
+			"message": "Not enough unused codes were found. Use a longer length.",
+		}, &status, w)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		out := make([]*Coupon, len(coupons))
+		for i, coupon := range coupons {
+			out[i] = convertCouponOut(coupon, coupon.Product)
+		}
+		status := http.StatusCreated // 201
+		EncodeJSONResponse(out, &status, w)
+	default:
+		panic(err)
+	}
+}
+
+// the columns of the CSV import and export of coupons
+var couponCSVHeader = []string{
+	"code", "productId", "name", "discount", "amount", "minSubtotal",
+	"maxRedemptions", "maxRedemptionsPerUser", "notBefore", "expiresAt",
+	"redemptions", "status",
+}
+
+// ExportCoupons - Export all coupons as CSV
+func (c *CouponsAPI) ExportCoupons(w http.ResponseWriter, r *http.Request) {
+	// action
+	coupons, err := c.ProductController.GetAllCoupons(r.Context())
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+		return
+	case err == nil:
+	default:
+		panic(err)
+	}
+
+	// output
+	w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="coupons.csv"`)
+	w.WriteHeader(http.StatusOK)
+	now := time.Now()
+	out := csv.NewWriter(w)
+	_ = out.Write(couponCSVHeader)
+	for _, coupon := range coupons {
+		var notBefore string
+		if !coupon.NotBefore.IsZero() {
+			notBefore = coupon.NotBefore.UTC().Truncate(time.Second).Format(time.RFC3339)
+		}
+		_ = out.Write([]string{
+			escapeCSVFormula(coupon.Code),
+			coupon.ProductID,
+			escapeCSVFormula(coupon.Name),
+			strconv.Itoa(coupon.Discount),
+			model.Money{Amount: coupon.Amount, Currency: model.DefaultCurrency}.String(),
+			model.Money{Amount: coupon.MinSubtotal, Currency: model.DefaultCurrency}.String(),
+			strconv.Itoa(coupon.MaxRedemptions),
+			strconv.Itoa(coupon.MaxRedemptionsPerUser),
+			notBefore,
+			coupon.ExpiresAt.UTC().Truncate(time.Second).Format(time.RFC3339),
+			strconv.Itoa(coupon.Redemptions),
+			couponStatus(coupon, now),
+		})
+	}
+	out.Flush()
+}
+
+// the first characters of values that spreadsheets run as formulas
+const csvFormulaStart = "=+-@\t\r"
+
+// Prefixes values that spreadsheets would run as formulas with a quote, so
+// that exported values cannot inject formulas.
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaStart, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Reverses escapeCSVFormula, so that exported coupons can be imported again.
+func unescapeCSVFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaStart, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// Returns the redemption status of the coupon. It is usedUp if the coupon
+// reached its maximum redemptions, otherwise expired, scheduled or active
+// depending on the time.
+func couponStatus(coupon *model.Coupon, now time.Time) string {
+	switch {
+	case coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions:
+		return "usedUp"
+	case coupon.ExpiresAt.Before(now):
+		return "expired"
+	case coupon.NotBefore.After(now):
+		return "scheduled"
+	default:
+		return "active"
+	}
+}
+
+// ImportCoupons - Import coupons from CSV
+func (c *CouponsAPI) ImportCoupons(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	in := csv.NewReader(r.Body)
+	in.FieldsPerRecord = -1 // checked below with a better message
+	header, err := in.Read()
+	if err == io.EOF {
+		invalidInput("The CSV is empty.", "The first line must name the columns.", w)
+		return
+	} else if err != nil {
+		invalidInput("The CSV is malformed.", err.Error(), w)
+		return
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		known := false
+		for _, column := range couponCSVHeader {
+			known = known || name == column
+		}
+		if !known {
+			failValidation(fmt.Sprintf("The column %q is unknown.", name), fmt.Sprintf("/1/%s", name), w)
+			return
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"code", "name"} {
+		if _, ok := columns[name]; !ok {
+			failValidation(fmt.Sprintf("The column %q is missing.", name), "/1", w)
+			return
+		}
+	}
+
+	// validation
+	var coupons []*model.Coupon
+	codes := make(map[string]bool)
+	products := make(map[string]*model.Product)
+	for line := 2; ; line++ {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			invalidInput("The CSV is malformed.", err.Error(), w)
+			return
+		}
+		pointer := fmt.Sprintf("/%d", line)
+		if len(record) != len(header) {
+			failValidation(fmt.Sprintf("Line %d must have %d fields.", line, len(header)), pointer, w)
+			return
+		}
+		if len(coupons) == maxCouponBatch {
+			failValidation(fmt.Sprintf("At most %d coupons can be imported at once.", maxCouponBatch), pointer, w)
+			return
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return record[i]
+			}
+			return ""
+		}
+
+		code := strings.ToLower(unescapeCSVFormula(field("code")))
+		if l := utf8.RuneCountInString(code); l < 6 || l > 40 {
+			failValidation("The coupon code must be 6 to 40 characters long.", pointer+"/code", w)
+			return
+		}
+		if codes[code] {
+			failValidation(fmt.Sprintf("The coupon %q cannot be imported twice.", code), pointer+"/code", w)
+			return
+		}
+		codes[code] = true
+
+		input := Coupon{
+			Name:        unescapeCSVFormula(field("name")),
+			Amount:      field("amount"),
+			MinSubtotal: field("minSubtotal"),
+		}
+		for _, f := range []struct {
+			name   string
+			target *int32
+		}{
+			{"discount", &input.Discount},
+			{"maxRedemptions", &input.MaxRedemptions},
+			{"maxRedemptionsPerUser", &input.MaxRedemptionsPerUser},
+		} {
+			if value := field(f.name); value != "" {
+				i, err := strconv.ParseInt(value, 10, 32)
+				if err != nil {
+					failValidation(fmt.Sprintf("The %s must be an integer.", f.name), pointer+"/"+f.name, w)
+					return
+				}
+				*f.target = int32(i)
+			}
+		}
+		var notBefore time.Time
+		for _, f := range []struct {
+			name   string
+			target *time.Time
+		}{
+			{"notBefore", &notBefore},
+			{"expiresAt", &input.ExpiresAt},
+		} {
+			if value := field(f.name); value != "" {
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					failValidation(fmt.Sprintf("The %s must be a time like %s.", f.name, time.RFC3339),
+						pointer+"/"+f.name, w)
+					return
+				}
+				*f.target = t
+			}
+		}
+		if !notBefore.IsZero() {
+			input.NotBefore = &notBefore
+		}
+		coupon, ok := convertCouponIn(w, code, &input, pointer)
+		if !ok {
+			return
+		}
+		if productID := field("productId"); productID != "" {
+			if !uuidPattern.MatchString(productID) {
+				failValidation("The productId is not a UUID.", pointer+"/productId", w)
+				return
+			}
+			if coupon.Product, ok = c.loadProduct(w, r, products, productID, pointer+"/productId"); !ok {
+				return
+			}
+		}
+		coupons = append(coupons, coupon)
+	}
+
+	// action
+	out := make([]*Coupon, len(coupons))
+	for i, coupon := range coupons {
+		coupon, err := c.ProductController.SaveCoupon(ctx, coupon)
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			w.WriteHeader(499) // client closed request
+			return
+		case err == nil:
+			out[i] = convertCouponOut(coupon, coupon.Product)
+		default:
+			panic(err)
+		}
+	}
+	EncodeJSONResponse(out, nil, w)
+}
+
+// loads the product with the given id into the cache of products, writes a
+// validation error at the pointer and returns false if it cannot be loaded
+func (c *CouponsAPI) loadProduct(w http.ResponseWriter, r *http.Request, products map[string]*model.Product, productID, pointer string) (*model.Product, bool) {
+	if product, ok := products[productID]; ok {
+		return product, true
+	}
+	product, err := c.ProductController.Get(r.Context(), productID, model.DefaultCurrency)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		failValidation(fmt.Sprintf("The product %q does not exist.", productID), pointer, w)
+		return nil, false
+	case errors.Is(err, controller.ErrDeleted):
+		failValidation(fmt.Sprintf("The product %q is deleted.", productID), pointer, w)
+		return nil, false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+		return nil, false
+	case err == nil:
+		products[productID] = product
+		return product, true
+	default:
+		panic(err)
+	}
+}
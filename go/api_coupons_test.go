@@ -0,0 +1,38 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeCSVFormula(t *testing.T) {
+	for _, tt := range []struct {
+		value, want string
+	}{
+		{"", ""},
+		{"summer-sale", "summer-sale"},
+		{"'quoted", "'quoted"},
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1+1", "'\t=1+1"},
+		{"\r=1+1", "'\r=1+1"},
+	} {
+		escaped := escapeCSVFormula(tt.value)
+		assert.Equal(t, tt.want, escaped, "%q", tt.value)
+
+		// round trip through a CSV file
+		var buf bytes.Buffer
+		out := csv.NewWriter(&buf)
+		require.NoError(t, out.Write([]string{escaped, "name"}))
+		out.Flush()
+		record, err := csv.NewReader(&buf).Read()
+		require.NoError(t, err)
+		assert.Equal(t, tt.value, unescapeCSVFormula(record[0]), "%q", tt.value)
+	}
+}
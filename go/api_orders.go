@@ -14,7 +14,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"unicode/utf8"
 
@@ -44,6 +46,24 @@ func (c *OrdersAPI) Routes() Routes {
 			Path:        "/beta/carts/{cartId}/prepareOrder",
 			HandlerFunc: c.Authenticator.HandlerFunc(c.CreateOrderFromCart),
 		},
+		{
+			Name:        "GetAllOrders",
+			Method:      "GET",
+			Path:        "/beta/orders",
+			HandlerFunc: c.Authenticator.HandlerFunc(c.GetAllOrders),
+		},
+		{
+			Name:        "GetOrder",
+			Method:      "GET",
+			Path:        "/beta/orders/{orderId}",
+			HandlerFunc: c.Authenticator.HandlerFunc(c.GetOrder),
+		},
+		{
+			Name:        "ChangeOrderStatus",
+			Method:      "PUT",
+			Path:        "/beta/orders/{orderId}/status",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageOrders, c.ChangeOrderStatus)),
+		},
 		{
 			Name:        "PlaceOrder",
 			Method:      "POST",
@@ -53,6 +73,53 @@ func (c *OrdersAPI) Routes() Routes {
 	}
 }
 
+// ChangeOrderStatus - Change the status of a placed order
+func (c *OrdersAPI) ChangeOrderStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	orderID := params["orderId"]
+	if !uuidPattern.Match([]byte(orderID)) {
+		invalidInput("The orderId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+	input := &OrderStatusChange{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+
+	// validation
+	switch status := model.OrderStatus(input.Status); status {
+	case model.OrderStatusPaid, model.OrderStatusPacked, model.OrderStatusShipped,
+		model.OrderStatusDelivered, model.OrderStatusCancelled, model.OrderStatusRefunded:
+		// valid target
+	default:
+		failValidation(fmt.Sprintf("The status must be one of %q, %q, %q, %q, %q or %q.",
+			model.OrderStatusPaid, model.OrderStatusPacked, model.OrderStatusShipped,
+			model.OrderStatusDelivered, model.OrderStatusCancelled, model.OrderStatusRefunded), "/status", w)
+		return
+	}
+
+	// action
+	order, err := c.OrderController.ChangeStatus(ctx, orderID, model.OrderStatus(input.Status))
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, controller.ErrInvalidTransition), errors.Is(err, controller.ErrConflict):
+		w.WriteHeader(http.StatusConflict) // 409
+	case errors.Is(err, controller.ErrPaymentFailed):
+		w.WriteHeader(http.StatusBadGateway) // 502
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertOrderOut(order), nil, w)
+	default:
+		panic(err)
+	}
+}
+
 // CreateOrderFromCart - Create order from cart
 func (c *OrdersAPI) CreateOrderFromCart(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -69,6 +136,11 @@ func (c *OrdersAPI) CreateOrderFromCart(w http.ResponseWriter, r *http.Request)
 		invalidJSON(err, w)
 		return
 	}
+	currency := model.Currency(input.Currency)
+	if currency != "" && !currency.Valid() {
+		failValidation(fmt.Sprintf("The currency %q is not supported.", input.Currency), "/currency", w)
+		return
+	}
 	// convert coupons to lower case
 	for i, code := range input.Coupons {
 		input.Coupons[i] = strings.ToLower(code)
@@ -117,6 +189,10 @@ func (c *OrdersAPI) CreateOrderFromCart(w http.ResponseWriter, r *http.Request)
 			return
 		}
 	}
+	if l := utf8.RuneCountInString(input.ShippingMethod); l > 100 {
+		failValidation("The shipping method must be at most 100 characters long.", "/shippingMethod", w)
+		return
+	}
 	uniqueCoupons := make(map[string]interface{}, len(input.Coupons))
 	for i, code := range input.Coupons {
 		if _, exists := uniqueCoupons[code]; exists {
@@ -133,6 +209,8 @@ func (c *OrdersAPI) CreateOrderFromCart(w http.ResponseWriter, r *http.Request)
 		Buyer:     model.Address(input.Buyer),
 		Recipient: model.Address(input.Recipient),
 		Coupons:   make([]*model.Coupon, len(input.Coupons)),
+
+		ShippingMethodID: input.ShippingMethod,
 	}
 	// load cart
 	cart, err := c.CartController.Get(ctx, cartID)
@@ -152,8 +230,12 @@ func (c *OrdersAPI) CreateOrderFromCart(w http.ResponseWriter, r *http.Request)
 	case err == nil && cart.Locked:
 		w.WriteHeader(http.StatusLocked) // 423
 		return
+	case err == nil && currency != "" && currency != cart.Currency:
+		failValidation(fmt.Sprintf("The currency must be the currency of the cart, %s.", cart.Currency), "/currency", w)
+		return
 	case err == nil:
 		orderInput.Cart = cart
+		orderInput.Currency = cart.Currency
 	default:
 		panic(err)
 	}
@@ -177,11 +259,79 @@ func (c *OrdersAPI) CreateOrderFromCart(w http.ResponseWriter, r *http.Request)
 
 	// action
 	order, err := c.OrderController.CreateAndGet(ctx, &orderInput)
+	var couponErr *controller.CouponError
 	switch {
+	case errors.As(err, &couponErr):
+		for i, code := range input.Coupons {
+			if code == couponErr.Code {
+				failValidation(fmt.Sprintf("The coupon %q %s.", code, couponErr.Reason),
+					fmt.Sprintf("/coupons/%d", i), w)
+			}
+		}
+	case errors.Is(err, controller.ErrNoShipping) && input.ShippingMethod != "":
+		failValidation(fmt.Sprintf("The shipping method %q is not available for this order.", input.ShippingMethod),
+			"/shippingMethod", w)
+	case errors.Is(err, controller.ErrNoShipping):
+		failValidation("No shipping method is available for this order.", "/shippingMethod", w)
+	case errors.Is(err, controller.ErrOutOfStock):
+		status := http.StatusConflict // 409
+		EncodeJSONResponse(map[string]string{
+			"message": "Not enough items of a product are in stock.",
+		}, &status, w)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertOrderOut(order), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// GetAllOrders - Get all placed orders
+func (c *OrdersAPI) GetAllOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := c.OrderController.GetAllPlaced(r.Context())
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		// newest first
+		sort.Slice(orders, func(i, j int) bool {
+			if !orders[i].PlacedAt.Equal(orders[j].PlacedAt) {
+				return orders[i].PlacedAt.After(orders[j].PlacedAt)
+			}
+			return orders[i].ID < orders[j].ID
+		})
+		result := make([]*Order, len(orders))
+		for i, order := range orders {
+			result[i] = convertOrderOut(order)
+		}
+		EncodeJSONResponse(result, nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// GetOrder - Get a placed order
+func (c *OrdersAPI) GetOrder(w http.ResponseWriter, r *http.Request) {
+	// validation
+	params := mux.Vars(r)
+	orderID := params["orderId"]
+	if !uuidPattern.Match([]byte(orderID)) {
+		invalidInput("The orderId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+
+	// action
+	order, err := c.OrderController.GetPlaced(r.Context(), orderID)
+	switch {
+	case errors.Is(err, controller.ErrForbidden):
+		w.WriteHeader(http.StatusForbidden) // 403
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 	case err == nil:
-		EncodeJSONResponse(convertOrderOut(order, "valid"), nil, w)
+		EncodeJSONResponse(convertOrderOut(order), nil, w)
 	default:
 		panic(err)
 	}
@@ -196,10 +346,23 @@ func (c *OrdersAPI) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		invalidInput("The orderId of the path is not a UUID.", uuidPattern.String(), w)
 		return
 	}
+	input := &PlaceOrderForm{} // the body is optional
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		invalidJSON(err, w)
+		return
+	}
+	if l := utf8.RuneCountInString(input.PaymentSource); l > 1000 {
+		failValidation("The payment source must be at most 1000 characters long.", "/paymentSource", w)
+		return
+	}
 
 	// action
-	order, err := c.OrderController.Place(r.Context(), orderID)
+	order, err := c.OrderController.Place(r.Context(), orderID, input.PaymentSource)
 	switch {
+	case errors.Is(err, controller.ErrPaymentDeclined):
+		w.WriteHeader(http.StatusPaymentRequired) // 402
+	case errors.Is(err, controller.ErrPaymentFailed):
+		w.WriteHeader(http.StatusBadGateway) // 502
 	case errors.Is(err, controller.ErrForbidden):
 		w.WriteHeader(http.StatusForbidden) // 403
 	case errors.Is(err, controller.ErrNotFound):
@@ -211,24 +374,44 @@ func (c *OrdersAPI) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 	case err == nil:
-		EncodeJSONResponse(convertOrderOut(order, "placed"), nil, w)
+		EncodeJSONResponse(convertOrderOut(order), nil, w)
 	default:
 		panic(err)
 	}
 }
 
-func convertOrderOut(order *model.Order, status string) *Order {
+func convertOrderOut(order *model.Order) *Order {
 	out := Order{
 		ID:        order.ID,
-		Status:    status,
-		Price:     float32(order.Price) / 100,
+		Status:    string(order.Status),
+		Currency:  string(order.Currency),
+		Price:     model.Money{Amount: order.Price, Currency: order.Currency}.String(),
 		Buyer:     Address(order.Buyer),
 		Recipient: Address(order.Recipient),
 		Coupons:   make([]string, len(order.Coupons)),
-		Positions: convertPositionsOut(order.Positions),
+		Positions: convertPositionsOut(order.Positions, order.Currency),
+
+		ShippingMethod: order.ShippingMethodID,
 	}
 	for i, coupon := range order.Coupons {
 		out.Coupons[i] = coupon.Code
 	}
+	for _, method := range order.ShippingMethods {
+		out.ShippingMethods = append(out.ShippingMethods, ShippingMethod{
+			ID:    method.ID,
+			Name:  method.Name,
+			Price: model.Money{Amount: method.Price, Currency: order.Currency}.String(),
+		})
+	}
+	if !order.PlacedAt.IsZero() {
+		placedAt := order.PlacedAt.UTC()
+		out.PlacedAt = &placedAt
+	}
+	for _, change := range order.StatusHistory {
+		out.StatusHistory = append(out.StatusHistory, OrderStatusChange{
+			Status:    string(change.Status),
+			ChangedAt: change.ChangedAt.UTC(),
+		})
+	}
 	return &out
 }
@@ -11,9 +11,14 @@ package openapi
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -21,6 +26,7 @@ import (
 	"github.com/Teelevision/excommerce/authentication"
 	"github.com/Teelevision/excommerce/controller"
 	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/tax"
 	"github.com/gorilla/mux"
 )
 
@@ -30,38 +36,439 @@ var _ Router = (*ProductsAPI)(nil)
 type ProductsAPI struct {
 	Authenticator     *authentication.Authenticator
 	ProductController *controller.Product
+	TaxRates          *tax.Rates // to validate the tax classes, may be nil
 }
 
 // Routes returns all of the api route for the ProductsApiController
 func (c *ProductsAPI) Routes() Routes {
 	return Routes{
+		{
+			Name:        "CreateProduct",
+			Method:      "POST",
+			Path:        "/beta/products/{productId}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageProducts, c.CreateProduct)),
+		},
+		{
+			Name:        "DeleteProduct",
+			Method:      "DELETE",
+			Path:        "/beta/products/{productId}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageProducts, c.DeleteProduct)),
+		},
 		{
 			Name:        "GetAllProducts",
 			Method:      "GET",
 			Path:        "/beta/products",
 			HandlerFunc: c.GetAllProducts,
 		},
+		{
+			Name:        "AdjustProductStock",
+			Method:      "POST",
+			Path:        "/beta/products/{productId}/stock/adjustments",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageProducts, c.AdjustProductStock)),
+		},
+		{
+			Name:        "DeleteProductStock",
+			Method:      "DELETE",
+			Path:        "/beta/products/{productId}/stock",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageProducts, c.DeleteProductStock)),
+		},
+		{
+			Name:        "GetProductStock",
+			Method:      "GET",
+			Path:        "/beta/products/{productId}/stock",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageProducts, c.GetProductStock)),
+		},
+		{
+			Name:        "SetProductStock",
+			Method:      "PUT",
+			Path:        "/beta/products/{productId}/stock",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageProducts, c.SetProductStock)),
+		},
+		{
+			Name:        "GetAllCouponsOfProduct",
+			Method:      "GET",
+			Path:        "/beta/products/{productId}/coupons",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.GetAllCouponsOfProduct)),
+		},
+		{
+			Name:        "GetCouponOfProduct",
+			Method:      "GET",
+			Path:        "/beta/products/{productId}/coupons/{couponCode}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.GetCouponOfProduct)),
+		},
+		{
+			Name:        "DeleteCouponOfProduct",
+			Method:      "DELETE",
+			Path:        "/beta/products/{productId}/coupons/{couponCode}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.DeleteCouponOfProduct)),
+		},
 		{
 			Name:        "StoreCouponForProduct",
 			Method:      "PUT",
 			Path:        "/beta/products/{productId}/coupons/{couponCode}",
-			HandlerFunc: c.Authenticator.HandlerFunc(c.StoreCouponForProduct),
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageCoupons, c.StoreCouponForProduct)),
+		},
+		{
+			Name:        "UpdateProduct",
+			Method:      "PUT",
+			Path:        "/beta/products/{productId}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageProducts, c.UpdateProduct)),
 		},
 	}
 }
 
+// CreateProduct - Create a product
+func (c *ProductsAPI) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	productInput, ok := decodeProduct(w, r, c.TaxRates)
+	if !ok {
+		return
+	}
+
+	// action
+	product, err := c.ProductController.Create(ctx, productInput)
+	switch {
+	case errors.Is(err, controller.ErrConflict):
+		w.WriteHeader(http.StatusConflict) // 409
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		status := http.StatusCreated // 201
+		EncodeJSONResponse(convertProductOut(product, model.DefaultCurrency), &status, w)
+	default:
+		panic(err)
+	}
+}
+
+// UpdateProduct - Update a product
+func (c *ProductsAPI) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	productInput, ok := decodeProduct(w, r, c.TaxRates)
+	if !ok {
+		return
+	}
+
+	// action
+	product, err := c.ProductController.Update(ctx, productInput)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, controller.ErrDeleted):
+		w.WriteHeader(http.StatusGone) // 410
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertProductOut(product, model.DefaultCurrency), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// DeleteProduct - Delete a product
+func (c *ProductsAPI) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// validation
+	params := mux.Vars(r)
+	productID := params["productId"]
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+
+	// action
+	err := c.ProductController.Delete(ctx, productID)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, controller.ErrDeleted):
+		w.WriteHeader(http.StatusGone) // 410
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		panic(err)
+	}
+}
+
+// decodes and validates the product of the request and converts it to the
+// internal model, the tax class must be known by the rates; returns false if
+// the request is invalid
+func decodeProduct(w http.ResponseWriter, r *http.Request, taxRates *tax.Rates) (*model.Product, bool) {
+	// input
+	params := mux.Vars(r)
+	productID := params["productId"]
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
+		return nil, false
+	}
+	input := &Product{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
+		return nil, false
+	}
+
+	// validation
+	if input.ID != "" && input.ID != productID {
+		failValidation("The id must match the productId of the path.", "/id", w)
+		return nil, false
+	}
+	if l := utf8.RuneCountInString(input.Name); l < 1 || l > 100 {
+		failValidation("The name must be 1 to 100 characters long.", "/name", w)
+		return nil, false
+	}
+	if input.Currency != "" && input.Currency != string(model.DefaultCurrency) {
+		failValidation(fmt.Sprintf("The currency must be %s. Prices in other currencies go into the prices.",
+			model.DefaultCurrency), "/currency", w)
+		return nil, false
+	}
+	price, ok := parseAmount(input.Price, model.DefaultCurrency)
+	if !ok {
+		failValidation("The price must be any amount from 0 to 1000000 with at most 2 decimal places.", "/price", w)
+		return nil, false
+	}
+	var prices map[model.Currency]int
+	for code, value := range input.Prices {
+		pointer := "/prices/" + jsonPointerEscaper.Replace(code)
+		currency := model.Currency(code)
+		if !currency.Valid() || currency == model.DefaultCurrency {
+			failValidation(fmt.Sprintf("The currency %q is unknown or the default one.", code), pointer, w)
+			return nil, false
+		}
+		price, ok := parseAmount(value, currency)
+		if !ok {
+			failValidation(fmt.Sprintf("The price must be any amount from 0 to 1000000 with at most %d decimal places.",
+				currency.Digits()), pointer, w)
+			return nil, false
+		}
+		if prices == nil {
+			prices = make(map[model.Currency]int, len(input.Prices))
+		}
+		prices[currency] = price
+	}
+	if !taxRates.HasClass(input.TaxClass) {
+		failValidation(fmt.Sprintf("The tax class %q is unknown.", input.TaxClass), "/taxClass", w)
+		return nil, false
+	}
+	if input.Weight < 0 || input.Weight > 1000000 {
+		failValidation("The weight must be 0 to 1000000 grams.", "/weight", w)
+		return nil, false
+	}
+	if l := utf8.RuneCountInString(input.Description); l > 10000 {
+		failValidation("The description must be at most 10000 characters long.", "/description", w)
+		return nil, false
+	}
+	if l := utf8.RuneCountInString(input.SKU); l > 100 {
+		failValidation("The sku must be at most 100 characters long.", "/sku", w)
+		return nil, false
+	}
+	if len(input.Categories) > 20 {
+		failValidation("There must be at most 20 categories.", "/categories", w)
+		return nil, false
+	}
+	uniqueCategories := make(map[string]interface{}, len(input.Categories))
+	for i, category := range input.Categories {
+		if l := utf8.RuneCountInString(category); l < 1 || l > 100 {
+			failValidation("The category must be 1 to 100 characters long.", fmt.Sprintf("/categories/%d", i), w)
+			return nil, false
+		}
+		if _, exists := uniqueCategories[category]; exists {
+			failValidation(fmt.Sprintf("The category %q cannot be used twice.", category),
+				fmt.Sprintf("/categories/%d", i), w)
+			return nil, false
+		}
+		uniqueCategories[category] = nil
+	}
+	if len(input.Attributes) > 50 {
+		failValidation("There must be at most 50 attributes.", "/attributes", w)
+		return nil, false
+	}
+	for key, value := range input.Attributes {
+		pointer := "/attributes/" + jsonPointerEscaper.Replace(key)
+		if l := utf8.RuneCountInString(key); l < 1 || l > 100 {
+			failValidation("The attribute name must be 1 to 100 characters long.", pointer, w)
+			return nil, false
+		}
+		if l := utf8.RuneCountInString(value); l > 1000 {
+			failValidation("The attribute value must be at most 1000 characters long.", pointer, w)
+			return nil, false
+		}
+	}
+	if len(input.Images) > 20 {
+		failValidation("There must be at most 20 images.", "/images", w)
+		return nil, false
+	}
+	for i, image := range input.Images {
+		u, err := url.Parse(image.URL)
+		if l := utf8.RuneCountInString(image.URL); l < 1 || l > 2000 || err != nil ||
+			!(u.Scheme == "http" || u.Scheme == "https" || (u.Scheme == "" && u.Host == "" && path.IsAbs(u.Path))) {
+			failValidation("The url must be an absolute http(s) url or an absolute path of at most 2000 characters.",
+				fmt.Sprintf("/images/%d/url", i), w)
+			return nil, false
+		}
+		if l := utf8.RuneCountInString(image.Alt); l > 1000 {
+			failValidation("The alternative text must be at most 1000 characters long.", fmt.Sprintf("/images/%d/alt", i), w)
+			return nil, false
+		}
+	}
+
+	// convert to internal model
+	product := model.Product{
+		ID:          productID,
+		Name:        input.Name,
+		Price:       price,
+		Prices:      prices,
+		TaxClass:    input.TaxClass,
+		Weight:      int(input.Weight),
+		Description: input.Description,
+		SKU:         input.SKU,
+		Categories:  input.Categories,
+		Attributes:  input.Attributes,
+	}
+	for _, image := range input.Images {
+		product.Images = append(product.Images, model.Image(image))
+	}
+	return &product, true
+}
+
+// escapes reference tokens of JSON pointers (RFC 6901)
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// parses an amount of money in the currency, like 12.30, into its minor unit,
+// the empty string is zero; returns false if the amount is invalid, negative
+// or larger than 1000000
+func parseAmount(value string, currency model.Currency) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+	money, err := model.ParseMoney(value, currency)
+	limit := 1000000
+	for i := 0; i < currency.Digits(); i++ {
+		limit *= 10
+	}
+	if err != nil || money.Amount < 0 || money.Amount > limit {
+		return 0, false
+	}
+	return money.Amount, true
+}
+
+// parses the currency query parameter of the request, which defaults to
+// model.DefaultCurrency; returns false if the currency is not supported, in
+// which case the response is written
+func decodeCurrencyQuery(w http.ResponseWriter, r *http.Request) (model.Currency, bool) {
+	currency := model.Currency(r.URL.Query().Get("currency"))
+	switch {
+	case currency == "":
+		return model.DefaultCurrency, true
+	case !currency.Valid():
+		invalidInput("The currency is not supported.", string(currency), w)
+		return "", false
+	}
+	return currency, true
+}
+
 // GetAllProducts - Get all products
 func (c *ProductsAPI) GetAllProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := c.ProductController.GetAll(r.Context())
+	ctx := r.Context()
+
+	// input
+	params := r.URL.Query()
+	currency, ok := decodeCurrencyQuery(w, r)
+	if !ok {
+		return
+	}
+	query := controller.ProductQuery{
+		Search:     params.Get("q"),
+		Currency:   currency,
+		Categories: params["category"],
+		Sort:       model.ProductSort(params.Get("sort")),
+		Limit:      50,
+	}
+
+	// validation
+	if l := utf8.RuneCountInString(query.Search); l > 100 {
+		invalidInput("The search query must be at most 100 characters long.", "", w)
+		return
+	}
+	for _, p := range []struct {
+		name  string
+		price **int
+	}{
+		{"minPrice", &query.MinPrice},
+		{"maxPrice", &query.MaxPrice},
+	} {
+		value := params.Get(p.name)
+		if value == "" {
+			continue
+		}
+		price, ok := parseAmount(value, currency)
+		if !ok {
+			invalidInput(fmt.Sprintf("The %s must be any amount from 0 to 1000000.", p.name), value, w)
+			return
+		}
+		*p.price = &price
+	}
+	if len(query.Categories) > 20 {
+		invalidInput("There must be at most 20 categories.", "", w)
+		return
+	}
+	for _, category := range query.Categories {
+		if l := utf8.RuneCountInString(category); l < 1 || l > 100 {
+			invalidInput("The category must be 1 to 100 characters long.", category, w)
+			return
+		}
+	}
+	switch query.Sort {
+	case "":
+		query.Sort = model.ProductSortNameAsc
+	case model.ProductSortNameAsc, model.ProductSortNameDesc,
+		model.ProductSortPriceAsc, model.ProductSortPriceDesc:
+	default:
+		invalidInput("The sort must be one of name, -name, price and -price.", string(query.Sort), w)
+		return
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 100 {
+			invalidInput("The limit must be any integer from 1 to 100.", value, w)
+			return
+		}
+		query.Limit = limit
+	}
+	if value := params.Get("cursor"); value != "" {
+		after, ok := decodeProductCursor(value, query.Sort, currency)
+		if !ok {
+			invalidInput("The cursor is invalid or does not match the sort and currency.", value, w)
+			return
+		}
+		query.After = after
+	}
+
+	// action
+	// One more product than requested is loaded to find out whether there is
+	// a next page.
+	limit := query.Limit
+	query.Limit++
+	products, err := c.ProductController.Query(ctx, query)
 	switch {
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 	case err == nil:
-		result := make([]Product, len(products))
+		if len(products) > limit {
+			products = products[:limit]
+			next := *r.URL
+			params.Set("cursor", encodeProductCursor(products[limit-1], query.Sort, currency))
+			next.RawQuery = params.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+		}
+		result := make([]*Product, len(products))
 		for i, product := range products {
-			result[i].ID = product.ID
-			result[i].Name = product.Name
-			result[i].Price = float32(product.Price) / 100
+			result[i] = convertProductOut(product, currency)
 		}
 		EncodeJSONResponse(result, nil, w)
 	default:
@@ -69,59 +476,229 @@ func (c *ProductsAPI) GetAllProducts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// StoreCouponForProduct - Create product coupon
-func (c *ProductsAPI) StoreCouponForProduct(w http.ResponseWriter, r *http.Request) {
+// productCursor is the position after which the next page of products starts.
+// It contains the sort and currency, so that it cannot be used with different
+// ones.
+type productCursor struct {
+	Sort     model.ProductSort `json:"s"`
+	Currency model.Currency    `json:"c,omitempty"` // empty for the default currency
+	ID       string            `json:"i"`
+	Name     string            `json:"n,omitempty"`
+	Price    int               `json:"p,omitempty"` // in the currency
+}
+
+// encodes the position of the product in the sort order into an opaque cursor,
+// the price of the product is expected to be in the currency
+func encodeProductCursor(product *model.Product, sort model.ProductSort, currency model.Currency) string {
+	cursor := productCursor{Sort: sort, ID: product.ID}
+	if currency != model.DefaultCurrency {
+		cursor.Currency = currency
+	}
+	switch sort {
+	case model.ProductSortPriceAsc, model.ProductSortPriceDesc:
+		cursor.Price = product.Price
+	default:
+		cursor.Name = product.Name
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodes the cursor into a product that only has the id and the field that is
+// sorted by, returns false if the cursor is invalid or of a different sort or
+// currency
+func decodeProductCursor(value string, sort model.ProductSort, currency model.Currency) (*model.Product, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+	cursor := productCursor{Currency: model.DefaultCurrency}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort || cursor.Currency != currency {
+		return nil, false
+	}
+	product := &model.Product{
+		ID:   cursor.ID,
+		Name: cursor.Name,
+	}
+	if currency == model.DefaultCurrency {
+		product.Price = cursor.Price
+	} else {
+		product.Prices = map[model.Currency]int{currency: cursor.Price}
+	}
+	return product, true
+}
+
+// GetProductStock - Get the stock of a product
+func (c *ProductsAPI) GetProductStock(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// check that the user is the admin
-	user := authentication.AuthenticatedUser(ctx)
-	if user.Name != "admin" {
-		w.WriteHeader(http.StatusForbidden) // 403
+	// validation
+	params := mux.Vars(r)
+	productID := params["productId"]
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
 		return
 	}
 
+	// action
+	stock, err := c.ProductController.GetStock(ctx, productID)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertStockOut(stock), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// SetProductStock - Set the stock of a product
+func (c *ProductsAPI) SetProductStock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
 	// input
 	params := mux.Vars(r)
 	productID := params["productId"]
-	couponCode := strings.ToLower(params["couponCode"])
-	coupon := &Coupon{}
-	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
-		w.WriteHeader(500)
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+	input := &Stock{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
 		return
 	}
 
 	// validation
+	if input.Quantity < 0 || input.Quantity > maxStockQuantity {
+		failValidation(fmt.Sprintf("The quantity must be any integer from 0 to %d.", maxStockQuantity), "/quantity", w)
+		return
+	}
+
+	// action
+	stock, err := c.ProductController.SetStock(ctx, productID, int(input.Quantity))
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, controller.ErrDeleted):
+		w.WriteHeader(http.StatusGone) // 410
+	case errors.Is(err, controller.ErrConflict):
+		w.WriteHeader(http.StatusConflict) // 409
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertStockOut(stock), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// AdjustProductStock - Adjust the stock of a product
+func (c *ProductsAPI) AdjustProductStock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	productID := params["productId"]
 	if !uuidPattern.Match([]byte(productID)) {
 		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
 		return
 	}
-	if l := utf8.RuneCountInString(couponCode); l < 6 || l > 40 {
-		invalidInput("The coupon code must be 6 to 40 characters long.", "", w)
+	input := &StockAdjustment{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
 		return
 	}
-	if l := utf8.RuneCountInString(coupon.Name); l < 1 || l > 100 {
-		failValidation("The name must be 1 to 100 characters long.", "/name", w)
+
+	// validation
+	if input.Delta < -maxStockQuantity || input.Delta > maxStockQuantity {
+		failValidation(fmt.Sprintf("The delta must be any integer from %d to %d.", -maxStockQuantity, maxStockQuantity), "/delta", w)
 		return
 	}
-	if coupon.Discount < 1 || coupon.Discount > 100 {
-		failValidation("The discount must be any integer from 1 to 100.", "/discount", w)
+
+	// action
+	stock, err := c.ProductController.AdjustStock(ctx, productID, int(input.Delta))
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, controller.ErrConflict):
+		w.WriteHeader(http.StatusConflict) // 409
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertStockOut(stock), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// DeleteProductStock - Stop tracking the stock of a product
+func (c *ProductsAPI) DeleteProductStock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// validation
+	params := mux.Vars(r)
+	productID := params["productId"]
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
 		return
 	}
 
-	// convert to internal model
-	couponInput := model.Coupon{
-		Code:      couponCode,
-		ProductID: productID,
-		Name:      coupon.Name,
-		Discount:  int(coupon.Discount),
-		ExpiresAt: coupon.ExpiresAt,
+	// action
+	err := c.ProductController.DeleteStock(ctx, productID)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		panic(err)
 	}
+}
+
+// the maximum quantity that can be set or adjusted at once
+const maxStockQuantity = 1000000000
+
+func convertStockOut(stock *model.Stock) *Stock {
+	return &Stock{
+		Quantity:  int64(stock.Quantity),
+		Reserved:  int64(stock.Reserved),
+		Available: int64(stock.Available()),
+	}
+}
+
+// StoreCouponForProduct - Create product coupon
+func (c *ProductsAPI) StoreCouponForProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	productID := params["productId"]
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+	couponInput, ok := decodeCoupon(w, r)
+	if !ok {
+		return
+	}
+
 	// load product
-	product, err := c.ProductController.Get(ctx, couponInput.ProductID)
+	product, err := c.ProductController.Get(ctx, productID, model.DefaultCurrency)
 	switch {
 	case errors.Is(err, controller.ErrNotFound):
 		w.WriteHeader(http.StatusNotFound) // 404
 		return
+	case errors.Is(err, controller.ErrDeleted):
+		w.WriteHeader(http.StatusGone) // 410
+		return
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 		return
@@ -132,23 +709,284 @@ func (c *ProductsAPI) StoreCouponForProduct(w http.ResponseWriter, r *http.Reque
 	}
 
 	// action
-	couponOutput, err := c.ProductController.SaveCoupon(ctx, &couponInput)
+	couponOutput, err := c.ProductController.SaveCoupon(ctx, couponInput)
 	switch {
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 	case err == nil:
-		EncodeJSONResponse(&Coupon{
-			Code:      couponOutput.Code,
-			Name:      couponOutput.Name,
-			Discount:  int32(couponOutput.Discount),
-			ExpiresAt: couponOutput.ExpiresAt.UTC().Truncate(time.Second),
-			Product: Product{
-				ID:    couponOutput.Product.ID,
-				Name:  couponOutput.Product.Name,
-				Price: float32(couponOutput.Product.Price) / 100,
-			},
-		}, nil, w)
+		EncodeJSONResponse(convertCouponOut(couponOutput, couponOutput.Product), nil, w)
 	default:
 		panic(err)
 	}
 }
+
+// decodes and validates the coupon of the request and converts it to the
+// internal model without product, returns false if the request is invalid
+func decodeCoupon(w http.ResponseWriter, r *http.Request) (*model.Coupon, bool) {
+	// input
+	couponCode := strings.ToLower(mux.Vars(r)["couponCode"])
+	input := &Coupon{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
+		return nil, false
+	}
+
+	// validation
+	if l := utf8.RuneCountInString(couponCode); l < 6 || l > 40 {
+		invalidInput("The coupon code must be 6 to 40 characters long.", "", w)
+		return nil, false
+	}
+
+	return convertCouponIn(w, couponCode, input, "")
+}
+
+// validates the coupon input and converts it to the internal model with the
+// given code and without product, returns false if the input is invalid; the
+// pointers of validation errors start with the given pointer
+func convertCouponIn(w http.ResponseWriter, code string, input *Coupon, pointer string) (*model.Coupon, bool) {
+	if l := utf8.RuneCountInString(input.Name); l < 1 || l > 100 {
+		failValidation("The name must be 1 to 100 characters long.", pointer+"/name", w)
+		return nil, false
+	}
+	amount, ok := parseAmount(input.Amount, model.DefaultCurrency)
+	switch {
+	case !ok:
+		failValidation("The amount must be any amount from 0.01 to 1000000.", pointer+"/amount", w)
+		return nil, false
+	case input.Discount != 0 && amount != 0:
+		failValidation("Either the discount or the amount must be given, not both.", pointer+"/amount", w)
+		return nil, false
+	case amount != 0:
+		// valid
+	case input.Discount < 1 || input.Discount > 100:
+		failValidation("The discount must be any integer from 1 to 100.", pointer+"/discount", w)
+		return nil, false
+	}
+	minSubtotal, ok := parseAmount(input.MinSubtotal, model.DefaultCurrency)
+	if !ok {
+		failValidation("The minimum subtotal must be any amount from 0 to 1000000.", pointer+"/minSubtotal", w)
+		return nil, false
+	}
+	if input.MaxRedemptions < 0 {
+		failValidation("The maximum redemptions must not be negative.", pointer+"/maxRedemptions", w)
+		return nil, false
+	}
+	if input.MaxRedemptionsPerUser < 0 {
+		failValidation("The maximum redemptions per user must not be negative.", pointer+"/maxRedemptionsPerUser", w)
+		return nil, false
+	}
+	var notBefore time.Time
+	if input.NotBefore != nil {
+		notBefore = *input.NotBefore
+	}
+	if !input.ExpiresAt.IsZero() && input.ExpiresAt.Before(notBefore) {
+		failValidation("The coupon must not expire before it starts.", pointer+"/expiresAt", w)
+		return nil, false
+	}
+
+	// convert to internal model
+	return &model.Coupon{
+		Code:                  code,
+		Name:                  input.Name,
+		Discount:              int(input.Discount),
+		Amount:                amount,
+		MinSubtotal:           minSubtotal,
+		MaxRedemptions:        int(input.MaxRedemptions),
+		MaxRedemptionsPerUser: int(input.MaxRedemptionsPerUser),
+		NotBefore:             notBefore,
+		ExpiresAt:             input.ExpiresAt,
+	}, true
+}
+
+// GetAllCouponsOfProduct - Get all coupons of a product
+func (c *ProductsAPI) GetAllCouponsOfProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	productID := params["productId"]
+	active, expired, ok := decodeExpiredQuery(w, r)
+	if !ok {
+		return
+	}
+
+	// validation
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+
+	// load product
+	product, ok := c.loadCouponProduct(w, r, productID)
+	if !ok {
+		return
+	}
+
+	// action
+	coupons, err := c.ProductController.GetCouponsOfProduct(ctx, productID, active, expired)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		out := make([]*Coupon, len(coupons))
+		for i, coupon := range coupons {
+			out[i] = convertCouponOut(coupon, product)
+		}
+		EncodeJSONResponse(out, nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// GetCouponOfProduct - Get a coupon of a product
+func (c *ProductsAPI) GetCouponOfProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	productID := params["productId"]
+	couponCode := strings.ToLower(params["couponCode"])
+
+	// validation
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+
+	// load product
+	product, ok := c.loadCouponProduct(w, r, productID)
+	if !ok {
+		return
+	}
+
+	// action
+	coupon, err := c.ProductController.GetCouponOfProduct(ctx, productID, couponCode)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertCouponOut(coupon, product), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// DeleteCouponOfProduct - Delete a coupon of a product
+func (c *ProductsAPI) DeleteCouponOfProduct(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	productID := params["productId"]
+	couponCode := strings.ToLower(params["couponCode"])
+
+	// validation
+	if !uuidPattern.Match([]byte(productID)) {
+		invalidInput("The productId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+
+	// action
+	err := c.ProductController.DeleteCouponOfProduct(ctx, productID, couponCode)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		panic(err)
+	}
+}
+
+// decodes the expired query parameter of coupon lists into whether active and
+// expired coupons are included, returns false if the parameter is invalid
+func decodeExpiredQuery(w http.ResponseWriter, r *http.Request) (active, expired, ok bool) {
+	switch r.URL.Query().Get("expired") {
+	case "":
+		return true, true, true
+	case "true":
+		return false, true, true
+	case "false":
+		return true, false, true
+	default:
+		invalidInput("The expired query parameter is invalid.", "Use expired=true or expired=false.", w)
+		return false, false, false
+	}
+}
+
+// loadCouponProduct loads the product of coupons. The response is written if
+// the product cannot be loaded.
+func (c *ProductsAPI) loadCouponProduct(w http.ResponseWriter, r *http.Request, productID string) (*model.Product, bool) {
+	product, err := c.ProductController.Get(r.Context(), productID, model.DefaultCurrency)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+		return nil, false
+	case errors.Is(err, controller.ErrDeleted):
+		w.WriteHeader(http.StatusGone) // 410
+		return nil, false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+		return nil, false
+	case err == nil:
+		return product, true
+	default:
+		panic(err)
+	}
+}
+
+func convertCouponOut(coupon *model.Coupon, product *model.Product) *Coupon {
+	out := Coupon{
+		Code:                  coupon.Code,
+		Name:                  coupon.Name,
+		Discount:              int32(coupon.Discount),
+		MaxRedemptions:        int32(coupon.MaxRedemptions),
+		MaxRedemptionsPerUser: int32(coupon.MaxRedemptionsPerUser),
+		ExpiresAt:             coupon.ExpiresAt.UTC().Truncate(time.Second),
+		Redemptions:           int32(coupon.Redemptions),
+	}
+	if coupon.Amount != 0 {
+		out.Amount = model.Money{Amount: coupon.Amount, Currency: model.DefaultCurrency}.String()
+	}
+	if coupon.MinSubtotal != 0 {
+		out.MinSubtotal = model.Money{Amount: coupon.MinSubtotal, Currency: model.DefaultCurrency}.String()
+	}
+	if product != nil {
+		out.Product = convertProductOut(product, model.DefaultCurrency)
+	}
+	if !coupon.NotBefore.IsZero() {
+		notBefore := coupon.NotBefore.UTC().Truncate(time.Second)
+		out.NotBefore = &notBefore
+	}
+	return &out
+}
+
+// converts the product with its price in the currency
+func convertProductOut(product *model.Product, currency model.Currency) *Product {
+	out := Product{
+		ID:          product.ID,
+		Name:        product.Name,
+		Price:       model.Money{Amount: product.Price, Currency: currency}.String(),
+		Currency:    string(currency),
+		TaxClass:    product.TaxClass,
+		Weight:      int32(product.Weight),
+		Description: product.Description,
+		SKU:         product.SKU,
+		Categories:  product.Categories,
+		Attributes:  product.Attributes,
+	}
+	for _, image := range product.Images {
+		out.Images = append(out.Images, Image(image))
+	}
+	for code, price := range product.Prices {
+		if out.Prices == nil {
+			out.Prices = make(map[string]string, len(product.Prices))
+		}
+		out.Prices[string(code)] = model.Money{Amount: price, Currency: code}.String()
+	}
+	return &out
+}
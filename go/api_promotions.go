@@ -0,0 +1,242 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/Teelevision/excommerce/authentication"
+	"github.com/Teelevision/excommerce/controller"
+	"github.com/Teelevision/excommerce/model"
+	"github.com/gorilla/mux"
+)
+
+var _ Router = (*PromotionsAPI)(nil)
+
+// A PromotionsAPI binds http requests to an api service and writes the service results to the http response
+type PromotionsAPI struct {
+	Authenticator       *authentication.Authenticator
+	PromotionController *controller.Promotion
+	ProductController   *controller.Product
+}
+
+// Routes returns all of the api route for the PromotionsApiController
+func (c *PromotionsAPI) Routes() Routes {
+	return Routes{
+		{
+			Name:        "DeletePromotion",
+			Method:      "DELETE",
+			Path:        "/beta/promotions/{promotionId}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManagePromotions, c.DeletePromotion)),
+		},
+		{
+			Name:        "GetAllPromotions",
+			Method:      "GET",
+			Path:        "/beta/promotions",
+			HandlerFunc: c.GetAllPromotions,
+		},
+		{
+			Name:        "StorePromotion",
+			Method:      "PUT",
+			Path:        "/beta/promotions/{promotionId}",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManagePromotions, c.StorePromotion)),
+		},
+	}
+}
+
+// DeletePromotion - Delete a promotion
+func (c *PromotionsAPI) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// validation
+	params := mux.Vars(r)
+	promotionID := params["promotionId"]
+	if !uuidPattern.Match([]byte(promotionID)) {
+		invalidInput("The promotionId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+
+	// action
+	err := c.PromotionController.Delete(ctx, promotionID)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		panic(err)
+	}
+}
+
+// GetAllPromotions - Get all promotions
+func (c *PromotionsAPI) GetAllPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := c.PromotionController.GetAll(r.Context())
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		sort.Slice(promotions, func(i, j int) bool { return promotions[i].ID < promotions[j].ID })
+		result := make([]*Promotion, len(promotions))
+		for i, promotion := range promotions {
+			result[i] = convertPromotionOut(promotion)
+		}
+		EncodeJSONResponse(result, nil, w)
+	default:
+		panic(err)
+	}
+}
+
+// StorePromotion - Store a promotion
+func (c *PromotionsAPI) StorePromotion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	promotionID := params["promotionId"]
+	if !uuidPattern.Match([]byte(promotionID)) {
+		invalidInput("The promotionId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+	input := &Promotion{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+
+	// validation
+	if l := utf8.RuneCountInString(input.Name); l < 1 || l > 100 {
+		failValidation("The name must be 1 to 100 characters long.", "/name", w)
+		return
+	}
+	if input.Discount < 1 || input.Discount > 100 {
+		failValidation("The discount must be any integer from 1 to 100.", "/discount", w)
+		return
+	}
+	var productID string // product that must exist, bundle items are checked on saving
+	switch model.PromotionType(input.Type) {
+	case model.PromotionTypeQuantityThreshold, model.PromotionTypeBuyXGetY:
+		if !uuidPattern.Match([]byte(input.ProductID)) {
+			failValidation("The product id is not a UUID.", "/productId", w)
+			return
+		}
+		if input.Quantity < 1 {
+			failValidation("The quantity must be 1 or greater.", "/quantity", w)
+			return
+		}
+		if input.Type == string(model.PromotionTypeBuyXGetY) && input.FreeQuantity < 1 {
+			failValidation("The free quantity must be 1 or greater.", "/freeQuantity", w)
+			return
+		}
+		productID = input.ProductID
+	case model.PromotionTypeBundle:
+		if len(input.Bundle) == 0 {
+			failValidation("The bundle must contain at least one product.", "/bundle", w)
+			return
+		}
+		for productID, quantity := range input.Bundle {
+			if !uuidPattern.Match([]byte(productID)) || productID == promotionID {
+				failValidation("The product id is not a UUID of another product.", "/bundle/"+productID, w)
+				return
+			}
+			if quantity < 1 {
+				failValidation("The quantity must be 1 or greater.", "/bundle/"+productID, w)
+				return
+			}
+		}
+	default:
+		failValidation(fmt.Sprintf("The type must be one of %q, %q or %q.",
+			model.PromotionTypeQuantityThreshold, model.PromotionTypeBundle, model.PromotionTypeBuyXGetY), "/type", w)
+		return
+	}
+
+	// convert to internal model
+	promotionInput := model.Promotion{
+		ID:           promotionID,
+		Type:         model.PromotionType(input.Type),
+		Name:         input.Name,
+		Discount:     int(input.Discount),
+		ProductID:    input.ProductID,
+		Quantity:     int(input.Quantity),
+		FreeQuantity: int(input.FreeQuantity),
+	}
+	if promotionInput.Type == model.PromotionTypeBundle {
+		promotionInput.ProductID = ""
+		promotionInput.Quantity = 0
+		promotionInput.Bundle = make(map[string]int, len(input.Bundle))
+		for productID, quantity := range input.Bundle {
+			promotionInput.Bundle[productID] = int(quantity)
+		}
+	}
+	if promotionInput.Type != model.PromotionTypeBuyXGetY {
+		promotionInput.FreeQuantity = 0
+	}
+	// check product
+	if productID != "" {
+		_, err := c.ProductController.Get(ctx, productID, model.DefaultCurrency)
+		switch {
+		case errors.Is(err, controller.ErrNotFound), errors.Is(err, controller.ErrDeleted):
+			failValidation("The product is not available.", "/productId", w)
+			return
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			w.WriteHeader(499) // client closed request
+			return
+		case err == nil:
+			// product exists
+		default:
+			panic(err)
+		}
+	}
+
+	// action
+	promotion, err := c.PromotionController.Save(ctx, &promotionInput)
+	var itemErr *controller.BundleItemError
+	switch {
+	case errors.Is(err, controller.ErrConflict):
+		status := http.StatusConflict // 409
+		EncodeJSONResponse(map[string]string{
+			"message": "A product with the id of the bundle exists.",
+		}, &status, w)
+	case errors.As(err, &itemErr):
+		failValidation("The product is not available or is a bundle itself.", "/bundle/"+itemErr.ProductID, w)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertPromotionOut(promotion), nil, w)
+	default:
+		panic(err)
+	}
+}
+
+func convertPromotionOut(promotion *model.Promotion) *Promotion {
+	out := Promotion{
+		ID:           promotion.ID,
+		Type:         string(promotion.Type),
+		Name:         promotion.Name,
+		ProductID:    promotion.ProductID,
+		Quantity:     int32(promotion.Quantity),
+		FreeQuantity: int32(promotion.FreeQuantity),
+		Discount:     int32(promotion.Discount),
+	}
+	if promotion.Bundle != nil {
+		out.Bundle = make(map[string]int32, len(promotion.Bundle))
+		for productID, quantity := range promotion.Bundle {
+			out.Bundle[productID] = int32(quantity)
+		}
+	}
+	return &out
+}
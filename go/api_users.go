@@ -10,30 +10,82 @@
 package openapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"time"
 	"unicode/utf8"
 
+	"github.com/Teelevision/excommerce/authentication"
 	"github.com/Teelevision/excommerce/controller"
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/ratelimit"
+	"github.com/gorilla/mux"
 )
 
 var _ Router = (*UsersAPI)(nil)
 
 // A UsersAPI binds http requests to an api service and writes the service results to the http response
 type UsersAPI struct {
+	Authenticator  *authentication.Authenticator
 	UserController *controller.User
+
+	// IPLimiter and AccountLimiter limit the failed logins per IP address and
+	// per name. They are optional.
+	IPLimiter      *ratelimit.Limiter
+	AccountLimiter *ratelimit.Limiter
 }
 
 // Routes returns all of the api route for the UsersApiController
 func (c *UsersAPI) Routes() Routes {
 	return Routes{
+		{
+			Name:        "CreateGuest",
+			Method:      "POST",
+			Path:        "/beta/guests",
+			HandlerFunc: c.CreateGuest,
+		},
+		{
+			Name:        "ChangePassword",
+			Method:      "POST",
+			Path:        "/beta/users/changePassword",
+			HandlerFunc: c.Authenticator.HandlerFunc(c.ChangePassword),
+		},
+		{
+			Name:        "DeleteUser",
+			Method:      "DELETE",
+			Path:        "/beta/users/{userId}",
+			HandlerFunc: c.Authenticator.HandlerFunc(c.DeleteUser),
+		},
+		{
+			Name:        "ForgotPassword",
+			Method:      "POST",
+			Path:        "/beta/users/forgotPassword",
+			HandlerFunc: c.ForgotPassword,
+		},
 		{
 			Name:        "Login",
 			Method:      "POST",
 			Path:        "/beta/users/login",
-			HandlerFunc: c.Login,
+			HandlerFunc: c.IPLimiter.Middleware(ratelimit.RemoteIP, http.StatusNotFound)(c.AccountLimiter.Middleware(loginName, http.StatusNotFound)(c.Login)),
+		},
+		{
+			Name:        "Logout",
+			Method:      "POST",
+			Path:        "/beta/users/logout",
+			HandlerFunc: c.Authenticator.HandlerFunc(c.Logout),
+		},
+		{
+			Name:        "Refresh",
+			Method:      "POST",
+			Path:        "/beta/users/refresh",
+			HandlerFunc: c.Refresh,
 		},
 		{
 			Name:        "Register",
@@ -41,6 +93,103 @@ func (c *UsersAPI) Routes() Routes {
 			Path:        "/beta/users",
 			HandlerFunc: c.Register,
 		},
+		{
+			Name:        "ResetPassword",
+			Method:      "POST",
+			Path:        "/beta/users/resetPassword",
+			HandlerFunc: c.ResetPassword,
+		},
+		{
+			Name:        "SetUserRoles",
+			Method:      "PUT",
+			Path:        "/beta/users/{userId}/roles",
+			HandlerFunc: c.Authenticator.HandlerFunc(authentication.RequirePermission(model.PermissionManageUsers, c.SetUserRoles)),
+		},
+	}
+}
+
+// CreateGuest - Create a guest
+func (c *UsersAPI) CreateGuest(w http.ResponseWriter, r *http.Request) {
+	tokens := c.UserController.CreateGuest(r.Context())
+	EncodeJSONResponse(&GuestToken{
+		ID:          tokens.User.ID,
+		AccessToken: tokens.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(math.Round(time.Until(tokens.AccessTokenExpiresAt).Seconds())),
+	}, nil, w)
+}
+
+// ChangePassword - Change the password of the user
+func (c *UsersAPI) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	form := &ChangePasswordForm{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+
+	// validation
+	if l := utf8.RuneCountInString(form.NewPassword); l < 8 || l > 64 {
+		failValidation("The password must be 8 to 64 characters long.", "/newPassword", w)
+		return
+	}
+
+	// action
+	err := c.UserController.ChangePassword(r.Context(), form.CurrentPassword, form.NewPassword)
+	switch {
+	case errors.Is(err, controller.ErrForbidden):
+		w.WriteHeader(http.StatusForbidden) // 403
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		unexpectedError(r.Context(), err, w)
+	}
+}
+
+// DeleteUser - Delete a user
+func (c *UsersAPI) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	// input
+	params := mux.Vars(r)
+	userID := params["userId"]
+	if !uuidPattern.Match([]byte(userID)) {
+		invalidInput("The userId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+
+	// action
+	err := c.UserController.Delete(r.Context(), userID)
+	switch {
+	case errors.Is(err, controller.ErrForbidden):
+		w.WriteHeader(http.StatusForbidden) // 403
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		unexpectedError(r.Context(), err, w)
+	}
+}
+
+// ForgotPassword - Request a token to reset the password
+func (c *UsersAPI) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	form := &ForgotPasswordForm{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+
+	// action
+	err := c.UserController.RequestPasswordReset(r.Context(), form.Name)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted) // 202
+	default:
+		unexpectedError(r.Context(), err, w)
 	}
 }
 
@@ -53,19 +202,73 @@ func (c *UsersAPI) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// action
-	u, err := c.UserController.GetByNameAndPassword(r.Context(), loginForm.Name, loginForm.Password)
+	tokens, err := c.UserController.Login(r.Context(), loginForm.Name, loginForm.Password)
 	switch {
 	case errors.Is(err, controller.ErrNotFound):
 		w.WriteHeader(http.StatusNotFound) // 404
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 	case err == nil:
-		EncodeJSONResponse(&User{
-			ID:   u.ID,
-			Name: u.Name,
-		}, nil, w)
+		EncodeJSONResponse(convertTokensOut(tokens), nil, w)
+	default:
+		unexpectedError(r.Context(), err, w)
+	}
+}
+
+// loginName returns the name of the login form of the request. The body of the
+// request can still be read afterwards.
+func loginName(r *http.Request) string {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err != nil {
+		return ""
+	}
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	loginForm := &LoginForm{}
+	if err := json.Unmarshal(body, &loginForm); err != nil {
+		return ""
+	}
+	return loginForm.Name
+}
+
+// Logout - Logout a user
+func (c *UsersAPI) Logout(w http.ResponseWriter, r *http.Request) {
+	logoutForm := &LogoutForm{}
+	if err := json.NewDecoder(r.Body).Decode(&logoutForm); err != nil && err != io.EOF { // the body is optional
+		invalidJSON(err, w)
+		return
+	}
+
+	// action
+	err := c.UserController.Logout(r.Context(), logoutForm.AllSessions)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		unexpectedError(r.Context(), err, w)
+	}
+}
+
+// Refresh - Refresh the tokens of a login session
+func (c *UsersAPI) Refresh(w http.ResponseWriter, r *http.Request) {
+	refreshForm := &RefreshForm{}
+	if err := json.NewDecoder(r.Body).Decode(&refreshForm); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+
+	// action
+	tokens, err := c.UserController.Refresh(r.Context(), refreshForm.RefreshToken)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusUnauthorized) // 401
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertTokensOut(tokens), nil, w)
 	default:
-		unexpectedError(err, w)
+		unexpectedError(r.Context(), err, w)
 	}
 }
 
@@ -88,18 +291,118 @@ func (c *UsersAPI) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// action
-	u, err := c.UserController.Create(r.Context(), user.Name, user.Password)
+	u, err := c.UserController.Create(r.Context(), user.Name, user.Password, user.GuestToken)
 	switch {
+	case errors.Is(err, controller.ErrInvalidToken):
+		failValidation("The guest token is invalid or expired.", "/guestToken", w)
 	case errors.Is(err, controller.ErrConflict):
 		w.WriteHeader(http.StatusConflict) // 409
 	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
 		w.WriteHeader(499) // client closed request
 	case err == nil:
-		EncodeJSONResponse(&User{
-			ID:   u.ID,
-			Name: u.Name,
-		}, nil, w)
+		EncodeJSONResponse(convertUserOut(u), nil, w)
 	default:
-		unexpectedError(err, w)
+		unexpectedError(r.Context(), err, w)
+	}
+}
+
+func convertTokensOut(tokens *controller.Tokens) *Tokens {
+	return &Tokens{
+		ID:                    tokens.User.ID,
+		Name:                  tokens.User.Name,
+		Roles:                 convertRolesOut(tokens.User.Roles),
+		AccessToken:           tokens.AccessToken,
+		TokenType:             "Bearer",
+		ExpiresIn:             int64(math.Round(time.Until(tokens.AccessTokenExpiresAt).Seconds())),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresIn: int64(math.Round(time.Until(tokens.RefreshTokenExpiresAt).Seconds())),
+	}
+}
+
+// ResetPassword - Reset the password with a token
+func (c *UsersAPI) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	form := &ResetPasswordForm{}
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+
+	// validation
+	if l := utf8.RuneCountInString(form.Password); l < 8 || l > 64 {
+		failValidation("The password must be 8 to 64 characters long.", "/password", w)
+		return
+	}
+
+	// action
+	err := c.UserController.ResetPassword(r.Context(), form.Token, form.Password)
+	switch {
+	case errors.Is(err, controller.ErrInvalidToken):
+		failValidation("The token is invalid, expired or was used before.", "/token", w)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent) // 204
+	default:
+		unexpectedError(r.Context(), err, w)
+	}
+}
+
+// SetUserRoles - Set the roles of a user
+func (c *UsersAPI) SetUserRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// input
+	params := mux.Vars(r)
+	userID := params["userId"]
+	if !uuidPattern.Match([]byte(userID)) {
+		invalidInput("The userId of the path is not a UUID.", uuidPattern.String(), w)
+		return
+	}
+	input := &UserRoles{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		invalidJSON(err, w)
+		return
+	}
+
+	// validation
+	roles := make([]model.Role, len(input.Roles))
+	for i, role := range input.Roles {
+		roles[i] = model.Role(role)
+		if !roles[i].Valid() {
+			failValidation("The role must be one of admin, catalogManager and orderManager.", fmt.Sprintf("/roles/%d", i), w)
+			return
+		}
+	}
+
+	// action
+	user, err := c.UserController.SetRoles(ctx, userID, roles)
+	switch {
+	case errors.Is(err, controller.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.WriteHeader(499) // client closed request
+	case err == nil:
+		EncodeJSONResponse(convertUserOut(user), nil, w)
+	default:
+		unexpectedError(r.Context(), err, w)
+	}
+}
+
+func convertUserOut(user *model.User) *User {
+	return &User{
+		ID:    user.ID,
+		Name:  user.Name,
+		Roles: convertRolesOut(user.Roles),
+	}
+}
+
+func convertRolesOut(roles []model.Role) []string {
+	if len(roles) == 0 {
+		return nil
+	}
+	result := make([]string, len(roles))
+	for i, role := range roles {
+		result[i] = string(role)
 	}
+	return result
 }
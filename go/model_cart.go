@@ -17,6 +17,9 @@ type Cart struct {
 
 	Positions []Position `json:"positions"`
 
+	// The currency of all prices of the cart.
+	Currency string `json:"currency"`
+
 	// Whether the cart is locked.
 	Locked bool `json:"locked,omitempty"`
 }
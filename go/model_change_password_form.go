@@ -0,0 +1,17 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// ChangePasswordForm - Change password form
+type ChangePasswordForm struct {
+	CurrentPassword string `json:"currentPassword"`
+
+	NewPassword string `json:"newPassword"`
+}
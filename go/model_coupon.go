@@ -13,7 +13,7 @@ import (
 	"time"
 )
 
-// Coupon - A coupon for a product that can be used during checkout.
+// Coupon - A coupon for a product or the whole cart that can be used during checkout.
 type Coupon struct {
 
 	// The coupon display text.
@@ -22,11 +22,30 @@ type Coupon struct {
 	// The case-insensitive coupon code.
 	Code string `json:"code"`
 
-	// The discount in percent on the product price.
+	// The discount in percent on the product price or cart total. Either discount or amount must be given.
 	Discount int32 `json:"discount"`
 
-	Product Product `json:"product"`
+	// The fixed amount in EUR off the product price or cart total as decimal number. Either discount or amount must be given.
+	Amount string `json:"amount,omitempty"`
+
+	// The minimum sum of all products in the cart in EUR for the coupon to apply as decimal number.
+	MinSubtotal string `json:"minSubtotal,omitempty"`
+
+	// The maximum number of placed orders that may use this coupon. Zero means unlimited.
+	MaxRedemptions int32 `json:"maxRedemptions,omitempty"`
+
+	// The maximum number of placed orders of one user that may use this coupon. Zero means unlimited.
+	MaxRedemptionsPerUser int32 `json:"maxRedemptionsPerUser,omitempty"`
+
+	// The product of the coupon. It is omitted for coupons on the whole cart.
+	Product *Product `json:"product,omitempty"`
+
+	// The time when this coupon starts. If omitted the coupon starts immediately.
+	NotBefore *time.Time `json:"notBefore,omitempty"`
 
 	// The time when this coupon exires. If omitted the server chooses a time in the future.
 	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+
+	// The number of placed orders that used this coupon. It is ignored on input.
+	Redemptions int32 `json:"redemptions"`
 }
@@ -0,0 +1,28 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// CouponBatch - A batch of coupons with random codes that share everything else.
+type CouponBatch struct {
+
+	// The start of every code. It may consist of letters, digits and hyphens.
+	Prefix string `json:"prefix,omitempty"`
+
+	// The length of every code including the prefix.
+	Length int32 `json:"length"`
+
+	// The number of coupons to generate.
+	Count int32 `json:"count"`
+
+	// The id of the product of the coupons. If omitted the coupons apply to the whole cart.
+	ProductID string `json:"productId,omitempty"`
+
+	Coupon Coupon `json:"coupon"`
+}
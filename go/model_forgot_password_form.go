@@ -0,0 +1,15 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// ForgotPasswordForm - Forgot password form
+type ForgotPasswordForm struct {
+	Name string `json:"name"`
+}
@@ -0,0 +1,26 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// GuestToken - The access token of a guest.
+type GuestToken struct {
+
+	// The UUID of the guest.
+	ID string `json:"id"`
+
+	// The access token to use as a bearer token.
+	AccessToken string `json:"accessToken"`
+
+	// The type of the access token. It is always Bearer.
+	TokenType string `json:"tokenType"`
+
+	// The number of seconds until the access token expires.
+	ExpiresIn int64 `json:"expiresIn"`
+}
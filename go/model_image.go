@@ -0,0 +1,20 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// Image - An image asset.
+type Image struct {
+
+	// The URL of the image. It is either absolute or relative to the host of the api.
+	URL string `json:"url"`
+
+	// The alternative text of the image.
+	Alt string `json:"alt,omitempty"`
+}
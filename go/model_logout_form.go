@@ -0,0 +1,17 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// LogoutForm - Logout form
+type LogoutForm struct {
+
+	// Whether to end all sessions of the user instead of only the current one.
+	AllSessions bool `json:"allSessions,omitempty"`
+}
@@ -9,6 +9,10 @@
 
 package openapi
 
+import (
+	"time"
+)
+
 // Order - An order.
 type Order struct {
 
@@ -18,8 +22,11 @@ type Order struct {
 	// The status of the order.
 	Status string `json:"status"`
 
-	// The total price of this order.
-	Price float32 `json:"price"`
+	// The currency of all prices of this order.
+	Currency string `json:"currency"`
+
+	// The total price of this order as decimal number.
+	Price string `json:"price"`
 
 	Buyer Address `json:"buyer"`
 
@@ -28,4 +35,16 @@ type Order struct {
 	Coupons []string `json:"coupons,omitempty"`
 
 	Positions []Position `json:"positions"`
+
+	// The id of the shipping method of this order. When preparing an order the cheapest method is used if none is given.
+	ShippingMethod string `json:"shippingMethod,omitempty"`
+
+	// The shipping methods available for this order with their prices. Only returned when preparing an order.
+	ShippingMethods []ShippingMethod `json:"shippingMethods,omitempty"`
+
+	// The time when this order was placed. Omitted if the order is not placed.
+	PlacedAt *time.Time `json:"placedAt,omitempty"`
+
+	// All statuses of the placed order, oldest first.
+	StatusHistory []OrderStatusChange `json:"statusHistory,omitempty"`
 }
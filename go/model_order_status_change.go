@@ -0,0 +1,24 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+import (
+	"time"
+)
+
+// OrderStatusChange - A change of the status of a placed order.
+type OrderStatusChange struct {
+
+	// The new status of the order.
+	Status string `json:"status"`
+
+	// The time of the change.
+	ChangedAt time.Time `json:"changedAt,omitempty"`
+}
@@ -0,0 +1,17 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// PlaceOrderForm - Form to place an order
+type PlaceOrderForm struct {
+
+	// Token of the payment source, like a credit card, issued by the payment provider.
+	PaymentSource string `json:"paymentSource,omitempty"`
+}
@@ -17,9 +17,14 @@ type Position struct {
 
 	Product Product `json:"product"`
 
-	// The total price of this position.
-	Price float32 `json:"price"`
+	// The total price of this position as decimal number.
+	Price string `json:"price"`
 
-	// The total savings of this position.
-	SavedPrice float32 `json:"savedPrice,omitempty"`
+	// The total savings of this position as decimal number.
+	SavedPrice string `json:"savedPrice,omitempty"`
+
+	Tax *Tax `json:"tax,omitempty"`
+
+	// The id of the shipping method if this position is the shipping of the order.
+	ShippingMethod string `json:"shippingMethod,omitempty"`
 }
@@ -18,6 +18,33 @@ type Product struct {
 	// The display name of the product.
 	Name string `json:"name"`
 
-	// The price of a single item of the product.
-	Price float32 `json:"price,omitempty"`
+	// The price of a single item of the product as decimal number, like 12.30.
+	Price string `json:"price,omitempty"`
+
+	// The currency of the price, like EUR. It is EUR on input.
+	Currency string `json:"currency,omitempty"`
+
+	// The prices in other currencies than EUR by currency. The product is not available in currencies without a price.
+	Prices map[string]string `json:"prices,omitempty"`
+
+	// The tax class of the product. Products without a tax class have the default one.
+	TaxClass string `json:"taxClass,omitempty"`
+
+	// The weight of the product in grams. It is used to calculate the shipping costs.
+	Weight int32 `json:"weight,omitempty"`
+
+	// The description of the product.
+	Description string `json:"description,omitempty"`
+
+	// The stock keeping unit of the product.
+	SKU string `json:"sku,omitempty"`
+
+	// The names of the categories the product belongs to.
+	Categories []string `json:"categories,omitempty"`
+
+	// Free-form attributes of the product, like color or origin.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// The images of the product. The first one is the main image.
+	Images []Image `json:"images,omitempty"`
 }
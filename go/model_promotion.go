@@ -0,0 +1,38 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// Promotion - A promotion that is applied automatically to carts and orders if its conditions are met.
+type Promotion struct {
+
+	// The UUID of the promotion. The id of a bundle promotion is also the id of the virtual product that represents the bundle.
+	ID string `json:"id"`
+
+	// The type of the promotion.
+	Type string `json:"type"`
+
+	// The display name of the promotion.
+	Name string `json:"name"`
+
+	// The UUID of the product the promotion applies to. Used by quantityThreshold and buyXGetY promotions.
+	ProductID string `json:"productId,omitempty"`
+
+	// The minimum quantity of a quantityThreshold promotion, or the quantity to buy of a buyXGetY promotion.
+	Quantity int32 `json:"quantity,omitempty"`
+
+	// The quantity that is discounted of a buyXGetY promotion.
+	FreeQuantity int32 `json:"freeQuantity,omitempty"`
+
+	// The products of a bundle promotion. Maps product UUIDs to quantities.
+	Bundle map[string]int32 `json:"bundle,omitempty"`
+
+	// The discount in percent.
+	Discount int32 `json:"discount"`
+}
@@ -0,0 +1,15 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// RefreshForm - Refresh form
+type RefreshForm struct {
+	RefreshToken string `json:"refreshToken"`
+}
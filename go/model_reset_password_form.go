@@ -0,0 +1,17 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// ResetPasswordForm - Reset password form
+type ResetPasswordForm struct {
+	Token string `json:"token"`
+
+	Password string `json:"password"`
+}
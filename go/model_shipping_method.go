@@ -0,0 +1,23 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// ShippingMethod - A shipping method with its price for an order.
+type ShippingMethod struct {
+
+	// The id of the shipping method.
+	ID string `json:"id"`
+
+	// The name of the shipping method.
+	Name string `json:"name"`
+
+	// The price of shipping the order with this method as decimal number.
+	Price string `json:"price"`
+}
@@ -0,0 +1,23 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// Stock - The stock level of a product.
+type Stock struct {
+
+	// The number of items in stock, including reserved ones.
+	Quantity int64 `json:"quantity"`
+
+	// The number of items that are reserved by orders that are being placed.
+	Reserved int64 `json:"reserved"`
+
+	// The number of items that can still be ordered.
+	Available int64 `json:"available"`
+}
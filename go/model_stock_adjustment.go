@@ -0,0 +1,17 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// StockAdjustment - A relative change of the stock level of a product.
+type StockAdjustment struct {
+
+	// The number of items to add to the stock. Negative numbers remove items.
+	Delta int64 `json:"delta"`
+}
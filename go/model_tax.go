@@ -0,0 +1,29 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// Tax - The value added tax on the positions of a tax class.
+type Tax struct {
+
+	// The tax class.
+	Class string `json:"class"`
+
+	// The tax rate in percent as decimal number, like 19 or 5.5.
+	Rate string `json:"rate"`
+
+	// The taxed sum without the tax as decimal number.
+	Net string `json:"net"`
+
+	// The tax as decimal number.
+	Amount string `json:"amount"`
+
+	// Whether the prices include the tax. Otherwise the tax is the price of the position.
+	Included bool `json:"included"`
+}
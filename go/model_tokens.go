@@ -0,0 +1,38 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// Tokens - The tokens of a login session.
+type Tokens struct {
+
+	// The UUID of the user.
+	ID string `json:"id"`
+
+	// The unique name of the user.
+	Name string `json:"name"`
+
+	// The roles of the user. Users without roles are customers.
+	Roles []string `json:"roles,omitempty"`
+
+	// The access token to use as a bearer token.
+	AccessToken string `json:"accessToken"`
+
+	// The type of the access token. It is always Bearer.
+	TokenType string `json:"tokenType"`
+
+	// The number of seconds until the access token expires.
+	ExpiresIn int64 `json:"expiresIn"`
+
+	// The token to get new tokens with. It can only be used once.
+	RefreshToken string `json:"refreshToken"`
+
+	// The number of seconds until the refresh token expires.
+	RefreshTokenExpiresIn int64 `json:"refreshTokenExpiresIn"`
+}
@@ -20,4 +20,11 @@ type User struct {
 
 	// The plain text password of the user.
 	Password string `json:"password,omitempty"`
+
+	// The access token of a guest whose carts and orders are claimed by the
+	// new user.
+	GuestToken string `json:"guestToken,omitempty"`
+
+	// The roles of the user. Users without roles are customers.
+	Roles []string `json:"roles,omitempty"`
 }
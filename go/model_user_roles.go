@@ -0,0 +1,17 @@
+/*
+ * ExCommerce
+ *
+ * ExCommerce is an example commerce system.
+ *
+ * API version: beta
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// UserRoles - The roles of a user.
+type UserRoles struct {
+
+	// The roles of the user. Users without roles are customers.
+	Roles []string `json:"roles"`
+}
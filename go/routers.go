@@ -10,13 +10,17 @@
 package openapi
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"runtime/debug"
 	"strconv"
 
-	"github.com/gorilla/handlers"
+	"github.com/Teelevision/excommerce/logging"
+	"github.com/Teelevision/excommerce/metrics"
 	"github.com/gorilla/mux"
 )
 
@@ -45,14 +49,35 @@ func NewRouter(routers ...Router) *mux.Router {
 				Methods(route.Method).
 				Path(route.Path).
 				Name(route.Name).
-				Handler(route.HandlerFunc)
+				Handler(metrics.Instrument(route.Name, route.HandlerFunc))
 		}
 	}
 
-	handlers.LoggingHandler(os.Stdout, router)
 	return router
 }
 
+// Recover is a middleware that recovers from panics in the handler. The panic
+// is logged with the request id and the unexpected error response is sent.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err) // aborts the response on purpose
+			}
+			logging.FromContext(r.Context()).Error("panic",
+				"error", fmt.Sprint(err),
+				"stack", string(debug.Stack()),
+			)
+			unexpectedError(r.Context(), nil, w)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
 func invalidInput(message, details string, w http.ResponseWriter) {
 	status := http.StatusBadRequest // 400
 	err := EncodeJSONResponse(map[string]string{
@@ -79,9 +104,12 @@ func failValidation(message, pointer string, w http.ResponseWriter) {
 	}
 }
 
-func unexpectedError(_ error, w http.ResponseWriter) {
+func unexpectedError(ctx context.Context, err error, w http.ResponseWriter) {
+	if err != nil {
+		logging.FromContext(ctx).Error("unexpected error", "error", err)
+	}
 	status := http.StatusInternalServerError // 500
-	err := EncodeJSONResponse(map[string]string{
+	err = EncodeJSONResponse(map[string]string{
 		"message": "Unexpected error.",
 	}, &status, w)
 	if err != nil {
@@ -0,0 +1,83 @@
+// Package health provides the liveness and readiness endpoints that
+// orchestrators use to decide whether to restart an instance and whether to
+// route requests to it.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Teelevision/excommerce/logging"
+)
+
+// Checker serves the health endpoints. The zero value is ready and has no
+// checks. Checker is safe for concurrent use.
+type Checker struct {
+	// Checks are run on every readiness request. The instance is ready if
+	// all of them return no error.
+	Checks map[string]func(context.Context) error
+	// Timeout limits the time of all checks. Zero means no timeout.
+	Timeout time.Duration
+
+	shuttingDown int32
+}
+
+// Status is the body of the health responses.
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// ShutDown marks the instance as not ready, so that no new requests are
+// routed to it while it drains.
+func (c *Checker) ShutDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+// Liveness responds with 200 OK as long as the server handles requests.
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, &Status{Status: "ok"})
+}
+
+// Readiness responds with 200 OK if all checks succeed and the instance is
+// not shutting down, and with 503 Service Unavailable otherwise.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&c.shuttingDown) != 0 {
+		writeStatus(w, http.StatusServiceUnavailable, &Status{Status: "shutting down"})
+		return
+	}
+
+	ctx := r.Context()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	status := Status{Status: "ok", Checks: make(map[string]string, len(c.Checks))}
+	code := http.StatusOK
+	for name, check := range c.Checks {
+		if err := check(ctx); err != nil {
+			logging.FromContext(ctx).Warn("readiness check failed", "check", name, "error", err)
+			status.Checks[name] = "failed"
+			status.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		} else {
+			status.Checks[name] = "ok"
+		}
+	}
+	writeStatus(w, code, &status)
+}
+
+func writeStatus(w http.ResponseWriter, code int, status *Status) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("Could not write health status: %s", err)
+	}
+}
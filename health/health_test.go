@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	var dbErr error
+	c := &Checker{
+		Checks: map[string]func(context.Context) error{
+			"persistence": func(context.Context) error { return dbErr },
+		},
+	}
+	do := func(handler http.HandlerFunc) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(c.Liveness).Code)
+	w := do(c.Readiness)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok","checks":{"persistence":"ok"}}`, w.Body.String())
+
+	// failing check
+	dbErr = errors.New("connection lost")
+	w = do(c.Readiness)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"unavailable","checks":{"persistence":"failed"}}`, w.Body.String())
+	assert.Equal(t, http.StatusOK, do(c.Liveness).Code)
+
+	// shutting down
+	dbErr = nil
+	c.ShutDown()
+	assert.Equal(t, http.StatusServiceUnavailable, do(c.Readiness).Code)
+	assert.Equal(t, http.StatusOK, do(c.Liveness).Code)
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Teelevision/excommerce/response"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header that carries the request id.
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware returns a middleware that puts a logger into the context of each
+// request. Its entries have the id of the request, which is taken from the
+// X-Request-ID header, if it is valid, or generated otherwise. The id is sent
+// back in the same header. Every request is logged when it is done.
+func Middleware(l *Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = uuid.New().String()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			logger := l.With("requestId", id)
+
+			recorder := response.NewRecorder(w)
+			next.ServeHTTP(recorder, r.WithContext(NewContext(r.Context(), logger)))
+
+			logger.Info("request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", recorder.Status(),
+				"bytes", recorder.Bytes(),
+				"durationMs", float64(time.Since(start).Microseconds())/1000,
+				"remoteAddr", r.RemoteAddr,
+				"userAgent", r.UserAgent(),
+			)
+		})
+	}
+}
+
+// validRequestID reports whether the id given by a client can be used. It
+// must be 1 to 128 printable ASCII characters, so that it cannot break logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+// Package logging writes structured log entries as JSON lines. Loggers are
+// carried in the context of requests, so that every entry of a request has its
+// request id.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+// levels
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the level with the given name.
+func ParseLevel(name string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Default is the logger that is used if the context has none.
+var Default = New(os.Stdout, LevelInfo)
+
+// Logger writes log entries of at least its level. Each entry is a JSON object
+// on a single line with the time, level, message and the fields of the logger
+// and the entry. Logger is safe for concurrent use.
+type Logger struct {
+	out    *output
+	level  Level
+	fields []byte // encoded fields, each starting with a comma
+}
+
+// output serializes the writes of all loggers derived from the same logger.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns a logger that writes to w.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w}, level: level}
+}
+
+// With returns a logger that adds the given fields to every entry. The fields
+// are given as alternating keys and values.
+func (l *Logger) With(fields ...interface{}) *Logger {
+	return &Logger{
+		out:    l.out,
+		level:  l.level,
+		fields: appendFields(append([]byte(nil), l.fields...), fields),
+	}
+}
+
+// Debug logs the message with the given fields at debug level.
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.log(LevelDebug, msg, fields)
+}
+
+// Info logs the message with the given fields at info level.
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.log(LevelInfo, msg, fields)
+}
+
+// Warn logs the message with the given fields at warn level.
+func (l *Logger) Warn(msg string, fields ...interface{}) {
+	l.log(LevelWarn, msg, fields)
+}
+
+// Error logs the message with the given fields at error level.
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.log(LevelError, msg, fields)
+}
+
+func (l *Logger) log(level Level, msg string, fields []interface{}) {
+	if level < l.level {
+		return
+	}
+	b := make([]byte, 0, 256)
+	b = append(b, `{"time":`...)
+	b = appendValue(b, time.Now().UTC().Format(time.RFC3339Nano))
+	b = append(b, `,"level":`...)
+	b = appendValue(b, level.String())
+	b = append(b, `,"msg":`...)
+	b = appendValue(b, msg)
+	b = append(b, l.fields...)
+	b = appendFields(b, fields)
+	b = append(b, "}\n"...)
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(b)
+}
+
+// Writer returns a writer that logs every write as message at the given level.
+// It can be used as output of the standard logger.
+func (l *Logger) Writer(level Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.log(level, string(bytes.TrimRight(p, "\n")), nil)
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func appendFields(b []byte, fields []interface{}) []byte {
+	for i := 0; i < len(fields); i += 2 {
+		b = append(b, ',')
+		b = appendValue(b, fmt.Sprint(fields[i]))
+		b = append(b, ':')
+		if i+1 < len(fields) {
+			b = appendValue(b, fields[i+1])
+		} else {
+			b = append(b, "null"...)
+		}
+	}
+	return b
+}
+
+func appendValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return append(b, data...)
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that carries the logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger of the context or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default
+}
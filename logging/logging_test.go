@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func entries(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, LevelInfo).With("requestId", "abc")
+	l.Debug("hidden")
+	l.Info("shown", "count", 3, "error", errors.New("oops"))
+	l.With("orderId", "o1").Warn("multi\nline")
+
+	e := entries(t, &b)
+	require.Len(t, e, 2)
+	assert.Equal(t, "info", e[0]["level"])
+	assert.Equal(t, "shown", e[0]["msg"])
+	assert.Equal(t, "abc", e[0]["requestId"])
+	assert.Equal(t, float64(3), e[0]["count"])
+	assert.Equal(t, "oops", e[0]["error"])
+	assert.NotEmpty(t, e[0]["time"])
+	assert.Equal(t, "warn", e[1]["level"])
+	assert.Equal(t, "multi\nline", e[1]["msg"])
+	assert.Equal(t, "o1", e[1]["orderId"])
+	assert.Equal(t, "abc", e[1]["requestId"])
+}
+
+func TestParseLevel(t *testing.T) {
+	l, err := ParseLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, l)
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	var b bytes.Buffer
+	handler := Middleware(New(&b, LevelInfo))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("handled")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	// given id
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/path", nil)
+	r.Header.Set(RequestIDHeader, "client-id")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, "client-id", w.Header().Get(RequestIDHeader))
+	e := entries(t, &b)
+	require.Len(t, e, 2)
+	assert.Equal(t, "handled", e[0]["msg"])
+	assert.Equal(t, "client-id", e[0]["requestId"])
+	assert.Equal(t, "request", e[1]["msg"])
+	assert.Equal(t, "client-id", e[1]["requestId"])
+	assert.Equal(t, float64(http.StatusTeapot), e[1]["status"])
+	assert.Equal(t, "/path", e[1]["path"])
+
+	// invalid id
+	b.Reset()
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/path", nil)
+	r.Header.Set(RequestIDHeader, "bad id")
+	handler.ServeHTTP(w, r)
+	id := w.Header().Get(RequestIDHeader)
+	assert.NotEqual(t, "bad id", id)
+	assert.Len(t, id, 36)
+	assert.Equal(t, id, entries(t, &b)[0]["requestId"])
+}
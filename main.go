@@ -11,42 +11,208 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Teelevision/excommerce/authentication"
+	"github.com/Teelevision/excommerce/config"
 	"github.com/Teelevision/excommerce/controller"
 	openapi "github.com/Teelevision/excommerce/go"
+	"github.com/Teelevision/excommerce/health"
+	"github.com/Teelevision/excommerce/logging"
+	"github.com/Teelevision/excommerce/metrics"
 	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/notification"
+	"github.com/Teelevision/excommerce/notification/local"
+	"github.com/Teelevision/excommerce/payment/fake"
 	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/persistence/embedded"
 	"github.com/Teelevision/excommerce/persistence/inmemory"
 	logrepo "github.com/Teelevision/excommerce/persistence/log"
+	"github.com/Teelevision/excommerce/persistence/postgres"
+	"github.com/Teelevision/excommerce/ratelimit"
+	"github.com/Teelevision/excommerce/shipping"
+	"github.com/Teelevision/excommerce/tax"
+	"github.com/google/uuid"
 	"github.com/gorilla/handlers"
 )
 
 func main() {
+	// the standard logger writes structured logs as well
+	log.SetFlags(0)
+	log.SetOutput(logging.Default.Writer(logging.LevelInfo))
 	log.Printf("Server started")
 
+	// run returns instead of exiting, so that its deferred calls close the
 	// persistence
-	repo := inmemory.NewAdapter()
-	initAdmin(context.Background(), repo)
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Server stopped")
+}
+
+// run configures and runs the server until it is stopped by a signal or
+// fails.
+func run() error {
+	// configuration
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %w", err)
+	}
+
+	// logging
+	logLevel, err := logging.ParseLevel(cfg.Logging.Level)
+	if err != nil {
+		panic(err) // validated by config
+	}
+	logging.Default = logging.New(os.Stdout, logLevel)
+	log.SetOutput(logging.Default.Writer(logging.LevelInfo))
+
+	// persistence
+	var repo repository
+	switch cfg.Persistence.Backend {
+	case config.BackendPostgres:
+		postgresRepo, err := postgres.Open(context.Background(), cfg.Persistence.PostgresDSN)
+		if err != nil {
+			return fmt.Errorf("could not open PostgreSQL database: %w", err)
+		}
+		defer postgresRepo.Close()
+		repo = postgresRepo
+	case config.BackendEmbedded:
+		embeddedRepo, err := embedded.Open(cfg.Persistence.EmbeddedDBFile)
+		if err != nil {
+			return fmt.Errorf("could not open embedded database file: %w", err)
+		}
+		defer embeddedRepo.Close()
+		repo = embeddedRepo
+	default:
+		repo = inmemory.NewAdapter()
+	}
+	placedOrderRepo := logrepo.NewAdapter(repo)
+	if err := initAdmin(context.Background(), repo, cfg.Auth.AdminName); err != nil {
+		return err
+	}
 	initProducts(context.Background(), repo)
-	logRepo := logrepo.NewAdapter()
+	initPromotions(context.Background(), repo)
+
+	// payment
+	paymentProvider := fake.NewProvider()
+	if cfg.Payment.FakeFile != "" {
+		paymentProvider, err = fake.Open(cfg.Payment.FakeFile)
+		if err != nil {
+			return fmt.Errorf("could not load fake payments: %w", err)
+		}
+	}
+
+	// notifications
+	var notifier notification.Notifier = local.NewNotifier(os.Stdout)
+	if cfg.Notifications.File != "" {
+		file, err := os.OpenFile(cfg.Notifications.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("could not open notification file: %w", err)
+		}
+		defer file.Close()
+		notifier = local.NewNotifier(file)
+	}
+
+	// taxes
+	var taxRates *tax.Rates
+	if cfg.Taxes.File != "" {
+		taxRates, err = tax.Load(cfg.Taxes.File)
+		if err != nil {
+			return fmt.Errorf("could not load tax rates: %w", err)
+		}
+	}
+
+	// shipping
+	var shippingMethods shipping.Methods
+	if cfg.Shipping.File != "" {
+		shippingMethods, err = shipping.Load(cfg.Shipping.File)
+		if err != nil {
+			return fmt.Errorf("could not load shipping methods: %w", err)
+		}
+	}
+
+	// brute-force protection of login and basic auth
+	rateLimitStore := ratelimit.NewMemoryStore()
+	ipLimiter := &ratelimit.Limiter{
+		Store:        rateLimitStore,
+		Prefix:       "ip:",
+		FreeFailures: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		ForgetAfter:  time.Hour,
+	}
+	accountLimiter := &ratelimit.Limiter{
+		Store:          rateLimitStore,
+		Prefix:         "account:",
+		FreeFailures:   5,
+		BaseDelay:      time.Second,
+		MaxDelay:       15 * time.Minute,
+		ForgetAfter:    time.Hour,
+		ResetOnSuccess: true,
+	}
 
 	// authentication
-	authenticator := authentication.Authenticator{UserRepository: repo}
+	authenticator := authentication.Authenticator{
+		UserRepository:    repo,
+		SessionRepository: repo,
+		Secret:            []byte(cfg.Auth.TokenSecret),
+		BasicAuth:         cfg.Auth.BasicAuth,
+		IPLimiter:         ipLimiter,
+		AccountLimiter:    accountLimiter,
+	}
 
 	// controllers
-	userController := controller.User{UserRepository: repo}
-	productController := controller.Product{ProductRepository: repo, CouponRepository: repo}
-	cartController := controller.Cart{CartRepository: repo, ProductRepository: repo}
+	userController := controller.User{
+		UserRepository:          repo,
+		SessionRepository:       repo,
+		CartRepository:          repo,
+		OrderRepository:         repo,
+		PlacedOrderRepository:   placedOrderRepo,
+		PasswordResetRepository: repo,
+		Authenticator:           &authenticator,
+		Notifier:                notifier,
+		AccessTokenLifetime:     time.Duration(cfg.Auth.AccessTokenLifetime),
+		RefreshTokenLifetime:    time.Duration(cfg.Auth.RefreshTokenLifetime),
+		GuestTokenLifetime:      time.Duration(cfg.Auth.GuestTokenLifetime),
+		PasswordResetLifetime:   time.Duration(cfg.Auth.PasswordResetLifetime),
+	}
+	productController := controller.Product{
+		ProductRepository:     repo,
+		CouponRepository:      repo,
+		PromotionRepository:   repo,
+		StockRepository:       repo,
+		CouponDefaultLifetime: time.Duration(cfg.Coupons.DefaultLifetime),
+	}
+	cartController := controller.Cart{
+		CartRepository:      repo,
+		ProductRepository:   repo,
+		PromotionRepository: repo,
+	}
 	orderController := controller.Order{
 		OrderRepository:       repo,
 		CartRepository:        repo,
 		ProductRepository:     repo,
 		CouponRepository:      repo,
-		PlacedOrderRepository: logRepo,
+		PromotionRepository:   repo,
+		PlacedOrderRepository: placedOrderRepo,
+		StockRepository:       repo,
+		PaymentProvider:       paymentProvider,
+		TaxRates:              taxRates,
+		ShippingMethods:       shippingMethods,
+	}
+	promotionController := controller.Promotion{
+		PromotionRepository: repo,
+		ProductRepository:   repo,
 	}
 
 	// apis
@@ -55,6 +221,10 @@ func main() {
 		CartController:    &cartController,
 		ProductController: &productController,
 	}
+	couponsAPI := &openapi.CouponsAPI{
+		Authenticator:     &authenticator,
+		ProductController: &productController,
+	}
 	ordersAPI := &openapi.OrdersAPI{
 		Authenticator:     &authenticator,
 		OrderController:   &orderController,
@@ -64,12 +234,34 @@ func main() {
 	productsAPI := &openapi.ProductsAPI{
 		Authenticator:     &authenticator,
 		ProductController: &productController,
+		TaxRates:          taxRates,
+	}
+	promotionsAPI := &openapi.PromotionsAPI{
+		Authenticator:       &authenticator,
+		PromotionController: &promotionController,
+		ProductController:   &productController,
 	}
 	usersAPI := &openapi.UsersAPI{
+		Authenticator:  &authenticator,
 		UserController: &userController,
+		IPLimiter:      ipLimiter,
+		AccountLimiter: accountLimiter,
 	}
 
-	router := openapi.NewRouter(cartsAPI, ordersAPI, productsAPI, usersAPI)
+	router := openapi.NewRouter(cartsAPI, couponsAPI, ordersAPI, productsAPI, promotionsAPI, usersAPI)
+
+	// health
+	healthChecker := &health.Checker{
+		Checks: map[string]func(context.Context) error{
+			"persistence": repo.Ping,
+		},
+		Timeout: 5 * time.Second,
+	}
+	router.Methods("GET").Path("/healthz").HandlerFunc(healthChecker.Liveness)
+	router.Methods("GET").Path("/readyz").HandlerFunc(healthChecker.Readiness)
+
+	// metrics
+	router.Methods("GET").Path("/metrics").Handler(metrics.Default.Handler())
 
 	// serve static files
 	router.PathPrefix("/beta/static/").
@@ -77,14 +269,12 @@ func main() {
 
 	var handler http.Handler = router
 
-	// logging
-	handler = handlers.CombinedLoggingHandler(os.Stdout, router)
+	// recover panics
+	handler = openapi.Recover(handler)
 
 	// CORS
 	handler = handlers.CORS(
-		handlers.AllowedOrigins([]string{
-			"http://localhost:3000", // frontend
-		}),
+		handlers.AllowedOrigins(cfg.Server.AllowedOrigins),
 		handlers.AllowedMethods([]string{
 			"HEAD", "GET", "POST", "PUT", "DELETE",
 		}),
@@ -92,34 +282,192 @@ func main() {
 			"X-Requested-With",
 			"Content-Type",
 			"Authorization",
+			logging.RequestIDHeader,
+		}),
+		handlers.ExposedHeaders([]string{
+			"Link",                  // pagination
+			"Retry-After",           // rate limiting
+			logging.RequestIDHeader, // logging
 		}),
 	)(handler)
 
-	// recover panics
-	handler = handlers.RecoveryHandler(
-		handlers.PrintRecoveryStack(true),
-	)(handler)
+	// request ids and logging
+	handler = logging.Middleware(logging.Default)(handler)
+
+	server := &http.Server{
+		Addr:         cfg.Server.Address,
+		Handler:      handler,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:  time.Duration(cfg.Server.IdleTimeout),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		if cfg.Server.TLS() {
+			serverErr <- server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
 
-	log.Fatal(http.ListenAndServe(":8080", handler))
+	// serve until stopped
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("server failed: %w", err)
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+	}
+
+	// Not being ready takes a while to reach the load balancers. Until then
+	// new requests are still served. Another signal skips the wait.
+	healthChecker.ShutDown()
+	select {
+	case <-time.After(time.Duration(cfg.Server.DrainDelay)):
+	case sig := <-stop:
+		log.Printf("Received %s, skipping the drain delay", sig)
+	}
+
+	// Drain in-flight requests, so that e.g. orders are not left behind
+	// half-placed. The persistence is closed afterwards by the deferred calls.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Could not drain all requests: %s", err)
+	}
+	return nil
 }
 
-func initAdmin(ctx context.Context, r persistence.UserRepository) {
-	err := r.CreateUser(ctx, "6de47f66-15d1-4e95-b41f-9b17d49ce898", "admin", "admin")
+// repository is implemented by all adapters that can be used as the main
+// persistence.
+type repository interface {
+	persistence.Pinger
+	persistence.UserRepository
+	persistence.SessionRepository
+	persistence.PasswordResetRepository
+	persistence.ProductRepository
+	persistence.CartRepository
+	persistence.CouponRepository
+	persistence.OrderRepository
+	persistence.PromotionRepository
+	persistence.PlacedOrderRepository
+	persistence.StockRepository
+}
+
+// The initial data is created only once. Persistent repositories may already
+// contain it from a previous start.
+
+// initAdmin creates the first administrator with the given name if there is
+// none. It gets a random password that is logged once. An error is returned if
+// the name is taken.
+func initAdmin(ctx context.Context, r persistence.UserRepository, name string) error {
+	admins, err := r.FindUsersWithRole(ctx, model.RoleAdmin)
 	if err != nil {
 		panic(err)
 	}
+	if len(admins) > 0 {
+		return nil
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		panic(err)
+	}
+	secret := make([]byte, 18)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	password := base64.RawURLEncoding.EncodeToString(secret)
+
+	err = r.CreateUser(ctx, id.String(), name, password)
+	if errors.Is(err, persistence.ErrConflict) {
+		return fmt.Errorf(`could not create the first administrator, because the name %q is taken.
+Use ADMIN_NAME to choose another name`, name)
+	} else if err != nil {
+		panic(err)
+	}
+	if err := r.SetUserRoles(ctx, id.String(), []model.Role{model.RoleAdmin}); err != nil {
+		panic(err)
+	}
+	log.Printf("Created the administrator %q with the id %s and the password %q. "+
+		"The password is not shown again.", name, id, password)
+	return nil
 }
 
 func initProducts(ctx context.Context, r persistence.ProductRepository) {
-	for _, product := range []model.Product{
-		{ID: "a6da78f8-2be6-49ff-b40a-32aa86a6a986", Name: "Apple", Price: 49},
-		{ID: "b16088e1-9603-4676-a8df-130823cf15a5", Name: "Banana", Price: 99},
-		{ID: "5438bfe8-6bd2-4a88-ac36-ec29716eb6d7", Name: "Pear", Price: 109},
-		{ID: "cfae533e-d9f2-4bbc-8fcb-24866fdca8fc", Name: "Orange", Price: 79},
+	for id, product := range map[string]persistence.ProductAttributes{
+		"a6da78f8-2be6-49ff-b40a-32aa86a6a986": {
+			Name:        "Apple",
+			Price:       49,
+			Prices:      map[model.Currency]int{"USD": 55},
+			Description: "A crisp and juicy apple.",
+			Weight:      180,
+			SKU:         "FRUIT-APPLE",
+			Categories:  []string{"fruits"},
+			Attributes:  map[string]string{"color": "red"},
+		},
+		"b16088e1-9603-4676-a8df-130823cf15a5": {
+			Name:        "Banana",
+			Price:       99,
+			Prices:      map[model.Currency]int{"USD": 109},
+			Description: "A sweet banana.",
+			Weight:      120,
+			SKU:         "FRUIT-BANANA",
+			Categories:  []string{"fruits", "tropical fruits"},
+			Attributes:  map[string]string{"color": "yellow"},
+		},
+		"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": {
+			Name:        "Pear",
+			Price:       109,
+			Prices:      map[model.Currency]int{"USD": 119},
+			Description: "A ripe pear.",
+			Weight:      200,
+			SKU:         "FRUIT-PEAR",
+			Categories:  []string{"fruits"},
+			Attributes:  map[string]string{"color": "green"},
+		},
+		"cfae533e-d9f2-4bbc-8fcb-24866fdca8fc": {
+			Name:        "Orange",
+			Price:       79,
+			Description: "A fresh orange.",
+			Weight:      150,
+			SKU:         "FRUIT-ORANGE",
+			Categories:  []string{"fruits", "citrus fruits"},
+			Attributes:  map[string]string{"color": "orange"},
+		},
 	} {
-		err := r.CreateProduct(context.Background(), product.ID, product.Name, product.Price)
-		if err != nil {
+		product.Images = []model.Image{
+			{URL: "/beta/static/products/" + id + ".jpg", Alt: product.Name},
+		}
+		err := r.CreateProduct(ctx, id, product)
+		if err != nil && !errors.Is(err, persistence.ErrConflict) {
 			panic(err)
 		}
 	}
 }
+
+func initPromotions(ctx context.Context, r persistence.PromotionRepository) {
+	// promotions are only seeded once, so that changes at runtime are kept
+	err := r.SeedPromotions(ctx, map[string]persistence.PromotionAttributes{
+		"4a0d5f6e-3f2c-4c3b-9b4e-2f5a3b1c7d21": {
+			Type:      model.PromotionTypeQuantityThreshold,
+			Name:      "10% off apples",
+			ProductID: "a6da78f8-2be6-49ff-b40a-32aa86a6a986", // apple
+			Quantity:  7,
+			Discount:  10,
+		},
+		"0de17a66-ea59-4032-9383-2603c6c77d25": {
+			Type: model.PromotionTypeBundle,
+			Name: "Set of 4 pears and 2 bananas (30% off)",
+			Bundle: map[string]int{
+				"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": 4, // pear
+				"b16088e1-9603-4676-a8df-130823cf15a5": 2, // banana
+			},
+			Discount: 30,
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Teelevision/excommerce/response"
+)
+
+var httpRequestDuration = NewHistogramVec(
+	"excommerce_http_request_duration_seconds",
+	"Latency of http requests by route, method and status.",
+	DefaultBuckets,
+	"route", "method", "status",
+)
+
+// Instrument records the latency and status of the requests of the route with
+// the given name. Panics are recorded as 500 Internal Server Error, because
+// that is what the recovery handler responds with.
+func Instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := response.NewRecorder(w)
+		defer func() {
+			err := recover()
+			status := recorder.Status()
+			if err != nil {
+				status = http.StatusInternalServerError
+			}
+			httpRequestDuration.
+				With(route, r.Method, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+			if err != nil {
+				panic(err)
+			}
+		}()
+		next(recorder, r)
+	}
+}
@@ -0,0 +1,389 @@
+// Package metrics collects counters and histograms and exposes them in the
+// Prometheus text format, so that they can be scraped without any client
+// library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets that fit the
+// latency of http requests in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry that the package functions register with.
+var Default = NewRegistry()
+
+// Registry holds metrics and writes them in the Prometheus text format.
+// Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// metric is a family of series with the same name.
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// register adds the metric. It panics if the name is invalid or taken,
+// because that is a programming error.
+func (r *Registry) register(m metric) {
+	if !validName(m.name()) {
+		panic(fmt.Sprintf("metrics: invalid name %q", m.name()))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[m.name()] {
+		panic(fmt.Sprintf("metrics: duplicate name %q", m.name()))
+	}
+	r.names[m.name()] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes all metrics sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+
+	cw := countingWriter{w: w}
+	bw := bufio.NewWriter(&cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler returns the handler of the metrics endpoint.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	vec *CounterVec
+}
+
+// NewCounter creates a counter and registers it with the default registry.
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewCounter creates a counter and registers it. The counter is reported as 0
+// until it is increased.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	vec := r.NewCounterVec(name, help)
+	vec.With()
+	return &Counter{vec: vec}
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.vec.With().Add(1)
+}
+
+// Add increases the counter by the given value. It panics if the value is
+// negative.
+func (c *Counter) Add(v float64) {
+	c.vec.With().Add(v)
+}
+
+// CounterVec is a family of counters that are distinguished by label values.
+type CounterVec struct {
+	family
+}
+
+// NewCounterVec creates a counter family with the given label names and
+// registers it with the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec creates a counter family with the given label names and
+// registers it.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{family: newFamily(name, help, "counter", labels)}
+	r.register(v)
+	return v
+}
+
+// CounterValue is the counter of a label combination.
+type CounterValue struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// With returns the counter of the given label values, which must be given in
+// the order of the label names.
+func (v *CounterVec) With(values ...string) *CounterValue {
+	return v.get(values, func() interface{} { return &CounterValue{} }).(*CounterValue)
+}
+
+// Inc increments the counter by 1.
+func (c *CounterValue) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter by the given value. It panics if the value is
+// negative.
+func (c *CounterValue) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, s interface{}) {
+		c := s.(*CounterValue)
+		c.mu.Lock()
+		value := c.value
+		c.mu.Unlock()
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, labels, formatFloat(value))
+	})
+}
+
+// HistogramVec is a family of histograms that are distinguished by label
+// values.
+type HistogramVec struct {
+	family
+	buckets []float64
+}
+
+// NewHistogramVec creates a histogram family with the given bucket upper
+// bounds and label names and registers it with the default registry.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec creates a histogram family with the given bucket upper
+// bounds and label names and registers it. The +Inf bucket is added
+// implicitly.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets must be sorted")
+	}
+	for _, label := range labels {
+		if label == "le" {
+			panic(`metrics: histograms cannot have the label "le"`)
+		}
+	}
+	v := &HistogramVec{
+		family:  newFamily(name, help, "histogram", labels),
+		buckets: append([]float64(nil), buckets...),
+	}
+	r.register(v)
+	return v
+}
+
+// Histogram is the histogram of a label combination.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // cumulative
+	count   uint64
+	sum     float64
+}
+
+// With returns the histogram of the given label values, which must be given
+// in the order of the label names.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.get(values, func() interface{} {
+		return &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+	}).(*Histogram)
+}
+
+// Observe adds the value to the histogram.
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, s interface{}) {
+		h := s.(*Histogram)
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		count, sum := h.count, h.sum
+		h.mu.Unlock()
+
+		// the le label is appended to the other labels
+		prefix := "{"
+		if labels != "" {
+			prefix = labels[:len(labels)-1] + ","
+		}
+		for i, bound := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%sle=\"%s\"} %d\n", v.metricName, prefix, formatFloat(bound), counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%sle=\"+Inf\"} %d\n", v.metricName, prefix, count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.metricName, labels, formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.metricName, labels, count)
+	})
+}
+
+// family holds the series of a metric by their label values.
+type family struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+
+	mu       sync.Mutex
+	byLabels map[string]*series
+}
+
+type series struct {
+	labels string // formatted like {a="1",b="2"}, empty without labels
+	value  interface{}
+}
+
+func newFamily(name, help, typ string, labels []string) family {
+	for _, label := range labels {
+		if !validName(label) || strings.Contains(label, ":") || strings.HasPrefix(label, "__") {
+			panic(fmt.Sprintf("metrics: invalid label name %q", label))
+		}
+	}
+	return family{
+		metricName: name,
+		help:       help,
+		typ:        typ,
+		labels:     append([]string(nil), labels...),
+		byLabels:   make(map[string]*series),
+	}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// get returns the value of the given label values and creates it if it
+// does not exist yet.
+func (f *family) get(values []string, create func() interface{}) interface{} {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	labels := formatLabels(f.labels, values)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.byLabels[labels]
+	if !ok {
+		s = &series{labels: labels, value: create()}
+		f.byLabels[labels] = s
+	}
+	return s.value
+}
+
+// each calls fn for each series sorted by labels.
+func (f *family) each(fn func(labels string, value interface{})) {
+	f.mu.Lock()
+	all := make([]*series, 0, len(f.byLabels))
+	for _, s := range f.byLabels {
+		all = append(all, s)
+	}
+	f.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].labels < all[j].labels })
+	for _, s := range all {
+		fn(s.labels, s.value)
+	}
+}
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, helpEscaper.Replace(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.typ)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// validName reports whether the name matches [a-zA-Z_:][a-zA-Z0-9_:]*.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	orders := r.NewCounter("orders_total", "Number of orders.")
+	carts := r.NewCounterVec("carts_total", "Number of carts\nby operation.", "operation")
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	orders.Inc()
+	orders.Add(2.5)
+	carts.With("update").Inc()
+	carts.With(`cre"ate`).Inc()
+	latency.With("a").Observe(0.05)
+	latency.With("a").Observe(0.5)
+	latency.With("a").Observe(5)
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP carts_total Number of carts\nby operation.
+# TYPE carts_total counter
+carts_total{operation="cre\"ate"} 1
+carts_total{operation="update"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="a",le="0.1"} 1
+latency_seconds_bucket{route="a",le="1"} 2
+latency_seconds_bucket{route="a",le="+Inf"} 3
+latency_seconds_sum{route="a"} 5.55
+latency_seconds_count{route="a"} 3
+# HELP orders_total Number of orders.
+# TYPE orders_total counter
+orders_total 3.5
+`, b.String())
+
+	assert.Panics(t, func() { r.NewCounter("orders_total", "Duplicate.") })
+	assert.Panics(t, func() { r.NewCounter("0rders", "Invalid.") })
+	assert.Panics(t, func() { carts.With() })
+	assert.Panics(t, func() { orders.Add(-1) })
+}
+
+func TestInstrument(t *testing.T) {
+	handler := Instrument("TestInstrument", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("test")
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Panics(t, func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	})
+
+	w := httptest.NewRecorder()
+	Default.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(),
+		`excommerce_http_request_duration_seconds_count{route="TestInstrument",method="GET",status="404"} 1`)
+	assert.Contains(t, w.Body.String(),
+		`excommerce_http_request_duration_seconds_count{route="TestInstrument",method="GET",status="500"} 1`)
+}
@@ -5,5 +5,6 @@ type Cart struct {
 	ID string
 
 	Positions []Position
+	Currency  Currency // of the prices of the positions, chosen on creation
 	Locked    bool
 }
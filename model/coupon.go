@@ -2,13 +2,43 @@ package model
 
 import "time"
 
-// Coupon is a coupon that gives a discount on a specific product.
+// Coupon is a coupon that gives a discount on a specific product, or on the
+// whole cart if it has no product. The discount is either in percent or a
+// fixed amount.
 type Coupon struct {
 	Code string // like an id
 
-	Product   *Product
-	ProductID string
-	Name      string
-	Discount  int // in percent
-	ExpiresAt time.Time
+	Product     *Product
+	ProductID   string
+	Name        string
+	Discount    int // in percent
+	Amount      int // in cents
+	MinSubtotal int // in cents
+	NotBefore   time.Time
+	ExpiresAt   time.Time
+
+	MaxRedemptions        int // zero means unlimited
+	MaxRedemptionsPerUser int // zero means unlimited
+	Redemptions           int // number of placed orders that used the coupon
+}
+
+// CartWide returns whether the coupon applies to the whole cart.
+func (c *Coupon) CartWide() bool {
+	return c.ProductID == ""
+}
+
+// Saving returns the amount in cents that the coupon takes off the given
+// price. It is never more than the price.
+func (c *Coupon) Saving(price int) int {
+	saving := c.Amount
+	if c.Discount > 0 {
+		saving = c.Discount * price / 100
+	}
+	if saving > price {
+		saving = price
+	}
+	if saving < 0 {
+		saving = 0
+	}
+	return saving
 }
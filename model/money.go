@@ -0,0 +1,111 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Currency is a currency by its code (ISO 4217), like EUR.
+type Currency string
+
+// DefaultCurrency is the currency of the base prices of products and of the
+// fixed amounts of coupons.
+const DefaultCurrency Currency = "EUR"
+
+// currencyDigits maps the supported currencies to the number of digits of
+// their minor unit.
+var currencyDigits = map[Currency]int{
+	"CHF": 2,
+	"CZK": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"NOK": 2,
+	"PLN": 2,
+	"SEK": 2,
+	"USD": 2,
+}
+
+// Valid returns whether the currency is one of the supported currencies.
+func (c Currency) Valid() bool {
+	_, ok := currencyDigits[c]
+	return ok
+}
+
+// Digits returns the number of digits of the minor unit of the currency, like
+// 2 for cents.
+func (c Currency) Digits() int {
+	return currencyDigits[c]
+}
+
+// Money is an exact amount of money in a currency.
+type Money struct {
+	Amount   int // in the minor unit of the currency, like cents
+	Currency Currency
+}
+
+// ErrInvalidMoney is returned by ParseMoney if the amount is not a decimal
+// number or has more digits than the currency allows.
+var ErrInvalidMoney = errors.New("invalid amount of money")
+
+// maxMoneyDigits is the maximum number of digits of the whole units of an
+// amount, so that the amount fits in the minor unit.
+const maxMoneyDigits = 12
+
+// ParseMoney parses an amount like 12.34 or -5 in the given currency. The
+// fractional digits must not exceed the digits of the minor unit of the
+// currency. ErrInvalidMoney is returned otherwise.
+func ParseMoney(s string, currency Currency) (Money, error) {
+	digits := currency.Digits()
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+		if fraction == "" {
+			return Money{}, ErrInvalidMoney
+		}
+	}
+	if whole == "" || len(whole) > maxMoneyDigits || len(fraction) > digits {
+		return Money{}, ErrInvalidMoney
+	}
+	amount := 0
+	for _, r := range whole + fraction + strings.Repeat("0", digits-len(fraction)) {
+		if r < '0' || r > '9' {
+			return Money{}, ErrInvalidMoney
+		}
+		amount = amount*10 + int(r-'0')
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String returns the amount as decimal number with all digits of the minor
+// unit of the currency, like 12.30, without the currency.
+func (m Money) String() string {
+	var b strings.Builder
+	amount := m.Amount
+	if amount < 0 {
+		b.WriteByte('-')
+		amount = -amount
+	}
+	digits := m.Currency.Digits()
+	unit := 1
+	for i := 0; i < digits; i++ {
+		unit *= 10
+	}
+	b.WriteString(strconv.Itoa(amount / unit))
+	if digits > 0 {
+		fraction := strconv.Itoa(amount % unit)
+		b.WriteByte('.')
+		b.WriteString(strings.Repeat("0", digits-len(fraction)))
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	for _, c := range []struct {
+		s        string
+		currency Currency
+		amount   int
+	}{
+		{"12.34", "EUR", 1234},
+		{"12.3", "EUR", 1230},
+		{"12", "EUR", 1200},
+		{"0.07", "USD", 7},
+		{"-1.50", "EUR", -150},
+		{"1500", "JPY", 1500},
+		{"999999999999.99", "EUR", 99999999999999},
+	} {
+		m, err := ParseMoney(c.s, c.currency)
+		if assert.NoError(t, err, c.s) {
+			assert.Equal(t, Money{Amount: c.amount, Currency: c.currency}, m, c.s)
+		}
+	}
+	for _, c := range []struct {
+		s        string
+		currency Currency
+	}{
+		{"", "EUR"},
+		{"-", "EUR"},
+		{".5", "EUR"},
+		{"1.", "EUR"},
+		{"1.234", "EUR"},
+		{"1.5", "JPY"},
+		{"1e3", "EUR"},
+		{"+1", "EUR"},
+		{" 1", "EUR"},
+		{"1,50", "EUR"},
+		{"1000000000000", "EUR"},
+	} {
+		_, err := ParseMoney(c.s, c.currency)
+		assert.Equal(t, ErrInvalidMoney, err, c.s)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	assert.Equal(t, "12.34", Money{1234, "EUR"}.String())
+	assert.Equal(t, "0.05", Money{5, "USD"}.String())
+	assert.Equal(t, "-1.50", Money{-150, "EUR"}.String())
+	assert.Equal(t, "0.00", Money{0, "EUR"}.String())
+	assert.Equal(t, "1500", Money{1500, "JPY"}.String())
+}
+
+func TestProductPriceIn(t *testing.T) {
+	p := Product{Price: 100, Prices: map[Currency]int{"USD": 120}}
+	price, ok := p.PriceIn(DefaultCurrency)
+	assert.True(t, ok)
+	assert.Equal(t, 100, price)
+	price, ok = p.PriceIn("USD")
+	assert.True(t, ok)
+	assert.Equal(t, 120, price)
+	_, ok = p.PriceIn("GBP")
+	assert.False(t, ok)
+}
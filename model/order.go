@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // Order is an order of an cart that can be placed.
 type Order struct {
 	ID string
@@ -10,7 +12,36 @@ type Order struct {
 	Buyer     Address
 	Recipient Address
 	Coupons   []*Coupon
-	Price     int // in cents
+	Currency  Currency // of all prices of the order
+	Price     int      // in cents
 	Positions []Position
 	Locked    bool
+	PlacedAt  time.Time // zero unless placed
+
+	ShippingMethodID string           // chosen, empty if orders are not shipped
+	ShippingMethods  []ShippingMethod // available, only set when prepared
+
+	Status        OrderStatus
+	StatusHistory []OrderStatusChange // oldest first, empty unless placed
+}
+
+// OrderStatus is the status in the lifecycle of an order.
+type OrderStatus string
+
+// all order statuses
+const (
+	OrderStatusValid     OrderStatus = "valid" // prepared, but not placed yet
+	OrderStatusPlaced    OrderStatus = "placed"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusPacked    OrderStatus = "packed"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+// OrderStatusChange is a change of the status of an order.
+type OrderStatusChange struct {
+	Status    OrderStatus
+	ChangedAt time.Time
 }
@@ -6,6 +6,9 @@ type Position struct {
 	ProductID  string
 	Coupon     *Coupon
 	CouponCode string
+	Promotion  *Promotion
+	Tax        *Tax
+	Shipping   *ShippingMethod
 	Quantity   int
 	Price      int // in cents
 	SavedPrice int // in cents
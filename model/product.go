@@ -5,6 +5,43 @@ type Product struct {
 	ID string
 
 	Name       string
-	Price      int // in cents
-	SavedPrice int // in cents
+	Price      int              // in cents, in the default currency
+	Prices     map[Currency]int // in cents, by currency other than the default one
+	SavedPrice int              // in cents
+	TaxClass   string           // empty for the default tax class
+	Weight     int              // in grams
+
+	Description string
+	SKU         string            // stock keeping unit
+	Categories  []string          // names of the categories it belongs to
+	Attributes  map[string]string // free-form, like color or origin
+	Images      []Image           // the first one is the main image
+}
+
+// PriceIn returns the price in cents of the product in the given currency.
+// False is returned if the product has no price in the currency.
+func (p *Product) PriceIn(currency Currency) (int, bool) {
+	if currency == DefaultCurrency {
+		return p.Price, true
+	}
+	price, ok := p.Prices[currency]
+	return price, ok
 }
+
+// Image is an image asset.
+type Image struct {
+	URL string
+	Alt string // alternative text
+}
+
+// ProductSort is the order in which products are listed. Products with the
+// same sort key are ordered by id.
+type ProductSort string
+
+// product sort orders
+const (
+	ProductSortNameAsc   ProductSort = "name"
+	ProductSortNameDesc  ProductSort = "-name"
+	ProductSortPriceAsc  ProductSort = "price"
+	ProductSortPriceDesc ProductSort = "-price"
+)
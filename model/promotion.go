@@ -0,0 +1,31 @@
+package model
+
+// Promotion is a discount that is applied automatically to carts and orders if
+// its conditions are met.
+type Promotion struct {
+	ID string
+
+	Type         PromotionType
+	Name         string
+	ProductID    string         // used by quantity threshold and buy x get y
+	Quantity     int            // minimum quantity or x of buy x get y
+	FreeQuantity int            // y of buy x get y
+	Bundle       map[string]int // product id to quantity, used by bundle
+	Discount     int            // in percent
+}
+
+// PromotionType is the type of a promotion.
+type PromotionType string
+
+// promotion types
+const (
+	// PromotionTypeQuantityThreshold gives a discount on all items of a
+	// product if at least a minimum quantity is ordered.
+	PromotionTypeQuantityThreshold PromotionType = "quantityThreshold"
+	// PromotionTypeBundle combines a set of products into a bundle with a
+	// discount. The bundle is a virtual product with the promotion's id.
+	PromotionTypeBundle PromotionType = "bundle"
+	// PromotionTypeBuyXGetY gives a discount on y items of a product for every
+	// x items that are ordered. A discount of 100 makes the y items free.
+	PromotionTypeBuyXGetY PromotionType = "buyXGetY"
+)
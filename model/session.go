@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Session is the login session of a user. It lasts as long as its refresh
+// token is valid and is renewed with every refresh.
+type Session struct {
+	ID string
+
+	UserID    string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,8 @@
+package model
+
+// ShippingMethod is a way to ship an order with its price for the order.
+type ShippingMethod struct {
+	ID    string
+	Name  string
+	Price int // in cents
+}
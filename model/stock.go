@@ -0,0 +1,15 @@
+package model
+
+// Stock is the stock level of a product. Reserved items are part of the
+// quantity, but are held for orders that are being placed.
+type Stock struct {
+	ProductID string
+
+	Quantity int // items in stock, including reserved ones
+	Reserved int
+}
+
+// Available returns the number of items that can still be ordered.
+func (s *Stock) Available() int {
+	return s.Quantity - s.Reserved
+}
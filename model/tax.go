@@ -0,0 +1,10 @@
+package model
+
+// Tax is the value added tax on the positions of a tax class in an order.
+type Tax struct {
+	Class    string
+	Rate     int  // in hundredths of a percent, like 1900 for 19 %
+	Net      int  // in cents, the taxed sum without the tax
+	Amount   int  // in cents
+	Included bool // whether the prices of the positions include the tax
+}
@@ -1,8 +1,74 @@
 package model
 
-// User is a user who can login and order products.
+// User is a user who can login and order products. Guests are users without
+// an account; they have no name, password or roles.
 type User struct {
 	ID string
 
-	Name string
+	Name  string
+	Roles []Role
+	Guest bool
+}
+
+// HasPermission returns whether any role of the user grants the permission.
+func (u *User) HasPermission(permission Permission) bool {
+	for _, role := range u.Roles {
+		for _, p := range rolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Role is a role of a user. Roles grant permissions. Users without roles are
+// customers.
+type Role string
+
+// all roles
+const (
+	// RoleAdmin grants all permissions.
+	RoleAdmin Role = "admin"
+	// RoleCatalogManager grants the permissions to manage products, their
+	// stock, coupons and promotions.
+	RoleCatalogManager Role = "catalogManager"
+	// RoleOrderManager grants the permission to manage placed orders.
+	RoleOrderManager Role = "orderManager"
+)
+
+// Valid returns whether the role is one of the known roles.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Permission allows a user to do something that customers cannot do.
+type Permission string
+
+// all permissions
+const (
+	PermissionManageUsers      Permission = "manageUsers"
+	PermissionManageProducts   Permission = "manageProducts" // including stock
+	PermissionManageCoupons    Permission = "manageCoupons"
+	PermissionManagePromotions Permission = "managePromotions"
+	PermissionManageOrders     Permission = "manageOrders"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermissionManageUsers,
+		PermissionManageProducts,
+		PermissionManageCoupons,
+		PermissionManagePromotions,
+		PermissionManageOrders,
+	},
+	RoleCatalogManager: {
+		PermissionManageProducts,
+		PermissionManageCoupons,
+		PermissionManagePromotions,
+	},
+	RoleOrderManager: {
+		PermissionManageOrders,
+	},
 }
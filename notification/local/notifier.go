@@ -0,0 +1,42 @@
+// Package local implements a notifier that writes notifications to a local
+// writer, like stdout or a file, instead of delivering them. It stands in for
+// a mail service during local development.
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Teelevision/excommerce/notification"
+)
+
+// Notifier is the local notifier. Please use NewNotifier to create a new
+// instance. Notifier is safe for concurrent use.
+type Notifier struct {
+	mx sync.Mutex
+	w  io.Writer
+}
+
+var _ notification.Notifier = (*Notifier)(nil)
+
+// NewNotifier returns a new notifier that writes to w.
+func NewNotifier(w io.Writer) *Notifier {
+	return &Notifier{w: w}
+}
+
+// Notify writes the notification.
+func (n *Notifier) Notify(_ context.Context, notification notification.Notification) error {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	_, err := fmt.Fprintf(n.w, "Date: %s\nTo: %s <%s>\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC1123Z),
+		notification.UserName, notification.UserID,
+		notification.Subject,
+		notification.Text,
+	)
+	return err
+}
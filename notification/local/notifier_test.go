@@ -0,0 +1,26 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Teelevision/excommerce/notification"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewNotifier(&buf)
+
+	err := n.Notify(context.Background(), notification.Notification{
+		UserID:   "6f0c8b4e-1a2d-4c3b-9e5f-7a8b9c0d1e2f",
+		UserName: "marius",
+		Subject:  "Reset your password",
+		Text:     "Use this token: abc",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "To: marius <6f0c8b4e-1a2d-4c3b-9e5f-7a8b9c0d1e2f>\n")
+	assert.Contains(t, buf.String(), "Subject: Reset your password\n\nUse this token: abc\n")
+}
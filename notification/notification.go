@@ -0,0 +1,22 @@
+// Package notification defines the interface to notifiers that deliver
+// messages to users, like the mails to reset passwords.
+package notification
+
+import (
+	"context"
+)
+
+// Notifier delivers notifications. Implementations must be safe for concurrent
+// use.
+type Notifier interface {
+	// Notify delivers the notification to the user.
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// Notification is a message to a user.
+type Notification struct {
+	UserID   string
+	UserName string
+	Subject  string
+	Text     string
+}
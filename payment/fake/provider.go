@@ -0,0 +1,179 @@
+// Package fake implements a payment provider that does not process any real
+// payments. Its behaviour is determined by the payment source and therefore
+// suited for tests and local development.
+package fake
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/Teelevision/excommerce/payment"
+)
+
+// Sources with a defined behaviour. Any other source, including the empty one,
+// is authorized.
+const (
+	SourceApproved = "fake_approved"
+	SourceDeclined = "fake_declined"
+)
+
+// State is the state of an authorization.
+type State string
+
+// all authorization states
+const (
+	StateAuthorized State = "authorized"
+	StateCaptured   State = "captured"
+	StateVoided     State = "voided"
+	StateRefunded   State = "refunded"
+)
+
+// Authorization is an authorization of the fake provider.
+type Authorization struct {
+	Payment payment.Payment
+	State   State
+}
+
+// Provider is the fake payment provider. Authorization ids are random, like
+// "fake_auth_" followed by 32 hex digits. Please use NewProvider or Open to
+// create a new instance. Provider is safe for concurrent use.
+type Provider struct {
+	mx             sync.Mutex
+	file           string // empty if the authorizations are only kept in memory
+	authorizations map[string]*Authorization
+}
+
+var _ payment.Provider = (*Provider)(nil)
+
+// NewProvider returns a new fake payment provider that keeps its
+// authorizations in memory. They are lost on restart.
+func NewProvider() *Provider {
+	return &Provider{authorizations: make(map[string]*Authorization)}
+}
+
+// Open returns a new fake payment provider that stores its authorizations in
+// the given JSON file, so that they survive restarts. The file is created if
+// it does not exist.
+func Open(file string) (*Provider, error) {
+	p := &Provider{file: file, authorizations: make(map[string]*Authorization)}
+	data, err := ioutil.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+		return p, p.save()
+	case err != nil:
+		return nil, fmt.Errorf("could not read fake payment file: %w", err)
+	}
+	if err := json.Unmarshal(data, &p.authorizations); err != nil {
+		return nil, fmt.Errorf("could not parse fake payment file %s: %w", file, err)
+	}
+	if p.authorizations == nil { // the file contained null
+		p.authorizations = make(map[string]*Authorization)
+	}
+	return p, nil
+}
+
+// Authorize authorizes the payment and returns the id of the authorization.
+// ErrDeclined is returned if the source is SourceDeclined.
+func (p *Provider) Authorize(_ context.Context, pmt payment.Payment) (string, error) {
+	if pmt.Source == SourceDeclined {
+		return "", payment.ErrDeclined
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	id := "fake_auth_" + hex.EncodeToString(random)
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.authorizations[id] = &Authorization{
+		Payment: pmt,
+		State:   StateAuthorized,
+	}
+	if err := p.save(); err != nil {
+		delete(p.authorizations, id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Capture charges the whole amount of the authorization with the given id.
+// ErrNotFound is returned if there is no authorization with the id.
+// ErrInvalidState is returned if the authorization is not authorized.
+func (p *Provider) Capture(_ context.Context, authorizationID string) error {
+	return p.transition(authorizationID, StateAuthorized, StateCaptured)
+}
+
+// Void releases the amount of the authorization with the given id. ErrNotFound
+// is returned if there is no authorization with the id. ErrInvalidState is
+// returned if the authorization is not authorized.
+func (p *Provider) Void(_ context.Context, authorizationID string) error {
+	return p.transition(authorizationID, StateAuthorized, StateVoided)
+}
+
+// Refund pays back the whole amount of the authorization with the given id.
+// ErrNotFound is returned if there is no authorization with the id.
+// ErrInvalidState is returned if the authorization is not captured.
+func (p *Provider) Refund(_ context.Context, authorizationID string) error {
+	return p.transition(authorizationID, StateCaptured, StateRefunded)
+}
+
+// Authorization returns the authorization with the given id. ErrNotFound is
+// returned if there is no authorization with the id.
+func (p *Provider) Authorization(authorizationID string) (Authorization, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	authorization, ok := p.authorizations[authorizationID]
+	if !ok {
+		return Authorization{}, payment.ErrNotFound
+	}
+	return *authorization, nil
+}
+
+func (p *Provider) transition(authorizationID string, from, to State) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	authorization, ok := p.authorizations[authorizationID]
+	if !ok {
+		return payment.ErrNotFound
+	}
+	if authorization.State != from {
+		return fmt.Errorf("%w: %s", payment.ErrInvalidState, authorization.State)
+	}
+	authorization.State = to
+	if err := p.save(); err != nil {
+		authorization.State = from
+		return err
+	}
+	return nil
+}
+
+// writes the authorizations to the file, if any. The file is replaced, so
+// that it is never left half written. The caller must hold the lock.
+func (p *Provider) save() error {
+	if p.file == "" {
+		return nil
+	}
+	data, err := json.Marshal(p.authorizations)
+	if err != nil {
+		return err
+	}
+	tmp := p.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("could not write fake payment file: %w", err)
+	}
+	if err := os.Rename(tmp, p.file); err != nil {
+		return fmt.Errorf("could not write fake payment file: %w", err)
+	}
+	return nil
+}
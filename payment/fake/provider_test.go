@@ -0,0 +1,94 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Teelevision/excommerce/payment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider(t *testing.T) {
+	ctx := context.Background()
+	p := NewProvider()
+
+	// authorize
+	id1, err := p.Authorize(ctx, payment.Payment{OrderID: "order1", Amount: 155, Source: SourceApproved})
+	require.NoError(t, err)
+	assert.Regexp(t, "^fake_auth_[0-9a-f]{32}$", id1)
+	id2, err := p.Authorize(ctx, payment.Payment{OrderID: "order2", Amount: 49})
+	require.NoError(t, err)
+	assert.NotEqual(t, id1, id2)
+	_, err = p.Authorize(ctx, payment.Payment{OrderID: "order3", Amount: 99, Source: SourceDeclined})
+	assert.True(t, errors.Is(err, payment.ErrDeclined))
+
+	// capture and refund the first
+	require.NoError(t, p.Capture(ctx, id1))
+	assert.True(t, errors.Is(p.Void(ctx, id1), payment.ErrInvalidState))
+	require.NoError(t, p.Refund(ctx, id1))
+	assert.True(t, errors.Is(p.Refund(ctx, id1), payment.ErrInvalidState))
+	authorization, err := p.Authorization(id1)
+	require.NoError(t, err)
+	assert.Equal(t, StateRefunded, authorization.State)
+	assert.Equal(t, 155, authorization.Payment.Amount)
+
+	// void the second
+	assert.True(t, errors.Is(p.Refund(ctx, id2), payment.ErrInvalidState))
+	require.NoError(t, p.Void(ctx, id2))
+	assert.True(t, errors.Is(p.Capture(ctx, id2), payment.ErrInvalidState))
+	authorization, err = p.Authorization(id2)
+	require.NoError(t, err)
+	assert.Equal(t, StateVoided, authorization.State)
+
+	// unknown
+	for _, id := range []string{"", "fake_auth_1", id1 + "x", NewProvider().mustAuthorize(t)} {
+		assert.True(t, errors.Is(p.Capture(ctx, id), payment.ErrNotFound), id)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "fake")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "payments.json")
+
+	p, err := Open(file)
+	require.NoError(t, err)
+	id1 := p.mustAuthorize(t)
+	id2 := p.mustAuthorize(t)
+	require.NoError(t, p.Capture(ctx, id1))
+
+	// the authorizations survive a restart
+	p, err = Open(file)
+	require.NoError(t, err)
+	authorization, err := p.Authorization(id1)
+	require.NoError(t, err)
+	assert.Equal(t, StateCaptured, authorization.State)
+	assert.Equal(t, 155, authorization.Payment.Amount)
+	require.NoError(t, p.Void(ctx, id2))
+	assert.NotEqual(t, id1, p.mustAuthorize(t))
+
+	p, err = Open(file)
+	require.NoError(t, err)
+	authorization, err = p.Authorization(id2)
+	require.NoError(t, err)
+	assert.Equal(t, StateVoided, authorization.State)
+
+	// invalid file
+	require.NoError(t, ioutil.WriteFile(file, []byte("fake_auth_1"), 0600))
+	_, err = Open(file)
+	assert.Error(t, err)
+}
+
+// authorizes a payment and returns the id of the authorization
+func (p *Provider) mustAuthorize(t *testing.T) string {
+	id, err := p.Authorize(context.Background(), payment.Payment{OrderID: "order", Amount: 155})
+	require.NoError(t, err)
+	return id
+}
@@ -0,0 +1,46 @@
+// Package payment defines the interface to payment providers. An order is paid
+// in two steps: First an amount is authorized, which reserves it at the
+// payment provider. Later the authorization is either captured, which actually
+// charges the amount, or voided, which releases it. Captured authorizations can
+// be refunded.
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+// payment errors
+var (
+	ErrDeclined     = errors.New("payment declined")
+	ErrNotFound     = errors.New("authorization not found")
+	ErrInvalidState = errors.New("invalid authorization state")
+)
+
+// Provider is a payment provider. Implementations must be safe for concurrent
+// use.
+type Provider interface {
+	// Authorize authorizes the payment and returns the id of the
+	// authorization. ErrDeclined is returned if the payment was declined.
+	Authorize(ctx context.Context, payment Payment) (string, error)
+	// Capture charges the whole amount of the authorization with the given
+	// id. ErrNotFound is returned if there is no authorization with the id.
+	// ErrInvalidState is returned if the authorization is not authorized.
+	Capture(ctx context.Context, authorizationID string) error
+	// Void releases the amount of the authorization with the given id.
+	// ErrNotFound is returned if there is no authorization with the id.
+	// ErrInvalidState is returned if the authorization is not authorized.
+	Void(ctx context.Context, authorizationID string) error
+	// Refund pays back the whole amount of the authorization with the given
+	// id. ErrNotFound is returned if there is no authorization with the id.
+	// ErrInvalidState is returned if the authorization is not captured.
+	Refund(ctx context.Context, authorizationID string) error
+}
+
+// Payment is a payment that is to be authorized.
+type Payment struct {
+	OrderID  string
+	Amount   int    // in cents
+	Currency string // code (ISO 4217), like EUR
+	Source   string // provider specific token of e.g. a credit card
+}
@@ -0,0 +1,131 @@
+// Package embedded implements repositories that persist in a single local
+// file. No database server is required, which makes it suitable for
+// single-node deployments.
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Adapter is the embedded persistence adapter. It implements a range of
+// repositories. Please use Open to create a new instance. Adapter is safe for
+// concurrent use.
+//
+// Every entity type is stored in its own bucket. Values are JSON encoded. Like
+// in the in-memory adapter, deleted carts and orders are kept as a null value,
+// so that they can be told apart from entities that never existed.
+type Adapter struct {
+	db *bbolt.DB
+
+	bcryptCost int
+}
+
+// Option can be used to configure an adapter.
+type Option func(*Adapter)
+
+// FastLessSecureHashingForTesting is an option that configures an adapter to
+// use a less secure hashing. It is not secure enough to use in production, but
+// can speed up tests.
+func FastLessSecureHashingForTesting() Option {
+	return func(a *Adapter) {
+		a.bcryptCost = bcrypt.MinCost
+	}
+}
+
+var buckets = [][]byte{
+	usersBucket,
+	userNamesBucket,
+	guestClaimsBucket,
+	sessionsBucket,
+	passwordResetsBucket,
+	productsBucket,
+	cartsBucket,
+	couponsBucket,
+	couponRedemptionsBucket,
+	ordersBucket,
+	placedOrdersBucket,
+	promotionsBucket,
+	seedsBucket,
+	stocksBucket,
+	stockReservationsBucket,
+}
+
+// Open opens the file at the given path and returns a new adapter that uses
+// it. The file is created if it does not exist. Only one adapter can use the
+// file at a time. Open fails if the file is not released within a second.
+func Open(path string, options ...Option) (*Adapter, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	a := Adapter{
+		db: db,
+	}
+	for _, option := range options {
+		option(&a)
+	}
+	return &a, nil
+}
+
+// Close closes the file.
+func (a *Adapter) Close() error {
+	return a.db.Close()
+}
+
+var _ persistence.Pinger = (*Adapter)(nil)
+
+// Ping returns an error if the persistence does not respond, e.g. because the
+// file is closed.
+func (a *Adapter) Ping(context.Context) error {
+	return a.db.View(func(*bbolt.Tx) error { return nil })
+}
+
+// bbolt does not support empty keys, but ids may be empty. Therefore all keys
+// are prefixed.
+const keyPrefix = '#'
+
+func encodeKey(key string) []byte {
+	return append([]byte{keyPrefix}, key...)
+}
+
+func decodeKey(key []byte) string {
+	return string(key[1:])
+}
+
+// get decodes the value of the key into v. It returns false if there is no
+// value for the key.
+func get(b *bbolt.Bucket, key string, v interface{}) (bool, error) {
+	data := b.Get(encodeKey(key))
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// put encodes v and stores it as the value of the key.
+func put(b *bbolt.Bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(encodeKey(key), data)
+}
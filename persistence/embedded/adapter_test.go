@@ -0,0 +1,183 @@
+package embedded_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/persistence/embedded"
+	"github.com/Teelevision/excommerce/persistence/testsuite"
+)
+
+func TestAdapterImplementsUserRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.UserRepositoryTestSuite{
+		NewRepository: func() persistence.UserRepository {
+			return newAdapter(embedded.FastLessSecureHashingForTesting())
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsProductRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.ProductRepositoryTestSuite{
+		NewRepository: func() persistence.ProductRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsCartRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.CartRepositoryTestSuite{
+		NewRepository: func() persistence.CartRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsCouponRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.CouponRepositoryTestSuite{
+		NewRepository: func() persistence.CouponRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsOrderRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.OrderRepositoryTestSuite{
+		NewRepository: func() persistence.OrderRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPromotionRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.PromotionRepositoryTestSuite{
+		NewRepository: func() persistence.PromotionRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsStockRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.StockRepositoryTestSuite{
+		NewRepository: func() persistence.StockRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsSessionRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.SessionRepositoryTestSuite{
+		NewRepository: func() persistence.SessionRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPasswordResetRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.PasswordResetRepositoryTestSuite{
+		NewRepository: func() persistence.PasswordResetRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPlacedOrderRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.PlacedOrderRepositoryTestSuite{
+		NewRepository: func() persistence.PlacedOrderRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterPersistsData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "excommerce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db")
+
+	a, err := embedded.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.CreateProduct(ctx, "c1f0e3f4-1e2a-4f4f-9e1b-1a2b3c4d5e6f", persistence.ProductAttributes{Name: "Apple", Price: 49}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err = embedded.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	product, err := a.FindProduct(ctx, "c1f0e3f4-1e2a-4f4f-9e1b-1a2b3c4d5e6f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "Apple" || product.Price != 49 {
+		t.Errorf("unexpected product %+v", product)
+	}
+}
+
+func TestAdapterPing(t *testing.T) {
+	a := adapterFactory(t)()
+	if err := a.Ping(ctx); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Ping(ctx); err == nil {
+		t.Error("expected an error after closing")
+	}
+}
+
+var ctx = context.Background()
+
+// adapterFactory returns a function that creates adapters, each with a new
+// file in a temporary directory that is removed when the test finishes.
+func adapterFactory(t *testing.T) func(options ...embedded.Option) *embedded.Adapter {
+	dir, err := ioutil.TempDir("", "excommerce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	var n int
+	return func(options ...embedded.Option) *embedded.Adapter {
+		n++
+		a, err := embedded.Open(filepath.Join(dir, fmt.Sprintf("%d.db", n)), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+}
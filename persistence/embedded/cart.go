@@ -0,0 +1,222 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.CartRepository = (*Adapter)(nil)
+
+var cartsBucket = []byte("carts")
+
+type cart struct {
+	UserID    string
+	Currency  model.Currency // empty if stored before carts had a currency
+	Positions map[string]int // maps product id to quantity
+	Locked    bool
+}
+
+// CreateCart creates a cart for the given user with the given id, currency and
+// positions. Id must be unique. ErrConflict is returned otherwise. Positions
+// maps product ids to quantity.
+func (a *Adapter) CreateCart(_ context.Context, userID, id string, currency model.Currency, positions map[string]int) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		carts := tx.Bucket(cartsBucket)
+		if carts.Get(encodeKey(id)) != nil {
+			return persistence.ErrConflict
+		}
+		return put(carts, id, cart{
+			UserID:    userID,
+			Currency:  currency,
+			Positions: positions,
+		})
+	})
+}
+
+// UpdateCartOfUser updates a cart of the given user with new positions in the
+// given currency. Any existing positions are replaced. ErrNotFound is returned
+// if the cart does not exist. ErrDeleted is returned if the cart did exist but
+// is deleted. ErrNotOwnedByUser is returned if the cart exists but it's not
+// owned by the given user. ErrLocked is returned if the cart is owned by the
+// given user, but is locked. ErrConflict is returned if the cart is in another
+// currency. Carts that were stored without a currency take the given one.
+func (a *Adapter) UpdateCartOfUser(_ context.Context, userID, id string, currency model.Currency, positions map[string]int) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		carts := tx.Bucket(cartsBucket)
+		cart, err := findUnlockedCartOfUser(carts, userID, id)
+		if err != nil {
+			return err
+		}
+		if cart.Currency != "" && cart.Currency != currency {
+			return persistence.ErrConflict
+		}
+		cart.Currency = currency
+		cart.Positions = positions
+		return put(carts, id, cart)
+	})
+}
+
+// FindAllUnlockedCartsOfUser returns all stored carts and their positions of
+// the given user. Carts are returned with their currency, which is empty if
+// they were stored without one.
+func (a *Adapter) FindAllUnlockedCartsOfUser(_ context.Context, userID string) ([]*model.Cart, error) {
+	result := make([]*model.Cart, 0)
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(cartsBucket).ForEach(func(k, v []byte) error {
+			var cart *cart
+			if err := json.Unmarshal(v, &cart); err != nil {
+				return err
+			}
+			if cart == nil || cart.UserID != userID || cart.Locked {
+				return nil
+			}
+			result = append(result, convertCartOut(decodeKey(k), cart))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindCartOfUser returns the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user.
+func (a *Adapter) FindCartOfUser(_ context.Context, userID, id string) (*model.Cart, error) {
+	var cart *cart
+	err := a.db.View(func(tx *bbolt.Tx) (err error) {
+		cart, err = findCartOfUser(tx.Bucket(cartsBucket), userID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertCartOut(id, cart), nil
+}
+
+// DeleteCartOfUser deletes the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user. ErrLocked is
+// returned if the cart is owned by the given user, but is locked.
+func (a *Adapter) DeleteCartOfUser(_ context.Context, userID, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		carts := tx.Bucket(cartsBucket)
+		if _, err := findUnlockedCartOfUser(carts, userID, id); err != nil {
+			return err
+		}
+		return put(carts, id, nil)
+	})
+}
+
+// LockCartOfUser locks the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user. ErrLocked is
+// returned if the cart is owned by the given user, but is locked.
+func (a *Adapter) LockCartOfUser(_ context.Context, userID, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		carts := tx.Bucket(cartsBucket)
+		cart, err := findUnlockedCartOfUser(carts, userID, id)
+		if err != nil {
+			return err
+		}
+		cart.Locked = true
+		return put(carts, id, cart)
+	})
+}
+
+// UnlockCartOfUser unlocks the cart of the given user with the given cart id.
+// Unlocking a cart that is not locked has no effect. ErrNotFound is returned
+// if there is no cart with the id. ErrDeleted is returned if the cart did exist
+// but is deleted. ErrNotOwnedByUser is returned if the cart exists but it's not
+// owned by the given user.
+func (a *Adapter) UnlockCartOfUser(_ context.Context, userID, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		carts := tx.Bucket(cartsBucket)
+		cart, err := findCartOfUser(carts, userID, id)
+		if err != nil {
+			return err
+		}
+		cart.Locked = false
+		return put(carts, id, cart)
+	})
+}
+
+// TransferCartsOfUser transfers all unlocked carts of the given user to the new
+// user. Locked and deleted carts stay with the given user.
+func (a *Adapter) TransferCartsOfUser(_ context.Context, userID, newUserID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		carts := tx.Bucket(cartsBucket)
+		transferred := make(map[string]*cart)
+		err := carts.ForEach(func(k, v []byte) error {
+			var cart *cart
+			if err := json.Unmarshal(v, &cart); err != nil {
+				return err
+			}
+			if cart != nil && cart.UserID == userID && !cart.Locked {
+				cart.UserID = newUserID
+				transferred[decodeKey(k)] = cart
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for id, cart := range transferred {
+			if err := put(carts, id, cart); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func findCartOfUser(carts *bbolt.Bucket, userID, id string) (*cart, error) {
+	var cart *cart
+	ok, err := get(carts, id, &cart)
+	switch {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, persistence.ErrNotFound
+	case cart == nil:
+		return nil, persistence.ErrDeleted
+	case cart.UserID != userID:
+		return nil, persistence.ErrNotOwnedByUser
+	}
+	return cart, nil
+}
+
+func findUnlockedCartOfUser(carts *bbolt.Bucket, userID, id string) (*cart, error) {
+	cart, err := findCartOfUser(carts, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if cart.Locked {
+		return nil, persistence.ErrLocked
+	}
+	return cart, nil
+}
+
+func convertCartOut(id string, cart *cart) *model.Cart {
+	out := model.Cart{
+		ID:        id,
+		Positions: make([]model.Position, 0, len(cart.Positions)),
+		Currency:  cart.Currency,
+		Locked:    cart.Locked,
+	}
+	for productID, quantity := range cart.Positions {
+		out.Positions = append(out.Positions, model.Position{
+			ProductID: productID,
+			Quantity:  quantity,
+		})
+	}
+	return &out
+}
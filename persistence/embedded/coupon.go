@@ -0,0 +1,378 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.CouponRepository = (*Adapter)(nil)
+
+var (
+	couponsBucket           = []byte("coupons")
+	couponRedemptionsBucket = []byte("couponRedemptions") // by order id
+)
+
+type coupon struct {
+	Name                  string
+	ProductID             string
+	Discount              int
+	Amount                int
+	MinSubtotal           int
+	MaxRedemptions        int
+	MaxRedemptionsPerUser int
+	NotBefore             time.Time
+	ExpiresAt             time.Time
+	Redemptions           int
+}
+
+type couponRedemption struct {
+	Code   string
+	UserID string
+}
+
+// StoreCoupon stores a coupon with the given code and attributes. If a coupon
+// with the same code was previously stored it is overwritten, but keeps its
+// redemptions.
+func (a *Adapter) StoreCoupon(_ context.Context, code string, attributes persistence.CouponAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		coupons := tx.Bucket(couponsBucket)
+
+		var existing coupon
+		if _, err := get(coupons, code, &existing); err != nil {
+			return err
+		}
+
+		return put(coupons, code, coupon{
+			Name:                  attributes.Name,
+			ProductID:             attributes.ProductID,
+			Discount:              attributes.Discount,
+			Amount:                attributes.Amount,
+			MinSubtotal:           attributes.MinSubtotal,
+			MaxRedemptions:        attributes.MaxRedemptions,
+			MaxRedemptionsPerUser: attributes.MaxRedemptionsPerUser,
+			NotBefore:             persistence.Timestamp(attributes.NotBefore),
+			ExpiresAt:             persistence.Timestamp(attributes.ExpiresAt),
+			Redemptions:           existing.Redemptions,
+		})
+	})
+}
+
+// CreateCoupon stores a new coupon with the given code and attributes.
+// ErrConflict is returned if there already is a coupon with the code.
+func (a *Adapter) CreateCoupon(_ context.Context, code string, attributes persistence.CouponAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		coupons := tx.Bucket(couponsBucket)
+		if coupons.Get(encodeKey(code)) != nil {
+			return persistence.ErrConflict
+		}
+		return put(coupons, code, coupon{
+			Name:                  attributes.Name,
+			ProductID:             attributes.ProductID,
+			Discount:              attributes.Discount,
+			Amount:                attributes.Amount,
+			MinSubtotal:           attributes.MinSubtotal,
+			MaxRedemptions:        attributes.MaxRedemptions,
+			MaxRedemptionsPerUser: attributes.MaxRedemptionsPerUser,
+			NotBefore:             persistence.Timestamp(attributes.NotBefore),
+			ExpiresAt:             persistence.Timestamp(attributes.ExpiresAt),
+		})
+	})
+}
+
+// CreateCoupons stores new coupons with the given distinct codes and the same
+// attributes. Either all coupons are created or none. A
+// *CouponConflictError is returned if there already are coupons with some of
+// the codes.
+func (a *Adapter) CreateCoupons(_ context.Context, codes []string, attributes persistence.CouponAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		coupons := tx.Bucket(couponsBucket)
+		var conflicts []string
+		for _, code := range codes {
+			if coupons.Get(encodeKey(code)) != nil {
+				conflicts = append(conflicts, code)
+			}
+		}
+		if len(conflicts) > 0 {
+			return &persistence.CouponConflictError{Codes: conflicts}
+		}
+		value := coupon{
+			Name:                  attributes.Name,
+			ProductID:             attributes.ProductID,
+			Discount:              attributes.Discount,
+			Amount:                attributes.Amount,
+			MinSubtotal:           attributes.MinSubtotal,
+			MaxRedemptions:        attributes.MaxRedemptions,
+			MaxRedemptionsPerUser: attributes.MaxRedemptionsPerUser,
+			NotBefore:             persistence.Timestamp(attributes.NotBefore),
+			ExpiresAt:             persistence.Timestamp(attributes.ExpiresAt),
+		}
+		for _, code := range codes {
+			if err := put(coupons, code, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindValidCoupon returns the coupon with the given code that has started and
+// is not expired. ErrNotFound is returned if there is no coupon with the code,
+// or the coupon has not started yet or is expired.
+func (a *Adapter) FindValidCoupon(_ context.Context, code string) (*model.Coupon, error) {
+	var coupon coupon
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(couponsBucket), code, &coupon)
+		now := time.Now()
+		if err != nil {
+			return err
+		} else if !ok || coupon.ExpiresAt.Before(now) || coupon.NotBefore.After(now) {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertCouponOut(code, &coupon), nil
+}
+
+// FindCoupon returns the coupon with the given code, even if it is expired.
+// ErrNotFound is returned if there is no coupon with the code.
+func (a *Adapter) FindCoupon(_ context.Context, code string) (*model.Coupon, error) {
+	var coupon coupon
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(couponsBucket), code, &coupon)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertCouponOut(code, &coupon), nil
+}
+
+// FindAllCoupons returns all coupons, including the expired ones, ordered by
+// code.
+func (a *Adapter) FindAllCoupons(context.Context) ([]*model.Coupon, error) {
+	var result []*model.Coupon
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		// keys are sorted, so the coupons are ordered by code
+		return tx.Bucket(couponsBucket).ForEach(func(k, v []byte) error {
+			var coupon coupon
+			if err := json.Unmarshal(v, &coupon); err != nil {
+				return err
+			}
+			result = append(result, convertCouponOut(decodeKey(k), &coupon))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindCouponsOfProduct returns all coupons of the product with the given id,
+// including the expired ones, ordered by code. The coupons on whole carts are
+// returned for the empty product id.
+func (a *Adapter) FindCouponsOfProduct(_ context.Context, productID string) ([]*model.Coupon, error) {
+	var result []*model.Coupon
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		// keys are sorted, so the coupons are ordered by code
+		return tx.Bucket(couponsBucket).ForEach(func(k, v []byte) error {
+			var coupon coupon
+			if err := json.Unmarshal(v, &coupon); err != nil {
+				return err
+			}
+			if coupon.ProductID == productID {
+				result = append(result, convertCouponOut(decodeKey(k), &coupon))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteCoupon deletes the coupon with the given code and its redemptions.
+// ErrNotFound is returned if there is no coupon with the code.
+func (a *Adapter) DeleteCoupon(_ context.Context, code string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		coupons := tx.Bucket(couponsBucket)
+		if coupons.Get(encodeKey(code)) == nil {
+			return persistence.ErrNotFound
+		}
+		if err := coupons.Delete(encodeKey(code)); err != nil {
+			return err
+		}
+
+		// drop the redemptions
+		redemptionsOfOrders := tx.Bucket(couponRedemptionsBucket)
+		changed := make(map[string][]couponRedemption)
+		err := redemptionsOfOrders.ForEach(func(k, v []byte) error {
+			var redemptions []couponRedemption
+			if err := json.Unmarshal(v, &redemptions); err != nil {
+				return err
+			}
+			kept := make([]couponRedemption, 0, len(redemptions))
+			for _, redemption := range redemptions {
+				if redemption.Code != code {
+					kept = append(kept, redemption)
+				}
+			}
+			if len(kept) < len(redemptions) {
+				changed[decodeKey(k)] = kept
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for orderID, kept := range changed {
+			if len(kept) == 0 {
+				err = redemptionsOfOrders.Delete(encodeKey(orderID))
+			} else {
+				err = put(redemptionsOfOrders, orderID, kept)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RedeemCoupons records a redemption of each coupon with the given codes by
+// the order and user with the given ids. Any previous redemptions of the order
+// are replaced. Either all coupons are redeemed or none. ErrNotFound is
+// returned if there is no coupon with one of the codes. ErrLimitReached is
+// returned if a coupon would be redeemed more often than its maximum
+// redemptions in total or per user.
+func (a *Adapter) RedeemCoupons(_ context.Context, orderID, userID string, codes []string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		if err := releaseCouponRedemptions(tx, orderID); err != nil {
+			return err
+		}
+
+		coupons := tx.Bucket(couponsBucket)
+		redemptions := make([]couponRedemption, len(codes))
+		for i, code := range codes {
+			var coupon coupon
+			ok, err := get(coupons, code, &coupon)
+			if err != nil {
+				return err
+			} else if !ok {
+				return persistence.ErrNotFound
+			}
+			if coupon.MaxRedemptions > 0 && coupon.Redemptions >= coupon.MaxRedemptions {
+				return persistence.ErrLimitReached
+			}
+			if coupon.MaxRedemptionsPerUser > 0 {
+				ofUser, err := countCouponRedemptionsOfUser(tx, code, userID)
+				if err != nil {
+					return err
+				}
+				if ofUser >= coupon.MaxRedemptionsPerUser {
+					return persistence.ErrLimitReached
+				}
+			}
+			coupon.Redemptions++
+			if err := put(coupons, code, coupon); err != nil {
+				return err
+			}
+			redemptions[i] = couponRedemption{Code: code, UserID: userID}
+		}
+		if len(redemptions) == 0 {
+			return nil
+		}
+		return put(tx.Bucket(couponRedemptionsBucket), orderID, redemptions)
+	})
+}
+
+// ReleaseCouponRedemptions drops the redemptions of the order with the given
+// id. Releasing an order without redemptions has no effect.
+func (a *Adapter) ReleaseCouponRedemptions(_ context.Context, orderID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return releaseCouponRedemptions(tx, orderID)
+	})
+}
+
+func releaseCouponRedemptions(tx *bbolt.Tx, orderID string) error {
+	redemptionsOfOrders := tx.Bucket(couponRedemptionsBucket)
+	var redemptions []couponRedemption
+	ok, err := get(redemptionsOfOrders, orderID, &redemptions)
+	if err != nil || !ok {
+		return err
+	}
+	coupons := tx.Bucket(couponsBucket)
+	for _, redemption := range redemptions {
+		var coupon coupon
+		ok, err := get(coupons, redemption.Code, &coupon)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		coupon.Redemptions--
+		if err := put(coupons, redemption.Code, coupon); err != nil {
+			return err
+		}
+	}
+	return redemptionsOfOrders.Delete(encodeKey(orderID))
+}
+
+// CountCouponRedemptionsOfUser returns how often the coupon with the given code
+// was redeemed by the user with the given id.
+func (a *Adapter) CountCouponRedemptionsOfUser(_ context.Context, code, userID string) (int, error) {
+	var count int
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		count, err = countCouponRedemptionsOfUser(tx, code, userID)
+		return err
+	})
+	return count, err
+}
+
+func countCouponRedemptionsOfUser(tx *bbolt.Tx, code, userID string) (int, error) {
+	var count int
+	err := tx.Bucket(couponRedemptionsBucket).ForEach(func(k, v []byte) error {
+		var redemptions []couponRedemption
+		if err := json.Unmarshal(v, &redemptions); err != nil {
+			return err
+		}
+		for _, redemption := range redemptions {
+			if redemption.Code == code && redemption.UserID == userID {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+func convertCouponOut(code string, coupon *coupon) *model.Coupon {
+	return &model.Coupon{
+		Code:                  code,
+		Name:                  coupon.Name,
+		ProductID:             coupon.ProductID,
+		Discount:              coupon.Discount,
+		Amount:                coupon.Amount,
+		MinSubtotal:           coupon.MinSubtotal,
+		NotBefore:             coupon.NotBefore,
+		ExpiresAt:             coupon.ExpiresAt,
+		MaxRedemptions:        coupon.MaxRedemptions,
+		MaxRedemptionsPerUser: coupon.MaxRedemptionsPerUser,
+		Redemptions:           coupon.Redemptions,
+	}
+}
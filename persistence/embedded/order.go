@@ -0,0 +1,192 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.OrderRepository = (*Adapter)(nil)
+
+var ordersBucket = []byte("orders")
+
+type order struct {
+	UserID    string
+	Hash      []byte
+	CartID    string
+	Buyer     orderAddress
+	Recipient orderAddress
+	Coupons   []string
+	Currency  model.Currency `json:",omitempty"`
+	Shipping  string         `json:",omitempty"` // id of the shipping method
+	Locked    bool
+}
+
+type orderAddress struct {
+	Name       string
+	Country    string
+	PostalCode string
+	City       string
+	Street     string
+}
+
+// CreateOrder creates an order for the given user with the given id and
+// attributes. Id must be unique. ErrConflict is returned otherwise.
+func (a *Adapter) CreateOrder(_ context.Context, userID, id string, attributes persistence.OrderAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		orders := tx.Bucket(ordersBucket)
+		if orders.Get(encodeKey(id)) != nil {
+			return persistence.ErrConflict
+		}
+		return put(orders, id, order{
+			UserID:    userID,
+			Hash:      attributes.Hash,
+			CartID:    attributes.CartID,
+			Buyer:     orderAddress(attributes.Buyer),
+			Recipient: orderAddress(attributes.Recipient),
+			Coupons:   attributes.Coupons,
+			Currency:  attributes.Currency,
+			Shipping:  attributes.ShippingMethodID,
+		})
+	})
+}
+
+// FindOrderOfUser returns the order of the given user with the given id.
+// ErrNotFound is returned if there is no order with the id. ErrDeleted is
+// returned if the order did exist but is deleted. ErrNotOwnedByUser is returned
+// if the order exists but it's not owned by the given user.
+func (a *Adapter) FindOrderOfUser(_ context.Context, userID, id string) (*model.Order, error) {
+	var order *order
+	err := a.db.View(func(tx *bbolt.Tx) (err error) {
+		order, err = findOrderOfUser(tx.Bucket(ordersBucket), userID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := model.Order{
+		ID:        id,
+		Hash:      order.Hash,
+		CartID:    order.CartID,
+		Buyer:     model.Address(order.Buyer),
+		Recipient: model.Address(order.Recipient),
+		Coupons:   make([]*model.Coupon, len(order.Coupons)),
+		Currency:  order.Currency,
+		Locked:    order.Locked,
+
+		ShippingMethodID: order.Shipping,
+	}
+	for i, code := range order.Coupons {
+		out.Coupons[i] = &model.Coupon{Code: code}
+	}
+	return &out, nil
+}
+
+// DeleteOrderOfUser deletes the order of the given user with the given id.
+// ErrNotFound is returned if there is no order with the id. ErrDeleted is
+// returned if the order did exist but is deleted. ErrNotOwnedByUser is returned
+// if the order exists but it's not owned by the given user. ErrLocked is
+// returned if the order is owned by the given user, but is locked.
+func (a *Adapter) DeleteOrderOfUser(_ context.Context, userID, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		orders := tx.Bucket(ordersBucket)
+		if _, err := findUnlockedOrderOfUser(orders, userID, id); err != nil {
+			return err
+		}
+		return put(orders, id, nil)
+	})
+}
+
+// LockOrderOfUser locks the order of the given user with the given id.
+// ErrNotFound is returned if there is no order with the id. ErrDeleted is
+// returned if the order did exist but is deleted. ErrNotOwnedByUser is returned
+// if the order exists but it's not owned by the given user. ErrLocked is
+// returned if the order is owned by the given user, but is locked.
+func (a *Adapter) LockOrderOfUser(_ context.Context, userID, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		orders := tx.Bucket(ordersBucket)
+		order, err := findUnlockedOrderOfUser(orders, userID, id)
+		if err != nil {
+			return err
+		}
+		order.Locked = true
+		return put(orders, id, order)
+	})
+}
+
+// UnlockOrderOfUser unlocks the order of the given user with the given id.
+// Unlocking an order that is not locked has no effect. ErrNotFound is returned
+// if there is no order with the id. ErrDeleted is returned if the order did
+// exist but is deleted. ErrNotOwnedByUser is returned if the order exists but
+// it's not owned by the given user.
+func (a *Adapter) UnlockOrderOfUser(_ context.Context, userID, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		orders := tx.Bucket(ordersBucket)
+		order, err := findOrderOfUser(orders, userID, id)
+		if err != nil {
+			return err
+		}
+		order.Locked = false
+		return put(orders, id, order)
+	})
+}
+
+// TransferOrdersOfUser transfers all unlocked orders of the given user to the
+// new user. Locked and deleted orders stay with the given user.
+func (a *Adapter) TransferOrdersOfUser(_ context.Context, userID, newUserID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		orders := tx.Bucket(ordersBucket)
+		transferred := make(map[string]*order)
+		err := orders.ForEach(func(k, v []byte) error {
+			var order *order
+			if err := json.Unmarshal(v, &order); err != nil {
+				return err
+			}
+			if order != nil && order.UserID == userID && !order.Locked {
+				order.UserID = newUserID
+				transferred[decodeKey(k)] = order
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for id, order := range transferred {
+			if err := put(orders, id, order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func findOrderOfUser(orders *bbolt.Bucket, userID, id string) (*order, error) {
+	var order *order
+	ok, err := get(orders, id, &order)
+	switch {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, persistence.ErrNotFound
+	case order == nil:
+		return nil, persistence.ErrDeleted
+	case order.UserID != userID:
+		return nil, persistence.ErrNotOwnedByUser
+	}
+	return order, nil
+}
+
+func findUnlockedOrderOfUser(orders *bbolt.Bucket, userID, id string) (*order, error) {
+	order, err := findOrderOfUser(orders, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if order.Locked {
+		return nil, persistence.ErrLocked
+	}
+	return order, nil
+}
@@ -0,0 +1,112 @@
+package embedded
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.PasswordResetRepository = (*Adapter)(nil)
+
+var passwordResetsBucket = []byte("passwordResets") // maps token hashes to resets
+
+type passwordReset struct {
+	UserID    string
+	ExpiresAt time.Time
+}
+
+// CreatePasswordReset stores the token to reset the password of the given
+// user. It expires at the given time. The token must be unique. ErrConflict is
+// returned otherwise. The token is stored as a hash and can never be retrieved
+// again.
+func (a *Adapter) CreatePasswordReset(_ context.Context, token, userID string, expiresAt time.Time) error {
+	key := passwordResetKey(token)
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		resets := tx.Bucket(passwordResetsBucket)
+
+		// clean up expired tokens
+		err := deletePasswordResets(resets, func(r *passwordReset) bool {
+			return r.ExpiresAt.Before(time.Now())
+		})
+		if err != nil {
+			return err
+		}
+
+		// check that token is unique
+		if resets.Get(encodeKey(key)) != nil {
+			return persistence.ErrConflict
+		}
+
+		return put(resets, key, passwordReset{
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+		})
+	})
+}
+
+// RedeemPasswordReset deletes the given token and returns the id of the user
+// whose password may be reset. ErrNotFound is returned if the token does not
+// exist.
+func (a *Adapter) RedeemPasswordReset(_ context.Context, token string) (string, error) {
+	key := passwordResetKey(token)
+	var reset passwordReset
+	err := a.db.Update(func(tx *bbolt.Tx) error {
+		resets := tx.Bucket(passwordResetsBucket)
+
+		ok, err := get(resets, key, &reset)
+		if err != nil {
+			return err
+		} else if !ok || reset.ExpiresAt.Before(time.Now()) {
+			return persistence.ErrNotFound
+		}
+		return resets.Delete(encodeKey(key))
+	})
+	if err != nil {
+		return "", err
+	}
+	return reset.UserID, nil
+}
+
+// DeletePasswordResetsOfUser deletes all tokens of the given user.
+func (a *Adapter) DeletePasswordResetsOfUser(_ context.Context, userID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return deletePasswordResets(tx.Bucket(passwordResetsBucket), func(r *passwordReset) bool {
+			return r.UserID == userID
+		})
+	})
+}
+
+// passwordResetKey returns the key of the token.
+func passwordResetKey(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// deletePasswordResets deletes all tokens that match.
+func deletePasswordResets(resets *bbolt.Bucket, match func(*passwordReset) bool) error {
+	var keys [][]byte
+	err := resets.ForEach(func(k, v []byte) error {
+		var reset passwordReset
+		if err := json.Unmarshal(v, &reset); err != nil {
+			return err
+		}
+		if match(&reset) {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := resets.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
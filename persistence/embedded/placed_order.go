@@ -0,0 +1,168 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.PlacedOrderRepository = (*Adapter)(nil)
+
+var placedOrdersBucket = []byte("placedOrders")
+
+// PlaceOrder places the order and all related data. The id of the order must
+// be unique. ErrConflict is returned otherwise.
+func (a *Adapter) PlaceOrder(_ context.Context, order persistence.PlacedOrder) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		placedOrders := tx.Bucket(placedOrdersBucket)
+		if placedOrders.Get(encodeKey(order.ID)) != nil {
+			return persistence.ErrConflict
+		}
+		return put(placedOrders, order.ID, order)
+	})
+}
+
+// FindAllPlacedOrdersOfUser returns all placed orders of the given user.
+func (a *Adapter) FindAllPlacedOrdersOfUser(_ context.Context, userID string) ([]*persistence.PlacedOrder, error) {
+	result := make([]*persistence.PlacedOrder, 0)
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(placedOrdersBucket).ForEach(func(k, v []byte) error {
+			var order persistence.PlacedOrder
+			if err := json.Unmarshal(v, &order); err != nil {
+				return err
+			}
+			if order.UserID == userID {
+				result = append(result, convertPlacedOrderOut(&order))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindPlacedOrderOfUser returns the placed order of the given user with the
+// given id. ErrNotFound is returned if there is no placed order with the id.
+// ErrNotOwnedByUser is returned if the placed order exists but it's not owned
+// by the given user.
+func (a *Adapter) FindPlacedOrderOfUser(_ context.Context, userID, id string) (*persistence.PlacedOrder, error) {
+	var order persistence.PlacedOrder
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(placedOrdersBucket), id, &order)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return persistence.ErrNotFound
+		case order.UserID != userID:
+			return persistence.ErrNotOwnedByUser
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertPlacedOrderOut(&order), nil
+}
+
+// FindPlacedOrder returns the placed order with the given id regardless of the
+// user. ErrNotFound is returned if there is no placed order with the id.
+func (a *Adapter) FindPlacedOrder(_ context.Context, id string) (*persistence.PlacedOrder, error) {
+	var order persistence.PlacedOrder
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(placedOrdersBucket), id, &order)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertPlacedOrderOut(&order), nil
+}
+
+// UpdatePlacedOrderStatus appends the change to the status history of the
+// placed order with the given id, if the current status is the given one. The
+// current status is the status of the last change or empty if there is none.
+// ErrNotFound is returned if there is no placed order with the id. ErrConflict
+// is returned if the current status is a different one.
+func (a *Adapter) UpdatePlacedOrderStatus(_ context.Context, id string, current model.OrderStatus, change model.OrderStatusChange) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		placedOrders := tx.Bucket(placedOrdersBucket)
+		var order persistence.PlacedOrder
+		ok, err := get(placedOrders, id, &order)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+
+		var status model.OrderStatus
+		if n := len(order.StatusHistory); n > 0 {
+			status = order.StatusHistory[n-1].Status
+		}
+		if status != current {
+			return persistence.ErrConflict
+		}
+
+		order.StatusHistory = append(order.StatusHistory, change)
+		return put(placedOrders, id, order)
+	})
+}
+
+// TransferPlacedOrdersOfUser transfers all placed orders of the given user to
+// the new user.
+func (a *Adapter) TransferPlacedOrdersOfUser(_ context.Context, userID, newUserID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		placedOrders := tx.Bucket(placedOrdersBucket)
+		var transferred []*persistence.PlacedOrder
+		err := placedOrders.ForEach(func(k, v []byte) error {
+			var order persistence.PlacedOrder
+			if err := json.Unmarshal(v, &order); err != nil {
+				return err
+			}
+			if order.UserID == userID {
+				order.UserID = newUserID
+				transferred = append(transferred, &order)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, order := range transferred {
+			if err := put(placedOrders, order.ID, order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// makes sure that maps, positions and status history are not nil
+func convertPlacedOrderOut(order *persistence.PlacedOrder) *persistence.PlacedOrder {
+	if order.Coupons == nil {
+		order.Coupons = make(map[string]persistence.OrderCoupon)
+	}
+	if order.Products == nil {
+		order.Products = make(map[string]persistence.OrderProduct)
+	}
+	if order.Positions == nil {
+		order.Positions = make([]persistence.OrderPosition, 0)
+	}
+	if order.Taxes == nil {
+		order.Taxes = make([]persistence.OrderTax, 0)
+	}
+	if order.StatusHistory == nil {
+		order.StatusHistory = make([]model.OrderStatusChange, 0)
+	}
+	return order
+}
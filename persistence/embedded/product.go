@@ -0,0 +1,142 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.ProductRepository = (*Adapter)(nil)
+
+var productsBucket = []byte("products")
+
+type product struct {
+	Name        string
+	Price       int                    // in cents
+	Prices      map[model.Currency]int `json:",omitempty"` // in cents
+	TaxClass    string                 `json:",omitempty"`
+	Weight      int                    `json:",omitempty"` // in grams
+	Description string                 `json:",omitempty"`
+	SKU         string                 `json:",omitempty"`
+	Categories  []string               `json:",omitempty"`
+	Attributes  map[string]string      `json:",omitempty"`
+	Images      []model.Image          `json:",omitempty"`
+}
+
+// CreateProduct creates a product with the given id and attributes. Id must be
+// unique. ErrConflict is returned otherwise.
+func (a *Adapter) CreateProduct(_ context.Context, id string, attributes persistence.ProductAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		products := tx.Bucket(productsBucket)
+		if products.Get(encodeKey(id)) != nil {
+			return persistence.ErrConflict
+		}
+		return put(products, id, product(attributes))
+	})
+}
+
+// UpdateProduct replaces the attributes of the product with the given id.
+// ErrNotFound is returned if there is no product with the id. ErrDeleted is
+// returned if the product did exist but is deleted.
+func (a *Adapter) UpdateProduct(_ context.Context, id string, attributes persistence.ProductAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		products := tx.Bucket(productsBucket)
+		if _, err := findProduct(products, id); err != nil {
+			return err
+		}
+		return put(products, id, product(attributes))
+	})
+}
+
+// DeleteProduct deletes the product with the given id. The id cannot be used
+// for another product. ErrNotFound is returned if there is no product with the
+// id. ErrDeleted is returned if the product did exist but is deleted.
+func (a *Adapter) DeleteProduct(_ context.Context, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		products := tx.Bucket(productsBucket)
+		if _, err := findProduct(products, id); err != nil {
+			return err
+		}
+		return put(products, id, nil)
+	})
+}
+
+// FindAllProducts returns all stored products that are not deleted.
+func (a *Adapter) FindAllProducts(_ context.Context) ([]*model.Product, error) {
+	result := make([]*model.Product, 0)
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(productsBucket).ForEach(func(k, v []byte) error {
+			var product *product
+			if err := json.Unmarshal(v, &product); err != nil {
+				return err
+			}
+			if product == nil {
+				return nil // deleted
+			}
+			result = append(result, convertProductOut(decodeKey(k), product))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindProduct returns the product with the given id. ErrNotFound is returned if
+// there is no product with the id. ErrDeleted is returned if the product did
+// exist but is deleted.
+func (a *Adapter) FindProduct(_ context.Context, id string) (*model.Product, error) {
+	var product *product
+	err := a.db.View(func(tx *bbolt.Tx) (err error) {
+		product, err = findProduct(tx.Bucket(productsBucket), id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertProductOut(id, product), nil
+}
+
+// QueryProducts returns the products that are not deleted and match the query,
+// in the order and page defined by the query.
+func (a *Adapter) QueryProducts(ctx context.Context, query persistence.ProductQuery) ([]*model.Product, error) {
+	products, err := a.FindAllProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(products), nil
+}
+
+func findProduct(products *bbolt.Bucket, id string) (*product, error) {
+	var product *product
+	ok, err := get(products, id, &product)
+	switch {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, persistence.ErrNotFound
+	case product == nil:
+		return nil, persistence.ErrDeleted
+	}
+	return product, nil
+}
+
+func convertProductOut(id string, product *product) *model.Product {
+	return &model.Product{
+		ID:          id,
+		Name:        product.Name,
+		Price:       product.Price,
+		Prices:      product.Prices,
+		TaxClass:    product.TaxClass,
+		Weight:      product.Weight,
+		Description: product.Description,
+		SKU:         product.SKU,
+		Categories:  product.Categories,
+		Attributes:  product.Attributes,
+		Images:      product.Images,
+	}
+}
@@ -0,0 +1,127 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.PromotionRepository = (*Adapter)(nil)
+
+var (
+	promotionsBucket = []byte("promotions")
+	seedsBucket      = []byte("seeds")
+)
+
+// key of the seeds bucket that marks that promotions were seeded
+const promotionsSeed = "promotions"
+
+type promotion struct {
+	Type         model.PromotionType
+	Name         string
+	ProductID    string
+	Quantity     int
+	FreeQuantity int
+	Bundle       map[string]int // maps product id to quantity
+	Discount     int
+}
+
+// StorePromotion stores a promotion with the given id and attributes. If a
+// promotion with the same id was previously stored it is overwritten.
+func (a *Adapter) StorePromotion(_ context.Context, id string, attributes persistence.PromotionAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return put(tx.Bucket(promotionsBucket), id, promotion(attributes))
+	})
+}
+
+// SeedPromotions stores the given promotions with their ids like
+// StorePromotion, but only the first time it is called on a repository
+// without promotions. Later calls do nothing, so that seeded promotions that
+// were deleted are not restored.
+func (a *Adapter) SeedPromotions(_ context.Context, promotions map[string]persistence.PromotionAttributes) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		seeds := tx.Bucket(seedsBucket)
+		if seeds.Get(encodeKey(promotionsSeed)) != nil {
+			return nil
+		}
+		if err := put(seeds, promotionsSeed, true); err != nil {
+			return err
+		}
+		bucket := tx.Bucket(promotionsBucket)
+		if k, _ := bucket.Cursor().First(); k != nil {
+			return nil // not empty
+		}
+		for id, attributes := range promotions {
+			if err := put(bucket, id, promotion(attributes)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindAllPromotions returns all stored promotions.
+func (a *Adapter) FindAllPromotions(_ context.Context) ([]*model.Promotion, error) {
+	result := make([]*model.Promotion, 0)
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(promotionsBucket).ForEach(func(k, v []byte) error {
+			var promotion promotion
+			if err := json.Unmarshal(v, &promotion); err != nil {
+				return err
+			}
+			result = append(result, convertPromotionOut(decodeKey(k), &promotion))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindPromotion returns the promotion with the given id. ErrNotFound is
+// returned if there is no promotion with the id.
+func (a *Adapter) FindPromotion(_ context.Context, id string) (*model.Promotion, error) {
+	var promotion promotion
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(promotionsBucket), id, &promotion)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertPromotionOut(id, &promotion), nil
+}
+
+// DeletePromotion deletes the promotion with the given id. ErrNotFound is
+// returned if there is no promotion with the id.
+func (a *Adapter) DeletePromotion(_ context.Context, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		promotions := tx.Bucket(promotionsBucket)
+		if promotions.Get(encodeKey(id)) == nil {
+			return persistence.ErrNotFound
+		}
+		return promotions.Delete(encodeKey(id))
+	})
+}
+
+func convertPromotionOut(id string, promotion *promotion) *model.Promotion {
+	return &model.Promotion{
+		ID:           id,
+		Type:         promotion.Type,
+		Name:         promotion.Name,
+		ProductID:    promotion.ProductID,
+		Quantity:     promotion.Quantity,
+		FreeQuantity: promotion.FreeQuantity,
+		Bundle:       promotion.Bundle,
+		Discount:     promotion.Discount,
+	}
+}
@@ -0,0 +1,154 @@
+package embedded
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"time"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.SessionRepository = (*Adapter)(nil)
+
+var sessionsBucket = []byte("sessions")
+
+type session struct {
+	UserID           string
+	RefreshTokenHash []byte // sha256
+	ExpiresAt        time.Time
+}
+
+// CreateSession creates a session of the given user with the given id and
+// refresh token that expires at the given time. Id must be unique. ErrConflict
+// is returned otherwise. The refresh token is stored as a hash and can never
+// be retrieved again.
+func (a *Adapter) CreateSession(_ context.Context, id, userID, refreshToken string, expiresAt time.Time) error {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+
+		// clean up expired sessions
+		err := deleteSessions(sessions, func(s *session) bool {
+			return s.ExpiresAt.Before(time.Now())
+		})
+		if err != nil {
+			return err
+		}
+
+		// check that id is unique
+		if sessions.Get(encodeKey(id)) != nil {
+			return persistence.ErrConflict
+		}
+
+		// add new session
+		return put(sessions, id, session{
+			UserID:           userID,
+			RefreshTokenHash: hash[:],
+			ExpiresAt:        expiresAt,
+		})
+	})
+}
+
+// RotateSession replaces the refresh token of the session with the given id
+// and sets the new expiry time. ErrNotFound is returned if there is no session
+// with the id. ErrConflict is returned if the refresh token is not the current
+// one of the session.
+func (a *Adapter) RotateSession(_ context.Context, id, refreshToken, newRefreshToken string, expiresAt time.Time) error {
+	hash := sha256.Sum256([]byte(refreshToken))
+	newHash := sha256.Sum256([]byte(newRefreshToken))
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+
+		var session session
+		ok, err := get(sessions, id, &session)
+		if err != nil {
+			return err
+		} else if !ok || session.ExpiresAt.Before(time.Now()) {
+			return persistence.ErrNotFound
+		}
+		if subtle.ConstantTimeCompare(hash[:], session.RefreshTokenHash) != 1 {
+			return persistence.ErrConflict
+		}
+
+		session.RefreshTokenHash = newHash[:]
+		session.ExpiresAt = expiresAt
+		return put(sessions, id, session)
+	})
+}
+
+// FindSession returns the session with the given id. ErrNotFound is returned
+// if there is no session with the id.
+func (a *Adapter) FindSession(_ context.Context, id string) (*model.Session, error) {
+	var session session
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(sessionsBucket), id, &session)
+		if err != nil {
+			return err
+		} else if !ok || session.ExpiresAt.Before(time.Now()) {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.Session{
+		ID:        id,
+		UserID:    session.UserID,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// DeleteSession deletes the session with the given id. ErrNotFound is returned
+// if there is no session with the id.
+func (a *Adapter) DeleteSession(_ context.Context, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		sessions := tx.Bucket(sessionsBucket)
+
+		var session session
+		ok, err := get(sessions, id, &session)
+		if err != nil {
+			return err
+		} else if !ok || session.ExpiresAt.Before(time.Now()) {
+			return persistence.ErrNotFound
+		}
+		return sessions.Delete(encodeKey(id))
+	})
+}
+
+// DeleteSessionsOfUser deletes all sessions of the given user.
+func (a *Adapter) DeleteSessionsOfUser(_ context.Context, userID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return deleteSessions(tx.Bucket(sessionsBucket), func(s *session) bool {
+			return s.UserID == userID
+		})
+	})
+}
+
+// deleteSessions deletes all sessions that match.
+func deleteSessions(sessions *bbolt.Bucket, match func(*session) bool) error {
+	var keys [][]byte
+	err := sessions.ForEach(func(k, v []byte) error {
+		var session session
+		if err := json.Unmarshal(v, &session); err != nil {
+			return err
+		}
+		if match(&session) {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := sessions.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
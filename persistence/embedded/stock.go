@@ -0,0 +1,208 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+)
+
+var _ persistence.StockRepository = (*Adapter)(nil)
+
+var (
+	stocksBucket            = []byte("stocks")
+	stockReservationsBucket = []byte("stock_reservations")
+)
+
+type stock struct {
+	Quantity int
+	Reserved int
+}
+
+// stockReservation maps product ids to quantity
+type stockReservation map[string]int
+
+// SetStock sets the quantity in stock of the product with the given id. The
+// product is tracked from now on. ErrConflict is returned if the quantity is
+// lower than the reserved quantity.
+func (a *Adapter) SetStock(_ context.Context, productID string, quantity int) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		stocks := tx.Bucket(stocksBucket)
+		var s stock
+		if _, err := get(stocks, productID, &s); err != nil {
+			return err
+		}
+		if quantity < s.Reserved {
+			return persistence.ErrConflict
+		}
+		s.Quantity = quantity
+		return put(stocks, productID, s)
+	})
+}
+
+// AdjustStock adds delta to the quantity in stock of the product with the given
+// id. ErrNotFound is returned if the product is not tracked. ErrConflict is
+// returned if the quantity would become lower than the reserved quantity.
+func (a *Adapter) AdjustStock(_ context.Context, productID string, delta int) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		stocks := tx.Bucket(stocksBucket)
+		s, err := findStock(stocks, productID)
+		if err != nil {
+			return err
+		}
+		if s.Quantity+delta < s.Reserved {
+			return persistence.ErrConflict
+		}
+		s.Quantity += delta
+		return put(stocks, productID, s)
+	})
+}
+
+// DeleteStock stops tracking the stock of the product with the given id. Its
+// reservations are dropped. ErrNotFound is returned if the product is not
+// tracked.
+func (a *Adapter) DeleteStock(_ context.Context, productID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		stocks := tx.Bucket(stocksBucket)
+		if _, err := findStock(stocks, productID); err != nil {
+			return err
+		}
+		if err := stocks.Delete(encodeKey(productID)); err != nil {
+			return err
+		}
+
+		// drop reservations of the product
+		reservations := tx.Bucket(stockReservationsBucket)
+		changed := make(map[string]stockReservation)
+		err := reservations.ForEach(func(k, v []byte) error {
+			var reservation stockReservation
+			if err := json.Unmarshal(v, &reservation); err != nil {
+				return err
+			}
+			if _, ok := reservation[productID]; ok {
+				delete(reservation, productID)
+				changed[decodeKey(k)] = reservation
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for orderID, reservation := range changed {
+			if err := put(reservations, orderID, reservation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindStock returns the stock of the product with the given id. ErrNotFound is
+// returned if the product is not tracked.
+func (a *Adapter) FindStock(_ context.Context, productID string) (*model.Stock, error) {
+	var s *stock
+	err := a.db.View(func(tx *bbolt.Tx) (err error) {
+		s, err = findStock(tx.Bucket(stocksBucket), productID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.Stock{
+		ProductID: productID,
+		Quantity:  s.Quantity,
+		Reserved:  s.Reserved,
+	}, nil
+}
+
+// ReserveStock reserves the quantities for the order with the given id.
+// Quantities maps product ids to quantity. Products that are not tracked are
+// ignored. Any previous reservation of the order is replaced. Either all
+// quantities are reserved or none. ErrInsufficientStock is returned if any
+// product has not enough available items.
+func (a *Adapter) ReserveStock(_ context.Context, orderID string, quantities map[string]int) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		if err := releaseStock(tx, orderID, false); err != nil {
+			return err
+		}
+
+		stocks := tx.Bucket(stocksBucket)
+		reservation := make(stockReservation, len(quantities))
+		for productID, quantity := range quantities {
+			s, err := findStock(stocks, productID)
+			if errors.Is(err, persistence.ErrNotFound) {
+				continue // not tracked
+			} else if err != nil {
+				return err
+			}
+			if s.Quantity-s.Reserved < quantity {
+				// returning an error rolls back the release above
+				return persistence.ErrInsufficientStock
+			}
+			s.Reserved += quantity
+			if err := put(stocks, productID, s); err != nil {
+				return err
+			}
+			reservation[productID] = quantity
+		}
+		return put(tx.Bucket(stockReservationsBucket), orderID, reservation)
+	})
+}
+
+// ReleaseStock drops the reservation of the order with the given id. Releasing
+// an order without reservation has no effect.
+func (a *Adapter) ReleaseStock(_ context.Context, orderID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return releaseStock(tx, orderID, false)
+	})
+}
+
+// CommitStock takes the reserved items of the order with the given id out of
+// stock and drops the reservation. Committing an order without reservation has
+// no effect.
+func (a *Adapter) CommitStock(_ context.Context, orderID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		return releaseStock(tx, orderID, true)
+	})
+}
+
+// Drops the reservation of the order. If commit is true the reserved items are
+// also taken out of stock.
+func releaseStock(tx *bbolt.Tx, orderID string, commit bool) error {
+	reservations := tx.Bucket(stockReservationsBucket)
+	var reservation stockReservation
+	if ok, err := get(reservations, orderID, &reservation); err != nil || !ok {
+		return err
+	}
+
+	stocks := tx.Bucket(stocksBucket)
+	for productID, quantity := range reservation {
+		s, err := findStock(stocks, productID)
+		if err != nil {
+			return err
+		}
+		s.Reserved -= quantity
+		if commit {
+			s.Quantity -= quantity
+		}
+		if err := put(stocks, productID, s); err != nil {
+			return err
+		}
+	}
+	return reservations.Delete(encodeKey(orderID))
+}
+
+func findStock(stocks *bbolt.Bucket, productID string) (*stock, error) {
+	var s stock
+	ok, err := get(stocks, productID, &s)
+	switch {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, persistence.ErrNotFound
+	}
+	return &s, nil
+}
@@ -0,0 +1,283 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ persistence.UserRepository = (*Adapter)(nil)
+
+var (
+	usersBucket       = []byte("users")
+	userNamesBucket   = []byte("userNames")   // maps names to ids
+	guestClaimsBucket = []byte("guestClaims") // maps guest ids to user ids
+)
+
+type user struct {
+	Name         string
+	PasswordHash []byte // bcrypt
+	Roles        []model.Role
+}
+
+// CreateUser creates a user with the given id, name and password. Id must be
+// unique. Name must be unique. ErrConflict is returned otherwise. The password
+// is stored as a hash and can never be retrieved again.
+func (a *Adapter) CreateUser(_ context.Context, id string, name string, password string) error {
+	// hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		users, names := tx.Bucket(usersBucket), tx.Bucket(userNamesBucket)
+
+		// check that id is unique
+		if users.Get(encodeKey(id)) != nil {
+			return persistence.ErrConflict
+		}
+		// check that name is unique
+		if names.Get(encodeKey(name)) != nil {
+			return persistence.ErrConflict
+		}
+
+		// save user
+		if err := put(users, id, user{Name: name, PasswordHash: hash}); err != nil {
+			return err
+		}
+		return put(names, name, id)
+	})
+}
+
+// FindUserByNameAndPassword finds the user by the given name and password. As
+// names are unique the result is unambiguous. ErrNotFound is returned if no
+// user matches the set of name and password.
+func (a *Adapter) FindUserByNameAndPassword(_ context.Context, name string, password string) (*model.User, error) {
+	var id string
+	var user user
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(userNamesBucket), name, &id)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		_, err = get(tx.Bucket(usersBucket), id, &user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checkUserPassword(id, &user, password)
+}
+
+// FindUserByIDAndPassword finds the user by the given id and password. As ids
+// are unique the result is unambiguous. ErrNotFound is returned if no user
+// matches the set of id and password.
+func (a *Adapter) FindUserByIDAndPassword(_ context.Context, id string, password string) (*model.User, error) {
+	var user user
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(usersBucket), id, &user)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checkUserPassword(id, &user, password)
+}
+
+// FindUser finds the user by the given id. ErrNotFound is returned if there is
+// no user with the id.
+func (a *Adapter) FindUser(_ context.Context, id string) (*model.User, error) {
+	var user user
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(usersBucket), id, &user)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user.model(id), nil
+}
+
+// FindUserByName finds the user by the given name. ErrNotFound is returned if
+// there is no user with the name.
+func (a *Adapter) FindUserByName(_ context.Context, name string) (*model.User, error) {
+	var id string
+	var user user
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(userNamesBucket), name, &id)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		_, err = get(tx.Bucket(usersBucket), id, &user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user.model(id), nil
+}
+
+// FindUsersWithRole returns all users that have the given role.
+func (a *Adapter) FindUsersWithRole(_ context.Context, role model.Role) ([]*model.User, error) {
+	var users []*model.User
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			var user user
+			if err := json.Unmarshal(v, &user); err != nil {
+				return err
+			}
+			for _, r := range user.Roles {
+				if r == role {
+					users = append(users, user.model(decodeKey(k)))
+					break
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetUserRoles replaces the roles of the user with the given id. The roles
+// must not contain duplicates. ErrNotFound is returned if there is no user
+// with the id.
+func (a *Adapter) SetUserRoles(_ context.Context, id string, roles []model.Role) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+
+		var user user
+		ok, err := get(users, id, &user)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+
+		user.Roles = nil
+		if len(roles) > 0 {
+			user.Roles = make([]model.Role, len(roles))
+			copy(user.Roles, roles)
+			sort.Slice(user.Roles, func(i, j int) bool { return user.Roles[i] < user.Roles[j] })
+		}
+		return put(users, id, user)
+	})
+}
+
+// SetUserPassword replaces the password of the user with the given id. The
+// password is stored as a hash and can never be retrieved again. ErrNotFound
+// is returned if there is no user with the id.
+func (a *Adapter) SetUserPassword(_ context.Context, id, password string) error {
+	// hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+
+		var user user
+		ok, err := get(users, id, &user)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+
+		user.PasswordHash = hash
+		return put(users, id, user)
+	})
+}
+
+// DeleteUser deletes the user with the given id. The name can be used by
+// another user afterwards. ErrNotFound is returned if there is no user with
+// the id.
+func (a *Adapter) DeleteUser(_ context.Context, id string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		users, names := tx.Bucket(usersBucket), tx.Bucket(userNamesBucket)
+
+		var user user
+		ok, err := get(users, id, &user)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+
+		if err := users.Delete(encodeKey(id)); err != nil {
+			return err
+		}
+		return names.Delete(encodeKey(user.Name))
+	})
+}
+
+// ClaimGuest records that the guest with the given id was claimed by the user
+// with the given id, so that the tokens of the guest can be rejected.
+// ErrConflict is returned if the guest was claimed before.
+func (a *Adapter) ClaimGuest(_ context.Context, guestID, userID string) error {
+	return a.db.Update(func(tx *bbolt.Tx) error {
+		claims := tx.Bucket(guestClaimsBucket)
+		if claims.Get(encodeKey(guestID)) != nil {
+			return persistence.ErrConflict
+		}
+		return put(claims, guestID, userID)
+	})
+}
+
+// FindGuestClaim returns the id of the user that claimed the guest with the
+// given id. ErrNotFound is returned if the guest was not claimed.
+func (a *Adapter) FindGuestClaim(_ context.Context, guestID string) (string, error) {
+	var userID string
+	err := a.db.View(func(tx *bbolt.Tx) error {
+		ok, err := get(tx.Bucket(guestClaimsBucket), guestID, &userID)
+		if err != nil {
+			return err
+		} else if !ok {
+			return persistence.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+func (u *user) model(id string) *model.User {
+	return &model.User{
+		ID:    id,
+		Name:  u.Name,
+		Roles: u.Roles,
+	}
+}
+
+func checkUserPassword(id string, user *user, password string) (*model.User, error) {
+	// check password
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
+		return nil, persistence.ErrNotFound
+	}
+	return user.model(id), nil
+}
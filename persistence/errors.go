@@ -1,6 +1,9 @@
 package persistence
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // package errors
 var (
@@ -9,4 +12,22 @@ var (
 	ErrNotOwnedByUser = errors.New("not owned by user")
 	ErrDeleted        = errors.New("deleted")
 	ErrLocked         = errors.New("locked")
+
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrLimitReached      = errors.New("limit reached")
 )
+
+// CouponConflictError is returned if coupons cannot be created, because there
+// already are coupons with some of the codes. It wraps ErrConflict.
+type CouponConflictError struct {
+	Codes []string // that exist, in the order they were given
+}
+
+func (e *CouponConflictError) Error() string {
+	return fmt.Sprintf("%d of the coupon codes exist", len(e.Codes))
+}
+
+// Unwrap returns ErrConflict.
+func (e *CouponConflictError) Unwrap() error {
+	return ErrConflict
+}
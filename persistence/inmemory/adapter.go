@@ -2,6 +2,9 @@ package inmemory
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,12 +19,24 @@ import (
 type Adapter struct {
 	mx sync.Mutex
 
-	usersByID     map[string]*user
-	usersByName   map[string]*user
-	productsByID  map[string]*product
-	cartsByID     map[string]*cart
-	couponsByCode map[string]*coupon
-	ordersByID    map[string]*order
+	usersByID        map[string]*user
+	usersByName      map[string]*user
+	guestClaims      map[string]string // guest id to user id
+	sessionsByID     map[string]*session
+	resetsByHash     map[[32]byte]*passwordReset
+	productsByID     map[string]*product
+	cartsByID        map[string]*cart
+	couponsByCode    map[string]*coupon
+	ordersByID       map[string]*order
+	promotionsByID   map[string]*promotion
+	promotionsSeeded bool
+
+	stocksByProductID     map[string]*stock
+	stockReservationsByID map[string]map[string]int // order id to product id to quantity
+
+	couponRedemptionsByOrderID map[string][]couponRedemption
+
+	placedOrdersByID map[string]*persistence.PlacedOrder
 
 	bcryptCost int
 }
@@ -41,12 +56,23 @@ func FastLessSecureHashingForTesting() Option {
 // NewAdapter returns a new in-memory adapter.
 func NewAdapter(options ...Option) *Adapter {
 	a := Adapter{
-		usersByID:     make(map[string]*user),
-		usersByName:   make(map[string]*user),
-		productsByID:  make(map[string]*product),
-		cartsByID:     make(map[string]*cart),
-		couponsByCode: make(map[string]*coupon),
-		ordersByID:    make(map[string]*order),
+		usersByID:      make(map[string]*user),
+		usersByName:    make(map[string]*user),
+		guestClaims:    make(map[string]string),
+		sessionsByID:   make(map[string]*session),
+		resetsByHash:   make(map[[32]byte]*passwordReset),
+		productsByID:   make(map[string]*product),
+		cartsByID:      make(map[string]*cart),
+		couponsByCode:  make(map[string]*coupon),
+		ordersByID:     make(map[string]*order),
+		promotionsByID: make(map[string]*promotion),
+
+		stocksByProductID:     make(map[string]*stock),
+		stockReservationsByID: make(map[string]map[string]int),
+
+		couponRedemptionsByOrderID: make(map[string][]couponRedemption),
+
+		placedOrdersByID: make(map[string]*persistence.PlacedOrder),
 	}
 	for _, option := range options {
 		option(&a)
@@ -54,12 +80,21 @@ func NewAdapter(options ...Option) *Adapter {
 	return &a
 }
 
+var _ persistence.Pinger = (*Adapter)(nil)
+
+// Ping returns an error if the persistence does not respond. The memory always
+// responds.
+func (a *Adapter) Ping(context.Context) error {
+	return nil
+}
+
 var _ persistence.UserRepository = (*Adapter)(nil)
 
 type user struct {
 	id           string
 	name         string
 	passwordHash []byte // bcrypt
+	roles        []model.Role
 }
 
 // CreateUser creates a user with the given id, name and password. Id must be
@@ -123,27 +158,333 @@ func (a *Adapter) FindUserByIDAndPassword(_ context.Context, id string, password
 	return checkUserPassword(user, password)
 }
 
+// FindUser finds the user by the given id. ErrNotFound is returned if there is
+// no user with the id.
+func (a *Adapter) FindUser(_ context.Context, id string) (*model.User, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	user, ok := a.usersByID[id]
+	if !ok {
+		return nil, persistence.ErrNotFound
+	}
+	return user.model(), nil
+}
+
+// FindUserByName finds the user by the given name. ErrNotFound is returned if
+// there is no user with the name.
+func (a *Adapter) FindUserByName(_ context.Context, name string) (*model.User, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	user, ok := a.usersByName[name]
+	if !ok {
+		return nil, persistence.ErrNotFound
+	}
+	return user.model(), nil
+}
+
+// FindUsersWithRole returns all users that have the given role.
+func (a *Adapter) FindUsersWithRole(_ context.Context, role model.Role) ([]*model.User, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	var users []*model.User
+	for _, user := range a.usersByID {
+		for _, r := range user.roles {
+			if r == role {
+				users = append(users, user.model())
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+// SetUserRoles replaces the roles of the user with the given id. The roles
+// must not contain duplicates. ErrNotFound is returned if there is no user
+// with the id.
+func (a *Adapter) SetUserRoles(_ context.Context, id string, roles []model.Role) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	user, ok := a.usersByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+	user.roles = nil
+	if len(roles) > 0 {
+		user.roles = make([]model.Role, len(roles))
+		copy(user.roles, roles)
+		sort.Slice(user.roles, func(i, j int) bool { return user.roles[i] < user.roles[j] })
+	}
+	return nil
+}
+
+// SetUserPassword replaces the password of the user with the given id. The
+// password is stored as a hash and can never be retrieved again. ErrNotFound
+// is returned if there is no user with the id.
+func (a *Adapter) SetUserPassword(_ context.Context, id, password string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	user, ok := a.usersByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	// hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+
+	user.passwordHash = hash
+	return nil
+}
+
+// DeleteUser deletes the user with the given id. The name can be used by
+// another user afterwards. ErrNotFound is returned if there is no user with
+// the id.
+func (a *Adapter) DeleteUser(_ context.Context, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	user, ok := a.usersByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+	delete(a.usersByID, id)
+	delete(a.usersByName, user.name)
+	return nil
+}
+
+// ClaimGuest records that the guest with the given id was claimed by the user
+// with the given id, so that the tokens of the guest can be rejected.
+// ErrConflict is returned if the guest was claimed before.
+func (a *Adapter) ClaimGuest(_ context.Context, guestID, userID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if _, ok := a.guestClaims[guestID]; ok {
+		return persistence.ErrConflict
+	}
+	a.guestClaims[guestID] = userID
+	return nil
+}
+
+// FindGuestClaim returns the id of the user that claimed the guest with the
+// given id. ErrNotFound is returned if the guest was not claimed.
+func (a *Adapter) FindGuestClaim(_ context.Context, guestID string) (string, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	userID, ok := a.guestClaims[guestID]
+	if !ok {
+		return "", persistence.ErrNotFound
+	}
+	return userID, nil
+}
+
+func (u *user) model() *model.User {
+	user := model.User{
+		ID:   u.id,
+		Name: u.name,
+	}
+	if len(u.roles) > 0 {
+		user.Roles = make([]model.Role, len(u.roles))
+		copy(user.Roles, u.roles)
+	}
+	return &user
+}
+
 func checkUserPassword(user *user, password string) (*model.User, error) {
 	// check password
 	if err := bcrypt.CompareHashAndPassword(user.passwordHash, []byte(password)); err != nil {
 		return nil, persistence.ErrNotFound
 	}
-	return &model.User{
-		ID:   user.id,
-		Name: user.name,
+	return user.model(), nil
+}
+
+var _ persistence.SessionRepository = (*Adapter)(nil)
+
+type session struct {
+	userID           string
+	refreshTokenHash [sha256.Size]byte
+	expiresAt        time.Time
+}
+
+// CreateSession creates a session of the given user with the given id and
+// refresh token that expires at the given time. Id must be unique. ErrConflict
+// is returned otherwise. The refresh token is stored as a hash and can never
+// be retrieved again.
+func (a *Adapter) CreateSession(_ context.Context, id, userID, refreshToken string, expiresAt time.Time) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	// clean up expired sessions
+	for id, session := range a.sessionsByID {
+		if session.expiresAt.Before(time.Now()) {
+			delete(a.sessionsByID, id)
+		}
+	}
+
+	if _, ok := a.sessionsByID[id]; ok {
+		return persistence.ErrConflict
+	}
+	a.sessionsByID[id] = &session{
+		userID:           userID,
+		refreshTokenHash: sha256.Sum256([]byte(refreshToken)),
+		expiresAt:        expiresAt,
+	}
+	return nil
+}
+
+// RotateSession replaces the refresh token of the session with the given id
+// and sets the new expiry time. ErrNotFound is returned if there is no session
+// with the id. ErrConflict is returned if the refresh token is not the current
+// one of the session.
+func (a *Adapter) RotateSession(_ context.Context, id, refreshToken, newRefreshToken string, expiresAt time.Time) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	session, ok := a.sessionsByID[id]
+	if !ok || session.expiresAt.Before(time.Now()) {
+		return persistence.ErrNotFound
+	}
+	hash := sha256.Sum256([]byte(refreshToken))
+	if subtle.ConstantTimeCompare(hash[:], session.refreshTokenHash[:]) != 1 {
+		return persistence.ErrConflict
+	}
+	session.refreshTokenHash = sha256.Sum256([]byte(newRefreshToken))
+	session.expiresAt = expiresAt
+	return nil
+}
+
+// FindSession returns the session with the given id. ErrNotFound is returned
+// if there is no session with the id.
+func (a *Adapter) FindSession(_ context.Context, id string) (*model.Session, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	session, ok := a.sessionsByID[id]
+	if !ok || session.expiresAt.Before(time.Now()) {
+		return nil, persistence.ErrNotFound
+	}
+	return &model.Session{
+		ID:        id,
+		UserID:    session.userID,
+		ExpiresAt: session.expiresAt,
 	}, nil
 }
 
+// DeleteSession deletes the session with the given id. ErrNotFound is returned
+// if there is no session with the id.
+func (a *Adapter) DeleteSession(_ context.Context, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	session, ok := a.sessionsByID[id]
+	if !ok || session.expiresAt.Before(time.Now()) {
+		return persistence.ErrNotFound
+	}
+	delete(a.sessionsByID, id)
+	return nil
+}
+
+// DeleteSessionsOfUser deletes all sessions of the given user.
+func (a *Adapter) DeleteSessionsOfUser(_ context.Context, userID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	for id, session := range a.sessionsByID {
+		if session.userID == userID {
+			delete(a.sessionsByID, id)
+		}
+	}
+	return nil
+}
+
+var _ persistence.PasswordResetRepository = (*Adapter)(nil)
+
+type passwordReset struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// CreatePasswordReset stores the token to reset the password of the given
+// user. It expires at the given time. The token must be unique. ErrConflict is
+// returned otherwise. The token is stored as a hash and can never be retrieved
+// again.
+func (a *Adapter) CreatePasswordReset(_ context.Context, token, userID string, expiresAt time.Time) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	// clean up expired tokens
+	for hash, reset := range a.resetsByHash {
+		if reset.expiresAt.Before(time.Now()) {
+			delete(a.resetsByHash, hash)
+		}
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	if _, ok := a.resetsByHash[hash]; ok {
+		return persistence.ErrConflict
+	}
+	a.resetsByHash[hash] = &passwordReset{
+		userID:    userID,
+		expiresAt: expiresAt,
+	}
+	return nil
+}
+
+// RedeemPasswordReset deletes the given token and returns the id of the user
+// whose password may be reset. ErrNotFound is returned if the token does not
+// exist.
+func (a *Adapter) RedeemPasswordReset(_ context.Context, token string) (string, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	hash := sha256.Sum256([]byte(token))
+	reset, ok := a.resetsByHash[hash]
+	if !ok || reset.expiresAt.Before(time.Now()) {
+		return "", persistence.ErrNotFound
+	}
+	delete(a.resetsByHash, hash)
+	return reset.userID, nil
+}
+
+// DeletePasswordResetsOfUser deletes all tokens of the given user.
+func (a *Adapter) DeletePasswordResetsOfUser(_ context.Context, userID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	for hash, reset := range a.resetsByHash {
+		if reset.userID == userID {
+			delete(a.resetsByHash, hash)
+		}
+	}
+	return nil
+}
+
 var _ persistence.ProductRepository = (*Adapter)(nil)
 
 type product struct {
-	name  string
-	price int // in cents
+	name        string
+	price       int                    // in cents
+	prices      map[model.Currency]int // in cents
+	taxClass    string
+	weight      int // in grams
+	description string
+	sku         string
+	categories  []string
+	attributes  map[string]string
+	images      []model.Image
 }
 
-// CreateProduct creates a product with the given id, name and price. Id must be
-// unique. ErrConflict is returned otherwise. The price is in cents.
-func (a *Adapter) CreateProduct(_ context.Context, id, name string, price int) error {
+// CreateProduct creates a product with the given id and attributes. Id must be
+// unique. ErrConflict is returned otherwise.
+func (a *Adapter) CreateProduct(_ context.Context, id string, attributes persistence.ProductAttributes) error {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
@@ -151,31 +492,68 @@ func (a *Adapter) CreateProduct(_ context.Context, id, name string, price int) e
 		return persistence.ErrConflict
 	}
 
-	a.productsByID[id] = &product{
-		name:  name,
-		price: price,
+	a.productsByID[id] = convertProductIn(attributes)
+	return nil
+}
+
+// UpdateProduct replaces the attributes of the product with the given id.
+// ErrNotFound is returned if there is no product with the id. ErrDeleted is
+// returned if the product did exist but is deleted.
+func (a *Adapter) UpdateProduct(_ context.Context, id string, attributes persistence.ProductAttributes) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	product, ok := a.productsByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if product == nil {
+		return persistence.ErrDeleted
+	}
+
+	a.productsByID[id] = convertProductIn(attributes)
+	return nil
+}
+
+// DeleteProduct deletes the product with the given id. The id cannot be used
+// for another product. ErrNotFound is returned if there is no product with the
+// id. ErrDeleted is returned if the product did exist but is deleted.
+func (a *Adapter) DeleteProduct(_ context.Context, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	product, ok := a.productsByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if product == nil {
+		return persistence.ErrDeleted
 	}
+
+	a.productsByID[id] = nil
 	return nil
 }
 
-// FindAllProducts returns all stored products.
+// FindAllProducts returns all stored products that are not deleted.
 func (a *Adapter) FindAllProducts(_ context.Context) ([]*model.Product, error) {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
 	result := make([]*model.Product, 0, len(a.productsByID))
 	for id, product := range a.productsByID {
-		result = append(result, &model.Product{
-			ID:    id,
-			Name:  product.name,
-			Price: product.price,
-		})
+		if product == nil {
+			continue // deleted
+		}
+		result = append(result, convertProductOut(id, product))
 	}
 	return result, nil
 }
 
 // FindProduct returns the product with the given id. ErrNotFound is returned if
-// there is no product with the id.
+// there is no product with the id. ErrDeleted is returned if the product did
+// exist but is deleted.
 func (a *Adapter) FindProduct(ctx context.Context, id string) (*model.Product, error) {
 	a.mx.Lock()
 	defer a.mx.Unlock()
@@ -185,251 +563,851 @@ func (a *Adapter) FindProduct(ctx context.Context, id string) (*model.Product, e
 		return nil, persistence.ErrNotFound
 	}
 
-	return &model.Product{
-		ID:    id,
-		Name:  product.name,
-		Price: product.price,
-	}, nil
+	if product == nil {
+		return nil, persistence.ErrDeleted
+	}
+
+	return convertProductOut(id, product), nil
 }
 
-var _ persistence.CartRepository = (*Adapter)(nil)
+// QueryProducts returns the products that are not deleted and match the query,
+// in the order and page defined by the query.
+func (a *Adapter) QueryProducts(ctx context.Context, query persistence.ProductQuery) ([]*model.Product, error) {
+	products, err := a.FindAllProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(products), nil
+}
 
-type cart struct {
-	userID    string
-	positions map[string]int // maps product id to quantity
-	locked    bool
+func convertProductIn(attributes persistence.ProductAttributes) *product {
+	product := product{
+		name:        attributes.Name,
+		price:       attributes.Price,
+		taxClass:    attributes.TaxClass,
+		weight:      attributes.Weight,
+		description: attributes.Description,
+		sku:         attributes.SKU,
+	}
+	if len(attributes.Prices) > 0 {
+		product.prices = make(map[model.Currency]int, len(attributes.Prices))
+		for currency, price := range attributes.Prices {
+			product.prices[currency] = price
+		}
+	}
+	if len(attributes.Categories) > 0 {
+		product.categories = make([]string, len(attributes.Categories))
+		copy(product.categories, attributes.Categories)
+	}
+	if len(attributes.Attributes) > 0 {
+		product.attributes = make(map[string]string, len(attributes.Attributes))
+		for key, value := range attributes.Attributes {
+			product.attributes[key] = value
+		}
+	}
+	if len(attributes.Images) > 0 {
+		product.images = make([]model.Image, len(attributes.Images))
+		copy(product.images, attributes.Images)
+	}
+	return &product
+}
+
+func convertProductOut(id string, product *product) *model.Product {
+	out := model.Product{
+		ID:          id,
+		Name:        product.name,
+		Price:       product.price,
+		TaxClass:    product.taxClass,
+		Weight:      product.weight,
+		Description: product.description,
+		SKU:         product.sku,
+	}
+	if product.prices != nil {
+		out.Prices = make(map[model.Currency]int, len(product.prices))
+		for currency, price := range product.prices {
+			out.Prices[currency] = price
+		}
+	}
+	if product.categories != nil {
+		out.Categories = make([]string, len(product.categories))
+		copy(out.Categories, product.categories)
+	}
+	if product.attributes != nil {
+		out.Attributes = make(map[string]string, len(product.attributes))
+		for key, value := range product.attributes {
+			out.Attributes[key] = value
+		}
+	}
+	if product.images != nil {
+		out.Images = make([]model.Image, len(product.images))
+		copy(out.Images, product.images)
+	}
+	return &out
+}
+
+var _ persistence.StockRepository = (*Adapter)(nil)
+
+type stock struct {
+	quantity int
+	reserved int
 }
 
-// CreateCart creates a cart for the given user with the given id and positions.
-// Id must be unique. ErrConflict is returned otherwise. Positions maps product
-// ids to quantity.
-func (a *Adapter) CreateCart(_ context.Context, userID, id string, positions map[string]int) error {
+// SetStock sets the quantity in stock of the product with the given id. The
+// product is tracked from now on. ErrConflict is returned if the quantity is
+// lower than the reserved quantity.
+func (a *Adapter) SetStock(_ context.Context, productID string, quantity int) error {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	if _, ok := a.cartsByID[id]; ok {
+	s, ok := a.stocksByProductID[productID]
+	if !ok {
+		s = &stock{}
+		a.stocksByProductID[productID] = s
+	}
+	if quantity < s.reserved {
 		return persistence.ErrConflict
 	}
 
-	cart := cart{
-		userID:    userID,
-		positions: make(map[string]int, len(positions)),
+	s.quantity = quantity
+	return nil
+}
+
+// AdjustStock adds delta to the quantity in stock of the product with the given
+// id. ErrNotFound is returned if the product is not tracked. ErrConflict is
+// returned if the quantity would become lower than the reserved quantity.
+func (a *Adapter) AdjustStock(_ context.Context, productID string, delta int) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	stock, ok := a.stocksByProductID[productID]
+	if !ok {
+		return persistence.ErrNotFound
 	}
-	for productID, quantity := range positions {
-		cart.positions[productID] = quantity
+	if stock.quantity+delta < stock.reserved {
+		return persistence.ErrConflict
 	}
-	a.cartsByID[id] = &cart
+
+	stock.quantity += delta
 	return nil
 }
 
-// UpdateCartOfUser updates a cart of the given user with new positions. Any
-// existing positions are replaced. ErrNotFound is returned if the cart does not
-// exist. ErrDeleted is returned if the cart did exist but is deleted.
-// ErrNotOwnedByUser is returned if the cart exists but it's not owned by the
-// given user. ErrLocked is returned if the cart is owned by the given user, but
-// is locked.
-func (a *Adapter) UpdateCartOfUser(_ context.Context, userID, id string, positions map[string]int) error {
+// DeleteStock stops tracking the stock of the product with the given id. Its
+// reservations are dropped. ErrNotFound is returned if the product is not
+// tracked.
+func (a *Adapter) DeleteStock(_ context.Context, productID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if _, ok := a.stocksByProductID[productID]; !ok {
+		return persistence.ErrNotFound
+	}
+
+	delete(a.stocksByProductID, productID)
+	for _, reservation := range a.stockReservationsByID {
+		delete(reservation, productID)
+	}
+	return nil
+}
+
+// FindStock returns the stock of the product with the given id. ErrNotFound is
+// returned if the product is not tracked.
+func (a *Adapter) FindStock(_ context.Context, productID string) (*model.Stock, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	stock, ok := a.stocksByProductID[productID]
+	if !ok {
+		return nil, persistence.ErrNotFound
+	}
+
+	return &model.Stock{
+		ProductID: productID,
+		Quantity:  stock.quantity,
+		Reserved:  stock.reserved,
+	}, nil
+}
+
+// ReserveStock reserves the quantities for the order with the given id.
+// Quantities maps product ids to quantity. Products that are not tracked are
+// ignored. Any previous reservation of the order is replaced. Either all
+// quantities are reserved or none. ErrInsufficientStock is returned if any
+// product has not enough available items.
+func (a *Adapter) ReserveStock(_ context.Context, orderID string, quantities map[string]int) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	previous := a.stockReservationsByID[orderID]
+
+	// check
+	reservation := make(map[string]int, len(quantities))
+	for productID, quantity := range quantities {
+		stock, ok := a.stocksByProductID[productID]
+		if !ok {
+			continue // not tracked
+		}
+		if stock.quantity-stock.reserved+previous[productID] < quantity {
+			return persistence.ErrInsufficientStock
+		}
+		reservation[productID] = quantity
+	}
+
+	// replace
+	a.releaseStock(orderID)
+	for productID, quantity := range reservation {
+		a.stocksByProductID[productID].reserved += quantity
+	}
+	a.stockReservationsByID[orderID] = reservation
+	return nil
+}
+
+// ReleaseStock drops the reservation of the order with the given id. Releasing
+// an order without reservation has no effect.
+func (a *Adapter) ReleaseStock(_ context.Context, orderID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	a.releaseStock(orderID)
+	return nil
+}
+
+// CommitStock takes the reserved items of the order with the given id out of
+// stock and drops the reservation. Committing an order without reservation has
+// no effect.
+func (a *Adapter) CommitStock(_ context.Context, orderID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	for productID, quantity := range a.stockReservationsByID[orderID] {
+		a.stocksByProductID[productID].quantity -= quantity
+	}
+	a.releaseStock(orderID)
+	return nil
+}
+
+func (a *Adapter) releaseStock(orderID string) {
+	for productID, quantity := range a.stockReservationsByID[orderID] {
+		a.stocksByProductID[productID].reserved -= quantity
+	}
+	delete(a.stockReservationsByID, orderID)
+}
+
+var _ persistence.CartRepository = (*Adapter)(nil)
+
+type cart struct {
+	userID    string
+	currency  model.Currency
+	positions map[string]int // maps product id to quantity
+	locked    bool
+}
+
+// CreateCart creates a cart for the given user with the given id, currency and
+// positions. Id must be unique. ErrConflict is returned otherwise. Positions
+// maps product ids to quantity.
+func (a *Adapter) CreateCart(_ context.Context, userID, id string, currency model.Currency, positions map[string]int) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if _, ok := a.cartsByID[id]; ok {
+		return persistence.ErrConflict
+	}
+
+	cart := cart{
+		userID:    userID,
+		currency:  currency,
+		positions: make(map[string]int, len(positions)),
+	}
+	for productID, quantity := range positions {
+		cart.positions[productID] = quantity
+	}
+	a.cartsByID[id] = &cart
+	return nil
+}
+
+// UpdateCartOfUser updates a cart of the given user with new positions in the
+// given currency. Any existing positions are replaced. ErrNotFound is returned
+// if the cart does not exist. ErrDeleted is returned if the cart did exist but
+// is deleted. ErrNotOwnedByUser is returned if the cart exists but it's not
+// owned by the given user. ErrLocked is returned if the cart is owned by the
+// given user, but is locked. ErrConflict is returned if the cart is in another
+// currency. Carts that were stored without a currency take the given one.
+func (a *Adapter) UpdateCartOfUser(_ context.Context, userID, id string, currency model.Currency, positions map[string]int) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	cart, ok := a.cartsByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if cart == nil {
+		return persistence.ErrDeleted
+	}
+
+	if cart.userID != userID {
+		return persistence.ErrNotOwnedByUser
+	}
+
+	if cart.locked {
+		return persistence.ErrLocked
+	}
+
+	if cart.currency != "" && cart.currency != currency {
+		return persistence.ErrConflict
+	}
+
+	cart.currency = currency
+	cart.positions = make(map[string]int, len(positions))
+	for productID, quantity := range positions {
+		cart.positions[productID] = quantity
+	}
+	return nil
+}
+
+// FindAllUnlockedCartsOfUser returns all stored carts and their positions of
+// the given user. Carts are returned with their currency, which is empty if
+// they were stored without one.
+func (a *Adapter) FindAllUnlockedCartsOfUser(_ context.Context, userID string) ([]*model.Cart, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	result := make([]*model.Cart, 0)
+	for id, cart := range a.cartsByID {
+		if cart == nil {
+			continue
+		}
+		if cart.userID != userID {
+			continue
+		}
+		if cart.locked {
+			continue
+		}
+		result = append(result, convertCartOut(id, cart))
+	}
+	return result, nil
+}
+
+// FindCartOfUser returns the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user.
+func (a *Adapter) FindCartOfUser(_ context.Context, userID, id string) (*model.Cart, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	cart, ok := a.cartsByID[id]
+	if !ok {
+		return nil, persistence.ErrNotFound
+	}
+
+	if cart == nil {
+		return nil, persistence.ErrDeleted
+	}
+
+	if cart.userID != userID {
+		return nil, persistence.ErrNotOwnedByUser
+	}
+
+	return convertCartOut(id, cart), nil
+}
+
+// DeleteCartOfUser deletes the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user. ErrLocked is
+// returned if the cart is owned by the given user, but is locked.
+func (a *Adapter) DeleteCartOfUser(_ context.Context, userID, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	cart, ok := a.cartsByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if cart == nil {
+		return persistence.ErrDeleted
+	}
+
+	if cart.userID != userID {
+		return persistence.ErrNotOwnedByUser
+	}
+
+	if cart.locked {
+		return persistence.ErrLocked
+	}
+
+	a.cartsByID[id] = nil
+	return nil
+}
+
+// LockCartOfUser locks the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user. ErrLocked is
+// returned if the cart is owned by the given user, but is locked.
+func (a *Adapter) LockCartOfUser(ctx context.Context, userID, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	cart, ok := a.cartsByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if cart == nil {
+		return persistence.ErrDeleted
+	}
+
+	if cart.userID != userID {
+		return persistence.ErrNotOwnedByUser
+	}
+
+	if cart.locked {
+		return persistence.ErrLocked
+	}
+
+	cart.locked = true
+	return nil
+}
+
+// UnlockCartOfUser unlocks the cart of the given user with the given cart id.
+// Unlocking a cart that is not locked has no effect. ErrNotFound is returned
+// if there is no cart with the id. ErrDeleted is returned if the cart did exist
+// but is deleted. ErrNotOwnedByUser is returned if the cart exists but it's not
+// owned by the given user.
+func (a *Adapter) UnlockCartOfUser(ctx context.Context, userID, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	cart, ok := a.cartsByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if cart == nil {
+		return persistence.ErrDeleted
+	}
+
+	if cart.userID != userID {
+		return persistence.ErrNotOwnedByUser
+	}
+
+	cart.locked = false
+	return nil
+}
+
+// TransferCartsOfUser transfers all unlocked carts of the given user to the new
+// user. Locked and deleted carts stay with the given user.
+func (a *Adapter) TransferCartsOfUser(_ context.Context, userID, newUserID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	for _, cart := range a.cartsByID {
+		if cart != nil && cart.userID == userID && !cart.locked {
+			cart.userID = newUserID
+		}
+	}
+	return nil
+}
+
+func convertCartOut(id string, cart *cart) *model.Cart {
+	out := model.Cart{
+		ID:        id,
+		Positions: make([]model.Position, 0, len(cart.positions)),
+		Currency:  cart.currency,
+		Locked:    cart.locked,
+	}
+	for productID, quantity := range cart.positions {
+		out.Positions = append(out.Positions, model.Position{
+			ProductID: productID,
+			Quantity:  quantity,
+		})
+	}
+	return &out
+}
+
+var _ persistence.CouponRepository = (*Adapter)(nil)
+
+type coupon struct {
+	attributes  persistence.CouponAttributes
+	redemptions int
+}
+
+type couponRedemption struct {
+	code   string
+	userID string
+}
+
+// StoreCoupon stores a coupon with the given code and attributes. If a coupon
+// with the same code was previously stored it is overwritten, but keeps its
+// redemptions.
+func (a *Adapter) StoreCoupon(ctx context.Context, code string, attributes persistence.CouponAttributes) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	var redemptions int
+	if existing, ok := a.couponsByCode[code]; ok {
+		redemptions = existing.redemptions
+	}
+	attributes.NotBefore = persistence.Timestamp(attributes.NotBefore)
+	attributes.ExpiresAt = persistence.Timestamp(attributes.ExpiresAt)
+	a.couponsByCode[code] = &coupon{
+		attributes:  attributes,
+		redemptions: redemptions,
+	}
+
+	return nil
+}
+
+// CreateCoupon stores a new coupon with the given code and attributes.
+// ErrConflict is returned if there already is a coupon with the code.
+func (a *Adapter) CreateCoupon(ctx context.Context, code string, attributes persistence.CouponAttributes) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if _, ok := a.couponsByCode[code]; ok {
+		return persistence.ErrConflict
+	}
+	attributes.NotBefore = persistence.Timestamp(attributes.NotBefore)
+	attributes.ExpiresAt = persistence.Timestamp(attributes.ExpiresAt)
+	a.couponsByCode[code] = &coupon{attributes: attributes}
+
+	return nil
+}
+
+// CreateCoupons stores new coupons with the given distinct codes and the same
+// attributes. Either all coupons are created or none. A
+// *CouponConflictError is returned if there already are coupons with some of
+// the codes.
+func (a *Adapter) CreateCoupons(ctx context.Context, codes []string, attributes persistence.CouponAttributes) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	var conflicts []string
+	for _, code := range codes {
+		if _, ok := a.couponsByCode[code]; ok {
+			conflicts = append(conflicts, code)
+		}
+	}
+	if len(conflicts) > 0 {
+		return &persistence.CouponConflictError{Codes: conflicts}
+	}
+	attributes.NotBefore = persistence.Timestamp(attributes.NotBefore)
+	attributes.ExpiresAt = persistence.Timestamp(attributes.ExpiresAt)
+	for _, code := range codes {
+		a.couponsByCode[code] = &coupon{attributes: attributes}
+	}
+
+	return nil
+}
+
+// FindValidCoupon returns the coupon with the given code that has started and
+// is not expired. ErrNotFound is returned if there is no coupon with the code,
+// or the coupon has not started yet or is expired.
+func (a *Adapter) FindValidCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	coupon, ok := a.couponsByCode[code]
+	now := time.Now()
+	if !ok || coupon.attributes.ExpiresAt.Before(now) || coupon.attributes.NotBefore.After(now) {
+		return nil, persistence.ErrNotFound
+	}
+
+	return convertCouponOut(code, coupon), nil
+}
+
+// FindCoupon returns the coupon with the given code, even if it is expired.
+// ErrNotFound is returned if there is no coupon with the code.
+func (a *Adapter) FindCoupon(ctx context.Context, code string) (*model.Coupon, error) {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	cart, ok := a.cartsByID[id]
+	coupon, ok := a.couponsByCode[code]
 	if !ok {
-		return persistence.ErrNotFound
+		return nil, persistence.ErrNotFound
 	}
 
-	if cart == nil {
-		return persistence.ErrDeleted
-	}
+	return convertCouponOut(code, coupon), nil
+}
 
-	if cart.userID != userID {
-		return persistence.ErrNotOwnedByUser
-	}
+// FindAllCoupons returns all coupons, including the expired ones, ordered by
+// code.
+func (a *Adapter) FindAllCoupons(ctx context.Context) ([]*model.Coupon, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
 
-	if cart.locked {
-		return persistence.ErrLocked
+	coupons := make([]*model.Coupon, 0, len(a.couponsByCode))
+	for code, coupon := range a.couponsByCode {
+		coupons = append(coupons, convertCouponOut(code, coupon))
 	}
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].Code < coupons[j].Code })
+	return coupons, nil
+}
 
-	cart.positions = make(map[string]int, len(positions))
-	for productID, quantity := range positions {
-		cart.positions[productID] = quantity
+// FindCouponsOfProduct returns all coupons of the product with the given id,
+// including the expired ones, ordered by code. The coupons on whole carts are
+// returned for the empty product id.
+func (a *Adapter) FindCouponsOfProduct(ctx context.Context, productID string) ([]*model.Coupon, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	var coupons []*model.Coupon
+	for code, coupon := range a.couponsByCode {
+		if coupon.attributes.ProductID == productID {
+			coupons = append(coupons, convertCouponOut(code, coupon))
+		}
 	}
-	return nil
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].Code < coupons[j].Code })
+	return coupons, nil
 }
 
-// FindAllUnlockedCartsOfUser returns all stored carts and their positions of
-// the given user.
-func (a *Adapter) FindAllUnlockedCartsOfUser(_ context.Context, userID string) ([]*model.Cart, error) {
+// DeleteCoupon deletes the coupon with the given code and its redemptions.
+// ErrNotFound is returned if there is no coupon with the code.
+func (a *Adapter) DeleteCoupon(ctx context.Context, code string) error {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	result := make([]*model.Cart, 0)
-	for id, cart := range a.cartsByID {
-		if cart == nil {
-			continue
-		}
-		if cart.userID != userID {
-			continue
+	if _, ok := a.couponsByCode[code]; !ok {
+		return persistence.ErrNotFound
+	}
+	delete(a.couponsByCode, code)
+	for orderID, redemptions := range a.couponRedemptionsByOrderID {
+		kept := redemptions[:0]
+		for _, redemption := range redemptions {
+			if redemption.code != code {
+				kept = append(kept, redemption)
+			}
 		}
-		if cart.locked {
-			continue
+		if len(kept) == 0 {
+			delete(a.couponRedemptionsByOrderID, orderID)
+		} else {
+			a.couponRedemptionsByOrderID[orderID] = kept
 		}
-		result = append(result, convertCartOut(id, cart))
 	}
-	return result, nil
+	return nil
 }
 
-// FindCartOfUser returns the cart of the given user with the given cart id.
-// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
-// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
-// if the cart exists but it's not owned by the given user.
-func (a *Adapter) FindCartOfUser(_ context.Context, userID, id string) (*model.Cart, error) {
+// RedeemCoupons records a redemption of each coupon with the given codes by
+// the order and user with the given ids. Any previous redemptions of the order
+// are replaced. Either all coupons are redeemed or none. ErrNotFound is
+// returned if there is no coupon with one of the codes. ErrLimitReached is
+// returned if a coupon would be redeemed more often than its maximum
+// redemptions in total or per user.
+func (a *Adapter) RedeemCoupons(ctx context.Context, orderID, userID string, codes []string) error {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	cart, ok := a.cartsByID[id]
-	if !ok {
-		return nil, persistence.ErrNotFound
+	// check against the redemptions without the ones of the order
+	previous := a.couponRedemptionsByOrderID[orderID]
+	for _, code := range codes {
+		coupon, ok := a.couponsByCode[code]
+		if !ok {
+			return persistence.ErrNotFound
+		}
+		total, ofUser := coupon.redemptions, 0
+		for _, redemption := range previous {
+			if redemption.code == code {
+				total--
+			}
+		}
+		for id, redemptions := range a.couponRedemptionsByOrderID {
+			for _, redemption := range redemptions {
+				if id != orderID && redemption.code == code && redemption.userID == userID {
+					ofUser++
+				}
+			}
+		}
+		if max := coupon.attributes.MaxRedemptions; max > 0 && total >= max {
+			return persistence.ErrLimitReached
+		}
+		if max := coupon.attributes.MaxRedemptionsPerUser; max > 0 && ofUser >= max {
+			return persistence.ErrLimitReached
+		}
 	}
 
-	if cart == nil {
-		return nil, persistence.ErrDeleted
+	a.releaseCouponRedemptions(orderID)
+	redemptions := make([]couponRedemption, len(codes))
+	for i, code := range codes {
+		a.couponsByCode[code].redemptions++
+		redemptions[i] = couponRedemption{code: code, userID: userID}
 	}
-
-	if cart.userID != userID {
-		return nil, persistence.ErrNotOwnedByUser
+	if len(redemptions) > 0 {
+		a.couponRedemptionsByOrderID[orderID] = redemptions
 	}
-
-	return convertCartOut(id, cart), nil
+	return nil
 }
 
-// DeleteCartOfUser deletes the cart of the given user with the given cart id.
-// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
-// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
-// if the cart exists but it's not owned by the given user. ErrLocked is
-// returned if the cart is owned by the given user, but is locked.
-func (a *Adapter) DeleteCartOfUser(_ context.Context, userID, id string) error {
+// ReleaseCouponRedemptions drops the redemptions of the order with the given
+// id. Releasing an order without redemptions has no effect.
+func (a *Adapter) ReleaseCouponRedemptions(ctx context.Context, orderID string) error {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	cart, ok := a.cartsByID[id]
-	if !ok {
-		return persistence.ErrNotFound
-	}
+	a.releaseCouponRedemptions(orderID)
+	return nil
+}
 
-	if cart == nil {
-		return persistence.ErrDeleted
+// releaseCouponRedemptions expects the caller to hold the lock.
+func (a *Adapter) releaseCouponRedemptions(orderID string) {
+	for _, redemption := range a.couponRedemptionsByOrderID[orderID] {
+		if coupon, ok := a.couponsByCode[redemption.code]; ok {
+			coupon.redemptions--
+		}
 	}
+	delete(a.couponRedemptionsByOrderID, orderID)
+}
 
-	if cart.userID != userID {
-		return persistence.ErrNotOwnedByUser
+// CountCouponRedemptionsOfUser returns how often the coupon with the given code
+// was redeemed by the user with the given id.
+func (a *Adapter) CountCouponRedemptionsOfUser(ctx context.Context, code, userID string) (int, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	var count int
+	for _, redemptions := range a.couponRedemptionsByOrderID {
+		for _, redemption := range redemptions {
+			if redemption.code == code && redemption.userID == userID {
+				count++
+			}
+		}
 	}
+	return count, nil
+}
 
-	if cart.locked {
-		return persistence.ErrLocked
+func convertCouponOut(code string, coupon *coupon) *model.Coupon {
+	return &model.Coupon{
+		Code:                  code,
+		Name:                  coupon.attributes.Name,
+		ProductID:             coupon.attributes.ProductID,
+		Discount:              coupon.attributes.Discount,
+		Amount:                coupon.attributes.Amount,
+		MinSubtotal:           coupon.attributes.MinSubtotal,
+		NotBefore:             coupon.attributes.NotBefore,
+		ExpiresAt:             coupon.attributes.ExpiresAt,
+		MaxRedemptions:        coupon.attributes.MaxRedemptions,
+		MaxRedemptionsPerUser: coupon.attributes.MaxRedemptionsPerUser,
+		Redemptions:           coupon.redemptions,
 	}
+}
 
-	a.cartsByID[id] = nil
-	return nil
+var _ persistence.PromotionRepository = (*Adapter)(nil)
+
+type promotion struct {
+	promotionType model.PromotionType
+	name          string
+	productID     string
+	quantity      int
+	freeQuantity  int
+	bundle        map[string]int // maps product id to quantity
+	discount      int
 }
 
-// LockCartOfUser locks the cart of the given user with the given cart id.
-// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
-// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
-// if the cart exists but it's not owned by the given user. ErrLocked is
-// returned if the cart is owned by the given user, but is locked.
-func (a *Adapter) LockCartOfUser(ctx context.Context, userID, id string) error {
+// StorePromotion stores a promotion with the given id and attributes. If a
+// promotion with the same id was previously stored it is overwritten.
+func (a *Adapter) StorePromotion(_ context.Context, id string, attributes persistence.PromotionAttributes) error {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	cart, ok := a.cartsByID[id]
-	if !ok {
-		return persistence.ErrNotFound
-	}
+	a.storePromotion(id, attributes)
+	return nil
+}
 
-	if cart == nil {
-		return persistence.ErrDeleted
-	}
+// SeedPromotions stores the given promotions with their ids like
+// StorePromotion, but only the first time it is called on a repository
+// without promotions. Later calls do nothing, so that seeded promotions that
+// were deleted are not restored.
+func (a *Adapter) SeedPromotions(_ context.Context, promotions map[string]persistence.PromotionAttributes) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
 
-	if cart.userID != userID {
-		return persistence.ErrNotOwnedByUser
+	if a.promotionsSeeded {
+		return nil
 	}
-
-	if cart.locked {
-		return persistence.ErrLocked
+	a.promotionsSeeded = true
+	if len(a.promotionsByID) > 0 {
+		return nil
+	}
+	for id, attributes := range promotions {
+		a.storePromotion(id, attributes)
 	}
-
-	cart.locked = true
 	return nil
 }
 
-func convertCartOut(id string, cart *cart) *model.Cart {
-	out := model.Cart{
-		ID:        id,
-		Positions: make([]model.Position, 0, len(cart.positions)),
-		Locked:    cart.locked,
+// storePromotion expects the caller to hold the lock.
+func (a *Adapter) storePromotion(id string, attributes persistence.PromotionAttributes) {
+	promotion := promotion{
+		promotionType: attributes.Type,
+		name:          attributes.Name,
+		productID:     attributes.ProductID,
+		quantity:      attributes.Quantity,
+		freeQuantity:  attributes.FreeQuantity,
+		discount:      attributes.Discount,
 	}
-	for productID, quantity := range cart.positions {
-		out.Positions = append(out.Positions, model.Position{
-			ProductID: productID,
-			Quantity:  quantity,
-		})
+	if attributes.Bundle != nil {
+		promotion.bundle = make(map[string]int, len(attributes.Bundle))
+		for productID, quantity := range attributes.Bundle {
+			promotion.bundle[productID] = quantity
+		}
 	}
-	return &out
+	a.promotionsByID[id] = &promotion
 }
 
-var _ persistence.CouponRepository = (*Adapter)(nil)
+// FindAllPromotions returns all stored promotions.
+func (a *Adapter) FindAllPromotions(_ context.Context) ([]*model.Promotion, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
 
-type coupon struct {
-	name      string
-	productID string
-	discount  int
-	expiresAt time.Time
+	result := make([]*model.Promotion, 0, len(a.promotionsByID))
+	for id, promotion := range a.promotionsByID {
+		result = append(result, convertPromotionOut(id, promotion))
+	}
+	return result, nil
 }
 
-// StoreCoupon stores a coupon with the given code, name, product id, discount
-// in percent and expires at time. If a coupon with the same code was previously
-// stored it is overwritten.
-func (a *Adapter) StoreCoupon(ctx context.Context, code string, name string, productID string, discount int, expiresAt time.Time) error {
+// FindPromotion returns the promotion with the given id. ErrNotFound is
+// returned if there is no promotion with the id.
+func (a *Adapter) FindPromotion(_ context.Context, id string) (*model.Promotion, error) {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	// clean up expired coupons
-	for code, coupon := range a.couponsByCode {
-		if coupon.expiresAt.Before(time.Now()) {
-			delete(a.couponsByCode, code)
-		}
-	}
-
-	// add new coupon
-	a.couponsByCode[code] = &coupon{
-		name:      name,
-		productID: productID,
-		discount:  discount,
-		expiresAt: expiresAt,
+	promotion, ok := a.promotionsByID[id]
+	if !ok {
+		return nil, persistence.ErrNotFound
 	}
-
-	return nil
+	return convertPromotionOut(id, promotion), nil
 }
 
-// FindValidCoupon returns the coupon with the given code that is not expired.
-// ErrNotFound is returned if there is no coupon with the code or the coupon is
-// expired.
-func (a *Adapter) FindValidCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+// DeletePromotion deletes the promotion with the given id. ErrNotFound is
+// returned if there is no promotion with the id.
+func (a *Adapter) DeletePromotion(_ context.Context, id string) error {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
-	coupon, ok := a.couponsByCode[code]
-	if !ok || coupon.expiresAt.Before(time.Now()) {
-		return nil, persistence.ErrNotFound
+	if _, ok := a.promotionsByID[id]; !ok {
+		return persistence.ErrNotFound
 	}
+	delete(a.promotionsByID, id)
+	return nil
+}
 
-	return &model.Coupon{
-		Code:      code,
-		Name:      coupon.name,
-		ProductID: coupon.productID,
-		Discount:  coupon.discount,
-		ExpiresAt: coupon.expiresAt,
-	}, nil
+func convertPromotionOut(id string, promotion *promotion) *model.Promotion {
+	out := model.Promotion{
+		ID:           id,
+		Type:         promotion.promotionType,
+		Name:         promotion.name,
+		ProductID:    promotion.productID,
+		Quantity:     promotion.quantity,
+		FreeQuantity: promotion.freeQuantity,
+		Discount:     promotion.discount,
+	}
+	if promotion.bundle != nil {
+		out.Bundle = make(map[string]int, len(promotion.bundle))
+		for productID, quantity := range promotion.bundle {
+			out.Bundle[productID] = quantity
+		}
+	}
+	return &out
 }
 
 var _ persistence.OrderRepository = (*Adapter)(nil)
@@ -441,6 +1419,8 @@ type order struct {
 	buyer     orderAddress
 	recipient orderAddress
 	coupons   []string
+	currency  model.Currency
+	shipping  string
 	locked    bool
 }
 
@@ -468,6 +1448,8 @@ func (a *Adapter) CreateOrder(_ context.Context, userID, id string, attributes p
 		buyer:     orderAddress(attributes.Buyer),
 		recipient: orderAddress(attributes.Recipient),
 		coupons:   make([]string, len(attributes.Coupons)),
+		currency:  attributes.Currency,
+		shipping:  attributes.ShippingMethodID,
 	}
 	if attributes.Hash != nil {
 		order.hash = make([]byte, len(attributes.Hash))
@@ -505,7 +1487,10 @@ func (a *Adapter) FindOrderOfUser(_ context.Context, userID, id string) (*model.
 		Buyer:     model.Address(order.buyer),
 		Recipient: model.Address(order.recipient),
 		Coupons:   make([]*model.Coupon, len(order.coupons)),
+		Currency:  order.currency,
 		Locked:    order.locked,
+
+		ShippingMethodID: order.shipping,
 	}
 	if order.hash != nil {
 		out.Hash = make([]byte, len(order.hash))
@@ -576,3 +1561,170 @@ func (a *Adapter) LockOrderOfUser(ctx context.Context, userID, id string) error
 	order.locked = true
 	return nil
 }
+
+// UnlockOrderOfUser unlocks the order of the given user with the given id.
+// Unlocking an order that is not locked has no effect. ErrNotFound is returned
+// if there is no order with the id. ErrDeleted is returned if the order did
+// exist but is deleted. ErrNotOwnedByUser is returned if the order exists but
+// it's not owned by the given user.
+func (a *Adapter) UnlockOrderOfUser(ctx context.Context, userID, id string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	order, ok := a.ordersByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if order == nil {
+		return persistence.ErrDeleted
+	}
+
+	if order.userID != userID {
+		return persistence.ErrNotOwnedByUser
+	}
+
+	order.locked = false
+	return nil
+}
+
+// TransferOrdersOfUser transfers all unlocked orders of the given user to the
+// new user. Locked and deleted orders stay with the given user.
+func (a *Adapter) TransferOrdersOfUser(_ context.Context, userID, newUserID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	for _, order := range a.ordersByID {
+		if order != nil && order.userID == userID && !order.locked {
+			order.userID = newUserID
+		}
+	}
+	return nil
+}
+
+var _ persistence.PlacedOrderRepository = (*Adapter)(nil)
+
+// PlaceOrder places the order and all related data. The id of the order must
+// be unique. ErrConflict is returned otherwise.
+func (a *Adapter) PlaceOrder(_ context.Context, order persistence.PlacedOrder) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if _, ok := a.placedOrdersByID[order.ID]; ok {
+		return persistence.ErrConflict
+	}
+
+	a.placedOrdersByID[order.ID] = copyPlacedOrder(&order)
+	return nil
+}
+
+// FindAllPlacedOrdersOfUser returns all placed orders of the given user.
+func (a *Adapter) FindAllPlacedOrdersOfUser(_ context.Context, userID string) ([]*persistence.PlacedOrder, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	result := make([]*persistence.PlacedOrder, 0)
+	for _, order := range a.placedOrdersByID {
+		if order.UserID == userID {
+			result = append(result, copyPlacedOrder(order))
+		}
+	}
+	return result, nil
+}
+
+// FindPlacedOrderOfUser returns the placed order of the given user with the
+// given id. ErrNotFound is returned if there is no placed order with the id.
+// ErrNotOwnedByUser is returned if the placed order exists but it's not owned
+// by the given user.
+func (a *Adapter) FindPlacedOrderOfUser(_ context.Context, userID, id string) (*persistence.PlacedOrder, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	order, ok := a.placedOrdersByID[id]
+	if !ok {
+		return nil, persistence.ErrNotFound
+	}
+
+	if order.UserID != userID {
+		return nil, persistence.ErrNotOwnedByUser
+	}
+
+	return copyPlacedOrder(order), nil
+}
+
+// FindPlacedOrder returns the placed order with the given id regardless of the
+// user. ErrNotFound is returned if there is no placed order with the id.
+func (a *Adapter) FindPlacedOrder(_ context.Context, id string) (*persistence.PlacedOrder, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	order, ok := a.placedOrdersByID[id]
+	if !ok {
+		return nil, persistence.ErrNotFound
+	}
+
+	return copyPlacedOrder(order), nil
+}
+
+// UpdatePlacedOrderStatus appends the change to the status history of the
+// placed order with the given id, if the current status is the given one. The
+// current status is the status of the last change or empty if there is none.
+// ErrNotFound is returned if there is no placed order with the id. ErrConflict
+// is returned if the current status is a different one.
+func (a *Adapter) UpdatePlacedOrderStatus(_ context.Context, id string, current model.OrderStatus, change model.OrderStatusChange) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	order, ok := a.placedOrdersByID[id]
+	if !ok {
+		return persistence.ErrNotFound
+	}
+
+	if currentPlacedOrderStatus(order) != current {
+		return persistence.ErrConflict
+	}
+
+	order.StatusHistory = append(order.StatusHistory, change)
+	return nil
+}
+
+// TransferPlacedOrdersOfUser transfers all placed orders of the given user to
+// the new user.
+func (a *Adapter) TransferPlacedOrdersOfUser(_ context.Context, userID, newUserID string) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	for _, order := range a.placedOrdersByID {
+		if order.UserID == userID {
+			order.UserID = newUserID
+		}
+	}
+	return nil
+}
+
+func currentPlacedOrderStatus(order *persistence.PlacedOrder) model.OrderStatus {
+	if len(order.StatusHistory) == 0 {
+		return ""
+	}
+	return order.StatusHistory[len(order.StatusHistory)-1].Status
+}
+
+// returns a deep copy with non-nil maps, positions, taxes and status history
+func copyPlacedOrder(order *persistence.PlacedOrder) *persistence.PlacedOrder {
+	out := *order
+	out.Coupons = make(map[string]persistence.OrderCoupon, len(order.Coupons))
+	for code, coupon := range order.Coupons {
+		out.Coupons[code] = coupon
+	}
+	out.Products = make(map[string]persistence.OrderProduct, len(order.Products))
+	for id, product := range order.Products {
+		out.Products[id] = product
+	}
+	out.Positions = make([]persistence.OrderPosition, len(order.Positions))
+	copy(out.Positions, order.Positions)
+	out.Taxes = make([]persistence.OrderTax, len(order.Taxes))
+	copy(out.Taxes, order.Taxes)
+	out.StatusHistory = make([]model.OrderStatusChange, len(order.StatusHistory))
+	copy(out.StatusHistory, order.StatusHistory)
+	return &out
+}
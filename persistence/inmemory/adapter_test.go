@@ -52,3 +52,48 @@ func TestAdapterImplementsOrderRepository(t *testing.T) {
 	}
 	suite.RunSuite(t)
 }
+
+func TestAdapterImplementsPromotionRepository(t *testing.T) {
+	suite := &testsuite.PromotionRepositoryTestSuite{
+		NewRepository: func() persistence.PromotionRepository {
+			return inmemory.NewAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsStockRepository(t *testing.T) {
+	suite := &testsuite.StockRepositoryTestSuite{
+		NewRepository: func() persistence.StockRepository {
+			return inmemory.NewAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsSessionRepository(t *testing.T) {
+	suite := &testsuite.SessionRepositoryTestSuite{
+		NewRepository: func() persistence.SessionRepository {
+			return inmemory.NewAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPasswordResetRepository(t *testing.T) {
+	suite := &testsuite.PasswordResetRepositoryTestSuite{
+		NewRepository: func() persistence.PasswordResetRepository {
+			return inmemory.NewAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPlacedOrderRepository(t *testing.T) {
+	suite := &testsuite.PlacedOrderRepositoryTestSuite{
+		NewRepository: func() persistence.PlacedOrderRepository {
+			return inmemory.NewAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
@@ -2,24 +2,74 @@ package log
 
 import (
 	"context"
-	"log"
 
+	"github.com/Teelevision/excommerce/logging"
+	"github.com/Teelevision/excommerce/model"
 	"github.com/Teelevision/excommerce/persistence"
 )
 
-// Adapter is a write only persistence adapter. It simply prints everything to
-// the standard output.
-type Adapter struct{}
+// Adapter is a persistence adapter that logs every placed order and status
+// change with the logger of the context. Only ids, prices and statuses are
+// logged, no personal data like addresses. Storing and loading is passed on to
+// another repository.
+type Adapter struct {
+	repository persistence.PlacedOrderRepository
+}
 
-// NewAdapter returns a new log adapter.
-func NewAdapter() *Adapter {
-	return &Adapter{}
+// NewAdapter returns a new log adapter that passes everything on to the given
+// repository.
+func NewAdapter(repository persistence.PlacedOrderRepository) *Adapter {
+	return &Adapter{repository: repository}
 }
 
 var _ persistence.PlacedOrderRepository = (*Adapter)(nil)
 
-// PlaceOrder places the order and all related data.
+// PlaceOrder places the order and all related data. The id of the order must
+// be unique. ErrConflict is returned otherwise.
 func (a *Adapter) PlaceOrder(ctx context.Context, order persistence.PlacedOrder) error {
-	log.Print(order)
+	if err := a.repository.PlaceOrder(ctx, order); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("placed order stored",
+		"orderId", order.ID, "userId", order.UserID, "price", order.Price, "currency", order.Currency)
+	return nil
+}
+
+// FindAllPlacedOrdersOfUser returns all placed orders of the given user.
+func (a *Adapter) FindAllPlacedOrdersOfUser(ctx context.Context, userID string) ([]*persistence.PlacedOrder, error) {
+	return a.repository.FindAllPlacedOrdersOfUser(ctx, userID)
+}
+
+// FindPlacedOrderOfUser returns the placed order of the given user with the
+// given id. ErrNotFound is returned if there is no placed order with the id.
+// ErrNotOwnedByUser is returned if the placed order exists but it's not owned
+// by the given user.
+func (a *Adapter) FindPlacedOrderOfUser(ctx context.Context, userID, id string) (*persistence.PlacedOrder, error) {
+	return a.repository.FindPlacedOrderOfUser(ctx, userID, id)
+}
+
+// FindPlacedOrder returns the placed order with the given id regardless of the
+// user. ErrNotFound is returned if there is no placed order with the id.
+func (a *Adapter) FindPlacedOrder(ctx context.Context, id string) (*persistence.PlacedOrder, error) {
+	return a.repository.FindPlacedOrder(ctx, id)
+}
+
+// UpdatePlacedOrderStatus appends the change to the status history of the
+// placed order with the given id, if the current status is the given one. The
+// current status is the status of the last change or empty if there is none.
+// ErrNotFound is returned if there is no placed order with the id. ErrConflict
+// is returned if the current status is a different one.
+func (a *Adapter) UpdatePlacedOrderStatus(ctx context.Context, id string, current model.OrderStatus, change model.OrderStatusChange) error {
+	if err := a.repository.UpdatePlacedOrderStatus(ctx, id, current, change); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Info("placed order status changed",
+		"orderId", id, "from", current, "to", change.Status)
 	return nil
 }
+
+// TransferPlacedOrdersOfUser transfers all placed orders of the given user to
+// the new user.
+func (a *Adapter) TransferPlacedOrdersOfUser(ctx context.Context, userID, newUserID string) error {
+	return a.repository.TransferPlacedOrdersOfUser(ctx, userID, newUserID)
+}
@@ -1,18 +1,49 @@
 package log_test
 
 import (
+	"bytes"
+	"context"
 	"testing"
+	"time"
 
+	"github.com/Teelevision/excommerce/logging"
+	"github.com/Teelevision/excommerce/model"
 	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/persistence/inmemory"
 	"github.com/Teelevision/excommerce/persistence/log"
 	"github.com/Teelevision/excommerce/persistence/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAdapterImplementsPlacedOrderRepository(t *testing.T) {
 	suite := &testsuite.PlacedOrderRepositoryTestSuite{
 		NewRepository: func() persistence.PlacedOrderRepository {
-			return log.NewAdapter()
+			return log.NewAdapter(inmemory.NewAdapter())
 		},
 	}
 	suite.RunSuite(t)
 }
+
+func TestPlaceOrderLogsNoPersonalData(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.NewContext(context.Background(), logging.New(&buf, logging.LevelInfo))
+	a := log.NewAdapter(inmemory.NewAdapter())
+
+	require.NoError(t, a.PlaceOrder(ctx, persistence.PlacedOrder{
+		ID:       "a4ae1dfc-4d1c-4e0e-9c62-1c7d7b1e3b36",
+		UserID:   "1c0a0c3c-3c35-4c53-a8b2-3a5bd4a0a53b",
+		PlacedAt: time.Now(),
+		Buyer:    persistence.OrderAddress{Name: "Jane Doe", Street: "Main Street 1"},
+		Currency: model.DefaultCurrency,
+		Price:    1299,
+	}))
+
+	logged := buf.String()
+	assert.Contains(t, logged, `"orderId":"a4ae1dfc-4d1c-4e0e-9c62-1c7d7b1e3b36"`)
+	assert.Contains(t, logged, `"userId":"1c0a0c3c-3c35-4c53-a8b2-3a5bd4a0a53b"`)
+	assert.Contains(t, logged, `"price":1299`)
+	assert.Contains(t, logged, `"currency":"EUR"`)
+	assert.NotContains(t, logged, "Jane Doe")
+	assert.NotContains(t, logged, "Main Street")
+}
@@ -2,12 +2,22 @@ package persistence
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/Teelevision/excommerce/model"
 )
 
-// UserRepository stores and loads users. It is safe for concurrent use.
+// Pinger checks that the persistence responds. It is safe for concurrent use.
+type Pinger interface {
+	// Ping returns an error if the persistence does not respond, e.g.
+	// because the connection to the database is lost.
+	Ping(ctx context.Context) error
+}
+
+// UserRepository stores and loads users. Users are returned with their roles
+// in ascending order. It is safe for concurrent use.
 type UserRepository interface {
 	// CreateUser creates a user with the given id, name and password. Id must
 	// be unique. Name must be unique. ErrConflict is returned otherwise. The
@@ -23,36 +33,291 @@ type UserRepository interface {
 	// ids are unique the result is unambiguous. ErrNotFound is returned if no
 	// user matches the set of id and password.
 	FindUserByIDAndPassword(ctx context.Context, id, password string) (*model.User, error)
+
+	// FindUser finds the user by the given id. ErrNotFound is returned if
+	// there is no user with the id.
+	FindUser(ctx context.Context, id string) (*model.User, error)
+
+	// FindUserByName finds the user by the given name. ErrNotFound is
+	// returned if there is no user with the name.
+	FindUserByName(ctx context.Context, name string) (*model.User, error)
+
+	// FindUsersWithRole returns all users that have the given role.
+	FindUsersWithRole(ctx context.Context, role model.Role) ([]*model.User, error)
+
+	// SetUserRoles replaces the roles of the user with the given id. The
+	// roles must not contain duplicates. ErrNotFound is returned if there is
+	// no user with the id.
+	SetUserRoles(ctx context.Context, id string, roles []model.Role) error
+
+	// SetUserPassword replaces the password of the user with the given id.
+	// The password is stored as a hash and can never be retrieved again.
+	// ErrNotFound is returned if there is no user with the id.
+	SetUserPassword(ctx context.Context, id, password string) error
+
+	// DeleteUser deletes the user with the given id. The name can be used by
+	// another user afterwards. ErrNotFound is returned if there is no user
+	// with the id.
+	DeleteUser(ctx context.Context, id string) error
+
+	// ClaimGuest records that the guest with the given id was claimed by the
+	// user with the given id, so that the tokens of the guest can be
+	// rejected. ErrConflict is returned if the guest was claimed before.
+	ClaimGuest(ctx context.Context, guestID, userID string) error
+
+	// FindGuestClaim returns the id of the user that claimed the guest with
+	// the given id. ErrNotFound is returned if the guest was not claimed.
+	FindGuestClaim(ctx context.Context, guestID string) (string, error)
+}
+
+// SessionRepository stores and loads login sessions. Expired sessions are
+// treated as if they did not exist. It is safe for concurrent use.
+type SessionRepository interface {
+	// CreateSession creates a session of the given user with the given id
+	// and refresh token that expires at the given time. Id must be unique.
+	// ErrConflict is returned otherwise. The refresh token is stored as a
+	// hash and can never be retrieved again.
+	CreateSession(ctx context.Context, id, userID, refreshToken string, expiresAt time.Time) error
+	// RotateSession replaces the refresh token of the session with the given
+	// id and sets the new expiry time. ErrNotFound is returned if there is no
+	// session with the id. ErrConflict is returned if the refresh token is
+	// not the current one of the session.
+	RotateSession(ctx context.Context, id, refreshToken, newRefreshToken string, expiresAt time.Time) error
+	// FindSession returns the session with the given id. ErrNotFound is
+	// returned if there is no session with the id.
+	FindSession(ctx context.Context, id string) (*model.Session, error)
+	// DeleteSession deletes the session with the given id. ErrNotFound is
+	// returned if there is no session with the id.
+	DeleteSession(ctx context.Context, id string) error
+	// DeleteSessionsOfUser deletes all sessions of the given user.
+	DeleteSessionsOfUser(ctx context.Context, userID string) error
+}
+
+// PasswordResetRepository stores and redeems password reset tokens. Expired
+// tokens are treated as if they did not exist. It is safe for concurrent use.
+type PasswordResetRepository interface {
+	// CreatePasswordReset stores the token to reset the password of the given
+	// user. It expires at the given time. The token must be unique.
+	// ErrConflict is returned otherwise. The token is stored as a hash and
+	// can never be retrieved again.
+	CreatePasswordReset(ctx context.Context, token, userID string, expiresAt time.Time) error
+	// RedeemPasswordReset deletes the given token and returns the id of the
+	// user whose password may be reset. ErrNotFound is returned if the token
+	// does not exist.
+	RedeemPasswordReset(ctx context.Context, token string) (string, error)
+	// DeletePasswordResetsOfUser deletes all tokens of the given user.
+	DeletePasswordResetsOfUser(ctx context.Context, userID string) error
 }
 
 // ProductRepository stores and loads products. It is safe for concurrent use.
 type ProductRepository interface {
-	// CreateProduct creates a product with the given id, name and price. Id
-	// must be unique. ErrConflict is returned otherwise. The price is in cents.
-	CreateProduct(ctx context.Context, id, name string, price int) error
-	// FindAllProducts returns all stored products.
+	// CreateProduct creates a product with the given id and attributes. Id
+	// must be unique. ErrConflict is returned otherwise.
+	CreateProduct(ctx context.Context, id string, attributes ProductAttributes) error
+	// UpdateProduct replaces the attributes of the product with the given id.
+	// ErrNotFound is returned if there is no product with the id. ErrDeleted
+	// is returned if the product did exist but is deleted.
+	UpdateProduct(ctx context.Context, id string, attributes ProductAttributes) error
+	// DeleteProduct deletes the product with the given id. The id cannot be
+	// used for another product. ErrNotFound is returned if there is no
+	// product with the id. ErrDeleted is returned if the product did exist
+	// but is deleted.
+	DeleteProduct(ctx context.Context, id string) error
+	// FindAllProducts returns all stored products that are not deleted.
 	FindAllProducts(context.Context) ([]*model.Product, error)
 	// FindProduct returns the product with the given id. ErrNotFound is
-	// returned if there is no product with the id.
+	// returned if there is no product with the id. ErrDeleted is returned if
+	// the product did exist but is deleted.
 	FindProduct(ctx context.Context, id string) (*model.Product, error)
+	// QueryProducts returns the products that are not deleted and match the
+	// query, in the order and page defined by the query.
+	QueryProducts(ctx context.Context, query ProductQuery) ([]*model.Product, error)
+}
+
+// ProductAttributes are the attributes of a product. The order of categories
+// and images is kept. Empty prices, categories, attributes and images of loaded
+// products are nil.
+type ProductAttributes struct {
+	Name        string
+	Price       int                    // in cents, in the default currency
+	Prices      map[model.Currency]int // in cents, by currency other than the default one
+	TaxClass    string                 // empty for the default tax class
+	Weight      int                    // in grams
+	Description string
+	SKU         string
+	Categories  []string
+	Attributes  map[string]string
+	Images      []model.Image
+}
+
+// StockRepository stores the stock levels of products and the reservations of
+// stock by orders. Products without a stock level are not tracked and have
+// unlimited stock. It is safe for concurrent use.
+type StockRepository interface {
+	// SetStock sets the quantity in stock of the product with the given id.
+	// The product is tracked from now on. ErrConflict is returned if the
+	// quantity is lower than the reserved quantity.
+	SetStock(ctx context.Context, productID string, quantity int) error
+	// AdjustStock adds delta to the quantity in stock of the product with the
+	// given id. ErrNotFound is returned if the product is not tracked.
+	// ErrConflict is returned if the quantity would become lower than the
+	// reserved quantity.
+	AdjustStock(ctx context.Context, productID string, delta int) error
+	// DeleteStock stops tracking the stock of the product with the given id.
+	// Its reservations are dropped. ErrNotFound is returned if the product is
+	// not tracked.
+	DeleteStock(ctx context.Context, productID string) error
+	// FindStock returns the stock of the product with the given id.
+	// ErrNotFound is returned if the product is not tracked.
+	FindStock(ctx context.Context, productID string) (*model.Stock, error)
+	// ReserveStock reserves the quantities for the order with the given id.
+	// Quantities maps product ids to quantity. Products that are not tracked
+	// are ignored. Any previous reservation of the order is replaced. Either
+	// all quantities are reserved or none. ErrInsufficientStock is returned if
+	// any product has not enough available items.
+	ReserveStock(ctx context.Context, orderID string, quantities map[string]int) error
+	// ReleaseStock drops the reservation of the order with the given id.
+	// Releasing an order without reservation has no effect.
+	ReleaseStock(ctx context.Context, orderID string) error
+	// CommitStock takes the reserved items of the order with the given id out
+	// of stock and drops the reservation. Committing an order without
+	// reservation has no effect.
+	CommitStock(ctx context.Context, orderID string) error
+}
+
+// ProductQuery selects, sorts and pages products. The zero value selects all
+// products sorted by name.
+type ProductQuery struct {
+	// Search matches products whose name, description or SKU contain it,
+	// ignoring case. Empty matches all products.
+	Search string
+	// Currency is the currency of the price range and of sorting by price.
+	// Products without a price in the currency do not match. Empty means
+	// model.DefaultCurrency.
+	Currency model.Currency
+	// MinPrice and MaxPrice are the inclusive price range in cents. Nil means
+	// no limit.
+	MinPrice, MaxPrice *int
+	// Categories matches products that are in any of them. Empty matches all
+	// products.
+	Categories []string
+	// Sort is the order of the products. Empty means model.ProductSortNameAsc.
+	// Names are compared byte-wise.
+	Sort model.ProductSort
+	// After is the last product of the previous page. Only products after it
+	// in the sort order are returned. Only its id and the field that is sorted
+	// by are used, which is the price in the currency of the query when
+	// sorting by price. Nil means the first page.
+	After *model.Product
+	// Limit is the maximum number of products. Zero means no limit.
+	Limit int
+}
+
+// Price returns the price in cents of the product in the currency of the
+// query. False is returned if the product has no price in the currency.
+func (q *ProductQuery) Price(product *model.Product) (int, bool) {
+	if q.Currency == "" {
+		return product.Price, true
+	}
+	return product.PriceIn(q.Currency)
+}
+
+// Apply selects, sorts and pages the products according to the query. It can
+// be used by repositories that cannot query their storage. The given slice is
+// modified.
+func (q *ProductQuery) Apply(products []*model.Product) []*model.Product {
+	result := products[:0]
+	for _, product := range products {
+		if q.Match(product) && (q.After == nil || q.Less(q.After, product)) {
+			result = append(result, product)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return q.Less(result[i], result[j]) })
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result
+}
+
+// Match returns whether the product matches the search, currency, price range
+// and categories of the query.
+func (q *ProductQuery) Match(product *model.Product) bool {
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(product.Name), search) &&
+			!strings.Contains(strings.ToLower(product.Description), search) &&
+			!strings.Contains(strings.ToLower(product.SKU), search) {
+			return false
+		}
+	}
+	price, ok := q.Price(product)
+	if !ok {
+		return false
+	}
+	if q.MinPrice != nil && price < *q.MinPrice {
+		return false
+	}
+	if q.MaxPrice != nil && price > *q.MaxPrice {
+		return false
+	}
+	if len(q.Categories) > 0 {
+		for _, category := range q.Categories {
+			for _, productCategory := range product.Categories {
+				if category == productCategory {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Less returns whether product a comes before product b in the sort order of
+// the query. Prices are compared in the currency of the query.
+func (q *ProductQuery) Less(a, b *model.Product) bool {
+	aPrice, _ := q.Price(a)
+	bPrice, _ := q.Price(b)
+	switch q.Sort {
+	case model.ProductSortNameDesc:
+		if a.Name != b.Name {
+			return a.Name > b.Name
+		}
+	case model.ProductSortPriceAsc:
+		if aPrice != bPrice {
+			return aPrice < bPrice
+		}
+	case model.ProductSortPriceDesc:
+		if aPrice != bPrice {
+			return aPrice > bPrice
+		}
+	default:
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+	}
+	return a.ID < b.ID
 }
 
 // CartRepository stores and loads carts and their positions. It is safe for
 // concurrent use.
 type CartRepository interface {
-	// CreateCart creates a cart for the given user with the given id and
-	// positions. Id must be unique. ErrConflict is returned otherwise.
-	// Positions maps product ids to quantity.
-	CreateCart(ctx context.Context, userID, id string, positions map[string]int) error
-	// UpdateCartOfUser updates a cart of the given user with new positions. Any
-	// existing positions are replaced. ErrNotFound is returned if the cart does
-	// not exist. ErrDeleted is returned if the cart did exist but is deleted.
-	// ErrNotOwnedByUser is returned if the cart exists but it's not owned by
-	// the given user. ErrLocked is returned if the cart is owned by the given
-	// user, but is locked.
-	UpdateCartOfUser(ctx context.Context, userID, id string, positions map[string]int) error
+	// CreateCart creates a cart for the given user with the given id,
+	// currency and positions. Id must be unique. ErrConflict is returned
+	// otherwise. Positions maps product ids to quantity.
+	CreateCart(ctx context.Context, userID, id string, currency model.Currency, positions map[string]int) error
+	// UpdateCartOfUser updates a cart of the given user with new positions in
+	// the given currency. Any existing positions are replaced. ErrNotFound is
+	// returned if the cart does not exist. ErrDeleted is returned if the cart
+	// did exist but is deleted. ErrNotOwnedByUser is returned if the cart
+	// exists but it's not owned by the given user. ErrLocked is returned if
+	// the cart is owned by the given user, but is locked. ErrConflict is
+	// returned if the cart is in another currency. Carts that were stored
+	// without a currency take the given one.
+	UpdateCartOfUser(ctx context.Context, userID, id string, currency model.Currency, positions map[string]int) error
 	// FindAllUnlockedCartsOfUser returns all stored carts and their positions
-	// of the given user.
+	// of the given user. Carts are returned with their currency, which is
+	// empty if they were stored without one.
 	FindAllUnlockedCartsOfUser(ctx context.Context, userID string) ([]*model.Cart, error)
 	// FindCartOfUser returns the cart of the given user with the given cart id.
 	// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
@@ -73,18 +338,117 @@ type CartRepository interface {
 	// ErrLocked is returned if the cart is owned by the given user, but is
 	// locked.
 	LockCartOfUser(ctx context.Context, userID, id string) error
+	// UnlockCartOfUser unlocks the cart of the given user with the given cart
+	// id. Unlocking a cart that is not locked has no effect. ErrNotFound is
+	// returned if there is no cart with the id. ErrDeleted is returned if the
+	// cart did exist but is deleted. ErrNotOwnedByUser is returned if the cart
+	// exists but it's not owned by the given user.
+	UnlockCartOfUser(ctx context.Context, userID, id string) error
+	// TransferCartsOfUser transfers all unlocked carts of the given user to
+	// the new user. Locked and deleted carts stay with the given user.
+	TransferCartsOfUser(ctx context.Context, userID, newUserID string) error
 }
 
-// CouponRepository stores and loads coupons. It is safe for concurrent use.
+// CouponRepository stores and loads coupons and records their redemptions. It
+// is safe for concurrent use.
 type CouponRepository interface {
-	// StoreCoupon stores a coupon with the given code, name, product id,
-	// discount in percent and expires at time. If a coupon with the same code
-	// was previously stored it is overwritten.
-	StoreCoupon(ctx context.Context, code, name, productID string, discount int, expiresAt time.Time) error
-	// FindValidCoupon returns the coupon with the given code that is not
-	// expired. ErrNotFound is returned if there is no coupon with the code or
-	// the coupon is expired.
+	// StoreCoupon stores a coupon with the given code and attributes. If a
+	// coupon with the same code was previously stored it is overwritten, but
+	// keeps its redemptions.
+	StoreCoupon(ctx context.Context, code string, attributes CouponAttributes) error
+	// CreateCoupon stores a new coupon with the given code and attributes.
+	// ErrConflict is returned if there already is a coupon with the code.
+	CreateCoupon(ctx context.Context, code string, attributes CouponAttributes) error
+	// CreateCoupons stores new coupons with the given distinct codes and the
+	// same attributes. Either all coupons are created or none. A
+	// *CouponConflictError is returned if there already are coupons with some
+	// of the codes.
+	CreateCoupons(ctx context.Context, codes []string, attributes CouponAttributes) error
+	// FindValidCoupon returns the coupon with the given code that has started
+	// and is not expired. ErrNotFound is returned if there is no coupon with
+	// the code, or the coupon has not started yet or is expired.
 	FindValidCoupon(ctx context.Context, code string) (*model.Coupon, error)
+	// FindCoupon returns the coupon with the given code, even if it is
+	// expired. ErrNotFound is returned if there is no coupon with the code.
+	FindCoupon(ctx context.Context, code string) (*model.Coupon, error)
+	// FindAllCoupons returns all coupons, including the expired ones, ordered
+	// by code.
+	FindAllCoupons(context.Context) ([]*model.Coupon, error)
+	// FindCouponsOfProduct returns all coupons of the product with the given
+	// id, including the expired ones, ordered by code. The coupons on whole
+	// carts are returned for the empty product id.
+	FindCouponsOfProduct(ctx context.Context, productID string) ([]*model.Coupon, error)
+	// DeleteCoupon deletes the coupon with the given code and its
+	// redemptions. ErrNotFound is returned if there is no coupon with the
+	// code.
+	DeleteCoupon(ctx context.Context, code string) error
+	// RedeemCoupons records a redemption of each coupon with the given codes
+	// by the order and user with the given ids. Any previous redemptions of
+	// the order are replaced. Either all coupons are redeemed or none.
+	// ErrNotFound is returned if there is no coupon with one of the codes.
+	// ErrLimitReached is returned if a coupon would be redeemed more often
+	// than its maximum redemptions in total or per user.
+	RedeemCoupons(ctx context.Context, orderID, userID string, codes []string) error
+	// ReleaseCouponRedemptions drops the redemptions of the order with the
+	// given id. Releasing an order without redemptions has no effect.
+	ReleaseCouponRedemptions(ctx context.Context, orderID string) error
+	// CountCouponRedemptionsOfUser returns how often the coupon with the given
+	// code was redeemed by the user with the given id.
+	CountCouponRedemptionsOfUser(ctx context.Context, code, userID string) (int, error)
+}
+
+// CouponAttributes are the attributes of a coupon. A coupon gives either a
+// discount in percent or a fixed amount off. Zero limits mean no limit. The
+// times are stored as returned by Timestamp.
+type CouponAttributes struct {
+	Name                  string
+	ProductID             string // empty for coupons on the whole cart
+	Discount              int    // in percent
+	Amount                int    // in cents
+	MinSubtotal           int    // in cents
+	MaxRedemptions        int
+	MaxRedemptionsPerUser int
+	NotBefore             time.Time
+	ExpiresAt             time.Time
+}
+
+// Timestamp returns the time in UTC truncated to microseconds, which is the
+// precision that all repositories can store.
+func Timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// PromotionRepository stores and loads promotions. It is safe for concurrent
+// use.
+type PromotionRepository interface {
+	// StorePromotion stores a promotion with the given id and attributes. If a
+	// promotion with the same id was previously stored it is overwritten.
+	StorePromotion(ctx context.Context, id string, attributes PromotionAttributes) error
+	// FindAllPromotions returns all stored promotions.
+	FindAllPromotions(context.Context) ([]*model.Promotion, error)
+	// FindPromotion returns the promotion with the given id. ErrNotFound is
+	// returned if there is no promotion with the id.
+	FindPromotion(ctx context.Context, id string) (*model.Promotion, error)
+	// DeletePromotion deletes the promotion with the given id. ErrNotFound is
+	// returned if there is no promotion with the id.
+	DeletePromotion(ctx context.Context, id string) error
+	// SeedPromotions stores the given promotions with their ids like
+	// StorePromotion, but only the first time it is called on a repository
+	// without promotions. Later calls do nothing, so that seeded promotions
+	// that were deleted are not restored.
+	SeedPromotions(ctx context.Context, promotions map[string]PromotionAttributes) error
+}
+
+// PromotionAttributes are the attributes of a promotion. Which attributes are
+// used depends on the type.
+type PromotionAttributes struct {
+	Type         model.PromotionType
+	Name         string
+	ProductID    string
+	Quantity     int
+	FreeQuantity int
+	Bundle       map[string]int // product id to quantity
+	Discount     int            // in percent
 }
 
 // OrderRepository stores and loads orders. It is safe for concurrent use.
@@ -111,15 +475,26 @@ type OrderRepository interface {
 	// ErrLocked is returned if the order is owned by the given user, but is
 	// locked.
 	LockOrderOfUser(ctx context.Context, userID, id string) error
+	// UnlockOrderOfUser unlocks the order of the given user with the given id.
+	// Unlocking an order that is not locked has no effect. ErrNotFound is
+	// returned if there is no order with the id. ErrDeleted is returned if the
+	// order did exist but is deleted. ErrNotOwnedByUser is returned if the
+	// order exists but it's not owned by the given user.
+	UnlockOrderOfUser(ctx context.Context, userID, id string) error
+	// TransferOrdersOfUser transfers all unlocked orders of the given user to
+	// the new user. Locked and deleted orders stay with the given user.
+	TransferOrdersOfUser(ctx context.Context, userID, newUserID string) error
 }
 
 // OrderAttributes are common attributes of an order.
 type OrderAttributes struct {
-	Hash      []byte
-	CartID    string
-	Buyer     OrderAddress
-	Recipient OrderAddress
-	Coupons   []string
+	Hash             []byte
+	CartID           string
+	Buyer            OrderAddress
+	Recipient        OrderAddress
+	Coupons          []string
+	Currency         model.Currency
+	ShippingMethodID string // chosen, empty if not shipped
 }
 
 // OrderAddress is an address used in orders.
@@ -131,27 +506,59 @@ type OrderAddress struct {
 	Street     string
 }
 
-// PlacedOrderRepository places orders. It is safe for concurrent use.
+// PlacedOrderRepository places orders and loads placed orders. It is safe for
+// concurrent use.
 type PlacedOrderRepository interface {
-	// PlaceOrder places the order and all related data.
+	// PlaceOrder places the order and all related data. The id of the order
+	// must be unique. ErrConflict is returned otherwise.
 	PlaceOrder(ctx context.Context, order PlacedOrder) error
+	// FindAllPlacedOrdersOfUser returns all placed orders of the given user.
+	FindAllPlacedOrdersOfUser(ctx context.Context, userID string) ([]*PlacedOrder, error)
+	// FindPlacedOrderOfUser returns the placed order of the given user with the
+	// given id. ErrNotFound is returned if there is no placed order with the
+	// id. ErrNotOwnedByUser is returned if the placed order exists but it's not
+	// owned by the given user.
+	FindPlacedOrderOfUser(ctx context.Context, userID, id string) (*PlacedOrder, error)
+	// FindPlacedOrder returns the placed order with the given id regardless of
+	// the user. ErrNotFound is returned if there is no placed order with the
+	// id.
+	FindPlacedOrder(ctx context.Context, id string) (*PlacedOrder, error)
+	// UpdatePlacedOrderStatus appends the change to the status history of the
+	// placed order with the given id, if the current status is the given one.
+	// The current status is the status of the last change or empty if there
+	// is none. ErrNotFound is returned if there is no placed order with the
+	// id. ErrConflict is returned if the current status is a different one.
+	UpdatePlacedOrderStatus(ctx context.Context, id string, current model.OrderStatus, change model.OrderStatusChange) error
+	// TransferPlacedOrdersOfUser transfers all placed orders of the given user
+	// to the new user.
+	TransferPlacedOrdersOfUser(ctx context.Context, userID, newUserID string) error
 }
 
-// PlacedOrder is a placed order including all related data.
+// PlacedOrder is a placed order including all related data. The maps,
+// positions, taxes and status history of loaded placed orders are never nil.
 type PlacedOrder struct {
+	ID        string // id of the order that was placed
 	UserID    string
+	PlacedAt  time.Time
 	Buyer     OrderAddress
 	Recipient OrderAddress
 	Coupons   map[string]OrderCoupon  // code to coupon
 	Products  map[string]OrderProduct // id to product
+	Currency  model.Currency          // of all prices of the order
 	Price     int                     // in cents
 	Positions []OrderPosition
+	Taxes     []OrderTax // by tax class, in the order of the tax positions
+
+	StatusHistory []model.OrderStatusChange // oldest first
+
+	PaymentAuthorization string // id at the payment provider, may be empty
 }
 
 // OrderProduct is a product of a PlacedOrder.
 type OrderProduct struct {
-	Name  string
-	Price int // in cents
+	Name     string
+	Price    int    // in cents
+	TaxClass string // empty for the default tax class
 }
 
 // OrderCoupon is a coupon of a PlacedOrder.
@@ -159,12 +566,27 @@ type OrderCoupon struct {
 	ProductID string
 	Name      string
 	Discount  int // in percent
+	Amount    int // in cents
+}
+
+// OrderTax is the value added tax on the positions of a tax class of a
+// PlacedOrder.
+type OrderTax struct {
+	Class    string
+	Rate     int  // in hundredths of a percent
+	Net      int  // in cents, the taxed sum without the tax
+	Amount   int  // in cents
+	Included bool // whether the prices of the positions include the tax
 }
 
-// OrderPosition is a position of a PlacedOrder.
+// OrderPosition is a position of a PlacedOrder. Name is only set for positions
+// that are neither a product nor a coupon, like discounts of promotions and
+// shipping, where it is the name of the shipping method.
 type OrderPosition struct {
-	ProductID  string
-	CouponCode string
-	Quantity   int
-	Price      int // in cents
+	ProductID        string
+	CouponCode       string
+	ShippingMethodID string
+	Name             string
+	Quantity         int
+	Price            int // in cents
 }
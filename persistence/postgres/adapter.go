@@ -0,0 +1,125 @@
+// Package postgres implements repositories that persist in a PostgreSQL
+// database.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Adapter is the PostgreSQL persistence adapter. It implements a range of
+// repositories. Please use Open or NewAdapter to create a new instance. Adapter
+// is safe for concurrent use.
+//
+// All strings are stored as bytea, because text columns cannot contain NUL
+// characters, but the repositories must support any string.
+type Adapter struct {
+	db *sql.DB
+
+	bcryptCost int
+}
+
+// Option can be used to configure an adapter.
+type Option func(*Adapter)
+
+// FastLessSecureHashingForTesting is an option that configures an adapter to
+// use a less secure hashing. It is not secure enough to use in production, but
+// can speed up tests.
+func FastLessSecureHashingForTesting() Option {
+	return func(a *Adapter) {
+		a.bcryptCost = bcrypt.MinCost
+	}
+}
+
+// Open opens the PostgreSQL database with the given data source name and
+// returns a new adapter that uses it. See NewAdapter.
+func Open(ctx context.Context, dataSourceName string, options ...Option) (*Adapter, error) {
+	db, err := sql.Open("postgres", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewAdapter(ctx, db, options...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewAdapter returns a new PostgreSQL adapter that uses the given database.
+// The database schema is migrated to the latest version.
+func NewAdapter(ctx context.Context, db *sql.DB, options ...Option) (*Adapter, error) {
+	a := Adapter{
+		db: db,
+	}
+	for _, option := range options {
+		option(&a)
+	}
+	if err := migrate(ctx, db); err != nil {
+		return nil, err
+	}
+	if err := lowerProducts(ctx, db); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Close closes the database.
+func (a *Adapter) Close() error {
+	return a.db.Close()
+}
+
+var _ persistence.Pinger = (*Adapter)(nil)
+
+// Ping returns an error if the persistence does not respond, e.g. because the
+// connection to the database is lost.
+func (a *Adapter) Ping(ctx context.Context) error {
+	return contextErr(ctx, a.db.PingContext(ctx))
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// runs f in a transaction that is committed if f returns no error
+func (a *Adapter) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return contextErr(ctx, err)
+	}
+	return contextErr(ctx, tx.Commit())
+}
+
+// Returns the context's error if the context is done. This way the caller can
+// identify errors that are caused by cancellation.
+func contextErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" // unique_violation
+}
+
+// nullBytes returns nil for a nil slice, so that it is stored as NULL.
+func nullBytes(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,170 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/persistence/postgres"
+	"github.com/Teelevision/excommerce/persistence/testsuite"
+	"github.com/lib/pq"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testsuite.StopPostgres()
+	os.Exit(code)
+}
+
+func TestAdapterImplementsUserRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.UserRepositoryTestSuite{
+		NewRepository: func() persistence.UserRepository {
+			return newAdapter(postgres.FastLessSecureHashingForTesting())
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsProductRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.ProductRepositoryTestSuite{
+		NewRepository: func() persistence.ProductRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsCartRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.CartRepositoryTestSuite{
+		NewRepository: func() persistence.CartRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsCouponRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.CouponRepositoryTestSuite{
+		NewRepository: func() persistence.CouponRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsOrderRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.OrderRepositoryTestSuite{
+		NewRepository: func() persistence.OrderRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPromotionRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.PromotionRepositoryTestSuite{
+		NewRepository: func() persistence.PromotionRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsStockRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.StockRepositoryTestSuite{
+		NewRepository: func() persistence.StockRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsSessionRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.SessionRepositoryTestSuite{
+		NewRepository: func() persistence.SessionRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPasswordResetRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.PasswordResetRepositoryTestSuite{
+		NewRepository: func() persistence.PasswordResetRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+func TestAdapterImplementsPlacedOrderRepository(t *testing.T) {
+	newAdapter := adapterFactory(t)
+	suite := &testsuite.PlacedOrderRepositoryTestSuite{
+		NewRepository: func() persistence.PlacedOrderRepository {
+			return newAdapter()
+		},
+	}
+	suite.RunSuite(t)
+}
+
+var schemaCounter int64
+
+// adapterFactory returns a function that creates adapters, each in a new
+// schema of the database given by testsuite.PostgresDSN. The test is skipped
+// if there is none. All schemas are dropped when the test finishes.
+func adapterFactory(t *testing.T) func(options ...postgres.Option) *postgres.Adapter {
+	dsn, err := testsuite.PostgresDSN()
+	if err != nil {
+		t.Fatal(err)
+	} else if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set and PostgreSQL is not installed")
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schemas []string
+	t.Cleanup(func() {
+		for _, schema := range schemas {
+			if _, err := db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+				t.Error(err)
+			}
+		}
+		db.Close()
+	})
+
+	ctx := context.Background()
+	return func(options ...postgres.Option) *postgres.Adapter {
+		schema := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), atomic.AddInt64(&schemaCounter, 1))
+		if _, err := db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatal(err)
+		}
+		schemas = append(schemas, schema)
+		a, err := postgres.Open(ctx, dsn+" search_path="+schema, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+}
@@ -0,0 +1,259 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+)
+
+var _ persistence.CartRepository = (*Adapter)(nil)
+
+// CreateCart creates a cart for the given user with the given id, currency and
+// positions. Id must be unique. ErrConflict is returned otherwise. Positions
+// maps product ids to quantity.
+func (a *Adapter) CreateCart(ctx context.Context, userID, id string, currency model.Currency, positions map[string]int) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO carts (id, user_id, currency) VALUES ($1, $2, $3)`,
+			[]byte(id), []byte(userID), []byte(currency))
+		if isUniqueViolation(err) {
+			return persistence.ErrConflict
+		} else if err != nil {
+			return err
+		}
+		return insertCartPositions(ctx, tx, id, positions)
+	})
+}
+
+// UpdateCartOfUser updates a cart of the given user with new positions in the
+// given currency. Any existing positions are replaced. ErrNotFound is returned
+// if the cart does not exist. ErrDeleted is returned if the cart did exist but
+// is deleted. ErrNotOwnedByUser is returned if the cart exists but it's not
+// owned by the given user. ErrLocked is returned if the cart is owned by the
+// given user, but is locked. ErrConflict is returned if the cart is in another
+// currency. Carts that were stored without a currency take the given one.
+func (a *Adapter) UpdateCartOfUser(ctx context.Context, userID, id string, currency model.Currency, positions map[string]int) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUnlockedCartOfUser(ctx, tx, userID, id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `
+			UPDATE carts SET currency = $2
+			WHERE id = $1 AND (currency = '' OR currency = $2)`,
+			[]byte(id), []byte(currency))
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return persistence.ErrConflict
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM cart_positions WHERE cart_id = $1`, []byte(id))
+		if err != nil {
+			return err
+		}
+		return insertCartPositions(ctx, tx, id, positions)
+	})
+}
+
+// FindAllUnlockedCartsOfUser returns all stored carts and their positions of
+// the given user. Carts are returned with their currency, which is empty if
+// they were stored without one.
+func (a *Adapter) FindAllUnlockedCartsOfUser(ctx context.Context, userID string) ([]*model.Cart, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT c.id, c.currency, p.product_id, p.quantity
+		FROM carts c
+		LEFT JOIN cart_positions p ON p.cart_id = c.id
+		WHERE c.user_id = $1 AND NOT c.locked AND NOT c.deleted
+		ORDER BY c.id`,
+		[]byte(userID))
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	defer rows.Close()
+
+	result := make([]*model.Cart, 0)
+	var cart *model.Cart
+	for rows.Next() {
+		var id, currency, productID []byte
+		var quantity sql.NullInt64
+		if err := rows.Scan(&id, &currency, &productID, &quantity); err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		if cart == nil || cart.ID != string(id) {
+			cart = &model.Cart{
+				ID:        string(id),
+				Positions: make([]model.Position, 0),
+				Currency:  model.Currency(currency),
+			}
+			result = append(result, cart)
+		}
+		if productID != nil {
+			cart.Positions = append(cart.Positions, model.Position{
+				ProductID: string(productID),
+				Quantity:  int(quantity.Int64),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	return result, nil
+}
+
+// FindCartOfUser returns the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user.
+func (a *Adapter) FindCartOfUser(ctx context.Context, userID, id string) (*model.Cart, error) {
+	var cart *model.Cart
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		locked, currency, err := findCartStateOfUser(ctx, tx, userID, id, false)
+		if err != nil {
+			return err
+		}
+		cart = &model.Cart{
+			ID:       id,
+			Currency: currency,
+			Locked:   locked,
+		}
+		cart.Positions, err = findCartPositions(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// DeleteCartOfUser deletes the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user. ErrLocked is
+// returned if the cart is owned by the given user, but is locked.
+func (a *Adapter) DeleteCartOfUser(ctx context.Context, userID, id string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUnlockedCartOfUser(ctx, tx, userID, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM cart_positions WHERE cart_id = $1`, []byte(id))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE carts SET deleted = true WHERE id = $1`, []byte(id))
+		return err
+	})
+}
+
+// LockCartOfUser locks the cart of the given user with the given cart id.
+// ErrNotFound is returned if there is no cart with the id. ErrDeleted is
+// returned if the cart did exist but is deleted. ErrNotOwnedByUser is returned
+// if the cart exists but it's not owned by the given user. ErrLocked is
+// returned if the cart is owned by the given user, but is locked.
+func (a *Adapter) LockCartOfUser(ctx context.Context, userID, id string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUnlockedCartOfUser(ctx, tx, userID, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE carts SET locked = true WHERE id = $1`, []byte(id))
+		return err
+	})
+}
+
+// UnlockCartOfUser unlocks the cart of the given user with the given cart id.
+// Unlocking a cart that is not locked has no effect. ErrNotFound is returned
+// if there is no cart with the id. ErrDeleted is returned if the cart did exist
+// but is deleted. ErrNotOwnedByUser is returned if the cart exists but it's not
+// owned by the given user.
+func (a *Adapter) UnlockCartOfUser(ctx context.Context, userID, id string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if _, _, err := findCartStateOfUser(ctx, tx, userID, id, true); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE carts SET locked = false WHERE id = $1`, []byte(id))
+		return err
+	})
+}
+
+// TransferCartsOfUser transfers all unlocked carts of the given user to the new
+// user. Locked and deleted carts stay with the given user.
+func (a *Adapter) TransferCartsOfUser(ctx context.Context, userID, newUserID string) error {
+	_, err := a.db.ExecContext(ctx,
+		`UPDATE carts SET user_id = $2 WHERE user_id = $1 AND NOT locked AND NOT deleted`,
+		[]byte(userID), []byte(newUserID))
+	return contextErr(ctx, err)
+}
+
+// Returns the locked state and the currency of the cart. If forUpdate is true,
+// the cart's row is locked until the end of the transaction.
+func findCartStateOfUser(ctx context.Context, q querier, userID, id string, forUpdate bool) (locked bool, currency model.Currency, err error) {
+	query := `SELECT user_id, locked, deleted, currency FROM carts WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	var owner, currencyBytes []byte
+	var deleted bool
+	err = q.QueryRowContext(ctx, query, []byte(id)).Scan(&owner, &locked, &deleted, &currencyBytes)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, "", persistence.ErrNotFound
+	case err != nil:
+		return false, "", err
+	case deleted:
+		return false, "", persistence.ErrDeleted
+	case string(owner) != userID:
+		return false, "", persistence.ErrNotOwnedByUser
+	}
+	return locked, model.Currency(currencyBytes), nil
+}
+
+// Locks the cart's row until the end of the transaction. Returns ErrLocked if
+// the cart itself is locked.
+func lockUnlockedCartOfUser(ctx context.Context, tx *sql.Tx, userID, id string) error {
+	locked, _, err := findCartStateOfUser(ctx, tx, userID, id, true)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return persistence.ErrLocked
+	}
+	return nil
+}
+
+func insertCartPositions(ctx context.Context, tx *sql.Tx, id string, positions map[string]int) error {
+	for productID, quantity := range positions {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO cart_positions (cart_id, product_id, quantity) VALUES ($1, $2, $3)`,
+			[]byte(id), []byte(productID), quantity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findCartPositions(ctx context.Context, q querier, id string) ([]model.Position, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT product_id, quantity FROM cart_positions WHERE cart_id = $1`,
+		[]byte(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := make([]model.Position, 0)
+	for rows.Next() {
+		var productID []byte
+		var position model.Position
+		if err := rows.Scan(&productID, &position.Quantity); err != nil {
+			return nil, err
+		}
+		position.ProductID = string(productID)
+		positions = append(positions, position)
+	}
+	return positions, rows.Err()
+}
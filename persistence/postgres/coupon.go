@@ -0,0 +1,319 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/lib/pq"
+)
+
+var _ persistence.CouponRepository = (*Adapter)(nil)
+
+const couponColumns = `code, name, product_id, discount, amount, min_subtotal,
+	max_redemptions, max_redemptions_per_user, not_before, expires_at, redemptions`
+
+// StoreCoupon stores a coupon with the given code and attributes. If a coupon
+// with the same code was previously stored it is overwritten, but keeps its
+// redemptions.
+func (a *Adapter) StoreCoupon(ctx context.Context, code string, attributes persistence.CouponAttributes) error {
+	_, err := a.db.ExecContext(ctx, `
+		INSERT INTO coupons (code, name, product_id, discount, amount, min_subtotal,
+			max_redemptions, max_redemptions_per_user, not_before, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (code) DO UPDATE SET
+			name = EXCLUDED.name,
+			product_id = EXCLUDED.product_id,
+			discount = EXCLUDED.discount,
+			amount = EXCLUDED.amount,
+			min_subtotal = EXCLUDED.min_subtotal,
+			max_redemptions = EXCLUDED.max_redemptions,
+			max_redemptions_per_user = EXCLUDED.max_redemptions_per_user,
+			not_before = EXCLUDED.not_before,
+			expires_at = EXCLUDED.expires_at`,
+		[]byte(code), []byte(attributes.Name), []byte(attributes.ProductID),
+		attributes.Discount, attributes.Amount, attributes.MinSubtotal,
+		attributes.MaxRedemptions, attributes.MaxRedemptionsPerUser,
+		persistence.Timestamp(attributes.NotBefore), persistence.Timestamp(attributes.ExpiresAt))
+	return contextErr(ctx, err)
+}
+
+// CreateCoupon stores a new coupon with the given code and attributes.
+// ErrConflict is returned if there already is a coupon with the code.
+func (a *Adapter) CreateCoupon(ctx context.Context, code string, attributes persistence.CouponAttributes) error {
+	_, err := a.db.ExecContext(ctx, `
+		INSERT INTO coupons (code, name, product_id, discount, amount, min_subtotal,
+			max_redemptions, max_redemptions_per_user, not_before, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		[]byte(code), []byte(attributes.Name), []byte(attributes.ProductID),
+		attributes.Discount, attributes.Amount, attributes.MinSubtotal,
+		attributes.MaxRedemptions, attributes.MaxRedemptionsPerUser,
+		persistence.Timestamp(attributes.NotBefore), persistence.Timestamp(attributes.ExpiresAt))
+	if isUniqueViolation(err) {
+		return persistence.ErrConflict
+	}
+	return contextErr(ctx, err)
+}
+
+// CreateCoupons stores new coupons with the given distinct codes and the same
+// attributes. Either all coupons are created or none. A
+// *CouponConflictError is returned if there already are coupons with some of
+// the codes.
+func (a *Adapter) CreateCoupons(ctx context.Context, codes []string, attributes persistence.CouponAttributes) error {
+	byteCodes := make([][]byte, len(codes))
+	for i, code := range codes {
+		byteCodes[i] = []byte(code)
+	}
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		// existing codes are skipped, so that they can be reported
+		rows, err := tx.QueryContext(ctx, `
+			INSERT INTO coupons (code, name, product_id, discount, amount, min_subtotal,
+				max_redemptions, max_redemptions_per_user, not_before, expires_at)
+			SELECT code, $2, $3, $4, $5, $6, $7, $8, $9, $10
+			FROM unnest($1::bytea[]) AS code
+			ON CONFLICT (code) DO NOTHING
+			RETURNING code`,
+			pq.ByteaArray(byteCodes), []byte(attributes.Name), []byte(attributes.ProductID),
+			attributes.Discount, attributes.Amount, attributes.MinSubtotal,
+			attributes.MaxRedemptions, attributes.MaxRedemptionsPerUser,
+			persistence.Timestamp(attributes.NotBefore), persistence.Timestamp(attributes.ExpiresAt))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		created := make(map[string]bool, len(codes))
+		for rows.Next() {
+			var code []byte
+			if err := rows.Scan(&code); err != nil {
+				return err
+			}
+			created[string(code)] = true
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(created) == len(codes) {
+			return nil
+		}
+		var conflicts []string
+		for _, code := range codes {
+			if !created[code] {
+				conflicts = append(conflicts, code)
+			}
+		}
+		return &persistence.CouponConflictError{Codes: conflicts} // rolls back
+	})
+}
+
+// FindValidCoupon returns the coupon with the given code that has started and
+// is not expired. ErrNotFound is returned if there is no coupon with the code,
+// or the coupon has not started yet or is expired.
+func (a *Adapter) FindValidCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	coupon, err := scanCoupon(a.db.QueryRowContext(ctx, `
+		SELECT `+couponColumns+`
+		FROM coupons
+		WHERE code = $1 AND not_before <= $2 AND expires_at >= $2`,
+		[]byte(code), time.Now()))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, persistence.ErrNotFound
+	case err != nil:
+		return nil, contextErr(ctx, err)
+	}
+	return coupon, nil
+}
+
+// FindCoupon returns the coupon with the given code, even if it is expired.
+// ErrNotFound is returned if there is no coupon with the code.
+func (a *Adapter) FindCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	coupon, err := scanCoupon(a.db.QueryRowContext(ctx, `
+		SELECT `+couponColumns+`
+		FROM coupons
+		WHERE code = $1`,
+		[]byte(code)))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, persistence.ErrNotFound
+	case err != nil:
+		return nil, contextErr(ctx, err)
+	}
+	return coupon, nil
+}
+
+// FindAllCoupons returns all coupons, including the expired ones, ordered by
+// code.
+func (a *Adapter) FindAllCoupons(ctx context.Context) ([]*model.Coupon, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT `+couponColumns+`
+		FROM coupons
+		ORDER BY code`)
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	defer rows.Close()
+	var coupons []*model.Coupon
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		coupons = append(coupons, coupon)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	return coupons, nil
+}
+
+// FindCouponsOfProduct returns all coupons of the product with the given id,
+// including the expired ones, ordered by code. The coupons on whole carts are
+// returned for the empty product id.
+func (a *Adapter) FindCouponsOfProduct(ctx context.Context, productID string) ([]*model.Coupon, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT `+couponColumns+`
+		FROM coupons
+		WHERE product_id = $1
+		ORDER BY code`,
+		[]byte(productID))
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	defer rows.Close()
+	var coupons []*model.Coupon
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		coupons = append(coupons, coupon)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	return coupons, nil
+}
+
+// DeleteCoupon deletes the coupon with the given code and its redemptions.
+// ErrNotFound is returned if there is no coupon with the code.
+func (a *Adapter) DeleteCoupon(ctx context.Context, code string) error {
+	// the redemptions are deleted by cascade
+	result, err := a.db.ExecContext(ctx, `DELETE FROM coupons WHERE code = $1`, []byte(code))
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// RedeemCoupons records a redemption of each coupon with the given codes by
+// the order and user with the given ids. Any previous redemptions of the order
+// are replaced. Either all coupons are redeemed or none. ErrNotFound is
+// returned if there is no coupon with one of the codes. ErrLimitReached is
+// returned if a coupon would be redeemed more often than its maximum
+// redemptions in total or per user.
+func (a *Adapter) RedeemCoupons(ctx context.Context, orderID, userID string, codes []string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := releaseCouponRedemptions(ctx, tx, orderID); err != nil {
+			return err
+		}
+		for _, code := range codes {
+			var maxRedemptions, maxRedemptionsPerUser, redemptions int
+			err := tx.QueryRowContext(ctx, `
+				SELECT max_redemptions, max_redemptions_per_user, redemptions
+				FROM coupons
+				WHERE code = $1
+				FOR UPDATE`,
+				[]byte(code)).Scan(&maxRedemptions, &maxRedemptionsPerUser, &redemptions)
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return persistence.ErrNotFound
+			case err != nil:
+				return err
+			}
+			if maxRedemptions > 0 && redemptions >= maxRedemptions {
+				return persistence.ErrLimitReached
+			}
+			if maxRedemptionsPerUser > 0 {
+				// the coupon row is locked, so the count cannot change
+				ofUser, err := countCouponRedemptionsOfUser(ctx, tx, code, userID)
+				if err != nil {
+					return err
+				}
+				if ofUser >= maxRedemptionsPerUser {
+					return persistence.ErrLimitReached
+				}
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO coupon_redemptions (order_id, code, user_id) VALUES ($1, $2, $3)`,
+				[]byte(orderID), []byte(code), []byte(userID))
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx,
+				`UPDATE coupons SET redemptions = redemptions + 1 WHERE code = $1`,
+				[]byte(code))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReleaseCouponRedemptions drops the redemptions of the order with the given
+// id. Releasing an order without redemptions has no effect.
+func (a *Adapter) ReleaseCouponRedemptions(ctx context.Context, orderID string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		return releaseCouponRedemptions(ctx, tx, orderID)
+	})
+}
+
+func releaseCouponRedemptions(ctx context.Context, tx *sql.Tx, orderID string) error {
+	_, err := tx.ExecContext(ctx, `
+		WITH released AS (
+			DELETE FROM coupon_redemptions WHERE order_id = $1 RETURNING code
+		)
+		UPDATE coupons SET redemptions = redemptions - 1
+		WHERE code IN (SELECT code FROM released)`,
+		[]byte(orderID))
+	return err
+}
+
+// CountCouponRedemptionsOfUser returns how often the coupon with the given code
+// was redeemed by the user with the given id.
+func (a *Adapter) CountCouponRedemptionsOfUser(ctx context.Context, code, userID string) (int, error) {
+	count, err := countCouponRedemptionsOfUser(ctx, a.db, code, userID)
+	return count, contextErr(ctx, err)
+}
+
+func countCouponRedemptionsOfUser(ctx context.Context, q querier, code, userID string) (int, error) {
+	var count int
+	err := q.QueryRowContext(ctx, `
+		SELECT count(*) FROM coupon_redemptions WHERE code = $1 AND user_id = $2`,
+		[]byte(code), []byte(userID)).Scan(&count)
+	return count, err
+}
+
+func scanCoupon(row scanner) (*model.Coupon, error) {
+	var code, name, productID []byte
+	var coupon model.Coupon
+	err := row.Scan(&code, &name, &productID, &coupon.Discount, &coupon.Amount, &coupon.MinSubtotal,
+		&coupon.MaxRedemptions, &coupon.MaxRedemptionsPerUser, &coupon.NotBefore, &coupon.ExpiresAt,
+		&coupon.Redemptions)
+	if err != nil {
+		return nil, err
+	}
+	coupon.Code = string(code)
+	coupon.Name = string(name)
+	coupon.ProductID = string(productID)
+	coupon.NotBefore = coupon.NotBefore.UTC()
+	coupon.ExpiresAt = coupon.ExpiresAt.UTC()
+	return &coupon, nil
+}
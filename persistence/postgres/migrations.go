@@ -0,0 +1,381 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Migrations are applied in order and each only once. The version of a
+// migration is its index plus one. Never change a migration that was
+// released, add a new one instead.
+var migrations = []string{
+	// 1: initial schema
+	`
+	CREATE TABLE users (
+		id            bytea PRIMARY KEY,
+		name          bytea NOT NULL UNIQUE,
+		password_hash bytea NOT NULL
+	);
+
+	CREATE TABLE products (
+		id    bytea PRIMARY KEY,
+		name  bytea NOT NULL,
+		price integer NOT NULL
+	);
+
+	CREATE TABLE carts (
+		id      bytea PRIMARY KEY,
+		user_id bytea NOT NULL,
+		locked  boolean NOT NULL DEFAULT false,
+		deleted boolean NOT NULL DEFAULT false
+	);
+	CREATE INDEX carts_user_id_idx ON carts (user_id);
+
+	CREATE TABLE cart_positions (
+		cart_id    bytea NOT NULL REFERENCES carts (id) ON DELETE CASCADE,
+		product_id bytea NOT NULL,
+		quantity   integer NOT NULL,
+		PRIMARY KEY (cart_id, product_id)
+	);
+
+	CREATE TABLE coupons (
+		code       bytea PRIMARY KEY,
+		name       bytea NOT NULL,
+		product_id bytea NOT NULL,
+		discount   integer NOT NULL,
+		expires_at timestamptz NOT NULL
+	);
+
+	CREATE TABLE orders (
+		id                    bytea PRIMARY KEY,
+		user_id               bytea NOT NULL,
+		hash                  bytea,
+		cart_id               bytea NOT NULL,
+		buyer_name            bytea NOT NULL,
+		buyer_country         bytea NOT NULL,
+		buyer_postal_code     bytea NOT NULL,
+		buyer_city            bytea NOT NULL,
+		buyer_street          bytea NOT NULL,
+		recipient_name        bytea NOT NULL,
+		recipient_country     bytea NOT NULL,
+		recipient_postal_code bytea NOT NULL,
+		recipient_city        bytea NOT NULL,
+		recipient_street      bytea NOT NULL,
+		locked                boolean NOT NULL DEFAULT false,
+		deleted               boolean NOT NULL DEFAULT false
+	);
+
+	CREATE TABLE order_coupons (
+		order_id bytea NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+		ordinal  integer NOT NULL,
+		code     bytea NOT NULL,
+		PRIMARY KEY (order_id, ordinal)
+	);
+
+	CREATE TABLE placed_orders (
+		id                    bigserial PRIMARY KEY,
+		user_id               bytea NOT NULL,
+		buyer_name            bytea NOT NULL,
+		buyer_country         bytea NOT NULL,
+		buyer_postal_code     bytea NOT NULL,
+		buyer_city            bytea NOT NULL,
+		buyer_street          bytea NOT NULL,
+		recipient_name        bytea NOT NULL,
+		recipient_country     bytea NOT NULL,
+		recipient_postal_code bytea NOT NULL,
+		recipient_city        bytea NOT NULL,
+		recipient_street      bytea NOT NULL,
+		price                 integer NOT NULL
+	);
+
+	CREATE TABLE placed_order_coupons (
+		placed_order_id bigint NOT NULL REFERENCES placed_orders (id) ON DELETE CASCADE,
+		code            bytea NOT NULL,
+		product_id      bytea NOT NULL,
+		name            bytea NOT NULL,
+		discount        integer NOT NULL,
+		PRIMARY KEY (placed_order_id, code)
+	);
+
+	CREATE TABLE placed_order_products (
+		placed_order_id bigint NOT NULL REFERENCES placed_orders (id) ON DELETE CASCADE,
+		product_id      bytea NOT NULL,
+		name            bytea NOT NULL,
+		price           integer NOT NULL,
+		PRIMARY KEY (placed_order_id, product_id)
+	);
+
+	CREATE TABLE placed_order_positions (
+		placed_order_id bigint NOT NULL REFERENCES placed_orders (id) ON DELETE CASCADE,
+		ordinal         integer NOT NULL,
+		product_id      bytea NOT NULL,
+		coupon_code     bytea NOT NULL,
+		quantity        integer NOT NULL,
+		price           integer NOT NULL,
+		PRIMARY KEY (placed_order_id, ordinal)
+	);
+
+	CREATE TABLE promotions (
+		id            bytea PRIMARY KEY,
+		type          bytea NOT NULL,
+		name          bytea NOT NULL,
+		product_id    bytea NOT NULL,
+		quantity      integer NOT NULL,
+		free_quantity integer NOT NULL,
+		discount      integer NOT NULL
+	);
+
+	CREATE TABLE promotion_bundle_items (
+		promotion_id bytea NOT NULL REFERENCES promotions (id) ON DELETE CASCADE,
+		product_id   bytea NOT NULL,
+		quantity     integer NOT NULL,
+		PRIMARY KEY (promotion_id, product_id)
+	);
+	`,
+
+	// 2: placed orders are identified by the id of the order and have a time
+	`
+	ALTER TABLE placed_orders
+		ADD COLUMN order_id bytea,
+		ADD COLUMN placed_at timestamptz NOT NULL DEFAULT now();
+	UPDATE placed_orders SET order_id = convert_to('legacy:' || id, 'UTF8');
+	ALTER TABLE placed_orders
+		ALTER COLUMN order_id SET NOT NULL,
+		ALTER COLUMN placed_at DROP DEFAULT,
+		ADD UNIQUE (order_id);
+	CREATE INDEX placed_orders_user_id_idx ON placed_orders (user_id);
+
+	ALTER TABLE placed_order_positions
+		ADD COLUMN name bytea NOT NULL DEFAULT ''::bytea;
+	`,
+
+	// 3: status history of placed orders
+	`
+	CREATE TABLE placed_order_status_changes (
+		placed_order_id bigint NOT NULL REFERENCES placed_orders (id) ON DELETE CASCADE,
+		ordinal         integer NOT NULL,
+		status          bytea NOT NULL,
+		changed_at      timestamptz NOT NULL,
+		PRIMARY KEY (placed_order_id, ordinal)
+	);
+	INSERT INTO placed_order_status_changes (placed_order_id, ordinal, status, changed_at)
+		SELECT id, 0, convert_to('placed', 'UTF8'), placed_at FROM placed_orders;
+	`,
+
+	// 4: payment authorization of placed orders
+	`
+	ALTER TABLE placed_orders ADD COLUMN payment_authorization bytea NOT NULL DEFAULT ''::bytea;
+	`,
+
+	// 5: products can be deleted
+	`
+	ALTER TABLE products ADD COLUMN deleted boolean NOT NULL DEFAULT false;
+	`,
+
+	// 6: descriptions, SKUs, categories, attributes and images of products
+	`
+	ALTER TABLE products
+		ADD COLUMN description bytea NOT NULL DEFAULT ''::bytea,
+		ADD COLUMN sku bytea NOT NULL DEFAULT ''::bytea;
+
+	CREATE TABLE product_categories (
+		product_id bytea NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+		ordinal    integer NOT NULL,
+		category   bytea NOT NULL,
+		PRIMARY KEY (product_id, ordinal)
+	);
+
+	CREATE TABLE product_attributes (
+		product_id bytea NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+		key        bytea NOT NULL,
+		value      bytea NOT NULL,
+		PRIMARY KEY (product_id, key)
+	);
+
+	CREATE TABLE product_images (
+		product_id bytea NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+		ordinal    integer NOT NULL,
+		url        bytea NOT NULL,
+		alt        bytea NOT NULL,
+		PRIMARY KEY (product_id, ordinal)
+	);
+	`,
+
+	// 7: stock levels and reservations
+	`
+	CREATE TABLE stocks (
+		product_id bytea PRIMARY KEY,
+		quantity   bigint NOT NULL
+	);
+
+	CREATE TABLE stock_reservations (
+		order_id   bytea NOT NULL,
+		product_id bytea NOT NULL REFERENCES stocks (product_id) ON DELETE CASCADE,
+		quantity   integer NOT NULL,
+		PRIMARY KEY (order_id, product_id)
+	);
+	`,
+
+	// 8: searching and sorting products; the lower case columns are filled by
+	// the adapter, because PostgreSQL cannot lower bytea
+	`
+	ALTER TABLE products
+		ADD COLUMN name_lower bytea,
+		ADD COLUMN description_lower bytea,
+		ADD COLUMN sku_lower bytea;
+
+	CREATE INDEX products_name_id_idx ON products (name, id);
+	CREATE INDEX products_price_id_idx ON products (price, id);
+	CREATE INDEX product_categories_category_idx ON product_categories (category);
+	`,
+
+	// 9: login sessions
+	`
+	CREATE TABLE sessions (
+		id                 bytea PRIMARY KEY,
+		user_id            bytea NOT NULL,
+		refresh_token_hash bytea NOT NULL,
+		expires_at         timestamptz NOT NULL
+	);
+	CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+	`,
+
+	// 10: roles of users
+	`
+	CREATE TABLE user_roles (
+		user_id bytea NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		role    bytea NOT NULL,
+		PRIMARY KEY (user_id, role)
+	);
+	CREATE INDEX user_roles_role_idx ON user_roles (role);
+	`,
+
+	// 11: password reset tokens
+	`
+	CREATE TABLE password_resets (
+		token_hash bytea PRIMARY KEY,
+		user_id    bytea NOT NULL,
+		expires_at timestamptz NOT NULL
+	);
+	CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
+	`,
+	// 12: listing coupons of products and counting their redemptions
+	`
+	ALTER TABLE coupons ADD COLUMN redemptions integer NOT NULL DEFAULT 0;
+	CREATE INDEX coupons_product_id_idx ON coupons (product_id);
+	`,
+
+	// 13: fixed-amount coupons, coupon limits and the redemption ledger
+	`
+	ALTER TABLE coupons
+		ADD COLUMN amount                   integer NOT NULL DEFAULT 0,
+		ADD COLUMN min_subtotal             integer NOT NULL DEFAULT 0,
+		ADD COLUMN max_redemptions          integer NOT NULL DEFAULT 0,
+		ADD COLUMN max_redemptions_per_user integer NOT NULL DEFAULT 0,
+		ADD COLUMN not_before               timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00+00';
+	CREATE TABLE coupon_redemptions (
+		order_id bytea NOT NULL,
+		code     bytea NOT NULL REFERENCES coupons (code) ON DELETE CASCADE,
+		user_id  bytea NOT NULL,
+		PRIMARY KEY (order_id, code)
+	);
+	CREATE INDEX coupon_redemptions_code_user_id_idx ON coupon_redemptions (code, user_id);
+	ALTER TABLE placed_order_coupons ADD COLUMN amount integer NOT NULL DEFAULT 0;
+	`,
+
+	// 14: prices in multiple currencies, orders in any of them
+	`
+	CREATE TABLE product_prices (
+		product_id bytea NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+		currency   bytea NOT NULL,
+		price      integer NOT NULL,
+		PRIMARY KEY (product_id, currency)
+	);
+	CREATE INDEX product_prices_currency_price_idx ON product_prices (currency, price, product_id);
+	ALTER TABLE orders ADD COLUMN currency bytea NOT NULL DEFAULT convert_to('EUR', 'UTF8');
+	ALTER TABLE placed_orders ADD COLUMN currency bytea NOT NULL DEFAULT convert_to('EUR', 'UTF8');
+	`,
+
+	// 15: tax classes of products and taxes of placed orders
+	`
+	ALTER TABLE products ADD COLUMN tax_class bytea NOT NULL DEFAULT ''::bytea;
+	ALTER TABLE placed_order_products ADD COLUMN tax_class bytea NOT NULL DEFAULT ''::bytea;
+	CREATE TABLE placed_order_taxes (
+		placed_order_id bigint NOT NULL REFERENCES placed_orders (id) ON DELETE CASCADE,
+		ordinal         integer NOT NULL,
+		class           bytea NOT NULL,
+		rate            integer NOT NULL,
+		net             integer NOT NULL,
+		amount          integer NOT NULL,
+		included        boolean NOT NULL,
+		PRIMARY KEY (placed_order_id, ordinal)
+	);
+	`,
+
+	// 16: weights of products and shipping methods of orders
+	`
+	ALTER TABLE products ADD COLUMN weight integer NOT NULL DEFAULT 0;
+	ALTER TABLE orders ADD COLUMN shipping_method_id bytea NOT NULL DEFAULT ''::bytea;
+	ALTER TABLE placed_order_positions ADD COLUMN shipping_method_id bytea NOT NULL DEFAULT ''::bytea;
+	`,
+
+	// 17: data that was seeded once
+	`
+	CREATE TABLE seeds (
+		name bytea PRIMARY KEY
+	);
+	`,
+
+	// 18: guests that were claimed by registered users
+	`
+	CREATE TABLE guest_claims (
+		guest_id bytea PRIMARY KEY,
+		user_id  bytea NOT NULL
+	);
+	`,
+
+	// 19: the currency of carts, empty for carts stored before
+	`
+	ALTER TABLE carts ADD COLUMN currency bytea NOT NULL DEFAULT '';
+	`,
+}
+
+// arbitrary key of the advisory lock that serializes migrations
+const migrationLockKey = 7156142084378237729
+
+// migrate applies all migrations that were not applied yet. Concurrent calls,
+// even from different processes, are serialized using an advisory lock.
+func migrate(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("locking migrations: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+	var version int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the latest known version %d", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, i+1); err != nil {
+			return fmt.Errorf("recording migration %d: %w", i+1, err)
+		}
+	}
+
+	return tx.Commit()
+}
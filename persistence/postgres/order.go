@@ -0,0 +1,219 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+)
+
+var _ persistence.OrderRepository = (*Adapter)(nil)
+
+// CreateOrder creates an order for the given user with the given id and
+// attributes. Id must be unique. ErrConflict is returned otherwise.
+func (a *Adapter) CreateOrder(ctx context.Context, userID, id string, attributes persistence.OrderAttributes) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO orders (
+				id, user_id, hash, cart_id,
+				buyer_name, buyer_country, buyer_postal_code, buyer_city, buyer_street,
+				recipient_name, recipient_country, recipient_postal_code, recipient_city, recipient_street,
+				currency, shipping_method_id
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+			[]byte(id), []byte(userID), nullBytes(attributes.Hash), []byte(attributes.CartID),
+			[]byte(attributes.Buyer.Name), []byte(attributes.Buyer.Country), []byte(attributes.Buyer.PostalCode),
+			[]byte(attributes.Buyer.City), []byte(attributes.Buyer.Street),
+			[]byte(attributes.Recipient.Name), []byte(attributes.Recipient.Country), []byte(attributes.Recipient.PostalCode),
+			[]byte(attributes.Recipient.City), []byte(attributes.Recipient.Street),
+			[]byte(attributes.Currency), []byte(attributes.ShippingMethodID),
+		)
+		if isUniqueViolation(err) {
+			return persistence.ErrConflict
+		} else if err != nil {
+			return err
+		}
+		for i, code := range attributes.Coupons {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO order_coupons (order_id, ordinal, code) VALUES ($1, $2, $3)`,
+				[]byte(id), i, []byte(code))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindOrderOfUser returns the order of the given user with the given id.
+// ErrNotFound is returned if there is no order with the id. ErrDeleted is
+// returned if the order did exist but is deleted. ErrNotOwnedByUser is returned
+// if the order exists but it's not owned by the given user.
+func (a *Adapter) FindOrderOfUser(ctx context.Context, userID, id string) (*model.Order, error) {
+	var order *model.Order
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		var owner, cartID, currency, shippingMethodID []byte
+		var buyer, recipient address
+		var deleted bool
+		order = &model.Order{ID: id}
+		err := tx.QueryRowContext(ctx, `
+			SELECT
+				user_id, hash, cart_id,
+				buyer_name, buyer_country, buyer_postal_code, buyer_city, buyer_street,
+				recipient_name, recipient_country, recipient_postal_code, recipient_city, recipient_street,
+				currency, shipping_method_id, locked, deleted
+			FROM orders
+			WHERE id = $1`,
+			[]byte(id)).Scan(
+			&owner, &order.Hash, &cartID,
+			&buyer.name, &buyer.country, &buyer.postalCode, &buyer.city, &buyer.street,
+			&recipient.name, &recipient.country, &recipient.postalCode, &recipient.city, &recipient.street,
+			&currency, &shippingMethodID, &order.Locked, &deleted,
+		)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		case deleted:
+			return persistence.ErrDeleted
+		case string(owner) != userID:
+			return persistence.ErrNotOwnedByUser
+		}
+		order.CartID = string(cartID)
+		order.Currency = model.Currency(currency)
+		order.ShippingMethodID = string(shippingMethodID)
+		order.Buyer = buyer.model()
+		order.Recipient = recipient.model()
+
+		// coupons
+		rows, err := tx.QueryContext(ctx,
+			`SELECT code FROM order_coupons WHERE order_id = $1 ORDER BY ordinal`,
+			[]byte(id))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		order.Coupons = make([]*model.Coupon, 0)
+		for rows.Next() {
+			var code []byte
+			if err := rows.Scan(&code); err != nil {
+				return err
+			}
+			order.Coupons = append(order.Coupons, &model.Coupon{Code: string(code)})
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// DeleteOrderOfUser deletes the order of the given user with the given id.
+// ErrNotFound is returned if there is no order with the id. ErrDeleted is
+// returned if the order did exist but is deleted. ErrNotOwnedByUser is returned
+// if the order exists but it's not owned by the given user. ErrLocked is
+// returned if the order is owned by the given user, but is locked.
+func (a *Adapter) DeleteOrderOfUser(ctx context.Context, userID, id string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUnlockedOrderOfUser(ctx, tx, userID, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM order_coupons WHERE order_id = $1`, []byte(id))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE orders SET deleted = true WHERE id = $1`, []byte(id))
+		return err
+	})
+}
+
+// LockOrderOfUser locks the order of the given user with the given id.
+// ErrNotFound is returned if there is no order with the id. ErrDeleted is
+// returned if the order did exist but is deleted. ErrNotOwnedByUser is returned
+// if the order exists but it's not owned by the given user. ErrLocked is
+// returned if the order is owned by the given user, but is locked.
+func (a *Adapter) LockOrderOfUser(ctx context.Context, userID, id string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUnlockedOrderOfUser(ctx, tx, userID, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE orders SET locked = true WHERE id = $1`, []byte(id))
+		return err
+	})
+}
+
+// UnlockOrderOfUser unlocks the order of the given user with the given id.
+// Unlocking an order that is not locked has no effect. ErrNotFound is returned
+// if there is no order with the id. ErrDeleted is returned if the order did
+// exist but is deleted. ErrNotOwnedByUser is returned if the order exists but
+// it's not owned by the given user.
+func (a *Adapter) UnlockOrderOfUser(ctx context.Context, userID, id string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := findOrderStateOfUser(ctx, tx, userID, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE orders SET locked = false WHERE id = $1`, []byte(id))
+		return err
+	})
+}
+
+// TransferOrdersOfUser transfers all unlocked orders of the given user to the
+// new user. Locked and deleted orders stay with the given user.
+func (a *Adapter) TransferOrdersOfUser(ctx context.Context, userID, newUserID string) error {
+	_, err := a.db.ExecContext(ctx,
+		`UPDATE orders SET user_id = $2 WHERE user_id = $1 AND NOT locked AND NOT deleted`,
+		[]byte(userID), []byte(newUserID))
+	return contextErr(ctx, err)
+}
+
+// Returns the locked state of the order. The order's row is locked until the
+// end of the transaction.
+func findOrderStateOfUser(ctx context.Context, tx *sql.Tx, userID, id string) (locked bool, err error) {
+	var owner []byte
+	var deleted bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id, locked, deleted FROM orders WHERE id = $1 FOR UPDATE`,
+		[]byte(id)).Scan(&owner, &locked, &deleted)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, persistence.ErrNotFound
+	case err != nil:
+		return false, err
+	case deleted:
+		return false, persistence.ErrDeleted
+	case string(owner) != userID:
+		return false, persistence.ErrNotOwnedByUser
+	}
+	return locked, nil
+}
+
+// Locks the order's row until the end of the transaction. Returns ErrLocked if
+// the order itself is locked.
+func lockUnlockedOrderOfUser(ctx context.Context, tx *sql.Tx, userID, id string) error {
+	locked, err := findOrderStateOfUser(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return persistence.ErrLocked
+	}
+	return nil
+}
+
+// address is used to scan the bytea columns of an address
+type address struct {
+	name, country, postalCode, city, street []byte
+}
+
+func (a address) model() model.Address {
+	return model.Address{
+		Name:       string(a.name),
+		Country:    string(a.country),
+		PostalCode: string(a.postalCode),
+		City:       string(a.city),
+		Street:     string(a.street),
+	}
+}
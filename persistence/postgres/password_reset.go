@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Teelevision/excommerce/persistence"
+)
+
+var _ persistence.PasswordResetRepository = (*Adapter)(nil)
+
+// CreatePasswordReset stores the token to reset the password of the given
+// user. It expires at the given time. The token must be unique. ErrConflict is
+// returned otherwise. The token is stored as a hash and can never be retrieved
+// again.
+func (a *Adapter) CreatePasswordReset(ctx context.Context, token, userID string, expiresAt time.Time) error {
+	hash := sha256.Sum256([]byte(token))
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		// clean up expired tokens
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM password_resets WHERE expires_at < $1`,
+			time.Now())
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO password_resets (token_hash, user_id, expires_at)
+			VALUES ($1, $2, $3)`,
+			hash[:], []byte(userID), expiresAt)
+		if isUniqueViolation(err) {
+			return persistence.ErrConflict
+		}
+		return err
+	})
+}
+
+// RedeemPasswordReset deletes the given token and returns the id of the user
+// whose password may be reset. ErrNotFound is returned if the token does not
+// exist.
+func (a *Adapter) RedeemPasswordReset(ctx context.Context, token string) (string, error) {
+	hash := sha256.Sum256([]byte(token))
+	var userID []byte
+	err := a.db.QueryRowContext(ctx, `
+		DELETE FROM password_resets
+		WHERE token_hash = $1 AND expires_at >= $2
+		RETURNING user_id`,
+		hash[:], time.Now()).Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", persistence.ErrNotFound
+	case err != nil:
+		return "", contextErr(ctx, err)
+	}
+	return string(userID), nil
+}
+
+// DeletePasswordResetsOfUser deletes all tokens of the given user.
+func (a *Adapter) DeletePasswordResetsOfUser(ctx context.Context, userID string) error {
+	_, err := a.db.ExecContext(ctx,
+		`DELETE FROM password_resets WHERE user_id = $1`,
+		[]byte(userID))
+	return contextErr(ctx, err)
+}
@@ -0,0 +1,390 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+)
+
+var _ persistence.PlacedOrderRepository = (*Adapter)(nil)
+
+// PlaceOrder places the order and all related data. The id of the order must
+// be unique. ErrConflict is returned otherwise.
+func (a *Adapter) PlaceOrder(ctx context.Context, order persistence.PlacedOrder) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO placed_orders (
+				order_id, user_id, placed_at,
+				buyer_name, buyer_country, buyer_postal_code, buyer_city, buyer_street,
+				recipient_name, recipient_country, recipient_postal_code, recipient_city, recipient_street,
+				currency, price, payment_authorization
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			RETURNING id`,
+			[]byte(order.ID), []byte(order.UserID), order.PlacedAt,
+			[]byte(order.Buyer.Name), []byte(order.Buyer.Country), []byte(order.Buyer.PostalCode),
+			[]byte(order.Buyer.City), []byte(order.Buyer.Street),
+			[]byte(order.Recipient.Name), []byte(order.Recipient.Country), []byte(order.Recipient.PostalCode),
+			[]byte(order.Recipient.City), []byte(order.Recipient.Street),
+			[]byte(order.Currency), order.Price, []byte(order.PaymentAuthorization),
+		).Scan(&id)
+		if isUniqueViolation(err) {
+			return persistence.ErrConflict
+		} else if err != nil {
+			return err
+		}
+
+		for code, coupon := range order.Coupons {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO placed_order_coupons (placed_order_id, code, product_id, name, discount, amount)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				id, []byte(code), []byte(coupon.ProductID), []byte(coupon.Name), coupon.Discount, coupon.Amount)
+			if err != nil {
+				return err
+			}
+		}
+		for productID, product := range order.Products {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO placed_order_products (placed_order_id, product_id, name, price, tax_class)
+				VALUES ($1, $2, $3, $4, $5)`,
+				id, []byte(productID), []byte(product.Name), product.Price, []byte(product.TaxClass))
+			if err != nil {
+				return err
+			}
+		}
+		for i, change := range order.StatusHistory {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO placed_order_status_changes (placed_order_id, ordinal, status, changed_at)
+				VALUES ($1, $2, $3, $4)`,
+				id, i, []byte(change.Status), change.ChangedAt)
+			if err != nil {
+				return err
+			}
+		}
+		for i, position := range order.Positions {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO placed_order_positions (placed_order_id, ordinal, product_id, coupon_code,
+					shipping_method_id, name, quantity, price)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				id, i, []byte(position.ProductID), []byte(position.CouponCode), []byte(position.ShippingMethodID),
+				[]byte(position.Name), position.Quantity, position.Price)
+			if err != nil {
+				return err
+			}
+		}
+		for i, tax := range order.Taxes {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO placed_order_taxes (placed_order_id, ordinal, class, rate, net, amount, included)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				id, i, []byte(tax.Class), tax.Rate, tax.Net, tax.Amount, tax.Included)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindAllPlacedOrdersOfUser returns all placed orders of the given user.
+func (a *Adapter) FindAllPlacedOrdersOfUser(ctx context.Context, userID string) ([]*persistence.PlacedOrder, error) {
+	var orders []*persistence.PlacedOrder
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			selectPlacedOrders+` WHERE user_id = $1 ORDER BY id`,
+			[]byte(userID))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var ids []int64
+		orders = make([]*persistence.PlacedOrder, 0)
+		for rows.Next() {
+			id, order, err := scanPlacedOrder(rows)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+			orders = append(orders, order)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		for i, order := range orders {
+			if err := findPlacedOrderDetails(ctx, tx, ids[i], order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// FindPlacedOrderOfUser returns the placed order of the given user with the
+// given id. ErrNotFound is returned if there is no placed order with the id.
+// ErrNotOwnedByUser is returned if the placed order exists but it's not owned
+// by the given user.
+func (a *Adapter) FindPlacedOrderOfUser(ctx context.Context, userID, id string) (*persistence.PlacedOrder, error) {
+	var order *persistence.PlacedOrder
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		var placedOrderID int64
+		var err error
+		placedOrderID, order, err = scanPlacedOrder(tx.QueryRowContext(ctx,
+			selectPlacedOrders+` WHERE order_id = $1`,
+			[]byte(id)))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		case order.UserID != userID:
+			return persistence.ErrNotOwnedByUser
+		}
+		return findPlacedOrderDetails(ctx, tx, placedOrderID, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// FindPlacedOrder returns the placed order with the given id regardless of the
+// user. ErrNotFound is returned if there is no placed order with the id.
+func (a *Adapter) FindPlacedOrder(ctx context.Context, id string) (*persistence.PlacedOrder, error) {
+	var order *persistence.PlacedOrder
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		var placedOrderID int64
+		var err error
+		placedOrderID, order, err = scanPlacedOrder(tx.QueryRowContext(ctx,
+			selectPlacedOrders+` WHERE order_id = $1`,
+			[]byte(id)))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		}
+		return findPlacedOrderDetails(ctx, tx, placedOrderID, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// UpdatePlacedOrderStatus appends the change to the status history of the
+// placed order with the given id, if the current status is the given one. The
+// current status is the status of the last change or empty if there is none.
+// ErrNotFound is returned if there is no placed order with the id. ErrConflict
+// is returned if the current status is a different one.
+func (a *Adapter) UpdatePlacedOrderStatus(ctx context.Context, id string, current model.OrderStatus, change model.OrderStatusChange) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		// lock the placed order, so that status changes are serialized
+		var placedOrderID int64
+		err := tx.QueryRowContext(ctx,
+			`SELECT id FROM placed_orders WHERE order_id = $1 FOR UPDATE`,
+			[]byte(id)).Scan(&placedOrderID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		}
+
+		var status []byte
+		var ordinal int
+		err = tx.QueryRowContext(ctx, `
+			SELECT status, ordinal + 1
+			FROM placed_order_status_changes
+			WHERE placed_order_id = $1
+			ORDER BY ordinal DESC
+			LIMIT 1`,
+			placedOrderID).Scan(&status, &ordinal)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if model.OrderStatus(status) != current {
+			return persistence.ErrConflict
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO placed_order_status_changes (placed_order_id, ordinal, status, changed_at)
+			VALUES ($1, $2, $3, $4)`,
+			placedOrderID, ordinal, []byte(change.Status), change.ChangedAt)
+		return err
+	})
+}
+
+// TransferPlacedOrdersOfUser transfers all placed orders of the given user to
+// the new user.
+func (a *Adapter) TransferPlacedOrdersOfUser(ctx context.Context, userID, newUserID string) error {
+	_, err := a.db.ExecContext(ctx,
+		`UPDATE placed_orders SET user_id = $2 WHERE user_id = $1`,
+		[]byte(userID), []byte(newUserID))
+	return contextErr(ctx, err)
+}
+
+const selectPlacedOrders = `
+	SELECT
+		id, order_id, user_id, placed_at,
+		buyer_name, buyer_country, buyer_postal_code, buyer_city, buyer_street,
+		recipient_name, recipient_country, recipient_postal_code, recipient_city, recipient_street,
+		currency, price, payment_authorization
+	FROM placed_orders`
+
+// scans a row of selectPlacedOrders and returns the internal id and the order
+func scanPlacedOrder(row scanner) (int64, *persistence.PlacedOrder, error) {
+	var id int64
+	var orderID, userID, currency, paymentAuthorization []byte
+	var buyer, recipient address
+	var order persistence.PlacedOrder
+	err := row.Scan(
+		&id, &orderID, &userID, &order.PlacedAt,
+		&buyer.name, &buyer.country, &buyer.postalCode, &buyer.city, &buyer.street,
+		&recipient.name, &recipient.country, &recipient.postalCode, &recipient.city, &recipient.street,
+		&currency, &order.Price, &paymentAuthorization,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	order.ID, order.UserID = string(orderID), string(userID)
+	order.Currency = model.Currency(currency)
+	order.PaymentAuthorization = string(paymentAuthorization)
+	order.Buyer = persistence.OrderAddress(buyer.model())
+	order.Recipient = persistence.OrderAddress(recipient.model())
+	return id, &order, nil
+}
+
+// loads coupons, products, status history, positions and taxes of the placed
+// order
+func findPlacedOrderDetails(ctx context.Context, q querier, id int64, order *persistence.PlacedOrder) error {
+	// coupons
+	rows, err := q.QueryContext(ctx,
+		`SELECT code, product_id, name, discount, amount FROM placed_order_coupons WHERE placed_order_id = $1`,
+		id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	order.Coupons = make(map[string]persistence.OrderCoupon)
+	for rows.Next() {
+		var code, productID, name []byte
+		var coupon persistence.OrderCoupon
+		if err := rows.Scan(&code, &productID, &name, &coupon.Discount, &coupon.Amount); err != nil {
+			return err
+		}
+		coupon.ProductID, coupon.Name = string(productID), string(name)
+		order.Coupons[string(code)] = coupon
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// products
+	rows, err = q.QueryContext(ctx,
+		`SELECT product_id, name, price, tax_class FROM placed_order_products WHERE placed_order_id = $1`,
+		id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	order.Products = make(map[string]persistence.OrderProduct)
+	for rows.Next() {
+		var productID, name, taxClass []byte
+		var product persistence.OrderProduct
+		if err := rows.Scan(&productID, &name, &product.Price, &taxClass); err != nil {
+			return err
+		}
+		product.Name, product.TaxClass = string(name), string(taxClass)
+		order.Products[string(productID)] = product
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// status history
+	rows, err = q.QueryContext(ctx, `
+		SELECT status, changed_at
+		FROM placed_order_status_changes
+		WHERE placed_order_id = $1
+		ORDER BY ordinal`,
+		id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	order.StatusHistory = make([]model.OrderStatusChange, 0)
+	for rows.Next() {
+		var status []byte
+		var change model.OrderStatusChange
+		if err := rows.Scan(&status, &change.ChangedAt); err != nil {
+			return err
+		}
+		change.Status = model.OrderStatus(status)
+		order.StatusHistory = append(order.StatusHistory, change)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// positions
+	rows, err = q.QueryContext(ctx, `
+		SELECT product_id, coupon_code, shipping_method_id, name, quantity, price
+		FROM placed_order_positions
+		WHERE placed_order_id = $1
+		ORDER BY ordinal`,
+		id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	order.Positions = make([]persistence.OrderPosition, 0)
+	for rows.Next() {
+		var productID, couponCode, shippingMethodID, name []byte
+		var position persistence.OrderPosition
+		err := rows.Scan(&productID, &couponCode, &shippingMethodID, &name, &position.Quantity, &position.Price)
+		if err != nil {
+			return err
+		}
+		position.ProductID, position.CouponCode, position.Name = string(productID), string(couponCode), string(name)
+		position.ShippingMethodID = string(shippingMethodID)
+		order.Positions = append(order.Positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// taxes
+	rows, err = q.QueryContext(ctx, `
+		SELECT class, rate, net, amount, included
+		FROM placed_order_taxes
+		WHERE placed_order_id = $1
+		ORDER BY ordinal`,
+		id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	order.Taxes = make([]persistence.OrderTax, 0)
+	for rows.Next() {
+		var class []byte
+		var tax persistence.OrderTax
+		if err := rows.Scan(&class, &tax.Rate, &tax.Net, &tax.Amount, &tax.Included); err != nil {
+			return err
+		}
+		tax.Class = string(class)
+		order.Taxes = append(order.Taxes, tax)
+	}
+	return rows.Err()
+}
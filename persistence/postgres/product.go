@@ -0,0 +1,454 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/lib/pq"
+)
+
+var _ persistence.ProductRepository = (*Adapter)(nil)
+
+// CreateProduct creates a product with the given id and attributes. Id must be
+// unique. ErrConflict is returned otherwise.
+func (a *Adapter) CreateProduct(ctx context.Context, id string, attributes persistence.ProductAttributes) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO products (id, name, price, description, sku, name_lower, description_lower, sku_lower, tax_class, weight)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			[]byte(id), []byte(attributes.Name), attributes.Price,
+			[]byte(attributes.Description), []byte(attributes.SKU),
+			lower(attributes.Name), lower(attributes.Description), lower(attributes.SKU),
+			[]byte(attributes.TaxClass), attributes.Weight)
+		if isUniqueViolation(err) {
+			return persistence.ErrConflict
+		} else if err != nil {
+			return err
+		}
+		return insertProductDetails(ctx, tx, id, attributes)
+	})
+}
+
+// UpdateProduct replaces the attributes of the product with the given id.
+// ErrNotFound is returned if there is no product with the id. ErrDeleted is
+// returned if the product did exist but is deleted.
+func (a *Adapter) UpdateProduct(ctx context.Context, id string, attributes persistence.ProductAttributes) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE products SET
+				name = $2, price = $3, description = $4, sku = $5,
+				name_lower = $6, description_lower = $7, sku_lower = $8, tax_class = $9, weight = $10
+			WHERE id = $1`,
+			[]byte(id), []byte(attributes.Name), attributes.Price,
+			[]byte(attributes.Description), []byte(attributes.SKU),
+			lower(attributes.Name), lower(attributes.Description), lower(attributes.SKU),
+			[]byte(attributes.TaxClass), attributes.Weight)
+		if err != nil {
+			return err
+		}
+		for _, table := range []string{"product_prices", "product_categories", "product_attributes", "product_images"} {
+			_, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE product_id = $1`, []byte(id))
+			if err != nil {
+				return err
+			}
+		}
+		return insertProductDetails(ctx, tx, id, attributes)
+	})
+}
+
+// DeleteProduct deletes the product with the given id. The id cannot be used
+// for another product. ErrNotFound is returned if there is no product with the
+// id. ErrDeleted is returned if the product did exist but is deleted.
+func (a *Adapter) DeleteProduct(ctx context.Context, id string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockProduct(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE products SET deleted = true WHERE id = $1`, []byte(id))
+		return err
+	})
+}
+
+// Locks the product's row until the end of the transaction. Returns ErrDeleted
+// if the product is deleted.
+func lockProduct(ctx context.Context, tx *sql.Tx, id string) error {
+	var deleted bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT deleted FROM products WHERE id = $1 FOR UPDATE`,
+		[]byte(id)).Scan(&deleted)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return persistence.ErrNotFound
+	case err != nil:
+		return err
+	case deleted:
+		return persistence.ErrDeleted
+	}
+	return nil
+}
+
+// inserts prices, categories, attributes and images of the product
+func insertProductDetails(ctx context.Context, tx *sql.Tx, id string, attributes persistence.ProductAttributes) error {
+	for currency, price := range attributes.Prices {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO product_prices (product_id, currency, price) VALUES ($1, $2, $3)`,
+			[]byte(id), []byte(currency), price)
+		if err != nil {
+			return err
+		}
+	}
+	for i, category := range attributes.Categories {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO product_categories (product_id, ordinal, category) VALUES ($1, $2, $3)`,
+			[]byte(id), i, []byte(category))
+		if err != nil {
+			return err
+		}
+	}
+	for key, value := range attributes.Attributes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO product_attributes (product_id, key, value) VALUES ($1, $2, $3)`,
+			[]byte(id), []byte(key), []byte(value))
+		if err != nil {
+			return err
+		}
+	}
+	for i, image := range attributes.Images {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO product_images (product_id, ordinal, url, alt) VALUES ($1, $2, $3, $4)`,
+			[]byte(id), i, []byte(image.URL), []byte(image.Alt))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindAllProducts returns all stored products that are not deleted.
+func (a *Adapter) FindAllProducts(ctx context.Context) ([]*model.Product, error) {
+	var result []*model.Product
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT id, name, price, description, sku, tax_class, weight FROM products WHERE NOT deleted`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		result = make([]*model.Product, 0)
+		for rows.Next() {
+			product, err := scanProduct(rows)
+			if err != nil {
+				return err
+			}
+			result = append(result, product)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		return findProductDetails(ctx, tx, result...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindProduct returns the product with the given id. ErrNotFound is returned if
+// there is no product with the id. ErrDeleted is returned if the product did
+// exist but is deleted.
+func (a *Adapter) FindProduct(ctx context.Context, id string) (*model.Product, error) {
+	var product *model.Product
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		var deleted bool
+		var name, description, sku, taxClass []byte
+		product = &model.Product{ID: id}
+		err := tx.QueryRowContext(ctx,
+			`SELECT name, price, description, sku, tax_class, weight, deleted FROM products WHERE id = $1`,
+			[]byte(id)).Scan(&name, &product.Price, &description, &sku, &taxClass, &product.Weight, &deleted)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		case deleted:
+			return persistence.ErrDeleted
+		}
+		product.Name, product.Description, product.SKU = string(name), string(description), string(sku)
+		product.TaxClass = string(taxClass)
+		return findProductDetails(ctx, tx, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// QueryProducts returns the products that are not deleted and match the query,
+// in the order and page defined by the query.
+func (a *Adapter) QueryProducts(ctx context.Context, query persistence.ProductQuery) ([]*model.Product, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// The price is the one of the currency of the query. Products without a
+	// price in the currency have a null price and are filtered out.
+	price := "price"
+	conditions := []string{"NOT deleted"}
+	if query.Currency != "" && query.Currency != model.DefaultCurrency {
+		price = `(SELECT p.price FROM product_prices p
+			WHERE p.product_id = products.id AND p.currency = ` + arg([]byte(query.Currency)) + `)`
+		conditions = append(conditions, price+" IS NOT NULL")
+	}
+
+	// filter
+	if query.Search != "" {
+		search := arg(lower(query.Search))
+		conditions = append(conditions, fmt.Sprintf(`(
+			position(%[1]s in name_lower) > 0 OR
+			position(%[1]s in description_lower) > 0 OR
+			position(%[1]s in sku_lower) > 0)`, search))
+	}
+	if query.MinPrice != nil {
+		conditions = append(conditions, price+" >= "+arg(*query.MinPrice))
+	}
+	if query.MaxPrice != nil {
+		conditions = append(conditions, price+" <= "+arg(*query.MaxPrice))
+	}
+	if len(query.Categories) > 0 {
+		categories := make([][]byte, len(query.Categories))
+		for i, category := range query.Categories {
+			categories[i] = []byte(category)
+		}
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM product_categories c
+			WHERE c.product_id = products.id AND c.category = ANY(`+arg(pq.ByteaArray(categories))+`))`)
+	}
+
+	// sort and page
+	column, direction, comparison := "name", "ASC", ">"
+	switch query.Sort {
+	case model.ProductSortNameDesc:
+		direction, comparison = "DESC", "<"
+	case model.ProductSortPriceAsc:
+		column = price
+	case model.ProductSortPriceDesc:
+		column, direction, comparison = price, "DESC", "<"
+	}
+	if query.After != nil {
+		var after interface{} = []byte(query.After.Name)
+		if column == price {
+			after, _ = query.Price(query.After)
+		}
+		value, id := arg(after), arg([]byte(query.After.ID))
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND id > %[4]s))",
+			column, comparison, value, id))
+	}
+	statement := `SELECT id, name, price, description, sku, tax_class, weight FROM products WHERE ` +
+		strings.Join(conditions, " AND ") +
+		fmt.Sprintf(" ORDER BY %s %s, id ASC", column, direction)
+	if query.Limit > 0 {
+		statement += " LIMIT " + arg(query.Limit)
+	}
+
+	var result []*model.Product
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, statement, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		result = make([]*model.Product, 0)
+		for rows.Next() {
+			product, err := scanProduct(rows)
+			if err != nil {
+				return err
+			}
+			result = append(result, product)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		return findProductDetails(ctx, tx, result...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// returns the lower case version of s that is used for searching
+func lower(s string) []byte {
+	return []byte(strings.ToLower(s))
+}
+
+// Fills the lower case columns of products that were stored before searching
+// was supported. It has no effect if there are no such products.
+func lowerProducts(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, name, description, sku FROM products WHERE name_lower IS NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var products [][4]string
+	for rows.Next() {
+		var id, name, description, sku []byte
+		if err := rows.Scan(&id, &name, &description, &sku); err != nil {
+			return err
+		}
+		products = append(products, [4]string{string(id), string(name), string(description), string(sku)})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, p := range products {
+		_, err := db.ExecContext(ctx, `
+			UPDATE products SET name_lower = $2, description_lower = $3, sku_lower = $4
+			WHERE id = $1 AND name_lower IS NULL`,
+			[]byte(p[0]), lower(p[1]), lower(p[2]), lower(p[3]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scans a row of id, name, price, description, sku, tax class and weight
+func scanProduct(row scanner) (*model.Product, error) {
+	var id, name, description, sku, taxClass []byte
+	var product model.Product
+	if err := row.Scan(&id, &name, &product.Price, &description, &sku, &taxClass, &product.Weight); err != nil {
+		return nil, err
+	}
+	product.ID, product.Name = string(id), string(name)
+	product.Description, product.SKU = string(description), string(sku)
+	product.TaxClass = string(taxClass)
+	return &product, nil
+}
+
+// loads prices, categories, attributes and images of the products
+func findProductDetails(ctx context.Context, q querier, products ...*model.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Product, len(products))
+	ids := make([][]byte, len(products))
+	for i, product := range products {
+		byID[product.ID] = product
+		ids[i] = []byte(product.ID)
+	}
+
+	// prices
+	rows, err := q.QueryContext(ctx, `
+		SELECT product_id, currency, price
+		FROM product_prices
+		WHERE product_id = ANY($1)`,
+		pq.ByteaArray(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productID, currency []byte
+		var price int
+		if err := rows.Scan(&productID, &currency, &price); err != nil {
+			return err
+		}
+		product := byID[string(productID)]
+		if product.Prices == nil {
+			product.Prices = make(map[model.Currency]int)
+		}
+		product.Prices[model.Currency(currency)] = price
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// categories
+	rows, err = q.QueryContext(ctx, `
+		SELECT product_id, category
+		FROM product_categories
+		WHERE product_id = ANY($1)
+		ORDER BY product_id, ordinal`,
+		pq.ByteaArray(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productID, category []byte
+		if err := rows.Scan(&productID, &category); err != nil {
+			return err
+		}
+		product := byID[string(productID)]
+		product.Categories = append(product.Categories, string(category))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// attributes
+	rows, err = q.QueryContext(ctx, `
+		SELECT product_id, key, value
+		FROM product_attributes
+		WHERE product_id = ANY($1)`,
+		pq.ByteaArray(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productID, key, value []byte
+		if err := rows.Scan(&productID, &key, &value); err != nil {
+			return err
+		}
+		product := byID[string(productID)]
+		if product.Attributes == nil {
+			product.Attributes = make(map[string]string)
+		}
+		product.Attributes[string(key)] = string(value)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	// images
+	rows, err = q.QueryContext(ctx, `
+		SELECT product_id, url, alt
+		FROM product_images
+		WHERE product_id = ANY($1)
+		ORDER BY product_id, ordinal`,
+		pq.ByteaArray(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productID, url, alt []byte
+		if err := rows.Scan(&productID, &url, &alt); err != nil {
+			return err
+		}
+		product := byID[string(productID)]
+		product.Images = append(product.Images, model.Image{URL: string(url), Alt: string(alt)})
+	}
+	return rows.Err()
+}
@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+)
+
+var _ persistence.PromotionRepository = (*Adapter)(nil)
+
+// StorePromotion stores a promotion with the given id and attributes. If a
+// promotion with the same id was previously stored it is overwritten.
+func (a *Adapter) StorePromotion(ctx context.Context, id string, attributes persistence.PromotionAttributes) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		return storePromotion(ctx, tx, id, attributes)
+	})
+}
+
+// SeedPromotions stores the given promotions with their ids like
+// StorePromotion, but only the first time it is called on a repository
+// without promotions. Later calls do nothing, so that seeded promotions that
+// were deleted are not restored.
+func (a *Adapter) SeedPromotions(ctx context.Context, promotions map[string]persistence.PromotionAttributes) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		// concurrent seeds wait here until the first one is committed
+		result, err := tx.ExecContext(ctx,
+			`INSERT INTO seeds (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`,
+			[]byte("promotions"))
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return nil // seeded before
+		}
+		var empty bool
+		err = tx.QueryRowContext(ctx, `SELECT NOT EXISTS (SELECT 1 FROM promotions)`).Scan(&empty)
+		if err != nil || !empty {
+			return err
+		}
+		for id, attributes := range promotions {
+			if err := storePromotion(ctx, tx, id, attributes); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func storePromotion(ctx context.Context, tx *sql.Tx, id string, attributes persistence.PromotionAttributes) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO promotions (id, type, name, product_id, quantity, free_quantity, discount)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			type = EXCLUDED.type,
+			name = EXCLUDED.name,
+			product_id = EXCLUDED.product_id,
+			quantity = EXCLUDED.quantity,
+			free_quantity = EXCLUDED.free_quantity,
+			discount = EXCLUDED.discount`,
+		[]byte(id), []byte(attributes.Type), []byte(attributes.Name), []byte(attributes.ProductID),
+		attributes.Quantity, attributes.FreeQuantity, attributes.Discount)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM promotion_bundle_items WHERE promotion_id = $1`, []byte(id))
+	if err != nil {
+		return err
+	}
+	for productID, quantity := range attributes.Bundle {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO promotion_bundle_items (promotion_id, product_id, quantity)
+			VALUES ($1, $2, $3)`,
+			[]byte(id), []byte(productID), quantity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindAllPromotions returns all promotions.
+func (a *Adapter) FindAllPromotions(ctx context.Context) ([]*model.Promotion, error) {
+	var promotions []*model.Promotion
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT id, type, name, product_id, quantity, free_quantity, discount
+			FROM promotions
+			ORDER BY id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		promotions = make([]*model.Promotion, 0)
+		for rows.Next() {
+			promotion, err := scanPromotion(rows)
+			if err != nil {
+				return err
+			}
+			promotions = append(promotions, promotion)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, promotion := range promotions {
+			if err := findPromotionBundle(ctx, tx, promotion); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// FindPromotion returns the promotion with the given id. ErrNotFound is
+// returned if there is no promotion with the id.
+func (a *Adapter) FindPromotion(ctx context.Context, id string) (*model.Promotion, error) {
+	var promotion *model.Promotion
+	err := a.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		promotion, err = scanPromotion(tx.QueryRowContext(ctx, `
+			SELECT id, type, name, product_id, quantity, free_quantity, discount
+			FROM promotions
+			WHERE id = $1`,
+			[]byte(id)))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		}
+		return findPromotionBundle(ctx, tx, promotion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
+
+// DeletePromotion deletes the promotion with the given id. ErrNotFound is
+// returned if there is no promotion with the id.
+func (a *Adapter) DeletePromotion(ctx context.Context, id string) error {
+	result, err := a.db.ExecContext(ctx, `DELETE FROM promotions WHERE id = $1`, []byte(id))
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPromotion(row scanner) (*model.Promotion, error) {
+	var id, typ, name, productID []byte
+	var promotion model.Promotion
+	err := row.Scan(&id, &typ, &name, &productID, &promotion.Quantity, &promotion.FreeQuantity, &promotion.Discount)
+	if err != nil {
+		return nil, err
+	}
+	promotion.ID = string(id)
+	promotion.Type = model.PromotionType(typ)
+	promotion.Name = string(name)
+	promotion.ProductID = string(productID)
+	return &promotion, nil
+}
+
+// Loads the bundle items of the promotion. The bundle stays nil if there are
+// no items.
+func findPromotionBundle(ctx context.Context, q querier, promotion *model.Promotion) error {
+	rows, err := q.QueryContext(ctx,
+		`SELECT product_id, quantity FROM promotion_bundle_items WHERE promotion_id = $1`,
+		[]byte(promotion.ID))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var productID []byte
+		var quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return err
+		}
+		if promotion.Bundle == nil {
+			promotion.Bundle = make(map[string]int)
+		}
+		promotion.Bundle[string(productID)] = quantity
+	}
+	return rows.Err()
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+)
+
+var _ persistence.SessionRepository = (*Adapter)(nil)
+
+// CreateSession creates a session of the given user with the given id and
+// refresh token that expires at the given time. Id must be unique. ErrConflict
+// is returned otherwise. The refresh token is stored as a hash and can never
+// be retrieved again.
+func (a *Adapter) CreateSession(ctx context.Context, id, userID, refreshToken string, expiresAt time.Time) error {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		// clean up expired sessions
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM sessions WHERE expires_at < $1`,
+			time.Now())
+		if err != nil {
+			return err
+		}
+
+		// add new session
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO sessions (id, user_id, refresh_token_hash, expires_at)
+			VALUES ($1, $2, $3, $4)`,
+			[]byte(id), []byte(userID), hash[:], expiresAt)
+		if isUniqueViolation(err) {
+			return persistence.ErrConflict
+		}
+		return err
+	})
+}
+
+// RotateSession replaces the refresh token of the session with the given id
+// and sets the new expiry time. ErrNotFound is returned if there is no session
+// with the id. ErrConflict is returned if the refresh token is not the current
+// one of the session.
+func (a *Adapter) RotateSession(ctx context.Context, id, refreshToken, newRefreshToken string, expiresAt time.Time) error {
+	hash := sha256.Sum256([]byte(refreshToken))
+	newHash := sha256.Sum256([]byte(newRefreshToken))
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		var currentHash []byte
+		err := tx.QueryRowContext(ctx, `
+			SELECT refresh_token_hash
+			FROM sessions
+			WHERE id = $1 AND expires_at >= $2
+			FOR UPDATE`,
+			[]byte(id), time.Now()).Scan(&currentHash)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		}
+		if subtle.ConstantTimeCompare(hash[:], currentHash) != 1 {
+			return persistence.ErrConflict
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE sessions
+			SET refresh_token_hash = $2, expires_at = $3
+			WHERE id = $1`,
+			[]byte(id), newHash[:], expiresAt)
+		return err
+	})
+}
+
+// FindSession returns the session with the given id. ErrNotFound is returned
+// if there is no session with the id.
+func (a *Adapter) FindSession(ctx context.Context, id string) (*model.Session, error) {
+	var userID []byte
+	session := model.Session{ID: id}
+	err := a.db.QueryRowContext(ctx, `
+		SELECT user_id, expires_at
+		FROM sessions
+		WHERE id = $1 AND expires_at >= $2`,
+		[]byte(id), time.Now()).Scan(&userID, &session.ExpiresAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, persistence.ErrNotFound
+	case err != nil:
+		return nil, contextErr(ctx, err)
+	}
+	session.UserID = string(userID)
+	return &session, nil
+}
+
+// DeleteSession deletes the session with the given id. ErrNotFound is returned
+// if there is no session with the id.
+func (a *Adapter) DeleteSession(ctx context.Context, id string) error {
+	result, err := a.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE id = $1 AND expires_at >= $2`,
+		[]byte(id), time.Now())
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return contextErr(ctx, err)
+	} else if n == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteSessionsOfUser deletes all sessions of the given user.
+func (a *Adapter) DeleteSessionsOfUser(ctx context.Context, userID string) error {
+	_, err := a.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user_id = $1`,
+		[]byte(userID))
+	return contextErr(ctx, err)
+}
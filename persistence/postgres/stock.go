@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/lib/pq"
+)
+
+var _ persistence.StockRepository = (*Adapter)(nil)
+
+// SetStock sets the quantity in stock of the product with the given id. The
+// product is tracked from now on. ErrConflict is returned if the quantity is
+// lower than the reserved quantity.
+func (a *Adapter) SetStock(ctx context.Context, productID string, quantity int) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO stocks (product_id, quantity) VALUES ($1, 0)
+			ON CONFLICT (product_id) DO NOTHING`,
+			[]byte(productID))
+		if err != nil {
+			return err
+		}
+		stock, err := lockStock(ctx, tx, productID)
+		if err != nil {
+			return err
+		}
+		if quantity < stock.Reserved {
+			return persistence.ErrConflict
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE stocks SET quantity = $2 WHERE product_id = $1`,
+			[]byte(productID), quantity)
+		return err
+	})
+}
+
+// AdjustStock adds delta to the quantity in stock of the product with the given
+// id. ErrNotFound is returned if the product is not tracked. ErrConflict is
+// returned if the quantity would become lower than the reserved quantity.
+func (a *Adapter) AdjustStock(ctx context.Context, productID string, delta int) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		stock, err := lockStock(ctx, tx, productID)
+		if err != nil {
+			return err
+		}
+		if stock.Quantity+delta < stock.Reserved {
+			return persistence.ErrConflict
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE stocks SET quantity = quantity + $2 WHERE product_id = $1`,
+			[]byte(productID), delta)
+		return err
+	})
+}
+
+// DeleteStock stops tracking the stock of the product with the given id. Its
+// reservations are dropped. ErrNotFound is returned if the product is not
+// tracked.
+func (a *Adapter) DeleteStock(ctx context.Context, productID string) error {
+	result, err := a.db.ExecContext(ctx,
+		`DELETE FROM stocks WHERE product_id = $1`,
+		[]byte(productID))
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return contextErr(ctx, err)
+	} else if n == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// FindStock returns the stock of the product with the given id. ErrNotFound is
+// returned if the product is not tracked.
+func (a *Adapter) FindStock(ctx context.Context, productID string) (*model.Stock, error) {
+	var stock *model.Stock
+	err := a.inTx(ctx, func(tx *sql.Tx) (err error) {
+		stock, err = findStock(ctx, tx, productID, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stock, nil
+}
+
+// ReserveStock reserves the quantities for the order with the given id.
+// Quantities maps product ids to quantity. Products that are not tracked are
+// ignored. Any previous reservation of the order is replaced. Either all
+// quantities are reserved or none. ErrInsufficientStock is returned if any
+// product has not enough available items.
+func (a *Adapter) ReserveStock(ctx context.Context, orderID string, quantities map[string]int) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		// Lock the stocks in a fixed order to avoid deadlocks with concurrent
+		// reservations of the same products.
+		productIDs := make([]string, 0, len(quantities))
+		for productID := range quantities {
+			productIDs = append(productIDs, productID)
+		}
+		sort.Strings(productIDs)
+		ids := make([][]byte, len(productIDs))
+		for i, productID := range productIDs {
+			ids[i] = []byte(productID)
+		}
+		_, err := tx.ExecContext(ctx, `
+			SELECT product_id FROM stocks
+			WHERE product_id = ANY($1)
+			ORDER BY product_id
+			FOR UPDATE`,
+			pq.ByteaArray(ids))
+		if err != nil {
+			return err
+		}
+
+		// replace the previous reservation
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM stock_reservations WHERE order_id = $1`,
+			[]byte(orderID))
+		if err != nil {
+			return err
+		}
+		for _, productID := range productIDs {
+			stock, err := findStock(ctx, tx, productID, false)
+			if errors.Is(err, persistence.ErrNotFound) {
+				continue // not tracked
+			} else if err != nil {
+				return err
+			}
+			if stock.Available() < quantities[productID] {
+				return persistence.ErrInsufficientStock
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO stock_reservations (order_id, product_id, quantity)
+				VALUES ($1, $2, $3)`,
+				[]byte(orderID), []byte(productID), quantities[productID])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReleaseStock drops the reservation of the order with the given id. Releasing
+// an order without reservation has no effect.
+func (a *Adapter) ReleaseStock(ctx context.Context, orderID string) error {
+	_, err := a.db.ExecContext(ctx,
+		`DELETE FROM stock_reservations WHERE order_id = $1`,
+		[]byte(orderID))
+	return contextErr(ctx, err)
+}
+
+// CommitStock takes the reserved items of the order with the given id out of
+// stock and drops the reservation. Committing an order without reservation has
+// no effect.
+func (a *Adapter) CommitStock(ctx context.Context, orderID string) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE stocks s SET quantity = s.quantity - r.quantity
+			FROM stock_reservations r
+			WHERE r.order_id = $1 AND r.product_id = s.product_id`,
+			[]byte(orderID))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM stock_reservations WHERE order_id = $1`,
+			[]byte(orderID))
+		return err
+	})
+}
+
+// Locks the stock's row until the end of the transaction and returns it.
+func lockStock(ctx context.Context, tx *sql.Tx, productID string) (*model.Stock, error) {
+	return findStock(ctx, tx, productID, true)
+}
+
+// returns the stock of the product including the reserved quantity, the row is
+// locked if forUpdate is true
+func findStock(ctx context.Context, q querier, productID string, forUpdate bool) (*model.Stock, error) {
+	stock := model.Stock{ProductID: productID}
+	query := `SELECT quantity FROM stocks WHERE product_id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	err := q.QueryRowContext(ctx, query, []byte(productID)).Scan(&stock.Quantity)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, persistence.ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+	err = q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM stock_reservations
+		WHERE product_id = $1`,
+		[]byte(productID)).Scan(&stock.Reserved)
+	if err != nil {
+		return nil, err
+	}
+	return &stock, nil
+}
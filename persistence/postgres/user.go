@@ -0,0 +1,285 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ persistence.UserRepository = (*Adapter)(nil)
+
+// CreateUser creates a user with the given id, name and password. Id must be
+// unique. Name must be unique. ErrConflict is returned otherwise. The password
+// is stored as a hash and can never be retrieved again.
+func (a *Adapter) CreateUser(ctx context.Context, id string, name string, password string) error {
+	// hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+
+	// save user
+	_, err = a.db.ExecContext(ctx,
+		`INSERT INTO users (id, name, password_hash) VALUES ($1, $2, $3)`,
+		[]byte(id), []byte(name), hash)
+	if isUniqueViolation(err) {
+		return persistence.ErrConflict
+	}
+	return contextErr(ctx, err)
+}
+
+// FindUserByNameAndPassword finds the user by the given name and password. As
+// names are unique the result is unambiguous. ErrNotFound is returned if no
+// user matches the set of name and password.
+func (a *Adapter) FindUserByNameAndPassword(ctx context.Context, name string, password string) (*model.User, error) {
+	row := a.db.QueryRowContext(ctx,
+		`SELECT id, name, password_hash FROM users WHERE name = $1`,
+		[]byte(name))
+	return scanAndCheckUserPassword(ctx, a.db, row, password)
+}
+
+// FindUserByIDAndPassword finds the user by the given id and password. As ids
+// are unique the result is unambiguous. ErrNotFound is returned if no user
+// matches the set of id and password.
+func (a *Adapter) FindUserByIDAndPassword(ctx context.Context, id string, password string) (*model.User, error) {
+	row := a.db.QueryRowContext(ctx,
+		`SELECT id, name, password_hash FROM users WHERE id = $1`,
+		[]byte(id))
+	return scanAndCheckUserPassword(ctx, a.db, row, password)
+}
+
+// FindUser finds the user by the given id. ErrNotFound is returned if there is
+// no user with the id.
+func (a *Adapter) FindUser(ctx context.Context, id string) (*model.User, error) {
+	var name []byte
+	err := a.db.QueryRowContext(ctx,
+		`SELECT name FROM users WHERE id = $1`,
+		[]byte(id)).Scan(&name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, persistence.ErrNotFound
+	case err != nil:
+		return nil, contextErr(ctx, err)
+	}
+	user := model.User{
+		ID:   id,
+		Name: string(name),
+	}
+	user.Roles, err = findUserRoles(ctx, a.db, id)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUserByName finds the user by the given name. ErrNotFound is returned if
+// there is no user with the name.
+func (a *Adapter) FindUserByName(ctx context.Context, name string) (*model.User, error) {
+	var id []byte
+	err := a.db.QueryRowContext(ctx,
+		`SELECT id FROM users WHERE name = $1`,
+		[]byte(name)).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, persistence.ErrNotFound
+	case err != nil:
+		return nil, contextErr(ctx, err)
+	}
+	user := model.User{
+		ID:   string(id),
+		Name: name,
+	}
+	user.Roles, err = findUserRoles(ctx, a.db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUsersWithRole returns all users that have the given role.
+func (a *Adapter) FindUsersWithRole(ctx context.Context, role model.Role) ([]*model.User, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT u.id, u.name
+		FROM users u
+		JOIN user_roles r ON r.user_id = u.id
+		WHERE r.role = $1`,
+		[]byte(role))
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	defer rows.Close()
+	var users []*model.User
+	for rows.Next() {
+		var id, name []byte
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		users = append(users, &model.User{
+			ID:   string(id),
+			Name: string(name),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	for _, user := range users {
+		user.Roles, err = findUserRoles(ctx, a.db, user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// SetUserRoles replaces the roles of the user with the given id. The roles
+// must not contain duplicates. ErrNotFound is returned if there is no user
+// with the id.
+func (a *Adapter) SetUserRoles(ctx context.Context, id string, roles []model.Role) error {
+	return a.inTx(ctx, func(tx *sql.Tx) error {
+		// lock user
+		err := tx.QueryRowContext(ctx,
+			`SELECT id FROM users WHERE id = $1 FOR UPDATE`,
+			[]byte(id)).Scan(new([]byte))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return persistence.ErrNotFound
+		case err != nil:
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM user_roles WHERE user_id = $1`,
+			[]byte(id)); err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO user_roles (user_id, role) VALUES ($1, $2)`,
+				[]byte(id), []byte(role)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetUserPassword replaces the password of the user with the given id. The
+// password is stored as a hash and can never be retrieved again. ErrNotFound
+// is returned if there is no user with the id.
+func (a *Adapter) SetUserPassword(ctx context.Context, id, password string) error {
+	// hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), a.bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+
+	result, err := a.db.ExecContext(ctx,
+		`UPDATE users SET password_hash = $2 WHERE id = $1`,
+		[]byte(id), hash)
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return contextErr(ctx, err)
+	} else if n == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteUser deletes the user with the given id. The name can be used by
+// another user afterwards. ErrNotFound is returned if there is no user with
+// the id.
+func (a *Adapter) DeleteUser(ctx context.Context, id string) error {
+	result, err := a.db.ExecContext(ctx,
+		`DELETE FROM users WHERE id = $1`,
+		[]byte(id))
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return contextErr(ctx, err)
+	} else if n == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// ClaimGuest records that the guest with the given id was claimed by the user
+// with the given id, so that the tokens of the guest can be rejected.
+// ErrConflict is returned if the guest was claimed before.
+func (a *Adapter) ClaimGuest(ctx context.Context, guestID, userID string) error {
+	_, err := a.db.ExecContext(ctx,
+		`INSERT INTO guest_claims (guest_id, user_id) VALUES ($1, $2)`,
+		[]byte(guestID), []byte(userID))
+	if isUniqueViolation(err) {
+		return persistence.ErrConflict
+	}
+	return contextErr(ctx, err)
+}
+
+// FindGuestClaim returns the id of the user that claimed the guest with the
+// given id. ErrNotFound is returned if the guest was not claimed.
+func (a *Adapter) FindGuestClaim(ctx context.Context, guestID string) (string, error) {
+	var userID []byte
+	err := a.db.QueryRowContext(ctx,
+		`SELECT user_id FROM guest_claims WHERE guest_id = $1`,
+		[]byte(guestID)).Scan(&userID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", persistence.ErrNotFound
+	case err != nil:
+		return "", contextErr(ctx, err)
+	}
+	return string(userID), nil
+}
+
+// findUserRoles returns the roles of the user in ascending order, or nil if
+// the user has no roles.
+func findUserRoles(ctx context.Context, q querier, id string) ([]model.Role, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`,
+		[]byte(id))
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	defer rows.Close()
+	var roles []model.Role
+	for rows.Next() {
+		var role []byte
+		if err := rows.Scan(&role); err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		roles = append(roles, model.Role(role))
+	}
+	return roles, contextErr(ctx, rows.Err())
+}
+
+func scanAndCheckUserPassword(ctx context.Context, q querier, row *sql.Row, password string) (*model.User, error) {
+	var id, name, passwordHash []byte
+	err := row.Scan(&id, &name, &passwordHash)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, persistence.ErrNotFound
+	case err != nil:
+		return nil, contextErr(ctx, err)
+	}
+
+	// check password
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(password)); err != nil {
+		return nil, persistence.ErrNotFound
+	}
+	user := model.User{
+		ID:   string(id),
+		Name: string(name),
+	}
+	user.Roles, err = findUserRoles(ctx, q, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
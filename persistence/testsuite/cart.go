@@ -29,6 +29,7 @@ func (s *CartRepositoryTestSuite) TestCreateCart() {
 		err := r.CreateCart(ctx,
 			"0cfb6682-4279-4928-af37-30fd3e4c0b15", // user id
 			"71388209-5d1d-4ce7-a7ac-38a2e75fd67c", // id
+			model.DefaultCurrency,
 			map[string]int{
 				"ce21148d-f8c8-437a-bd9c-fd72797803dd": 1,
 				"c92a017b-3e75-43d0-bb38-7f05e7d9b3c3": 999,
@@ -38,7 +39,7 @@ func (s *CartRepositoryTestSuite) TestCreateCart() {
 	})
 	s.Run("with empty id, positions and locked status", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "", "", nil)
+		err := r.CreateCart(ctx, "", "", model.DefaultCurrency, nil)
 		s.NoError(err)
 	})
 	s.Run("many", func() {
@@ -54,41 +55,41 @@ func (s *CartRepositoryTestSuite) TestCreateCart() {
 			{"053ac78e-4332-4e0f-bb1a-544c3b8bfd83", "2e485bac-dade-4a20-9fee-f5a5bcfe8428"},
 			{"1e1d6a41-5827-40a6-9a82-404f278cce5c", "8b7d133d-666b-41c9-8d73-1fd391161b15"},
 		} {
-			err := r.CreateCart(ctx, c.userID, c.id, nil)
+			err := r.CreateCart(ctx, c.userID, c.id, model.DefaultCurrency, nil)
 			s.Require().NoError(err)
 		}
 	})
 	s.Run("conflict on same id", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user1", "id", nil)
+		err := r.CreateCart(ctx, "user1", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
-		err = r.CreateCart(ctx, "user2", "id", nil)
+		err = r.CreateCart(ctx, "user2", "id", model.DefaultCurrency, nil)
 		s.True(errors.Is(err, persistence.ErrConflict))
 	})
 	s.Run("no conflict on same user", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id1", nil)
+		err := r.CreateCart(ctx, "user", "id1", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
-		err = r.CreateCart(ctx, "user", "id2", nil)
+		err = r.CreateCart(ctx, "user", "id2", model.DefaultCurrency, nil)
 		s.NoError(err)
 	})
 	s.Run("is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
-		err = r.CreateCart(ctx, "user", "ID", nil)
+		err = r.CreateCart(ctx, "user", "ID", model.DefaultCurrency, nil)
 		s.NoError(err)
 	})
 	s.Run("supports more complex strings", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "औकखग \u0000\t\"abc", "‽ⓐ◐\n👽 乐乑", nil)
+		err := r.CreateCart(ctx, "औकखग \u0000\t\"abc", "‽ⓐ◐\n👽 乐乑", model.DefaultCurrency, nil)
 		s.NoError(err)
 	})
 	s.Run("does not trim whitespaces", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", " a", nil)
+		err := r.CreateCart(ctx, "user", " a", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
-		err = r.CreateCart(ctx, "user", "a", nil)
+		err = r.CreateCart(ctx, "user", "a", model.DefaultCurrency, nil)
 		s.NoError(err)
 	})
 	s.Run("works concurrently", func() {
@@ -105,7 +106,7 @@ func (s *CartRepositoryTestSuite) TestCreateCart() {
 		do := func(ids []string) {
 			defer wg.Done()
 			for _, id := range ids {
-				err := r.CreateCart(ctx, "user", id, nil)
+				err := r.CreateCart(ctx, "user", id, model.DefaultCurrency, nil)
 				s.Require().NoError(err)
 			}
 		}
@@ -120,7 +121,7 @@ func (s *CartRepositoryTestSuite) TestCreateCart() {
 			"6a11c1d3-bc6d-45c7-968d-4fdcd63f05b3": 2,
 			"237bd725-bec1-4cf5-be3b-51fcb6ee1d0a": 1,
 		}
-		err := r.CreateCart(ctx, "user", "id", positions)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, positions)
 		s.Require().NoError(err)
 		// changing the input ...
 		positions["6a11c1d3-bc6d-45c7-968d-4fdcd63f05b3"]++
@@ -133,7 +134,7 @@ func (s *CartRepositoryTestSuite) TestCreateCart() {
 			{ProductID: "237bd725-bec1-4cf5-be3b-51fcb6ee1d0a", Quantity: 1},
 		}, cart.Positions)
 		cart.Positions = nil
-		s.Equal(&model.Cart{ID: "id"}, cart)
+		s.Equal(&model.Cart{ID: "id", Currency: model.DefaultCurrency}, cart)
 	})
 }
 
@@ -144,6 +145,7 @@ func (s *CartRepositoryTestSuite) TestUpdateCartOfUser() {
 		err := r.CreateCart(ctx,
 			"user",
 			"id",
+			model.DefaultCurrency,
 			map[string]int{
 				"bb364bf5-e1fb-445d-be2d-ebad49316e0c": 1,
 				"77181602-1b4c-463c-b9a5-c2188610fd68": 999,
@@ -153,6 +155,7 @@ func (s *CartRepositoryTestSuite) TestUpdateCartOfUser() {
 		err = r.UpdateCartOfUser(ctx,
 			"user",
 			"id",
+			model.DefaultCurrency,
 			map[string]int{
 				"e11c7885-92a9-4833-8e52-ed020fef5aff": 2,
 				"ff62397c-cbcf-4cd9-b57d-0a9348dd8ef4": 3,
@@ -160,18 +163,31 @@ func (s *CartRepositoryTestSuite) TestUpdateCartOfUser() {
 		)
 		s.Require().NoError(err)
 	})
+	s.Run("keeps the currency", func() {
+		r := s.NewRepository()
+		err := r.CreateCart(ctx, "user", "id", "USD", map[string]int{"product1": 1})
+		s.Require().NoError(err)
+		err = r.UpdateCartOfUser(ctx, "user", "id", "USD", map[string]int{"product1": 2})
+		s.Require().NoError(err)
+		err = r.UpdateCartOfUser(ctx, "user", "id", "EUR", map[string]int{"product1": 3})
+		s.True(errors.Is(err, persistence.ErrConflict))
+		cart, err := r.FindCartOfUser(ctx, "user", "id")
+		s.NoError(err)
+		s.Equal(model.Currency("USD"), cart.Currency)
+		s.Equal([]model.Position{{ProductID: "product1", Quantity: 2}}, cart.Positions)
+	})
 	s.Run("user is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
-		err = r.UpdateCartOfUser(ctx, "USER", "id", nil)
+		err = r.UpdateCartOfUser(ctx, "USER", "id", model.DefaultCurrency, nil)
 		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
 	})
 	s.Run("id is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
-		err = r.UpdateCartOfUser(ctx, "user", "ID", nil)
+		err = r.UpdateCartOfUser(ctx, "user", "ID", model.DefaultCurrency, nil)
 		s.True(errors.Is(err, persistence.ErrNotFound))
 	})
 	s.Run("works concurrently", func() {
@@ -188,11 +204,11 @@ func (s *CartRepositoryTestSuite) TestUpdateCartOfUser() {
 		do := func(ids []string) {
 			defer wg.Done()
 			for _, id := range ids {
-				err := r.CreateCart(ctx, "user", id, nil)
+				err := r.CreateCart(ctx, "user", id, model.DefaultCurrency, nil)
 				s.Require().NoError(err)
 			}
 			for _, id := range ids {
-				err := r.UpdateCartOfUser(ctx, "user", id, nil)
+				err := r.UpdateCartOfUser(ctx, "user", id, model.DefaultCurrency, nil)
 				s.Require().NoError(err)
 			}
 		}
@@ -203,13 +219,13 @@ func (s *CartRepositoryTestSuite) TestUpdateCartOfUser() {
 	})
 	s.Run("changing the input does not have any side effects", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		positions := map[string]int{
 			"268621f3-24dc-48f8-ad5b-db3e9a8a5f4e": 2,
 			"10637059-e964-4528-8f3e-81a329614249": 1,
 		}
-		err = r.UpdateCartOfUser(ctx, "user", "id", positions)
+		err = r.UpdateCartOfUser(ctx, "user", "id", model.DefaultCurrency, positions)
 		s.Require().NoError(err)
 		// changing the input ...
 		positions["268621f3-24dc-48f8-ad5b-db3e9a8a5f4e"]++
@@ -222,7 +238,7 @@ func (s *CartRepositoryTestSuite) TestUpdateCartOfUser() {
 			{ProductID: "10637059-e964-4528-8f3e-81a329614249", Quantity: 1},
 		}, cart.Positions)
 		cart.Positions = nil
-		s.Equal(&model.Cart{ID: "id"}, cart)
+		s.Equal(&model.Cart{ID: "id", Currency: model.DefaultCurrency}, cart)
 	})
 }
 
@@ -230,7 +246,7 @@ func (s *CartRepositoryTestSuite) TestUpdateCartOfUser() {
 func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 	s.Run("finds cart with positions", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "8a0f04c7-babb-4ae6-a003-03637cb4396a", "4a33699b-afc5-41e7-b22f-3cdfca5952f8", map[string]int{
+		err := r.CreateCart(ctx, "8a0f04c7-babb-4ae6-a003-03637cb4396a", "4a33699b-afc5-41e7-b22f-3cdfca5952f8", model.DefaultCurrency, map[string]int{
 			"eb8013e1-74ec-4c20-b57f-19d7a47c8bb0": 1,
 			"80d96241-96de-486e-a9bd-5f31dfb59405": 9,
 		})
@@ -249,12 +265,13 @@ func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 		carts[0].Positions = nil
 		s.Equal([]*model.Cart{
 			{
-				ID:     "4a33699b-afc5-41e7-b22f-3cdfca5952f8",
-				Locked: false,
+				ID:       "4a33699b-afc5-41e7-b22f-3cdfca5952f8",
+				Currency: model.DefaultCurrency,
+				Locked:   false,
 			},
 		}, carts)
 		s.Run("after updating it", func() {
-			err := r.UpdateCartOfUser(ctx, "8a0f04c7-babb-4ae6-a003-03637cb4396a", "4a33699b-afc5-41e7-b22f-3cdfca5952f8", map[string]int{
+			err := r.UpdateCartOfUser(ctx, "8a0f04c7-babb-4ae6-a003-03637cb4396a", "4a33699b-afc5-41e7-b22f-3cdfca5952f8", model.DefaultCurrency, map[string]int{
 				"58a89337-e6e3-4ed8-b6b8-1999f79d48d5": 5, // new one
 				"eb8013e1-74ec-4c20-b57f-19d7a47c8bb0": 1,
 				// removed 80d96241-96de-486e-a9bd-5f31dfb59405
@@ -274,19 +291,21 @@ func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 			carts[0].Positions = nil
 			s.Equal([]*model.Cart{
 				{
-					ID:     "4a33699b-afc5-41e7-b22f-3cdfca5952f8",
-					Locked: false,
+					ID:       "4a33699b-afc5-41e7-b22f-3cdfca5952f8",
+					Currency: model.DefaultCurrency,
+					Locked:   false,
 				},
 			}, carts)
 		})
 		s.Run("after removing all positions", func() {
-			err := r.UpdateCartOfUser(ctx, "8a0f04c7-babb-4ae6-a003-03637cb4396a", "4a33699b-afc5-41e7-b22f-3cdfca5952f8", nil)
+			err := r.UpdateCartOfUser(ctx, "8a0f04c7-babb-4ae6-a003-03637cb4396a", "4a33699b-afc5-41e7-b22f-3cdfca5952f8", model.DefaultCurrency, nil)
 			s.Require().NoError(err)
 			carts, err := r.FindAllUnlockedCartsOfUser(ctx, "8a0f04c7-babb-4ae6-a003-03637cb4396a")
 			s.NoError(err)
 			s.Equal([]*model.Cart{
 				{
 					ID:        "4a33699b-afc5-41e7-b22f-3cdfca5952f8",
+					Currency:  model.DefaultCurrency,
 					Positions: []model.Position{},
 					Locked:    false,
 				},
@@ -304,19 +323,19 @@ func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 			"dc5be657-5bbc-48eb-a529-bf60107bd725",
 			"d69829b0-ec64-4608-88f6-3c5005fae6e6",
 		} {
-			err := r.CreateCart(ctx, "821a9932-f585-4d5a-a383-17091b55adcd", id, nil)
+			err := r.CreateCart(ctx, "821a9932-f585-4d5a-a383-17091b55adcd", id, model.DefaultCurrency, nil)
 			s.Require().NoError(err)
 		}
 		carts, err := r.FindAllUnlockedCartsOfUser(ctx, "821a9932-f585-4d5a-a383-17091b55adcd")
 		s.NoError(err)
 		s.ElementsMatch([]*model.Cart{
-			{ID: "ec9d12ab-a7e8-4e27-8f58-4ef62f14d82c", Positions: []model.Position{}},
-			{ID: "d1111e81-6d8d-4531-bd2f-294fa41eab9b", Positions: []model.Position{}},
-			{ID: "9b312fc0-4867-42f5-948c-731582193a3d", Positions: []model.Position{}},
-			{ID: "e7e08f45-0cfd-45a5-8ae4-3bfef52bf590", Positions: []model.Position{}},
-			{ID: "3f616dc1-ad44-4720-9fa0-02985896ee5d", Positions: []model.Position{}},
-			{ID: "dc5be657-5bbc-48eb-a529-bf60107bd725", Positions: []model.Position{}},
-			{ID: "d69829b0-ec64-4608-88f6-3c5005fae6e6", Positions: []model.Position{}},
+			{ID: "ec9d12ab-a7e8-4e27-8f58-4ef62f14d82c", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "d1111e81-6d8d-4531-bd2f-294fa41eab9b", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "9b312fc0-4867-42f5-948c-731582193a3d", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "e7e08f45-0cfd-45a5-8ae4-3bfef52bf590", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "3f616dc1-ad44-4720-9fa0-02985896ee5d", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "dc5be657-5bbc-48eb-a529-bf60107bd725", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "d69829b0-ec64-4608-88f6-3c5005fae6e6", Currency: model.DefaultCurrency, Positions: []model.Position{}},
 		}, carts)
 	})
 	s.Run("no carts exist", func() {
@@ -338,15 +357,15 @@ func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 			{"userB", "5b33586b-7a90-45a4-94f8-f396dcd45261"},
 			{"userB", "dd742448-09ea-4cc1-adb8-f00bba75c520"},
 		} {
-			err := r.CreateCart(ctx, c.userID, c.id, nil)
+			err := r.CreateCart(ctx, c.userID, c.id, model.DefaultCurrency, nil)
 			s.Require().NoError(err)
 		}
 		carts, err := r.FindAllUnlockedCartsOfUser(ctx, "userA")
 		s.NoError(err)
 		s.ElementsMatch([]*model.Cart{
-			{ID: "158d7eb1-c82f-46fc-9075-bfa3f545d2fd", Positions: []model.Position{}},
-			{ID: "bc8b368b-b412-4087-995d-b199e5dffb8c", Positions: []model.Position{}},
-			{ID: "bf9350a2-8a34-4ae3-8672-590cf740b19d", Positions: []model.Position{}},
+			{ID: "158d7eb1-c82f-46fc-9075-bfa3f545d2fd", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "bc8b368b-b412-4087-995d-b199e5dffb8c", Currency: model.DefaultCurrency, Positions: []model.Position{}},
+			{ID: "bf9350a2-8a34-4ae3-8672-590cf740b19d", Currency: model.DefaultCurrency, Positions: []model.Position{}},
 		}, carts)
 	})
 	s.Run("does not mix up positions", func() {
@@ -361,7 +380,7 @@ func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 			{"id2", "product2", 2},
 			{"id3", "product3", 3},
 		} {
-			err := r.CreateCart(ctx, "user", c.id, map[string]int{
+			err := r.CreateCart(ctx, "user", c.id, model.DefaultCurrency, map[string]int{
 				c.productID: c.quantity,
 			})
 			s.Require().NoError(err)
@@ -369,9 +388,9 @@ func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 		carts, err := r.FindAllUnlockedCartsOfUser(ctx, "user")
 		s.NoError(err)
 		s.ElementsMatch([]*model.Cart{
-			{ID: "id1", Positions: []model.Position{{ProductID: "product1", Quantity: 1}}},
-			{ID: "id2", Positions: []model.Position{{ProductID: "product2", Quantity: 2}}},
-			{ID: "id3", Positions: []model.Position{{ProductID: "product3", Quantity: 3}}},
+			{ID: "id1", Currency: model.DefaultCurrency, Positions: []model.Position{{ProductID: "product1", Quantity: 1}}},
+			{ID: "id2", Currency: model.DefaultCurrency, Positions: []model.Position{{ProductID: "product2", Quantity: 2}}},
+			{ID: "id3", Currency: model.DefaultCurrency, Positions: []model.Position{{ProductID: "product3", Quantity: 3}}},
 		}, carts)
 	})
 	s.Run("works concurrently", func() {
@@ -391,7 +410,7 @@ func (s *CartRepositoryTestSuite) TestFindAllUnlockedCartsOfUser() {
 		do := func(cases []singleCase) {
 			defer wg.Done()
 			for _, c := range cases {
-				err := r.CreateCart(ctx, c.userID, c.id, nil)
+				err := r.CreateCart(ctx, c.userID, c.id, model.DefaultCurrency, nil)
 				s.Require().NoError(err)
 			}
 			for _, c := range cases {
@@ -413,6 +432,7 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 		err := r.CreateCart(ctx,
 			"user",
 			"id",
+			model.DefaultCurrency,
 			map[string]int{
 				"49dd8502-2d5a-4c71-ac50-e0affcba22c2": 1,
 				"f99a9ea1-8c0f-4e86-b778-18b2537f6234": 999,
@@ -427,12 +447,13 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 		}, cart.Positions)
 		cart.Positions = nil
 		s.Equal(&model.Cart{
-			ID: "id",
+			ID:       "id",
+			Currency: model.DefaultCurrency,
 		}, cart)
 	})
 	s.Run("user is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		cart, err := r.FindCartOfUser(ctx, "USER", "id")
 		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
@@ -440,7 +461,7 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 	})
 	s.Run("id is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		cart, err := r.FindCartOfUser(ctx, "user", "ID")
 		s.True(errors.Is(err, persistence.ErrNotFound))
@@ -460,7 +481,7 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 		do := func(ids []string) {
 			defer wg.Done()
 			for _, id := range ids {
-				err := r.CreateCart(ctx, "user", id, nil)
+				err := r.CreateCart(ctx, "user", id, model.DefaultCurrency, nil)
 				s.Require().NoError(err)
 			}
 			for _, id := range ids {
@@ -478,6 +499,7 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 		err := r.CreateCart(ctx,
 			"user",
 			"id",
+			model.DefaultCurrency,
 			map[string]int{
 				"04d2c9a8-068d-40ac-acd7-7bf3f5357953": 2,
 			}, // positions
@@ -486,7 +508,8 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 		cart, err := r.FindCartOfUser(ctx, "user", "id")
 		s.Require().NoError(err)
 		s.Require().Equal(&model.Cart{
-			ID: "id",
+			ID:       "id",
+			Currency: model.DefaultCurrency,
 			Positions: []model.Position{
 				{ProductID: "04d2c9a8-068d-40ac-acd7-7bf3f5357953", Quantity: 2},
 			},
@@ -500,7 +523,8 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 		cart, err = r.FindCartOfUser(ctx, "user", "id")
 		s.NoError(err)
 		s.Equal(&model.Cart{
-			ID: "id",
+			ID:       "id",
+			Currency: model.DefaultCurrency,
 			Positions: []model.Position{
 				{ProductID: "04d2c9a8-068d-40ac-acd7-7bf3f5357953", Quantity: 2},
 			},
@@ -512,7 +536,7 @@ func (s *CartRepositoryTestSuite) TestFindCartOfUser() {
 func (s *CartRepositoryTestSuite) TestDeleteCartOfUser() {
 	s.Run("deletes a cart", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		err = r.DeleteCartOfUser(ctx, "user", "id")
 		s.Require().NoError(err)
@@ -527,11 +551,11 @@ func (s *CartRepositoryTestSuite) TestDeleteCartOfUser() {
 			s.Empty(carts)
 		})
 		s.Run("prevents re-creating it", func() {
-			err := r.CreateCart(ctx, "user", "id", nil)
+			err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 			s.True(errors.Is(err, persistence.ErrConflict))
 		})
 		s.Run("prevents updating it", func() {
-			err := r.UpdateCartOfUser(ctx, "user", "id", nil)
+			err := r.UpdateCartOfUser(ctx, "user", "id", model.DefaultCurrency, nil)
 			s.True(errors.Is(err, persistence.ErrDeleted))
 		})
 		s.Run("prevents locking it", func() {
@@ -541,14 +565,14 @@ func (s *CartRepositoryTestSuite) TestDeleteCartOfUser() {
 	})
 	s.Run("user is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		err = r.DeleteCartOfUser(ctx, "USER", "id")
 		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
 	})
 	s.Run("id is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		err = r.DeleteCartOfUser(ctx, "user", "ID")
 		s.True(errors.Is(err, persistence.ErrNotFound))
@@ -567,7 +591,7 @@ func (s *CartRepositoryTestSuite) TestDeleteCartOfUser() {
 		do := func(ids []string) {
 			defer wg.Done()
 			for _, id := range ids {
-				err := r.CreateCart(ctx, "user", id, nil)
+				err := r.CreateCart(ctx, "user", id, model.DefaultCurrency, nil)
 				s.Require().NoError(err)
 			}
 			for _, id := range ids {
@@ -586,7 +610,7 @@ func (s *CartRepositoryTestSuite) TestDeleteCartOfUser() {
 func (s *CartRepositoryTestSuite) TestLockCartOfUser() {
 	s.Run("locks a cart", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		err = r.LockCartOfUser(ctx, "user", "id")
 		s.Require().NoError(err)
@@ -608,24 +632,24 @@ func (s *CartRepositoryTestSuite) TestLockCartOfUser() {
 			s.Empty(carts)
 		})
 		s.Run("prevents re-creating it", func() {
-			err := r.CreateCart(ctx, "user", "id", nil)
+			err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 			s.True(errors.Is(err, persistence.ErrConflict))
 		})
 		s.Run("prevents updating it", func() {
-			err := r.UpdateCartOfUser(ctx, "user", "id", nil)
+			err := r.UpdateCartOfUser(ctx, "user", "id", model.DefaultCurrency, nil)
 			s.True(errors.Is(err, persistence.ErrLocked))
 		})
 	})
 	s.Run("user is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		err = r.LockCartOfUser(ctx, "USER", "id")
 		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
 	})
 	s.Run("id is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateCart(ctx, "user", "id", nil)
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
 		s.Require().NoError(err)
 		err = r.LockCartOfUser(ctx, "user", "ID")
 		s.True(errors.Is(err, persistence.ErrNotFound))
@@ -644,7 +668,7 @@ func (s *CartRepositoryTestSuite) TestLockCartOfUser() {
 		do := func(ids []string) {
 			defer wg.Done()
 			for _, id := range ids {
-				err := r.CreateCart(ctx, "user", id, nil)
+				err := r.CreateCart(ctx, "user", id, model.DefaultCurrency, nil)
 				s.Require().NoError(err)
 			}
 			for _, id := range ids {
@@ -658,3 +682,116 @@ func (s *CartRepositoryTestSuite) TestLockCartOfUser() {
 		wg.Wait()
 	})
 }
+
+// TestUnlockCartOfUser tests unlocking a cart of a user.
+func (s *CartRepositoryTestSuite) TestUnlockCartOfUser() {
+	s.Run("unlocks a locked cart", func() {
+		r := s.NewRepository()
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, map[string]int{"product": 1})
+		s.Require().NoError(err)
+		err = r.LockCartOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		err = r.UnlockCartOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		s.Run("and accessing it returns the unlocked state", func() {
+			cart, err := r.FindCartOfUser(ctx, "user", "id")
+			s.NoError(err)
+			s.False(cart.Locked)
+			s.Len(cart.Positions, 1)
+		})
+		s.Run("allows updating it", func() {
+			err := r.UpdateCartOfUser(ctx, "user", "id", model.DefaultCurrency, nil)
+			s.NoError(err)
+		})
+		s.Run("allows locking it again", func() {
+			err := r.LockCartOfUser(ctx, "user", "id")
+			s.NoError(err)
+		})
+	})
+	s.Run("unlocking an unlocked cart has no effect", func() {
+		r := s.NewRepository()
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
+		s.Require().NoError(err)
+		err = r.UnlockCartOfUser(ctx, "user", "id")
+		s.NoError(err)
+		cart, err := r.FindCartOfUser(ctx, "user", "id")
+		s.NoError(err)
+		s.False(cart.Locked)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.UnlockCartOfUser(ctx, "user", "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("deleted", func() {
+		r := s.NewRepository()
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
+		s.Require().NoError(err)
+		err = r.DeleteCartOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		err = r.UnlockCartOfUser(ctx, "user", "id")
+		s.True(errors.Is(err, persistence.ErrDeleted))
+	})
+	s.Run("user is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
+		s.Require().NoError(err)
+		err = r.LockCartOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		err = r.UnlockCartOfUser(ctx, "USER", "id")
+		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
+	})
+	s.Run("id is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.CreateCart(ctx, "user", "id", model.DefaultCurrency, nil)
+		s.Require().NoError(err)
+		err = r.UnlockCartOfUser(ctx, "user", "ID")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
+
+// TestTransferCartsOfUser tests transferring the carts of a user to another.
+func (s *CartRepositoryTestSuite) TestTransferCartsOfUser() {
+	s.Run("transfers unlocked carts", func() {
+		r := s.NewRepository()
+		for _, c := range []struct{ userID, id string }{
+			{"guest", "cart 1"},
+			{"guest", "cart 2"},
+			{"guest", "locked"},
+			{"guest", "deleted"},
+			{"other", "cart 3"},
+		} {
+			err := r.CreateCart(ctx, c.userID, c.id, model.DefaultCurrency, map[string]int{"product": 1})
+			s.Require().NoError(err)
+		}
+		s.Require().NoError(r.LockCartOfUser(ctx, "guest", "locked"))
+		s.Require().NoError(r.DeleteCartOfUser(ctx, "guest", "deleted"))
+
+		err := r.TransferCartsOfUser(ctx, "guest", "user")
+		s.NoError(err)
+
+		carts, err := r.FindAllUnlockedCartsOfUser(ctx, "user")
+		s.NoError(err)
+		ids := make([]string, len(carts))
+		for i, cart := range carts {
+			ids[i] = cart.ID
+		}
+		s.ElementsMatch([]string{"cart 1", "cart 2"}, ids)
+		cart, err := r.FindCartOfUser(ctx, "user", "cart 1")
+		s.NoError(err)
+		s.Equal([]model.Position{{ProductID: "product", Quantity: 1}}, cart.Positions)
+		_, err = r.FindCartOfUser(ctx, "guest", "cart 1")
+		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
+		// locked carts stay
+		_, err = r.FindCartOfUser(ctx, "guest", "locked")
+		s.NoError(err)
+		// carts of other users are not affected
+		_, err = r.FindCartOfUser(ctx, "other", "cart 3")
+		s.NoError(err)
+	})
+	s.Run("user without carts", func() {
+		r := s.NewRepository()
+		err := r.TransferCartsOfUser(ctx, "guest", "user")
+		s.NoError(err)
+	})
+}
@@ -2,6 +2,7 @@ package testsuite
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -27,18 +28,17 @@ func (s *CouponRepositoryTestSuite) RunSuite(t *testing.T) {
 func (s *CouponRepositoryTestSuite) TestStoreCoupon() {
 	s.Run("one", func() {
 		r := s.NewRepository()
-		err := r.StoreCoupon(ctx,
-			"ORANGE30",                             // code
-			"30% off oranges",                      // name
-			"0061f256-d4b8-4dd3-85e3-aaaa88a050d2", // product id
-			30,                                     // discount
-			time.Now().Add(time.Hour),              // expires at
-		)
+		err := r.StoreCoupon(ctx, "ORANGE30", persistence.CouponAttributes{
+			Name:      "30% off oranges",
+			ProductID: "0061f256-d4b8-4dd3-85e3-aaaa88a050d2",
+			Discount:  30,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
 		s.NoError(err)
 	})
 	s.Run("with empty everything", func() {
 		r := s.NewRepository()
-		err := r.StoreCoupon(ctx, "", "", "", 0, time.Time{})
+		err := r.StoreCoupon(ctx, "", persistence.CouponAttributes{})
 		s.NoError(err)
 	})
 	s.Run("many", func() {
@@ -55,21 +55,41 @@ func (s *CouponRepositoryTestSuite) TestStoreCoupon() {
 			{"0CBAF5D3", "name 55", "39f70198-359d-4e51-beb4-d023ec1e8809", 55},
 			{"9D338E6C", "name 56", "2a9f0d57-65f1-4cbf-8381-51f63fbc7ef5", 56},
 		} {
-			err := r.StoreCoupon(ctx, c.code, c.name, c.productID, c.discount, time.Now().Add(time.Minute))
+			err := r.StoreCoupon(ctx, c.code, persistence.CouponAttributes{
+				Name:      c.name,
+				ProductID: c.productID,
+				Discount:  c.discount,
+				ExpiresAt: time.Now().Add(time.Minute),
+			})
 			s.Require().NoError(err)
 		}
 	})
 	s.Run("no conflict", func() {
 		r := s.NewRepository()
 		t := time.Now()
-		err := r.StoreCoupon(ctx, "code", "name", "product", 42, t)
+		err := r.StoreCoupon(ctx, "code", persistence.CouponAttributes{
+			Name:      "name",
+			ProductID: "product",
+			Discount:  42,
+			ExpiresAt: t,
+		})
 		s.Require().NoError(err)
-		err = r.StoreCoupon(ctx, "code", "name", "product", 42, t)
+		err = r.StoreCoupon(ctx, "code", persistence.CouponAttributes{
+			Name:      "name",
+			ProductID: "product",
+			Discount:  42,
+			ExpiresAt: t,
+		})
 		s.NoError(err)
 	})
 	s.Run("supports more complex strings", func() {
 		r := s.NewRepository()
-		err := r.StoreCoupon(ctx, "औकखग", "\u0000\t\"abc", "‽ⓐ◐\n👽 乐乑", -1337, time.Now())
+		err := r.StoreCoupon(ctx, "औकखग", persistence.CouponAttributes{
+			Name:      "\u0000\t\"abc",
+			ProductID: "‽ⓐ◐\n👽 乐乑",
+			Discount:  -1337,
+			ExpiresAt: time.Now(),
+		})
 		s.NoError(err)
 	})
 	s.Run("works concurrently", func() {
@@ -90,7 +110,12 @@ func (s *CouponRepositoryTestSuite) TestStoreCoupon() {
 		do := func(cases []singleCase) {
 			defer wg.Done()
 			for _, c := range cases {
-				err := r.StoreCoupon(ctx, c.code, c.name, c.productID, c.discount, time.Now().Add(time.Hour))
+				err := r.StoreCoupon(ctx, c.code, persistence.CouponAttributes{
+					Name:      c.name,
+					ProductID: c.productID,
+					Discount:  c.discount,
+					ExpiresAt: time.Now().Add(time.Hour),
+				})
 				s.Require().NoError(err)
 			}
 		}
@@ -106,7 +131,12 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 	s.Run("finds coupon", func() {
 		r := s.NewRepository()
 		t := time.Now().Add(time.Minute)
-		err := r.StoreCoupon(ctx, "11D10425", "北京市", "d933396f-20a3-46c6-a4f6-bf6b2ad4fec9", 42, t)
+		err := r.StoreCoupon(ctx, "11D10425", persistence.CouponAttributes{
+			Name:      "北京市",
+			ProductID: "d933396f-20a3-46c6-a4f6-bf6b2ad4fec9",
+			Discount:  42,
+			ExpiresAt: t,
+		})
 		s.Require().NoError(err)
 		coupon, err := r.FindValidCoupon(ctx, "11D10425")
 		s.NoError(err)
@@ -121,7 +151,12 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 	})
 	s.Run("does not find expired coupon", func() {
 		r := s.NewRepository()
-		err := r.StoreCoupon(ctx, "9e539b7f", "name", "6a1dc32a-c626-4739-8d85-30c5144b3315", 1, time.Now())
+		err := r.StoreCoupon(ctx, "9e539b7f", persistence.CouponAttributes{
+			Name:      "name",
+			ProductID: "6a1dc32a-c626-4739-8d85-30c5144b3315",
+			Discount:  1,
+			ExpiresAt: time.Now(),
+		})
 		s.Require().NoError(err)
 		coupon, err := r.FindValidCoupon(ctx, "9e539b7f")
 		s.True(errors.Is(err, persistence.ErrNotFound))
@@ -142,7 +177,12 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 			{"d4a89757", "name 134", "81c22a54-9434-426e-8158-f8c1bba3bfeb", 134},
 			{"3ba909d6", "name 135", "d83025eb-7ab2-467d-826e-69c175c47414", 135},
 		} {
-			err := r.StoreCoupon(ctx, c.code, c.name, c.productID, c.discount, t)
+			err := r.StoreCoupon(ctx, c.code, persistence.CouponAttributes{
+				Name:      c.name,
+				ProductID: c.productID,
+				Discount:  c.discount,
+				ExpiresAt: t,
+			})
 			s.Require().NoError(err)
 		}
 		coupon, err := r.FindValidCoupon(ctx, "2cf878cf")
@@ -167,7 +207,12 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 			{"631768F8", "name 159", "d58ac65d-ba44-4d3a-848a-1a8012b84b35", 159, time.Now().Add(159 * time.Second)},
 			{"6E28465C", "name 160", "deab8615-d163-4093-8980-1e89ccd7dde5", 160, time.Now().Add(160 * time.Second)},
 		} {
-			err := r.StoreCoupon(ctx, c.code, c.name, c.productID, c.discount, c.expiresAt)
+			err := r.StoreCoupon(ctx, c.code, persistence.CouponAttributes{
+				Name:      c.name,
+				ProductID: c.productID,
+				Discount:  c.discount,
+				ExpiresAt: c.expiresAt,
+			})
 			s.Require().NoError(err)
 		}
 		coupon, err := r.FindValidCoupon(ctx, "49252F6B")
@@ -185,7 +230,12 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 			{"name 177", "bbdad944-ee78-4833-bacd-dbdac9574b6f", 177},
 			{"name 178", "e80bb51e-175b-4560-81a8-7f4a404baf09", 178},
 		} {
-			err := r.StoreCoupon(ctx, "ED2BBF84", c.name, c.productID, c.discount, t)
+			err := r.StoreCoupon(ctx, "ED2BBF84", persistence.CouponAttributes{
+				Name:      c.name,
+				ProductID: c.productID,
+				Discount:  c.discount,
+				ExpiresAt: t,
+			})
 			s.Require().NoError(err)
 		}
 		coupon, err := r.FindValidCoupon(ctx, "ED2BBF84")
@@ -218,7 +268,12 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 		do := func(cases []singleCase) {
 			defer wg.Done()
 			for _, c := range cases {
-				err := r.StoreCoupon(ctx, c.id, c.name, c.productID, c.discount, c.expiresAt)
+				err := r.StoreCoupon(ctx, c.id, persistence.CouponAttributes{
+					Name:      c.name,
+					ProductID: c.productID,
+					Discount:  c.discount,
+					ExpiresAt: c.expiresAt,
+				})
 				s.Require().NoError(err)
 			}
 			for _, c := range cases {
@@ -234,7 +289,12 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 	s.Run("changing the result does not have any side effects", func() {
 		r := s.NewRepository()
 		t := time.Now().Add(time.Hour)
-		err := r.StoreCoupon(ctx, "51D11123", "北京市", "7839c105-add5-443b-9018-f6bc73136195", 1337, t)
+		err := r.StoreCoupon(ctx, "51D11123", persistence.CouponAttributes{
+			Name:      "北京市",
+			ProductID: "7839c105-add5-443b-9018-f6bc73136195",
+			Discount:  1337,
+			ExpiresAt: t,
+		})
 		s.Require().NoError(err)
 		coupon, err := r.FindValidCoupon(ctx, "51D11123")
 		s.Require().NoError(err)
@@ -243,7 +303,7 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 			Name:      "北京市",
 			ProductID: "7839c105-add5-443b-9018-f6bc73136195",
 			Discount:  1337,
-			ExpiresAt: t,
+			ExpiresAt: persistence.Timestamp(t),
 		}, coupon)
 		// changing the result ...
 		coupon.Code = "changed"
@@ -259,7 +319,449 @@ func (s *CouponRepositoryTestSuite) TestFindValidCoupon() {
 			Name:      "北京市",
 			ProductID: "7839c105-add5-443b-9018-f6bc73136195",
 			Discount:  1337,
+			ExpiresAt: persistence.Timestamp(t),
+		}, coupon)
+	})
+}
+
+// TestFindCoupon tests finding a coupon regardless of its expiry.
+func (s *CouponRepositoryTestSuite) TestFindCoupon() {
+	s.Run("finds expired coupon", func() {
+		r := s.NewRepository()
+		t := time.Now().Add(-time.Minute)
+		err := r.StoreCoupon(ctx, "E1F3A0B2", persistence.CouponAttributes{
+			Name:      "expired",
+			ProductID: "7f1c8b0e-1d1a-4b5e-9b0e-4c2f1f0e3a11",
+			Discount:  10,
 			ExpiresAt: t,
+		})
+		s.Require().NoError(err)
+		coupon, err := r.FindCoupon(ctx, "E1F3A0B2")
+		s.NoError(err)
+		s.Equal(&model.Coupon{
+			Code:      "E1F3A0B2",
+			Name:      "expired",
+			ProductID: "7f1c8b0e-1d1a-4b5e-9b0e-4c2f1f0e3a11",
+			Discount:  10,
+			ExpiresAt: persistence.Timestamp(t),
+		}, coupon)
+	})
+	s.Run("does not find other coupon", func() {
+		r := s.NewRepository()
+		err := r.StoreCoupon(ctx, "A7E2B1C9", persistence.CouponAttributes{
+			Name:      "name",
+			ProductID: "3c5e0a2b-8f1d-4e7a-b6c3-2d9f4a1e0b57",
+			Discount:  10,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		s.Require().NoError(err)
+		coupon, err := r.FindCoupon(ctx, "B8F3C2DA")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(coupon)
+	})
+}
+
+// TestFindCouponsOfProduct tests listing the coupons of a product.
+func (s *CouponRepositoryTestSuite) TestFindCouponsOfProduct() {
+	s.Run("finds active and expired coupons ordered by code", func() {
+		r := s.NewRepository()
+		productID := "a1e4c7d0-2b5f-4e8a-9c3d-6f0b1a4e7c2d"
+		for _, c := range []struct {
+			code, productID string
+			expiresAt       time.Time
+		}{
+			{"c0upon03", productID, time.Now().Add(time.Hour)},
+			{"c0upon01", productID, time.Now().Add(-time.Hour)},
+			{"c0upon02", "b2f5d8e1-3c6a-4f9b-8d4e-7a1c2b5f8d3e", time.Now().Add(time.Hour)},
+			{"c0upon04", productID, time.Now().Add(time.Hour)},
+		} {
+			err := r.StoreCoupon(ctx, c.code, persistence.CouponAttributes{
+				Name:      "name",
+				ProductID: c.productID,
+				Discount:  10,
+				ExpiresAt: c.expiresAt,
+			})
+			s.Require().NoError(err)
+		}
+		coupons, err := r.FindCouponsOfProduct(ctx, productID)
+		s.NoError(err)
+		var codes []string
+		for _, coupon := range coupons {
+			s.Equal(productID, coupon.ProductID)
+			codes = append(codes, coupon.Code)
+		}
+		s.Equal([]string{"c0upon01", "c0upon03", "c0upon04"}, codes)
+	})
+	s.Run("finds nothing", func() {
+		r := s.NewRepository()
+		coupons, err := r.FindCouponsOfProduct(ctx, "c3a6e9f2-4d7b-4a0c-9e5f-8b2d3c6a9e4f")
+		s.NoError(err)
+		s.Empty(coupons)
+	})
+}
+
+// TestDeleteCoupon tests deleting coupons.
+func (s *CouponRepositoryTestSuite) TestDeleteCoupon() {
+	s.Run("deletes coupon", func() {
+		r := s.NewRepository()
+		err := r.StoreCoupon(ctx, "D3L3T3M3", persistence.CouponAttributes{
+			Name:      "name",
+			ProductID: "d4b7f0a3-5e8c-4b1d-8f6a-9c3e4d7b0f5a",
+			Discount:  10,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		s.Require().NoError(err)
+		s.NoError(r.DeleteCoupon(ctx, "D3L3T3M3"))
+		_, err = r.FindCoupon(ctx, "D3L3T3M3")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		err = r.DeleteCoupon(ctx, "D3L3T3M3")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.DeleteCoupon(ctx, "N0TF0UND")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
+
+// TestCreateCoupon tests creating coupons without overwriting.
+func (s *CouponRepositoryTestSuite) TestCreateCoupon() {
+	s.Run("creates coupon", func() {
+		r := s.NewRepository()
+		err := r.CreateCoupon(ctx, "CR3AT301", persistence.CouponAttributes{
+			Name:      "name",
+			Discount:  10,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		s.Require().NoError(err)
+		coupon, err := r.FindValidCoupon(ctx, "CR3AT301")
+		s.NoError(err)
+		s.Equal("name", coupon.Name)
+		s.Equal(10, coupon.Discount)
+	})
+	s.Run("conflict", func() {
+		r := s.NewRepository()
+		err := r.StoreCoupon(ctx, "CR3AT302", persistence.CouponAttributes{Name: "first", Discount: 10})
+		s.Require().NoError(err)
+		err = r.CreateCoupon(ctx, "CR3AT302", persistence.CouponAttributes{Name: "second", Discount: 20})
+		s.True(errors.Is(err, persistence.ErrConflict))
+		coupon, err := r.FindCoupon(ctx, "CR3AT302")
+		s.NoError(err)
+		s.Equal("first", coupon.Name)
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		var mx sync.Mutex
+		var created int
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := r.CreateCoupon(ctx, "CR3AT303", persistence.CouponAttributes{Discount: 10})
+				if errors.Is(err, persistence.ErrConflict) {
+					return
+				}
+				s.NoError(err)
+				mx.Lock()
+				created++
+				mx.Unlock()
+			}()
+		}
+		wg.Wait()
+		s.Equal(1, created)
+	})
+}
+
+// TestFindAllCoupons tests listing all coupons.
+func (s *CouponRepositoryTestSuite) TestCreateCoupons() {
+	s.Run("creates coupons", func() {
+		r := s.NewRepository()
+		expiresAt := time.Now().Add(time.Hour)
+		err := r.CreateCoupons(ctx, []string{"CR3AT3S1", "CR3AT3S2"}, persistence.CouponAttributes{
+			Name:      "name",
+			Discount:  10,
+			ExpiresAt: expiresAt,
+		})
+		s.Require().NoError(err)
+		for _, code := range []string{"CR3AT3S1", "CR3AT3S2"} {
+			coupon, err := r.FindValidCoupon(ctx, code)
+			s.NoError(err)
+			s.Equal("name", coupon.Name)
+			s.Equal(10, coupon.Discount)
+			s.Equal(persistence.Timestamp(expiresAt), coupon.ExpiresAt)
+		}
+	})
+	s.Run("conflict creates none", func() {
+		r := s.NewRepository()
+		for _, code := range []string{"CR3AT3S4", "CR3AT3S6"} {
+			err := r.StoreCoupon(ctx, code, persistence.CouponAttributes{Name: "first", Discount: 10})
+			s.Require().NoError(err)
+		}
+		err := r.CreateCoupons(ctx, []string{"CR3AT3S3", "CR3AT3S4", "CR3AT3S5", "CR3AT3S6"},
+			persistence.CouponAttributes{Name: "second", Discount: 20})
+		s.True(errors.Is(err, persistence.ErrConflict))
+		var conflict *persistence.CouponConflictError
+		s.Require().True(errors.As(err, &conflict))
+		s.Equal([]string{"CR3AT3S4", "CR3AT3S6"}, conflict.Codes)
+		for _, code := range []string{"CR3AT3S3", "CR3AT3S5"} {
+			_, err := r.FindCoupon(ctx, code)
+			s.True(errors.Is(err, persistence.ErrNotFound))
+		}
+		coupon, err := r.FindCoupon(ctx, "CR3AT3S4")
+		s.NoError(err)
+		s.Equal("first", coupon.Name)
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		var mx sync.Mutex
+		var created int
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := r.CreateCoupons(ctx, []string{"CR3AT3S7", "CR3AT3S8"}, persistence.CouponAttributes{Discount: 10})
+				if errors.Is(err, persistence.ErrConflict) {
+					return
+				}
+				s.NoError(err)
+				mx.Lock()
+				created++
+				mx.Unlock()
+			}()
+		}
+		wg.Wait()
+		s.Equal(1, created)
+	})
+}
+
+func (s *CouponRepositoryTestSuite) TestFindAllCoupons() {
+	s.Run("finds all coupons ordered by code", func() {
+		r := s.NewRepository()
+		for _, c := range []struct {
+			code, productID string
+			expiresAt       time.Time
+		}{
+			{"a11c0up03", "", time.Now().Add(time.Hour)},
+			{"a11c0up01", "e2a5c8f1-4b7d-4e0a-8c3f-6d9b2e5a8c1f", time.Now().Add(-time.Hour)},
+			{"a11c0up02", "f3b6d9a2-5c8e-4f1b-9d4a-7e0c3f6b9d2a", time.Now().Add(time.Hour)},
+		} {
+			err := r.StoreCoupon(ctx, c.code, persistence.CouponAttributes{
+				ProductID: c.productID,
+				Discount:  10,
+				ExpiresAt: c.expiresAt,
+			})
+			s.Require().NoError(err)
+		}
+		coupons, err := r.FindAllCoupons(ctx)
+		s.NoError(err)
+		var codes []string
+		for _, coupon := range coupons {
+			codes = append(codes, coupon.Code)
+		}
+		s.Equal([]string{"a11c0up01", "a11c0up02", "a11c0up03"}, codes)
+	})
+	s.Run("finds nothing", func() {
+		r := s.NewRepository()
+		coupons, err := r.FindAllCoupons(ctx)
+		s.NoError(err)
+		s.Empty(coupons)
+	})
+}
+
+// TestCouponAttributes tests storing and finding all attributes of coupons.
+func (s *CouponRepositoryTestSuite) TestCouponAttributes() {
+	s.Run("stores all attributes", func() {
+		r := s.NewRepository()
+		notBefore := time.Now().Add(-time.Hour)
+		expiresAt := time.Now().Add(time.Hour)
+		err := r.StoreCoupon(ctx, "FIVEOFF", persistence.CouponAttributes{
+			Name:                  "5 € off",
+			Amount:                500,
+			MinSubtotal:           2000,
+			MaxRedemptions:        100,
+			MaxRedemptionsPerUser: 1,
+			NotBefore:             notBefore,
+			ExpiresAt:             expiresAt,
+		})
+		s.Require().NoError(err)
+		coupon, err := r.FindValidCoupon(ctx, "FIVEOFF")
+		s.Require().NoError(err)
+		s.Equal(&model.Coupon{
+			Code:                  "FIVEOFF",
+			Name:                  "5 € off",
+			Amount:                500,
+			MinSubtotal:           2000,
+			MaxRedemptions:        100,
+			MaxRedemptionsPerUser: 1,
+			NotBefore:             persistence.Timestamp(notBefore),
+			ExpiresAt:             persistence.Timestamp(expiresAt),
 		}, coupon)
 	})
+	s.Run("does not find coupon that has not started", func() {
+		r := s.NewRepository()
+		err := r.StoreCoupon(ctx, "L4T3R", persistence.CouponAttributes{
+			Discount:  10,
+			NotBefore: time.Now().Add(time.Minute),
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		s.Require().NoError(err)
+		_, err = r.FindValidCoupon(ctx, "L4T3R")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		_, err = r.FindCoupon(ctx, "L4T3R")
+		s.NoError(err)
+	})
+	s.Run("finds cart-wide coupons", func() {
+		r := s.NewRepository()
+		for _, c := range []struct{ code, productID string }{
+			{"CART02", ""},
+			{"PRODUCT01", "a8c1e4f7-0b3d-4e6a-9f2c-5d8b1e4a7c0f"},
+			{"CART01", ""},
+		} {
+			err := r.StoreCoupon(ctx, c.code, persistence.CouponAttributes{
+				ProductID: c.productID,
+				Discount:  10,
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			s.Require().NoError(err)
+		}
+		coupons, err := r.FindCouponsOfProduct(ctx, "")
+		s.NoError(err)
+		var codes []string
+		for _, coupon := range coupons {
+			s.True(coupon.CartWide())
+			codes = append(codes, coupon.Code)
+		}
+		s.Equal([]string{"CART01", "CART02"}, codes)
+	})
+}
+
+// TestRedeemCoupons tests the redemption ledger of coupons.
+func (s *CouponRepositoryTestSuite) TestRedeemCoupons() {
+	store := func(r persistence.CouponRepository, code string, maxRedemptions, maxRedemptionsPerUser int) {
+		err := r.StoreCoupon(ctx, code, persistence.CouponAttributes{
+			Discount:              10,
+			MaxRedemptions:        maxRedemptions,
+			MaxRedemptionsPerUser: maxRedemptionsPerUser,
+			ExpiresAt:             time.Now().Add(time.Hour),
+		})
+		s.Require().NoError(err)
+	}
+	redemptions := func(r persistence.CouponRepository, code string) int {
+		coupon, err := r.FindCoupon(ctx, code)
+		s.Require().NoError(err)
+		return coupon.Redemptions
+	}
+	s.Run("counts redemptions", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M01", 0, 0)
+		store(r, "R3D33M02", 0, 0)
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M01", "R3D33M02"}))
+		s.Require().NoError(r.RedeemCoupons(ctx, "order2", "user1", []string{"R3D33M01"}))
+		s.Require().NoError(r.RedeemCoupons(ctx, "order3", "user2", []string{"R3D33M01"}))
+		s.Equal(3, redemptions(r, "R3D33M01"))
+		s.Equal(1, redemptions(r, "R3D33M02"))
+		count, err := r.CountCouponRedemptionsOfUser(ctx, "R3D33M01", "user1")
+		s.NoError(err)
+		s.Equal(2, count)
+		count, err = r.CountCouponRedemptionsOfUser(ctx, "R3D33M02", "user2")
+		s.NoError(err)
+		s.Equal(0, count)
+	})
+	s.Run("keeps redemptions when stored again", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M03", 0, 0)
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M03"}))
+		err := r.StoreCoupon(ctx, "R3D33M03", persistence.CouponAttributes{
+			Name:      "new name",
+			Discount:  20,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		s.Require().NoError(err)
+		coupon, err := r.FindCoupon(ctx, "R3D33M03")
+		s.NoError(err)
+		s.Equal("new name", coupon.Name)
+		s.Equal(1, coupon.Redemptions)
+	})
+	s.Run("replaces redemptions of the same order", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M04", 0, 0)
+		store(r, "R3D33M05", 0, 0)
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M04"}))
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M05"}))
+		s.Equal(0, redemptions(r, "R3D33M04"))
+		s.Equal(1, redemptions(r, "R3D33M05"))
+	})
+	s.Run("releases redemptions", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M06", 1, 0)
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M06"}))
+		s.Require().NoError(r.ReleaseCouponRedemptions(ctx, "order1"))
+		s.Equal(0, redemptions(r, "R3D33M06"))
+		s.NoError(r.ReleaseCouponRedemptions(ctx, "order1"))
+		s.NoError(r.RedeemCoupons(ctx, "order2", "user1", []string{"R3D33M06"}))
+	})
+	s.Run("enforces maximum redemptions", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M07", 2, 0)
+		store(r, "R3D33M08", 0, 0)
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M07"}))
+		s.Require().NoError(r.RedeemCoupons(ctx, "order2", "user2", []string{"R3D33M07"}))
+		err := r.RedeemCoupons(ctx, "order3", "user3", []string{"R3D33M08", "R3D33M07"})
+		s.True(errors.Is(err, persistence.ErrLimitReached))
+		// none are redeemed
+		s.Equal(0, redemptions(r, "R3D33M08"))
+		s.Equal(2, redemptions(r, "R3D33M07"))
+		// redeeming again for the same order does not count twice
+		s.NoError(r.RedeemCoupons(ctx, "order2", "user2", []string{"R3D33M07"}))
+	})
+	s.Run("enforces maximum redemptions per user", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M09", 0, 1)
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M09"}))
+		err := r.RedeemCoupons(ctx, "order2", "user1", []string{"R3D33M09"})
+		s.True(errors.Is(err, persistence.ErrLimitReached))
+		s.NoError(r.RedeemCoupons(ctx, "order3", "user2", []string{"R3D33M09"}))
+	})
+	s.Run("deletes redemptions with the coupon", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M10", 0, 1)
+		s.Require().NoError(r.RedeemCoupons(ctx, "order1", "user1", []string{"R3D33M10"}))
+		s.Require().NoError(r.DeleteCoupon(ctx, "R3D33M10"))
+		store(r, "R3D33M10", 0, 1)
+		s.Equal(0, redemptions(r, "R3D33M10"))
+		s.NoError(r.RedeemCoupons(ctx, "order2", "user1", []string{"R3D33M10"}))
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.RedeemCoupons(ctx, "order1", "user1", []string{"N0TF0UND"})
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		store(r, "R3D33M11", 15, 0)
+		var wg sync.WaitGroup
+		var mx sync.Mutex
+		var limited int
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					err := r.RedeemCoupons(ctx, fmt.Sprintf("order%d-%d", i, j), "user1", []string{"R3D33M11"})
+					if errors.Is(err, persistence.ErrLimitReached) {
+						mx.Lock()
+						limited++
+						mx.Unlock()
+					} else {
+						s.NoError(err)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		s.Equal(5, limited)
+		s.Equal(15, redemptions(r, "R3D33M11"))
+	})
 }
@@ -0,0 +1,119 @@
+package testsuite_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/persistence/embedded"
+	"github.com/Teelevision/excommerce/persistence/testsuite"
+)
+
+// Tests the suite against the embedded implementation.
+func TestEmbeddedImplementation(t *testing.T) {
+	newAdapter := embeddedAdapterFactory(t)
+	{ // user
+		suite := &testsuite.UserRepositoryTestSuite{
+			NewRepository: func() persistence.UserRepository {
+				return newAdapter(embedded.FastLessSecureHashingForTesting())
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // product
+		suite := &testsuite.ProductRepositoryTestSuite{
+			NewRepository: func() persistence.ProductRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // cart
+		suite := &testsuite.CartRepositoryTestSuite{
+			NewRepository: func() persistence.CartRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // coupon
+		suite := &testsuite.CouponRepositoryTestSuite{
+			NewRepository: func() persistence.CouponRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // order
+		suite := &testsuite.OrderRepositoryTestSuite{
+			NewRepository: func() persistence.OrderRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // promotion
+		suite := &testsuite.PromotionRepositoryTestSuite{
+			NewRepository: func() persistence.PromotionRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // stock
+		suite := &testsuite.StockRepositoryTestSuite{
+			NewRepository: func() persistence.StockRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // session
+		suite := &testsuite.SessionRepositoryTestSuite{
+			NewRepository: func() persistence.SessionRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // password reset
+		suite := &testsuite.PasswordResetRepositoryTestSuite{
+			NewRepository: func() persistence.PasswordResetRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // placed order
+		suite := &testsuite.PlacedOrderRepositoryTestSuite{
+			NewRepository: func() persistence.PlacedOrderRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+}
+
+// Returns a function that creates adapters, each with a new file in a
+// temporary directory that is removed when the test finishes.
+func embeddedAdapterFactory(t *testing.T) func(options ...embedded.Option) *embedded.Adapter {
+	dir, err := ioutil.TempDir("", "excommerce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	var n int
+	return func(options ...embedded.Option) *embedded.Adapter {
+		n++
+		a, err := embedded.Open(filepath.Join(dir, fmt.Sprintf("%d.db", n)), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+}
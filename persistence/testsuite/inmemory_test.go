@@ -51,10 +51,50 @@ func TestReferenceImplementation(t *testing.T) {
 		}
 		suite.RunSuite(t)
 	}
+	{ // promotion
+		suite := &testsuite.PromotionRepositoryTestSuite{
+			NewRepository: func() persistence.PromotionRepository {
+				return inmemory.NewAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // stock
+		suite := &testsuite.StockRepositoryTestSuite{
+			NewRepository: func() persistence.StockRepository {
+				return inmemory.NewAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // session
+		suite := &testsuite.SessionRepositoryTestSuite{
+			NewRepository: func() persistence.SessionRepository {
+				return inmemory.NewAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // password reset
+		suite := &testsuite.PasswordResetRepositoryTestSuite{
+			NewRepository: func() persistence.PasswordResetRepository {
+				return inmemory.NewAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
 	{ // placed order
 		suite := &testsuite.PlacedOrderRepositoryTestSuite{
 			NewRepository: func() persistence.PlacedOrderRepository {
-				return log.NewAdapter()
+				return inmemory.NewAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // placed order with logging
+		suite := &testsuite.PlacedOrderRepositoryTestSuite{
+			NewRepository: func() persistence.PlacedOrderRepository {
+				return log.NewAdapter(inmemory.NewAdapter())
 			},
 		}
 		suite.RunSuite(t)
@@ -177,7 +177,10 @@ func (s *OrderRepositoryTestSuite) TestFindOrderOfUser() {
 					City:       "Berlin",
 					Street:     "Willy-Brandt-Straße 1",
 				},
-				Coupons: []string{"orange30"},
+				Coupons:  []string{"orange30"},
+				Currency: "USD",
+
+				ShippingMethodID: "express",
 			},
 		)
 		s.Require().NoError(err)
@@ -201,7 +204,10 @@ func (s *OrderRepositoryTestSuite) TestFindOrderOfUser() {
 				City:       "Berlin",
 				Street:     "Willy-Brandt-Straße 1",
 			},
-			Coupons: []*model.Coupon{{Code: "orange30"}},
+			Coupons:  []*model.Coupon{{Code: "orange30"}},
+			Currency: "USD",
+
+			ShippingMethodID: "express",
 		}, order)
 	})
 	s.Run("user is case-sensitive", func() {
@@ -417,3 +423,104 @@ func (s *OrderRepositoryTestSuite) TestLockOrderOfUser() {
 		wg.Wait()
 	})
 }
+
+// TestUnlockOrderOfUser tests unlocking an order of a user.
+func (s *OrderRepositoryTestSuite) TestUnlockOrderOfUser() {
+	s.Run("unlocks a locked order", func() {
+		r := s.NewRepository()
+		err := r.CreateOrder(ctx, "user", "id", persistence.OrderAttributes{CartID: "cart"})
+		s.Require().NoError(err)
+		err = r.LockOrderOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		err = r.UnlockOrderOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		s.Run("and accessing it returns the unlocked state", func() {
+			order, err := r.FindOrderOfUser(ctx, "user", "id")
+			s.NoError(err)
+			s.False(order.Locked)
+			s.Equal("cart", order.CartID)
+		})
+		s.Run("allows locking it again", func() {
+			err := r.LockOrderOfUser(ctx, "user", "id")
+			s.NoError(err)
+		})
+	})
+	s.Run("unlocking an unlocked order has no effect", func() {
+		r := s.NewRepository()
+		err := r.CreateOrder(ctx, "user", "id", persistence.OrderAttributes{})
+		s.Require().NoError(err)
+		err = r.UnlockOrderOfUser(ctx, "user", "id")
+		s.NoError(err)
+		order, err := r.FindOrderOfUser(ctx, "user", "id")
+		s.NoError(err)
+		s.False(order.Locked)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.UnlockOrderOfUser(ctx, "user", "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("deleted", func() {
+		r := s.NewRepository()
+		err := r.CreateOrder(ctx, "user", "id", persistence.OrderAttributes{})
+		s.Require().NoError(err)
+		err = r.DeleteOrderOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		err = r.UnlockOrderOfUser(ctx, "user", "id")
+		s.True(errors.Is(err, persistence.ErrDeleted))
+	})
+	s.Run("user is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.CreateOrder(ctx, "user", "id", persistence.OrderAttributes{})
+		s.Require().NoError(err)
+		err = r.LockOrderOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		err = r.UnlockOrderOfUser(ctx, "USER", "id")
+		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
+	})
+	s.Run("id is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.CreateOrder(ctx, "user", "id", persistence.OrderAttributes{})
+		s.Require().NoError(err)
+		err = r.UnlockOrderOfUser(ctx, "user", "ID")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
+
+// TestTransferOrdersOfUser tests transferring the orders of a user to another.
+func (s *OrderRepositoryTestSuite) TestTransferOrdersOfUser() {
+	s.Run("transfers unlocked orders", func() {
+		r := s.NewRepository()
+		for _, c := range []struct{ userID, id string }{
+			{"guest", "order 1"},
+			{"guest", "locked"},
+			{"guest", "deleted"},
+			{"other", "order 2"},
+		} {
+			err := r.CreateOrder(ctx, c.userID, c.id, persistence.OrderAttributes{CartID: "cart"})
+			s.Require().NoError(err)
+		}
+		s.Require().NoError(r.LockOrderOfUser(ctx, "guest", "locked"))
+		s.Require().NoError(r.DeleteOrderOfUser(ctx, "guest", "deleted"))
+
+		err := r.TransferOrdersOfUser(ctx, "guest", "user")
+		s.NoError(err)
+
+		order, err := r.FindOrderOfUser(ctx, "user", "order 1")
+		s.NoError(err)
+		s.Equal("cart", order.CartID)
+		_, err = r.FindOrderOfUser(ctx, "guest", "order 1")
+		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
+		// locked orders stay
+		_, err = r.FindOrderOfUser(ctx, "guest", "locked")
+		s.NoError(err)
+		// orders of other users are not affected
+		_, err = r.FindOrderOfUser(ctx, "other", "order 2")
+		s.NoError(err)
+	})
+	s.Run("user without orders", func() {
+		r := s.NewRepository()
+		err := r.TransferOrdersOfUser(ctx, "guest", "user")
+		s.NoError(err)
+	})
+}
@@ -0,0 +1,152 @@
+package testsuite
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/stretchr/testify/suite"
+)
+
+// PasswordResetRepositoryTestSuite is the suite that tests that a password
+// reset repository behaves as expected. Use RunSuite to run it.
+type PasswordResetRepositoryTestSuite struct {
+	suite.Suite
+	NewRepository func() persistence.PasswordResetRepository
+}
+
+// RunSuite runs the test suite.
+func (s *PasswordResetRepositoryTestSuite) RunSuite(t *testing.T) {
+	suite.Run(t, s)
+}
+
+// TestCreatePasswordReset tests the creation of password reset tokens.
+func (s *PasswordResetRepositoryTestSuite) TestCreatePasswordReset() {
+	s.Run("one", func() {
+		r := s.NewRepository()
+		err := r.CreatePasswordReset(ctx,
+			"reset token",                          // token
+			"9b7e5d2c-1c3f-4a8d-8d6e-2e4b6a0c9f12", // user id
+			time.Now().Add(time.Hour),              // expires at
+		)
+		s.NoError(err)
+		userID, err := r.RedeemPasswordReset(ctx, "reset token")
+		s.NoError(err)
+		s.Equal("9b7e5d2c-1c3f-4a8d-8d6e-2e4b6a0c9f12", userID)
+	})
+	s.Run("many of the same user", func() {
+		r := s.NewRepository()
+		for _, token := range []string{"token 1", "token 2", "token 3"} {
+			err := r.CreatePasswordReset(ctx, token, "user", time.Now().Add(time.Hour))
+			s.Require().NoError(err)
+		}
+	})
+	s.Run("conflict on same token", func() {
+		r := s.NewRepository()
+		err := r.CreatePasswordReset(ctx, "token", "user 1", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.CreatePasswordReset(ctx, "token", "user 2", time.Now().Add(time.Hour))
+		s.True(errors.Is(err, persistence.ErrConflict))
+	})
+	s.Run("same token as expired token", func() {
+		r := s.NewRepository()
+		err := r.CreatePasswordReset(ctx, "token", "user", time.Now().Add(-time.Second))
+		s.Require().NoError(err)
+		err = r.CreatePasswordReset(ctx, "token", "user", time.Now().Add(time.Hour))
+		s.NoError(err)
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		tokens := []string{"token 1", "token 2", "token 3", "token 4", "token 5", "token 6"}
+		do := func(tokens []string) {
+			defer wg.Done()
+			for _, token := range tokens {
+				err := r.CreatePasswordReset(ctx, token, "user", time.Now().Add(time.Hour))
+				s.Require().NoError(err)
+			}
+		}
+		wg.Add(2)
+		go do(tokens[:3])
+		go do(tokens[3:])
+		wg.Wait()
+	})
+}
+
+// TestRedeemPasswordReset tests redeeming password reset tokens.
+func (s *PasswordResetRepositoryTestSuite) TestRedeemPasswordReset() {
+	s.Run("can only be redeemed once", func() {
+		r := s.NewRepository()
+		err := r.CreatePasswordReset(ctx, "token", "user", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		userID, err := r.RedeemPasswordReset(ctx, "token")
+		s.NoError(err)
+		s.Equal("user", userID)
+		_, err = r.RedeemPasswordReset(ctx, "token")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("token does not exist", func() {
+		r := s.NewRepository()
+		err := r.CreatePasswordReset(ctx, "token", "user", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		_, err = r.RedeemPasswordReset(ctx, "other token")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("token is expired", func() {
+		r := s.NewRepository()
+		err := r.CreatePasswordReset(ctx, "token", "user", time.Now().Add(-time.Second))
+		s.Require().NoError(err)
+		_, err = r.RedeemPasswordReset(ctx, "token")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("concurrently only once", func() {
+		r := s.NewRepository()
+		err := r.CreatePasswordReset(ctx, "token", "user", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		var wg sync.WaitGroup
+		results := make(chan error, 6)
+		for i := 0; i < cap(results); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := r.RedeemPasswordReset(ctx, "token")
+				results <- err
+			}()
+		}
+		wg.Wait()
+		close(results)
+		var redeemed int
+		for err := range results {
+			if err == nil {
+				redeemed++
+			} else {
+				s.True(errors.Is(err, persistence.ErrNotFound))
+			}
+		}
+		s.Equal(1, redeemed)
+	})
+}
+
+// TestDeletePasswordResetsOfUser tests deleting all tokens of a user.
+func (s *PasswordResetRepositoryTestSuite) TestDeletePasswordResetsOfUser() {
+	r := s.NewRepository()
+	for _, reset := range []struct{ token, userID string }{
+		{"token 1", "user 1"},
+		{"token 2", "user 2"},
+		{"token 3", "user 1"},
+	} {
+		err := r.CreatePasswordReset(ctx, reset.token, reset.userID, time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+	}
+	err := r.DeletePasswordResetsOfUser(ctx, "user 1")
+	s.NoError(err)
+	_, err = r.RedeemPasswordReset(ctx, "token 1")
+	s.True(errors.Is(err, persistence.ErrNotFound))
+	_, err = r.RedeemPasswordReset(ctx, "token 3")
+	s.True(errors.Is(err, persistence.ErrNotFound))
+	userID, err := r.RedeemPasswordReset(ctx, "token 2")
+	s.NoError(err)
+	s.Equal("user 2", userID)
+}
@@ -1,9 +1,12 @@
 package testsuite
 
 import (
+	"errors"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/Teelevision/excommerce/model"
 	"github.com/Teelevision/excommerce/persistence"
 	"github.com/stretchr/testify/suite"
 )
@@ -20,63 +23,105 @@ func (s *PlacedOrderRepositoryTestSuite) RunSuite(t *testing.T) {
 	suite.Run(t, s)
 }
 
-// TestPlaceOrder tests placing orders.
-func (s *PlacedOrderRepositoryTestSuite) TestPlaceOrder() {
-	s.Run("one", func() {
-		r := s.NewRepository()
-		err := r.PlaceOrder(ctx, persistence.PlacedOrder{
-			UserID: "8e668ea2-ba30-421b-a773-6e289b5b68fd",
-			Buyer: persistence.OrderAddress{
-				Name:       "Bundeskanzleramt, Bundeskanzlerin Angela Merkel",
-				Country:    "DE",
-				PostalCode: "10557",
-				City:       "Berlin",
-				Street:     "Willy-Brandt-Straße 1",
+// returns a placed order with all fields set
+func newPlacedOrder(userID, id string, placedAt time.Time) persistence.PlacedOrder {
+	return persistence.PlacedOrder{
+		ID:       id,
+		UserID:   userID,
+		PlacedAt: placedAt,
+		Buyer: persistence.OrderAddress{
+			Name:       "Bundeskanzleramt, Bundeskanzlerin Angela Merkel",
+			Country:    "DE",
+			PostalCode: "10557",
+			City:       "Berlin",
+			Street:     "Willy-Brandt-Straße 1",
+		},
+		Recipient: persistence.OrderAddress{
+			Name:       "Bundeskanzleramt, Bundeskanzlerin Angela Merkel",
+			Country:    "DE",
+			PostalCode: "10557",
+			City:       "Berlin",
+			Street:     "Willy-Brandt-Straße 1",
+		},
+		Coupons: map[string]persistence.OrderCoupon{
+			"orange30": {
+				ProductID: "5b31a473-4b5e-48ad-8033-bcccdfb373f9",
+				Name:      "30% off oranges",
+				Discount:  30,
 			},
-			Recipient: persistence.OrderAddress{
-				Name:       "Bundeskanzleramt, Bundeskanzlerin Angela Merkel",
-				Country:    "DE",
-				PostalCode: "10557",
-				City:       "Berlin",
-				Street:     "Willy-Brandt-Straße 1",
+		},
+		Products: map[string]persistence.OrderProduct{
+			"5b31a473-4b5e-48ad-8033-bcccdfb373f9": {
+				Name:     "Orange",
+				Price:    79,
+				TaxClass: "reduced",
 			},
-			Coupons: map[string]persistence.OrderCoupon{
-				"orange30": {
-					ProductID: "5b31a473-4b5e-48ad-8033-bcccdfb373f9",
-					Name:      "30% off oranges",
-					Discount:  30,
-				},
+			"a67d84d3-3417-478f-b93f-fb5990ce0052": {
+				Name:  "Apple",
+				Price: 49,
 			},
-			Products: map[string]persistence.OrderProduct{
-				"5b31a473-4b5e-48ad-8033-bcccdfb373f9": {
-					Name:  "Orange",
-					Price: 79,
-				},
-				"a67d84d3-3417-478f-b93f-fb5990ce0052": {
-					Name:  "Apple",
-					Price: 49,
-				},
+		},
+		Currency: "USD",
+		Price:    645,
+		StatusHistory: []model.OrderStatusChange{
+			{Status: model.OrderStatusPlaced, ChangedAt: placedAt},
+		},
+		PaymentAuthorization: "auth_5f3c2a",
+		Positions: []persistence.OrderPosition{
+			{
+				ProductID:  "5b31a473-4b5e-48ad-8033-bcccdfb373f9",
+				CouponCode: "",
+				Quantity:   2,
+				Price:      158,
+			}, {
+				ProductID:  "",
+				CouponCode: "orange30",
+				Quantity:   1,
+				Price:      -47,
+			}, {
+				ProductID:  "a67d84d3-3417-478f-b93f-fb5990ce0052",
+				CouponCode: "",
+				Quantity:   1,
+				Price:      49,
+			}, {
+				Name:     "10% off apples",
+				Quantity: 1,
+				Price:    -5,
+			}, {
+				ShippingMethodID: "standard",
+				Name:             "Standard shipping",
+				Quantity:         1,
+				Price:            490,
 			},
-			Price: 160,
-			Positions: []persistence.OrderPosition{
-				{
-					ProductID:  "5b31a473-4b5e-48ad-8033-bcccdfb373f9",
-					CouponCode: "",
-					Quantity:   2,
-					Price:      158,
-				}, {
-					ProductID:  "",
-					CouponCode: "orange30",
-					Quantity:   1,
-					Price:      -47,
-				}, {
-					ProductID:  "a67d84d3-3417-478f-b93f-fb5990ce0052",
-					CouponCode: "",
-					Quantity:   1,
-					Price:      49,
-				},
-			},
-		})
+		},
+		Taxes: []persistence.OrderTax{
+			{Class: "standard", Rate: 1900, Net: 37, Amount: 7, Included: true},
+			{Class: "reduced", Rate: 700, Net: 104, Amount: 7, Included: true},
+		},
+	}
+}
+
+// Checks that all times of the order are close to the given time and sets
+// them to it. Persisting times might drop the monotonic clock reading, the
+// location or some precision.
+func (s *PlacedOrderRepositoryTestSuite) normalizeTimes(order *persistence.PlacedOrder, t time.Time) {
+	s.WithinDuration(t, order.PlacedAt, time.Millisecond)
+	order.PlacedAt = t
+	for i, change := range order.StatusHistory {
+		s.WithinDuration(t, change.ChangedAt, time.Millisecond)
+		order.StatusHistory[i].ChangedAt = t
+	}
+}
+
+// TestPlaceOrder tests placing orders.
+func (s *PlacedOrderRepositoryTestSuite) TestPlaceOrder() {
+	s.Run("one", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, newPlacedOrder(
+			"8e668ea2-ba30-421b-a773-6e289b5b68fd",
+			"ba3e44b1-59ea-4325-a8a8-600f3a081e73",
+			time.Now(),
+		))
 		s.NoError(err)
 	})
 	s.Run("with empty everything", func() {
@@ -87,25 +132,34 @@ func (s *PlacedOrderRepositoryTestSuite) TestPlaceOrder() {
 	s.Run("many", func() {
 		r := s.NewRepository()
 		for _, c := range []struct {
-			userID string
+			userID, id string
 		}{
-			{"50d710f1-e8e6-4449-a690-57585e970699"},
-			{"b00a387d-dcac-4ecf-9ad0-88857d9bc6ee"},
-			{"249ed004-4c5e-47f4-bf55-9ceea0c6a385"},
-			{"d062616b-52eb-48c3-9372-7876f7eaff53"},
-			{"2e0bd181-b76e-46a2-a538-bb8f0da7b6c0"},
-			{"ca77448b-3eca-445a-b3c4-28c66d132879"},
-			{"f1af4738-4b7a-492f-ac09-9efe8da20731"},
+			{"50d710f1-e8e6-4449-a690-57585e970699", "e2d0b7a4-0f7e-4f3b-8d46-7e5d2b6c1a01"},
+			{"b00a387d-dcac-4ecf-9ad0-88857d9bc6ee", "6c1f4b1e-2b8a-4c57-9f2e-0d3a5e7b9c02"},
+			{"249ed004-4c5e-47f4-bf55-9ceea0c6a385", "a4b3c2d1-8e7f-4a6b-9c5d-1e2f3a4b5c03"},
+			{"d062616b-52eb-48c3-9372-7876f7eaff53", "0f9e8d7c-6b5a-4c3d-8e2f-1a0b9c8d7e04"},
+			{"2e0bd181-b76e-46a2-a538-bb8f0da7b6c0", "5a6b7c8d-9e0f-4a1b-8c2d-3e4f5a6b7c05"},
+			{"ca77448b-3eca-445a-b3c4-28c66d132879", "9d8c7b6a-5f4e-4d3c-9b2a-1f0e9d8c7b06"},
+			{"f1af4738-4b7a-492f-ac09-9efe8da20731", "3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e07"},
 		} {
 			err := r.PlaceOrder(ctx, persistence.PlacedOrder{
+				ID:     c.id,
 				UserID: c.userID,
 			})
 			s.Require().NoError(err)
 		}
 	})
+	s.Run("conflict on same id", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user1"})
+		s.Require().NoError(err)
+		err = r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user2"})
+		s.True(errors.Is(err, persistence.ErrConflict))
+	})
 	s.Run("supports more complex strings", func() {
 		r := s.NewRepository()
 		err := r.PlaceOrder(ctx, persistence.PlacedOrder{
+			ID:     "औकखग \u0000\t\"abc",
 			UserID: "‽ⓐ◐\n👽",
 			Buyer: persistence.OrderAddress{
 				Name:       "औकखग",
@@ -139,6 +193,7 @@ func (s *PlacedOrderRepositoryTestSuite) TestPlaceOrder() {
 			defer wg.Done()
 			for _, id := range ids {
 				err := r.PlaceOrder(ctx, persistence.PlacedOrder{
+					ID:     id,
 					UserID: id,
 				})
 				s.Require().NoError(err)
@@ -150,3 +205,321 @@ func (s *PlacedOrderRepositoryTestSuite) TestPlaceOrder() {
 		wg.Wait()
 	})
 }
+
+// TestFindAllPlacedOrdersOfUser tests finding all placed orders of a user.
+func (s *PlacedOrderRepositoryTestSuite) TestFindAllPlacedOrdersOfUser() {
+	s.Run("finds placed order with all data", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		err := r.PlaceOrder(ctx, newPlacedOrder("user", "id", placedAt))
+		s.Require().NoError(err)
+		orders, err := r.FindAllPlacedOrdersOfUser(ctx, "user")
+		s.NoError(err)
+		s.Require().Len(orders, 1)
+		s.normalizeTimes(orders[0], placedAt)
+		expected := newPlacedOrder("user", "id", placedAt)
+		s.Equal([]*persistence.PlacedOrder{&expected}, orders)
+	})
+	s.Run("finds many", func() {
+		r := s.NewRepository()
+		for _, id := range []string{"id1", "id2", "id3"} {
+			err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: id, UserID: "user"})
+			s.Require().NoError(err)
+		}
+		orders, err := r.FindAllPlacedOrdersOfUser(ctx, "user")
+		s.NoError(err)
+		ids := make([]string, len(orders))
+		for i, order := range orders {
+			ids[i] = order.ID
+		}
+		s.ElementsMatch([]string{"id1", "id2", "id3"}, ids)
+	})
+	s.Run("finds none", func() {
+		r := s.NewRepository()
+		orders, err := r.FindAllPlacedOrdersOfUser(ctx, "user")
+		s.NoError(err)
+		s.Empty(orders)
+	})
+	s.Run("does not find placed orders of other users", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user1"})
+		s.Require().NoError(err)
+		orders, err := r.FindAllPlacedOrdersOfUser(ctx, "user2")
+		s.NoError(err)
+		s.Empty(orders)
+	})
+	s.Run("returns empty maps and positions", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user"})
+		s.Require().NoError(err)
+		orders, err := r.FindAllPlacedOrdersOfUser(ctx, "user")
+		s.NoError(err)
+		s.Require().Len(orders, 1)
+		s.NotNil(orders[0].Coupons)
+		s.NotNil(orders[0].Products)
+		s.NotNil(orders[0].Positions)
+		s.NotNil(orders[0].Taxes)
+		s.NotNil(orders[0].StatusHistory)
+	})
+}
+
+// TestFindPlacedOrderOfUser tests finding a placed order of a user.
+func (s *PlacedOrderRepositoryTestSuite) TestFindPlacedOrderOfUser() {
+	s.Run("finds placed order with all data", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		err := r.PlaceOrder(ctx, newPlacedOrder("user", "id", placedAt))
+		s.Require().NoError(err)
+		order, err := r.FindPlacedOrderOfUser(ctx, "user", "id")
+		s.NoError(err)
+		s.Require().NotNil(order)
+		s.normalizeTimes(order, placedAt)
+		expected := newPlacedOrder("user", "id", placedAt)
+		s.Equal(&expected, order)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		order, err := r.FindPlacedOrderOfUser(ctx, "user", "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(order)
+	})
+	s.Run("not owned by user", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user1"})
+		s.Require().NoError(err)
+		order, err := r.FindPlacedOrderOfUser(ctx, "user2", "id")
+		s.True(errors.Is(err, persistence.ErrNotOwnedByUser))
+		s.Nil(order)
+	})
+	s.Run("is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user"})
+		s.Require().NoError(err)
+		_, err = r.FindPlacedOrderOfUser(ctx, "user", "ID")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("supports more complex strings", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		input := newPlacedOrder("‽ⓐ◐\n👽", "औकखग \u0000\t\"abc", placedAt)
+		input.Buyer.Street = " \u0000\t\"abc"
+		input.Positions[3].Name = "乐乑 \u0000"
+		err := r.PlaceOrder(ctx, input)
+		s.Require().NoError(err)
+		order, err := r.FindPlacedOrderOfUser(ctx, "‽ⓐ◐\n👽", "औकखग \u0000\t\"abc")
+		s.NoError(err)
+		s.Require().NotNil(order)
+		s.normalizeTimes(order, placedAt)
+		s.Equal(&input, order)
+	})
+	s.Run("changing the input does not have any side effects", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		input := newPlacedOrder("user", "id", placedAt)
+		err := r.PlaceOrder(ctx, input)
+		s.Require().NoError(err)
+		// changing the input ...
+		input.Coupons["orange30"] = persistence.OrderCoupon{Name: "changed"}
+		input.Products["added"] = persistence.OrderProduct{Name: "added"}
+		input.Positions[0].Quantity++
+		input.Taxes[0].Amount++
+		input.StatusHistory[0].Status = "changed"
+		// ... does not have any side effects
+		order, err := r.FindPlacedOrderOfUser(ctx, "user", "id")
+		s.NoError(err)
+		s.Require().NotNil(order)
+		s.normalizeTimes(order, placedAt)
+		expected := newPlacedOrder("user", "id", placedAt)
+		s.Equal(&expected, order)
+	})
+	s.Run("changing the result does not have any side effects", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		err := r.PlaceOrder(ctx, newPlacedOrder("user", "id", placedAt))
+		s.Require().NoError(err)
+		order, err := r.FindPlacedOrderOfUser(ctx, "user", "id")
+		s.Require().NoError(err)
+		// changing the result ...
+		order.Coupons["orange30"] = persistence.OrderCoupon{Name: "changed"}
+		order.Products["added"] = persistence.OrderProduct{Name: "added"}
+		order.Positions[0].Quantity++
+		order.Taxes[0].Amount++
+		order.StatusHistory[0].Status = "changed"
+		// ... does not have any side effects
+		order, err = r.FindPlacedOrderOfUser(ctx, "user", "id")
+		s.NoError(err)
+		s.Require().NotNil(order)
+		s.normalizeTimes(order, placedAt)
+		expected := newPlacedOrder("user", "id", placedAt)
+		s.Equal(&expected, order)
+	})
+}
+
+// TestFindPlacedOrder tests finding a placed order regardless of the user.
+func (s *PlacedOrderRepositoryTestSuite) TestFindPlacedOrder() {
+	s.Run("finds placed order with all data", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		err := r.PlaceOrder(ctx, newPlacedOrder("user", "id", placedAt))
+		s.Require().NoError(err)
+		order, err := r.FindPlacedOrder(ctx, "id")
+		s.NoError(err)
+		s.Require().NotNil(order)
+		s.normalizeTimes(order, placedAt)
+		expected := newPlacedOrder("user", "id", placedAt)
+		s.Equal(&expected, order)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		order, err := r.FindPlacedOrder(ctx, "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(order)
+	})
+	s.Run("is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user"})
+		s.Require().NoError(err)
+		_, err = r.FindPlacedOrder(ctx, "ID")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
+
+// TestUpdatePlacedOrderStatus tests changing the status of a placed order.
+func (s *PlacedOrderRepositoryTestSuite) TestUpdatePlacedOrderStatus() {
+	s.Run("appends to history", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		err := r.PlaceOrder(ctx, newPlacedOrder("user", "id", placedAt))
+		s.Require().NoError(err)
+		paidAt := placedAt.Add(time.Hour)
+		err = r.UpdatePlacedOrderStatus(ctx, "id", model.OrderStatusPlaced, model.OrderStatusChange{
+			Status:    model.OrderStatusPaid,
+			ChangedAt: paidAt,
+		})
+		s.NoError(err)
+		order, err := r.FindPlacedOrder(ctx, "id")
+		s.Require().NoError(err)
+		s.Require().Len(order.StatusHistory, 2)
+		s.Equal(model.OrderStatusPlaced, order.StatusHistory[0].Status)
+		s.WithinDuration(placedAt, order.StatusHistory[0].ChangedAt, time.Millisecond)
+		s.Equal(model.OrderStatusPaid, order.StatusHistory[1].Status)
+		s.WithinDuration(paidAt, order.StatusHistory[1].ChangedAt, time.Millisecond)
+		s.Run("again", func() {
+			shippedAt := paidAt.Add(time.Hour)
+			err = r.UpdatePlacedOrderStatus(ctx, "id", model.OrderStatusPaid, model.OrderStatusChange{
+				Status:    model.OrderStatusShipped,
+				ChangedAt: shippedAt,
+			})
+			s.NoError(err)
+			order, err := r.FindPlacedOrder(ctx, "id")
+			s.Require().NoError(err)
+			s.Require().Len(order.StatusHistory, 3)
+			s.Equal(model.OrderStatusShipped, order.StatusHistory[2].Status)
+			s.WithinDuration(shippedAt, order.StatusHistory[2].ChangedAt, time.Millisecond)
+		})
+	})
+	s.Run("first status of empty history", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id", UserID: "user"})
+		s.Require().NoError(err)
+		err = r.UpdatePlacedOrderStatus(ctx, "id", "", model.OrderStatusChange{
+			Status:    model.OrderStatusPlaced,
+			ChangedAt: time.Now(),
+		})
+		s.NoError(err)
+		order, err := r.FindPlacedOrder(ctx, "id")
+		s.Require().NoError(err)
+		s.Require().Len(order.StatusHistory, 1)
+		s.Equal(model.OrderStatusPlaced, order.StatusHistory[0].Status)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.UpdatePlacedOrderStatus(ctx, "id", model.OrderStatusPlaced, model.OrderStatusChange{
+			Status:    model.OrderStatusPaid,
+			ChangedAt: time.Now(),
+		})
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("conflict on different current status", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, newPlacedOrder("user", "id", time.Now()))
+		s.Require().NoError(err)
+		err = r.UpdatePlacedOrderStatus(ctx, "id", model.OrderStatusPaid, model.OrderStatusChange{
+			Status:    model.OrderStatusPacked,
+			ChangedAt: time.Now(),
+		})
+		s.True(errors.Is(err, persistence.ErrConflict))
+		order, err := r.FindPlacedOrder(ctx, "id")
+		s.Require().NoError(err)
+		s.Len(order.StatusHistory, 1)
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		err := r.PlaceOrder(ctx, newPlacedOrder("user", "id", time.Now()))
+		s.Require().NoError(err)
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = r.UpdatePlacedOrderStatus(ctx, "id", model.OrderStatusPlaced, model.OrderStatusChange{
+					Status:    model.OrderStatusPaid,
+					ChangedAt: time.Now(),
+				})
+			}(i)
+		}
+		wg.Wait()
+		// exactly one succeeds
+		var succeeded int
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+			} else {
+				s.True(errors.Is(err, persistence.ErrConflict))
+			}
+		}
+		s.Equal(1, succeeded)
+		order, err := r.FindPlacedOrder(ctx, "id")
+		s.Require().NoError(err)
+		s.Len(order.StatusHistory, 2)
+	})
+}
+
+// TestTransferPlacedOrdersOfUser tests transferring the placed orders of a user
+// to another.
+func (s *PlacedOrderRepositoryTestSuite) TestTransferPlacedOrdersOfUser() {
+	s.Run("transfers placed orders", func() {
+		r := s.NewRepository()
+		placedAt := time.Now()
+		err := r.PlaceOrder(ctx, newPlacedOrder("guest", "id1", placedAt))
+		s.Require().NoError(err)
+		err = r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id2", UserID: "guest"})
+		s.Require().NoError(err)
+		err = r.PlaceOrder(ctx, persistence.PlacedOrder{ID: "id3", UserID: "other"})
+		s.Require().NoError(err)
+
+		err = r.TransferPlacedOrdersOfUser(ctx, "guest", "user")
+		s.NoError(err)
+
+		orders, err := r.FindAllPlacedOrdersOfUser(ctx, "user")
+		s.NoError(err)
+		s.Len(orders, 2)
+		order, err := r.FindPlacedOrderOfUser(ctx, "user", "id1")
+		s.Require().NoError(err)
+		s.normalizeTimes(order, placedAt)
+		expected := newPlacedOrder("user", "id1", placedAt)
+		s.Equal(&expected, order)
+		orders, err = r.FindAllPlacedOrdersOfUser(ctx, "guest")
+		s.NoError(err)
+		s.Empty(orders)
+		// placed orders of other users are not affected
+		_, err = r.FindPlacedOrderOfUser(ctx, "other", "id3")
+		s.NoError(err)
+	})
+	s.Run("user without placed orders", func() {
+		r := s.NewRepository()
+		err := r.TransferPlacedOrdersOfUser(ctx, "guest", "user")
+		s.NoError(err)
+	})
+}
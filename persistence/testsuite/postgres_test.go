@@ -0,0 +1,155 @@
+package testsuite_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/Teelevision/excommerce/persistence/postgres"
+	"github.com/Teelevision/excommerce/persistence/testsuite"
+	"github.com/lib/pq"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	testsuite.StopPostgres()
+	os.Exit(code)
+}
+
+// Tests the suite against the PostgreSQL implementation. The database is
+// given by testsuite.PostgresDSN. The test is skipped if there is none.
+func TestPostgresImplementation(t *testing.T) {
+	newAdapter := postgresAdapterFactory(t)
+	{ // user
+		suite := &testsuite.UserRepositoryTestSuite{
+			NewRepository: func() persistence.UserRepository {
+				return newAdapter(postgres.FastLessSecureHashingForTesting())
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // product
+		suite := &testsuite.ProductRepositoryTestSuite{
+			NewRepository: func() persistence.ProductRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // cart
+		suite := &testsuite.CartRepositoryTestSuite{
+			NewRepository: func() persistence.CartRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // coupon
+		suite := &testsuite.CouponRepositoryTestSuite{
+			NewRepository: func() persistence.CouponRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // order
+		suite := &testsuite.OrderRepositoryTestSuite{
+			NewRepository: func() persistence.OrderRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // promotion
+		suite := &testsuite.PromotionRepositoryTestSuite{
+			NewRepository: func() persistence.PromotionRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // stock
+		suite := &testsuite.StockRepositoryTestSuite{
+			NewRepository: func() persistence.StockRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // session
+		suite := &testsuite.SessionRepositoryTestSuite{
+			NewRepository: func() persistence.SessionRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // password reset
+		suite := &testsuite.PasswordResetRepositoryTestSuite{
+			NewRepository: func() persistence.PasswordResetRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+	{ // placed order
+		suite := &testsuite.PlacedOrderRepositoryTestSuite{
+			NewRepository: func() persistence.PlacedOrderRepository {
+				return newAdapter()
+			},
+		}
+		suite.RunSuite(t)
+	}
+}
+
+var postgresSchemaCounter int64
+
+// Returns a function that creates adapters, each in a new schema, so that
+// every repository starts empty. All schemas are dropped when the test
+// finishes.
+func postgresAdapterFactory(t *testing.T) func(options ...postgres.Option) *postgres.Adapter {
+	dsn, err := testsuite.PostgresDSN()
+	if err != nil {
+		t.Fatal(err)
+	} else if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set and PostgreSQL is not installed")
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schemas []string
+	t.Cleanup(func() {
+		for _, schema := range schemas {
+			if _, err := db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+				t.Error(err)
+			}
+		}
+		db.Close()
+	})
+
+	return func(options ...postgres.Option) *postgres.Adapter {
+		schema := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), atomic.AddInt64(&postgresSchemaCounter, 1))
+		if _, err := db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatal(err)
+		}
+		schemas = append(schemas, schema)
+		a, err := postgres.Open(context.Background(), dsn+" search_path="+schema, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Close() })
+		return a
+	}
+}
@@ -28,14 +28,16 @@ func (s *ProductRepositoryTestSuite) TestCreateProduct() {
 		r := s.NewRepository()
 		err := r.CreateProduct(ctx,
 			"191f6123-6cbc-4424-a40a-c68018aec9a1", // id
-			"Orange",                               // name
-			1337,                                   // price
+			persistence.ProductAttributes{
+				Name:  "Orange",
+				Price: 1337,
+			},
 		)
 		s.NoError(err)
 	})
 	s.Run("with empty id, name and price", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "", "", 0)
+		err := r.CreateProduct(ctx, "", persistence.ProductAttributes{Name: "", Price: 0})
 		s.NoError(err)
 	})
 	s.Run("many", func() {
@@ -52,41 +54,41 @@ func (s *ProductRepositoryTestSuite) TestCreateProduct() {
 			{"93137b05-c002-4831-8691-1be66796912d", "name 52", 52},
 			{"9cbe377b-1a5a-46a0-8f5d-e2ae3c16b3b3", "name 53", 53},
 		} {
-			err := r.CreateProduct(ctx, c.id, c.name, c.price)
+			err := r.CreateProduct(ctx, c.id, persistence.ProductAttributes{Name: c.name, Price: c.price})
 			s.Require().NoError(err)
 		}
 	})
 	s.Run("conflict on same id", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "id", "name1", 1337)
+		err := r.CreateProduct(ctx, "id", persistence.ProductAttributes{Name: "name1", Price: 1337})
 		s.Require().NoError(err)
-		err = r.CreateProduct(ctx, "id", "name1", 1337)
+		err = r.CreateProduct(ctx, "id", persistence.ProductAttributes{Name: "name1", Price: 1337})
 		s.True(errors.Is(err, persistence.ErrConflict))
 	})
 	s.Run("no conflict on same name", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "id1", "name", 1337)
+		err := r.CreateProduct(ctx, "id1", persistence.ProductAttributes{Name: "name", Price: 1337})
 		s.Require().NoError(err)
-		err = r.CreateProduct(ctx, "id2", "name", 1337)
+		err = r.CreateProduct(ctx, "id2", persistence.ProductAttributes{Name: "name", Price: 1337})
 		s.NoError(err)
 	})
 	s.Run("is case-sensitive", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "id", "name", 1337)
+		err := r.CreateProduct(ctx, "id", persistence.ProductAttributes{Name: "name", Price: 1337})
 		s.Require().NoError(err)
-		err = r.CreateProduct(ctx, "ID", "NAME", 1337)
+		err = r.CreateProduct(ctx, "ID", persistence.ProductAttributes{Name: "NAME", Price: 1337})
 		s.NoError(err)
 	})
 	s.Run("supports more complex strings", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "औकखग \u0000\t\"abc", "‽ⓐ◐\n👽 乐乑", -1337)
+		err := r.CreateProduct(ctx, "औकखग \u0000\t\"abc", persistence.ProductAttributes{Name: "‽ⓐ◐\n👽 乐乑", Price: -1337})
 		s.NoError(err)
 	})
 	s.Run("does not trim whitespaces", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, " a", "b\n", 1337)
+		err := r.CreateProduct(ctx, " a", persistence.ProductAttributes{Name: "b\n", Price: 1337})
 		s.Require().NoError(err)
-		err = r.CreateProduct(ctx, "a", "b", 1337)
+		err = r.CreateProduct(ctx, "a", persistence.ProductAttributes{Name: "b", Price: 1337})
 		s.NoError(err)
 	})
 	s.Run("works concurrently", func() {
@@ -107,7 +109,7 @@ func (s *ProductRepositoryTestSuite) TestCreateProduct() {
 		do := func(cases []singleCase) {
 			defer wg.Done()
 			for _, c := range cases {
-				err := r.CreateProduct(ctx, c.id, c.name, c.price)
+				err := r.CreateProduct(ctx, c.id, persistence.ProductAttributes{Name: c.name, Price: c.price})
 				s.Require().NoError(err)
 			}
 		}
@@ -122,7 +124,7 @@ func (s *ProductRepositoryTestSuite) TestCreateProduct() {
 func (s *ProductRepositoryTestSuite) TestFindAllProducts() {
 	s.Run("finds product", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "cc10b2f8-2405-441a-9edf-6ee7d10481c6", "北京市", 1337)
+		err := r.CreateProduct(ctx, "cc10b2f8-2405-441a-9edf-6ee7d10481c6", persistence.ProductAttributes{Name: "北京市", Price: 1337})
 		s.Require().NoError(err)
 		products, err := r.FindAllProducts(ctx)
 		s.NoError(err)
@@ -148,7 +150,7 @@ func (s *ProductRepositoryTestSuite) TestFindAllProducts() {
 			{"c983501f-53f3-4087-b161-b3c257a35fef", "name 148", 148},
 			{"59f25fca-a105-454f-bd0a-5711c0689b16", "name 149", 149},
 		} {
-			err := r.CreateProduct(ctx, c.id, c.name, c.price)
+			err := r.CreateProduct(ctx, c.id, persistence.ProductAttributes{Name: c.name, Price: c.price})
 			s.Require().NoError(err)
 		}
 		products, err := r.FindAllProducts(ctx)
@@ -187,7 +189,7 @@ func (s *ProductRepositoryTestSuite) TestFindAllProducts() {
 		do := func(cases []singleCase) {
 			defer wg.Done()
 			for _, c := range cases {
-				err := r.CreateProduct(ctx, c.id, c.name, c.price)
+				err := r.CreateProduct(ctx, c.id, persistence.ProductAttributes{Name: c.name, Price: c.price})
 				s.Require().NoError(err)
 			}
 			_, err := r.FindAllProducts(ctx)
@@ -204,7 +206,7 @@ func (s *ProductRepositoryTestSuite) TestFindAllProducts() {
 func (s *ProductRepositoryTestSuite) TestFindProduct() {
 	s.Run("finds product", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "e6c73a05-c169-452e-8a6c-4afd9ffeb8ba", "北京市", 1337)
+		err := r.CreateProduct(ctx, "e6c73a05-c169-452e-8a6c-4afd9ffeb8ba", persistence.ProductAttributes{Name: "北京市", Price: 1337})
 		s.Require().NoError(err)
 		product, err := r.FindProduct(ctx, "e6c73a05-c169-452e-8a6c-4afd9ffeb8ba")
 		s.NoError(err)
@@ -228,7 +230,7 @@ func (s *ProductRepositoryTestSuite) TestFindProduct() {
 			{"e78d6142-0be8-4355-8cb0-ae4b0d8bcabf", "name 228", 228},
 			{"dfeacc59-874d-4f22-8447-9661901f2070", "name 229", 229},
 		} {
-			err := r.CreateProduct(ctx, c.id, c.name, c.price)
+			err := r.CreateProduct(ctx, c.id, persistence.ProductAttributes{Name: c.name, Price: c.price})
 			s.Require().NoError(err)
 		}
 		product, err := r.FindProduct(ctx, "494b3baf-3b90-46b9-9026-fc92377e127f")
@@ -249,7 +251,7 @@ func (s *ProductRepositoryTestSuite) TestFindProduct() {
 			{"47f8ce74-6581-4be9-b696-1d5ca1065e48", "name 249", 249},
 			{"3cc44ebe-177a-4651-8de9-bb2aae53699c", "name 250", 250},
 		} {
-			err := r.CreateProduct(ctx, c.id, c.name, c.price)
+			err := r.CreateProduct(ctx, c.id, persistence.ProductAttributes{Name: c.name, Price: c.price})
 			s.Require().NoError(err)
 		}
 		product, err := r.FindProduct(ctx, "efc07346-98ac-4c6d-81e9-af3a93c03c71")
@@ -274,7 +276,7 @@ func (s *ProductRepositoryTestSuite) TestFindProduct() {
 		do := func(cases []singleCase) {
 			defer wg.Done()
 			for _, c := range cases {
-				err := r.CreateProduct(ctx, c.id, c.name, c.price)
+				err := r.CreateProduct(ctx, c.id, persistence.ProductAttributes{Name: c.name, Price: c.price})
 				s.Require().NoError(err)
 			}
 			for _, c := range cases {
@@ -289,7 +291,7 @@ func (s *ProductRepositoryTestSuite) TestFindProduct() {
 	})
 	s.Run("changing the result does not have any side effects", func() {
 		r := s.NewRepository()
-		err := r.CreateProduct(ctx, "aeaedf82-2d9b-4e69-948b-c3ab92f893df", "北京市", 1337)
+		err := r.CreateProduct(ctx, "aeaedf82-2d9b-4e69-948b-c3ab92f893df", persistence.ProductAttributes{Name: "北京市", Price: 1337})
 		s.Require().NoError(err)
 		product, err := r.FindProduct(ctx, "aeaedf82-2d9b-4e69-948b-c3ab92f893df")
 		s.Require().NoError(err)
@@ -312,3 +314,451 @@ func (s *ProductRepositoryTestSuite) TestFindProduct() {
 		}, product)
 	})
 }
+
+// TestUpdateProduct tests updating a product.
+func (s *ProductRepositoryTestSuite) TestUpdateProduct() {
+	s.Run("updates name and price", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "2a0f4d5b-0a3f-4bd8-8d7e-7c2f4b9f5b61", persistence.ProductAttributes{Name: "name", Price: 1337})
+		s.Require().NoError(err)
+		err = r.UpdateProduct(ctx, "2a0f4d5b-0a3f-4bd8-8d7e-7c2f4b9f5b61", persistence.ProductAttributes{Name: "北京市", Price: 42})
+		s.Require().NoError(err)
+		product, err := r.FindProduct(ctx, "2a0f4d5b-0a3f-4bd8-8d7e-7c2f4b9f5b61")
+		s.NoError(err)
+		s.Equal(&model.Product{
+			ID:    "2a0f4d5b-0a3f-4bd8-8d7e-7c2f4b9f5b61",
+			Name:  "北京市",
+			Price: 42,
+		}, product)
+	})
+	s.Run("does not update other products", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id1", persistence.ProductAttributes{Name: "name1", Price: 1})
+		s.Require().NoError(err)
+		err = r.CreateProduct(ctx, "id2", persistence.ProductAttributes{Name: "name2", Price: 2})
+		s.Require().NoError(err)
+		err = r.UpdateProduct(ctx, "id1", persistence.ProductAttributes{Name: "changed", Price: 3})
+		s.Require().NoError(err)
+		product, err := r.FindProduct(ctx, "id2")
+		s.NoError(err)
+		s.Equal(&model.Product{ID: "id2", Name: "name2", Price: 2}, product)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.UpdateProduct(ctx, "id", persistence.ProductAttributes{Name: "name", Price: 1337})
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("id is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", persistence.ProductAttributes{Name: "name", Price: 1337})
+		s.Require().NoError(err)
+		err = r.UpdateProduct(ctx, "ID", persistence.ProductAttributes{Name: "name", Price: 1337})
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("deleted", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", persistence.ProductAttributes{Name: "name", Price: 1337})
+		s.Require().NoError(err)
+		err = r.DeleteProduct(ctx, "id")
+		s.Require().NoError(err)
+		err = r.UpdateProduct(ctx, "id", persistence.ProductAttributes{Name: "name", Price: 1337})
+		s.True(errors.Is(err, persistence.ErrDeleted))
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", persistence.ProductAttributes{Name: "name", Price: 0})
+		s.Require().NoError(err)
+		var wg sync.WaitGroup
+		do := func(name string) {
+			defer wg.Done()
+			for i := 1; i <= 5; i++ {
+				err := r.UpdateProduct(ctx, "id", persistence.ProductAttributes{Name: name, Price: i})
+				s.Require().NoError(err)
+			}
+		}
+		wg.Add(2)
+		go do("name1")
+		go do("name2")
+		wg.Wait()
+		product, err := r.FindProduct(ctx, "id")
+		s.NoError(err)
+		s.Contains([]string{"name1", "name2"}, product.Name)
+		s.Equal(5, product.Price)
+	})
+}
+
+// TestDeleteProduct tests deleting a product.
+func (s *ProductRepositoryTestSuite) TestDeleteProduct() {
+	s.Run("deletes a product", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id1", persistence.ProductAttributes{Name: "name1", Price: 1})
+		s.Require().NoError(err)
+		err = r.CreateProduct(ctx, "id2", persistence.ProductAttributes{Name: "name2", Price: 2})
+		s.Require().NoError(err)
+		err = r.DeleteProduct(ctx, "id1")
+		s.Require().NoError(err)
+		s.Run("and finding it returns deleted", func() {
+			product, err := r.FindProduct(ctx, "id1")
+			s.True(errors.Is(err, persistence.ErrDeleted))
+			s.Nil(product)
+		})
+		s.Run("and finding all does not return it", func() {
+			products, err := r.FindAllProducts(ctx)
+			s.NoError(err)
+			s.Equal([]*model.Product{{ID: "id2", Name: "name2", Price: 2}}, products)
+		})
+		s.Run("and deleting it again returns deleted", func() {
+			err := r.DeleteProduct(ctx, "id1")
+			s.True(errors.Is(err, persistence.ErrDeleted))
+		})
+		s.Run("prevents re-creating it", func() {
+			err := r.CreateProduct(ctx, "id1", persistence.ProductAttributes{Name: "name1", Price: 1})
+			s.True(errors.Is(err, persistence.ErrConflict))
+		})
+		s.Run("does not delete other products", func() {
+			product, err := r.FindProduct(ctx, "id2")
+			s.NoError(err)
+			s.Equal(&model.Product{ID: "id2", Name: "name2", Price: 2}, product)
+		})
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.DeleteProduct(ctx, "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("id is case-sensitive", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", persistence.ProductAttributes{Name: "name", Price: 1337})
+		s.Require().NoError(err)
+		err = r.DeleteProduct(ctx, "ID")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		ids := []string{
+			"4c3e6a6b-21e8-4bd8-9c38-52a0e9a1b0f2",
+			"8f5d1c7e-7c44-4f0a-a2b9-3c6d9e0f1a2b",
+			"b2e9f0a1-5d6c-4e7f-8a9b-0c1d2e3f4a5b",
+			"c7d8e9f0-1a2b-4c3d-9e4f-5a6b7c8d9e0f",
+			"d1e2f3a4-b5c6-4d7e-8f9a-0b1c2d3e4f5a",
+			"e5f6a7b8-c9d0-4e1f-a2b3-c4d5e6f7a8b9",
+		}
+		do := func(ids []string) {
+			defer wg.Done()
+			for _, id := range ids {
+				err := r.CreateProduct(ctx, id, persistence.ProductAttributes{Name: "name", Price: 1337})
+				s.Require().NoError(err)
+			}
+			for _, id := range ids {
+				err := r.DeleteProduct(ctx, id)
+				s.Require().NoError(err)
+			}
+		}
+		wg.Add(2)
+		go do(ids[:3])
+		go do(ids[3:])
+		wg.Wait()
+		products, err := r.FindAllProducts(ctx)
+		s.NoError(err)
+		s.Empty(products)
+	})
+}
+
+// returns product attributes with all fields set
+func newProductAttributes() persistence.ProductAttributes {
+	return persistence.ProductAttributes{
+		Name:        "Orange",
+		Price:       79,
+		Prices:      map[model.Currency]int{"USD": 89, "JPY": 120},
+		TaxClass:    "reduced",
+		Weight:      180,
+		Description: "A fresh orange.\n\u0000‽",
+		SKU:         "FRUIT-ORANGE",
+		Categories:  []string{"fruits", "citrus fruits", "Fruits"},
+		Attributes: map[string]string{
+			"color":  "orange",
+			"origin": "Spain",
+			"":       "",
+		},
+		Images: []model.Image{
+			{URL: "/static/products/orange.jpg", Alt: "An orange"},
+			{URL: "https://example.com/orange-2.jpg"},
+		},
+	}
+}
+
+// TestProductAttributes tests that all attributes of a product are stored.
+func (s *ProductRepositoryTestSuite) TestProductAttributes() {
+	s.Run("are created", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", newProductAttributes())
+		s.Require().NoError(err)
+		product, err := r.FindProduct(ctx, "id")
+		s.NoError(err)
+		s.Equal(&model.Product{
+			ID:          "id",
+			Name:        "Orange",
+			Price:       79,
+			Prices:      map[model.Currency]int{"USD": 89, "JPY": 120},
+			TaxClass:    "reduced",
+			Weight:      180,
+			Description: "A fresh orange.\n\u0000‽",
+			SKU:         "FRUIT-ORANGE",
+			Categories:  []string{"fruits", "citrus fruits", "Fruits"},
+			Attributes: map[string]string{
+				"color":  "orange",
+				"origin": "Spain",
+				"":       "",
+			},
+			Images: []model.Image{
+				{URL: "/static/products/orange.jpg", Alt: "An orange"},
+				{URL: "https://example.com/orange-2.jpg"},
+			},
+		}, product)
+		s.Run("and found among all", func() {
+			products, err := r.FindAllProducts(ctx)
+			s.NoError(err)
+			s.Equal([]*model.Product{product}, products)
+		})
+	})
+	s.Run("are replaced on update", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", newProductAttributes())
+		s.Require().NoError(err)
+		err = r.UpdateProduct(ctx, "id", persistence.ProductAttributes{
+			Name:       "Blood orange",
+			Price:      89,
+			Prices:     map[model.Currency]int{"GBP": 75},
+			Categories: []string{"citrus fruits"},
+			Images:     []model.Image{{URL: "/static/products/blood-orange.jpg"}},
+		})
+		s.Require().NoError(err)
+		product, err := r.FindProduct(ctx, "id")
+		s.NoError(err)
+		s.Equal(&model.Product{
+			ID:         "id",
+			Name:       "Blood orange",
+			Price:      89,
+			Prices:     map[model.Currency]int{"GBP": 75},
+			Categories: []string{"citrus fruits"},
+			Images:     []model.Image{{URL: "/static/products/blood-orange.jpg"}},
+		}, product)
+	})
+	s.Run("are nil if empty", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", persistence.ProductAttributes{
+			Prices:     map[model.Currency]int{},
+			Categories: []string{},
+			Attributes: map[string]string{},
+			Images:     []model.Image{},
+		})
+		s.Require().NoError(err)
+		product, err := r.FindProduct(ctx, "id")
+		s.NoError(err)
+		s.Nil(product.Prices)
+		s.Nil(product.Categories)
+		s.Nil(product.Attributes)
+		s.Nil(product.Images)
+	})
+	s.Run("are not shared between products", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id1", newProductAttributes())
+		s.Require().NoError(err)
+		err = r.CreateProduct(ctx, "id2", persistence.ProductAttributes{Name: "Apple"})
+		s.Require().NoError(err)
+		product, err := r.FindProduct(ctx, "id2")
+		s.NoError(err)
+		s.Equal(&model.Product{ID: "id2", Name: "Apple"}, product)
+	})
+	s.Run("changing the input or result does not have any side effects", func() {
+		r := s.NewRepository()
+		attributes := newProductAttributes()
+		err := r.CreateProduct(ctx, "id", attributes)
+		s.Require().NoError(err)
+		attributes.Prices["USD"] = 1
+		attributes.Categories[0] = "changed"
+		attributes.Attributes["color"] = "changed"
+		attributes.Images[0].URL = "changed"
+		product, err := r.FindProduct(ctx, "id")
+		s.Require().NoError(err)
+		product.Prices["JPY"] = 1
+		product.Categories[1] = "changed"
+		product.Attributes["origin"] = "changed"
+		product.Images[1].Alt = "changed"
+		product, err = r.FindProduct(ctx, "id")
+		s.NoError(err)
+		expected := newProductAttributes()
+		s.Equal(expected.Prices, product.Prices)
+		s.Equal(expected.Categories, product.Categories)
+		s.Equal(expected.Attributes, product.Attributes)
+		s.Equal(expected.Images, product.Images)
+	})
+}
+
+// creates products to query and returns the repository
+func (s *ProductRepositoryTestSuite) newQueryRepository() persistence.ProductRepository {
+	r := s.NewRepository()
+	for id, attributes := range map[string]persistence.ProductAttributes{
+		"1": {Name: "Apple", Price: 49, Prices: usd(55), SKU: "FRUIT-APPLE", Categories: []string{"fruits"}},
+		"2": {Name: "Banana", Price: 99, Prices: usd(109), Description: "Sweet and yellow.", Categories: []string{"fruits", "tropical fruits"}},
+		"3": {Name: "Orange", Price: 79, Prices: usd(85), Categories: []string{"fruits", "citrus fruits"}},
+		"4": {Name: "Pear", Price: 49, Description: "Juicy as an apple."},
+		"5": {Name: "pineapple", Price: 299, Categories: []string{"tropical fruits"}},
+		"6": {Name: "Apple", Price: 59, Prices: usd(65), SKU: "fruit-apple-2", Categories: []string{"Fruits"}},
+		"7": {Name: "Deleted apple", Price: 49, Prices: usd(55), Categories: []string{"fruits"}},
+	} {
+		err := r.CreateProduct(ctx, id, attributes)
+		s.Require().NoError(err)
+	}
+	err := r.DeleteProduct(ctx, "7")
+	s.Require().NoError(err)
+	return r
+}
+
+// returns the ids of the products
+func productIDs(products []*model.Product) []string {
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids
+}
+
+func intPointer(i int) *int {
+	return &i
+}
+
+// returns a price list with the price in US dollars
+func usd(price int) map[model.Currency]int {
+	return map[model.Currency]int{"USD": price}
+}
+
+// TestQueryProducts tests searching, filtering, sorting and paging products.
+func (s *ProductRepositoryTestSuite) TestQueryProducts() {
+	s.Run("empty repository", func() {
+		r := s.NewRepository()
+		products, err := r.QueryProducts(ctx, persistence.ProductQuery{})
+		s.NoError(err)
+		s.Empty(products)
+	})
+	s.Run("all by default", func() {
+		r := s.newQueryRepository()
+		products, err := r.QueryProducts(ctx, persistence.ProductQuery{})
+		s.NoError(err)
+		s.Equal([]string{"1", "6", "2", "3", "4", "5"}, productIDs(products))
+	})
+	s.Run("with all attributes", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", newProductAttributes())
+		s.Require().NoError(err)
+		products, err := r.QueryProducts(ctx, persistence.ProductQuery{})
+		s.NoError(err)
+		product, err := r.FindProduct(ctx, "id")
+		s.Require().NoError(err)
+		s.Equal([]*model.Product{product}, products)
+	})
+	for _, c := range []struct {
+		name  string
+		query persistence.ProductQuery
+		ids   []string
+	}{
+		{"search name", persistence.ProductQuery{Search: "apple"}, []string{"1", "6", "4", "5"}},
+		{"search ignores case", persistence.ProductQuery{Search: "APPLE"}, []string{"1", "6", "4", "5"}},
+		{"search description", persistence.ProductQuery{Search: "yellow"}, []string{"2"}},
+		{"search sku", persistence.ProductQuery{Search: "apple-2"}, []string{"6"}},
+		{"search nothing", persistence.ProductQuery{Search: "kiwi"}, []string{}},
+		{"min price", persistence.ProductQuery{MinPrice: intPointer(79)}, []string{"2", "3", "5"}},
+		{"max price", persistence.ProductQuery{MaxPrice: intPointer(59)}, []string{"1", "6", "4"}},
+		{"price range", persistence.ProductQuery{MinPrice: intPointer(59), MaxPrice: intPointer(99)}, []string{"6", "2", "3"}},
+		{"empty price range", persistence.ProductQuery{MinPrice: intPointer(60), MaxPrice: intPointer(59)}, []string{}},
+		{"category", persistence.ProductQuery{Categories: []string{"fruits"}}, []string{"1", "2", "3"}},
+		{"any category", persistence.ProductQuery{Categories: []string{"citrus fruits", "tropical fruits"}}, []string{"2", "3", "5"}},
+		{"unknown category", persistence.ProductQuery{Categories: []string{"vegetables"}}, []string{}},
+		{"combined", persistence.ProductQuery{Search: "apple", MaxPrice: intPointer(100), Categories: []string{"fruits", "Fruits"}}, []string{"1", "6"}},
+		{"sort by name", persistence.ProductQuery{Sort: model.ProductSortNameAsc}, []string{"1", "6", "2", "3", "4", "5"}},
+		{"sort by name descending", persistence.ProductQuery{Sort: model.ProductSortNameDesc}, []string{"5", "4", "3", "2", "1", "6"}},
+		{"sort by price", persistence.ProductQuery{Sort: model.ProductSortPriceAsc}, []string{"1", "4", "6", "3", "2", "5"}},
+		{"sort by price descending", persistence.ProductQuery{Sort: model.ProductSortPriceDesc}, []string{"5", "2", "3", "6", "1", "4"}},
+		{"limit", persistence.ProductQuery{Sort: model.ProductSortPriceAsc, Limit: 2}, []string{"1", "4"}},
+		{"limit larger than result", persistence.ProductQuery{Search: "yellow", Limit: 2}, []string{"2"}},
+		{"after", persistence.ProductQuery{After: &model.Product{ID: "1", Name: "Apple"}}, []string{"6", "2", "3", "4", "5"}},
+		{"after unknown", persistence.ProductQuery{After: &model.Product{ID: "x", Name: "B"}}, []string{"2", "3", "4", "5"}},
+		{"after by price", persistence.ProductQuery{Sort: model.ProductSortPriceDesc, After: &model.Product{ID: "6", Price: 59}, Limit: 1}, []string{"1"}},
+		{"after last", persistence.ProductQuery{After: &model.Product{ID: "5", Name: "pineapple"}}, []string{}},
+		{"default currency", persistence.ProductQuery{Currency: model.DefaultCurrency}, []string{"1", "6", "2", "3", "4", "5"}},
+		{"currency", persistence.ProductQuery{Currency: "USD"}, []string{"1", "6", "2", "3"}},
+		{"unknown currency", persistence.ProductQuery{Currency: "GBP"}, []string{}},
+		{"price range in currency", persistence.ProductQuery{Currency: "USD", MinPrice: intPointer(60), MaxPrice: intPointer(99)}, []string{"6", "3"}},
+		{"sort by price in currency", persistence.ProductQuery{Currency: "USD", Sort: model.ProductSortPriceAsc}, []string{"1", "6", "3", "2"}},
+		{"after by price in currency", persistence.ProductQuery{Currency: "USD", Sort: model.ProductSortPriceAsc,
+			After: &model.Product{ID: "6", Prices: usd(65)}}, []string{"3", "2"}},
+	} {
+		c := c
+		s.Run(c.name, func() {
+			r := s.newQueryRepository()
+			products, err := r.QueryProducts(ctx, c.query)
+			s.NoError(err)
+			s.Equal(c.ids, productIDs(products))
+		})
+	}
+	s.Run("pages", func() {
+		r := s.newQueryRepository()
+		for _, sort := range []model.ProductSort{
+			model.ProductSortNameAsc,
+			model.ProductSortNameDesc,
+			model.ProductSortPriceAsc,
+			model.ProductSortPriceDesc,
+		} {
+			all, err := r.QueryProducts(ctx, persistence.ProductQuery{Sort: sort})
+			s.Require().NoError(err)
+			var paged []*model.Product
+			query := persistence.ProductQuery{Sort: sort, Limit: 4}
+			for {
+				products, err := r.QueryProducts(ctx, query)
+				s.Require().NoError(err)
+				paged = append(paged, products...)
+				if len(products) < query.Limit {
+					break
+				}
+				query.After = products[len(products)-1]
+			}
+			s.Equal(productIDs(all), productIDs(paged), sort)
+		}
+	})
+	s.Run("pages in currency", func() {
+		r := s.newQueryRepository()
+		for _, sort := range []model.ProductSort{
+			model.ProductSortPriceAsc,
+			model.ProductSortPriceDesc,
+		} {
+			all, err := r.QueryProducts(ctx, persistence.ProductQuery{Currency: "USD", Sort: sort})
+			s.Require().NoError(err)
+			var paged []*model.Product
+			query := persistence.ProductQuery{Currency: "USD", Sort: sort, Limit: 3}
+			for {
+				products, err := r.QueryProducts(ctx, query)
+				s.Require().NoError(err)
+				paged = append(paged, products...)
+				if len(products) < query.Limit {
+					break
+				}
+				query.After = products[len(products)-1]
+			}
+			s.Equal(productIDs(all), productIDs(paged), sort)
+		}
+	})
+	s.Run("changing the result does not have any side effects", func() {
+		r := s.NewRepository()
+		err := r.CreateProduct(ctx, "id", newProductAttributes())
+		s.Require().NoError(err)
+		products, err := r.QueryProducts(ctx, persistence.ProductQuery{})
+		s.Require().NoError(err)
+		products[0].Name = "changed"
+		products[0].Categories[0] = "changed"
+		products, err = r.QueryProducts(ctx, persistence.ProductQuery{})
+		s.NoError(err)
+		s.Equal("Orange", products[0].Name)
+		s.Equal("fruits", products[0].Categories[0])
+	})
+}
@@ -0,0 +1,403 @@
+package testsuite
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/stretchr/testify/suite"
+)
+
+// PromotionRepositoryTestSuite is the suite that tests that a promotion
+// repository behaves as expected. Use RunSuite to run it.
+type PromotionRepositoryTestSuite struct {
+	suite.Suite
+	NewRepository func() persistence.PromotionRepository
+}
+
+// RunSuite runs the test suite.
+func (s *PromotionRepositoryTestSuite) RunSuite(t *testing.T) {
+	suite.Run(t, s)
+}
+
+// TestStorePromotion tests the promotion creation/updates.
+func (s *PromotionRepositoryTestSuite) TestStorePromotion() {
+	s.Run("one", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx,
+			"e8a4d4f5-6ba1-4b44-b1b3-2bd6b0d1b6c5", // id
+			persistence.PromotionAttributes{
+				Type:      model.PromotionTypeQuantityThreshold,
+				Name:      "10% off apples",
+				ProductID: "a6da78f8-2be6-49ff-b40a-32aa86a6a986",
+				Quantity:  7,
+				Discount:  10,
+			},
+		)
+		s.NoError(err)
+	})
+	s.Run("with empty everything", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "", persistence.PromotionAttributes{})
+		s.NoError(err)
+	})
+	s.Run("many", func() {
+		r := s.NewRepository()
+		for _, c := range []struct {
+			id, name string
+			discount int
+		}{
+			{"2c0e0d9e-8a4b-4c6f-9f0e-3a5b0e9c1f50", "name 50", 50},
+			{"c4b4c0b7-7d0e-4b58-9a39-0e4a5e6f2d51", "name 51", 51},
+			{"8f0b1c4e-2b7a-4f8e-8e1d-6b1c2d3e4f52", "name 52", 52},
+			{"6d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f53", "name 53", 53},
+			{"f1e2d3c4-b5a6-4978-8695-a4b3c2d1e054", "name 54", 54},
+		} {
+			err := r.StorePromotion(ctx, c.id, persistence.PromotionAttributes{
+				Type:     model.PromotionTypeBundle,
+				Name:     c.name,
+				Bundle:   map[string]int{"b16088e1-9603-4676-a8df-130823cf15a5": 2},
+				Discount: c.discount,
+			})
+			s.Require().NoError(err)
+		}
+	})
+	s.Run("no conflict", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "id", persistence.PromotionAttributes{Name: "name"})
+		s.Require().NoError(err)
+		err = r.StorePromotion(ctx, "id", persistence.PromotionAttributes{Name: "name"})
+		s.NoError(err)
+	})
+	s.Run("supports more complex strings", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "औकखग", persistence.PromotionAttributes{
+			Type:      "\u0000\t\"abc",
+			Name:      "‽ⓐ◐\n👽 乐乑",
+			ProductID: "乐乑",
+			Bundle:    map[string]int{"‽ⓐ◐\n👽": -1337},
+			Discount:  -1337,
+		})
+		s.NoError(err)
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		ids := []string{
+			"5bd52b3a-ed59-460f-b6fb-d0c0d49f81e0",
+			"196bcfaa-154b-4c7e-bf35-907d96ce1f15",
+			"721e6fdc-605a-4528-9d96-2418747cdf0e",
+			"1386a8bd-2663-4ed6-b36e-47553c89e036",
+			"6a0152cf-46fb-4606-a02b-b4bbef8421f3",
+			"9449ff31-949f-43f0-88a1-d2051c5479e4",
+		}
+		do := func(ids []string) {
+			defer wg.Done()
+			for _, id := range ids {
+				err := r.StorePromotion(ctx, id, persistence.PromotionAttributes{
+					Type:      model.PromotionTypeBuyXGetY,
+					ProductID: "cfae533e-d9f2-4bbc-8fcb-24866fdca8fc",
+				})
+				s.Require().NoError(err)
+			}
+		}
+		wg.Add(2)
+		go do(ids[:3])
+		go do(ids[3:])
+		wg.Wait()
+	})
+}
+
+// TestFindAllPromotions tests finding all promotions.
+func (s *PromotionRepositoryTestSuite) TestFindAllPromotions() {
+	s.Run("finds promotion", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "4b7b0c40-7c0b-4f0a-9df2-6d1e1f5cb3a1", persistence.PromotionAttributes{
+			Type:     model.PromotionTypeBundle,
+			Name:     "北京市",
+			Bundle:   map[string]int{"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": 4, "b16088e1-9603-4676-a8df-130823cf15a5": 2},
+			Discount: 30,
+		})
+		s.Require().NoError(err)
+		promotions, err := r.FindAllPromotions(ctx)
+		s.NoError(err)
+		s.Equal([]*model.Promotion{
+			{
+				ID:       "4b7b0c40-7c0b-4f0a-9df2-6d1e1f5cb3a1",
+				Type:     model.PromotionTypeBundle,
+				Name:     "北京市",
+				Bundle:   map[string]int{"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": 4, "b16088e1-9603-4676-a8df-130823cf15a5": 2},
+				Discount: 30,
+			},
+		}, promotions)
+	})
+	s.Run("finds many promotions", func() {
+		r := s.NewRepository()
+		for _, c := range []struct {
+			id, name string
+			quantity int
+		}{
+			{"075a4c76-a06b-412e-a96f-43cf9ca5cd92", "name 143", 143},
+			{"f7062ad5-5d2b-4842-987a-1e58e2a27777", "name 144", 144},
+			{"e02c1dbd-2d07-41b7-b368-2258e9a396b8", "name 145", 145},
+			{"18970305-6cea-4000-a705-3b70bdaf15da", "name 146", 146},
+		} {
+			err := r.StorePromotion(ctx, c.id, persistence.PromotionAttributes{
+				Type:         model.PromotionTypeBuyXGetY,
+				Name:         c.name,
+				ProductID:    "cfae533e-d9f2-4bbc-8fcb-24866fdca8fc",
+				Quantity:     c.quantity,
+				FreeQuantity: 1,
+				Discount:     100,
+			})
+			s.Require().NoError(err)
+		}
+		promotions, err := r.FindAllPromotions(ctx)
+		s.NoError(err)
+		s.ElementsMatch([]*model.Promotion{
+			{ID: "075a4c76-a06b-412e-a96f-43cf9ca5cd92", Type: model.PromotionTypeBuyXGetY, Name: "name 143", ProductID: "cfae533e-d9f2-4bbc-8fcb-24866fdca8fc", Quantity: 143, FreeQuantity: 1, Discount: 100},
+			{ID: "f7062ad5-5d2b-4842-987a-1e58e2a27777", Type: model.PromotionTypeBuyXGetY, Name: "name 144", ProductID: "cfae533e-d9f2-4bbc-8fcb-24866fdca8fc", Quantity: 144, FreeQuantity: 1, Discount: 100},
+			{ID: "e02c1dbd-2d07-41b7-b368-2258e9a396b8", Type: model.PromotionTypeBuyXGetY, Name: "name 145", ProductID: "cfae533e-d9f2-4bbc-8fcb-24866fdca8fc", Quantity: 145, FreeQuantity: 1, Discount: 100},
+			{ID: "18970305-6cea-4000-a705-3b70bdaf15da", Type: model.PromotionTypeBuyXGetY, Name: "name 146", ProductID: "cfae533e-d9f2-4bbc-8fcb-24866fdca8fc", Quantity: 146, FreeQuantity: 1, Discount: 100},
+		}, promotions)
+	})
+	s.Run("no promotions exist", func() {
+		r := s.NewRepository()
+		promotions, err := r.FindAllPromotions(ctx)
+		s.NoError(err)
+		s.Equal([]*model.Promotion{}, promotions)
+	})
+	s.Run("does not find deleted promotions", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "0b5ac2f4-73e1-4d0a-9a3f-7d2a7f1e9b11", persistence.PromotionAttributes{Name: "name"})
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "0b5ac2f4-73e1-4d0a-9a3f-7d2a7f1e9b11")
+		s.Require().NoError(err)
+		promotions, err := r.FindAllPromotions(ctx)
+		s.NoError(err)
+		s.Equal([]*model.Promotion{}, promotions)
+	})
+}
+
+// TestFindPromotion tests finding a promotion.
+func (s *PromotionRepositoryTestSuite) TestFindPromotion() {
+	s.Run("finds promotion", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "e6c73a05-c169-452e-8a6c-4afd9ffeb8ba", persistence.PromotionAttributes{
+			Type:      model.PromotionTypeQuantityThreshold,
+			Name:      "北京市",
+			ProductID: "a6da78f8-2be6-49ff-b40a-32aa86a6a986",
+			Quantity:  7,
+			Discount:  10,
+		})
+		s.Require().NoError(err)
+		promotion, err := r.FindPromotion(ctx, "e6c73a05-c169-452e-8a6c-4afd9ffeb8ba")
+		s.NoError(err)
+		s.Equal(&model.Promotion{
+			ID:        "e6c73a05-c169-452e-8a6c-4afd9ffeb8ba",
+			Type:      model.PromotionTypeQuantityThreshold,
+			Name:      "北京市",
+			ProductID: "a6da78f8-2be6-49ff-b40a-32aa86a6a986",
+			Quantity:  7,
+			Discount:  10,
+		}, promotion)
+	})
+	s.Run("does find the latest version of a promotion", func() {
+		r := s.NewRepository()
+		for _, c := range []struct {
+			name     string
+			discount int
+		}{
+			{"name 176", 176},
+			{"name 177", 177},
+			{"name 178", 178},
+		} {
+			err := r.StorePromotion(ctx, "ED2BBF84", persistence.PromotionAttributes{
+				Name:     c.name,
+				Discount: c.discount,
+			})
+			s.Require().NoError(err)
+		}
+		promotion, err := r.FindPromotion(ctx, "ED2BBF84")
+		s.NoError(err)
+		s.Equal(&model.Promotion{
+			ID:       "ED2BBF84",
+			Name:     "name 178",
+			Discount: 178,
+		}, promotion)
+	})
+	s.Run("does not find other promotion", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "629faf00-6ffd-4c87-8b7b-7805162709bc", persistence.PromotionAttributes{Name: "name"})
+		s.Require().NoError(err)
+		promotion, err := r.FindPromotion(ctx, "efc07346-98ac-4c6d-81e9-af3a93c03c71")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(promotion)
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		ids := []string{
+			"012887a6-0f3a-447e-a524-2ea2f70264c4",
+			"75199849-5dde-4d87-811a-504e1893e31c",
+			"74c84ced-0430-4076-b65c-be72930ed7e9",
+			"7aee97ac-767e-49c5-9df7-b572dd12875c",
+			"ec20f20e-3173-4b8f-a6a2-2194936f81d9",
+			"b067259d-c1ef-4915-af2a-bec3ada752da",
+		}
+		do := func(ids []string) {
+			defer wg.Done()
+			for _, id := range ids {
+				err := r.StorePromotion(ctx, id, persistence.PromotionAttributes{Name: id})
+				s.Require().NoError(err)
+			}
+			for _, id := range ids {
+				_, err := r.FindPromotion(ctx, id)
+				s.Require().NoError(err)
+			}
+		}
+		wg.Add(2)
+		go do(ids[:3])
+		go do(ids[3:])
+		wg.Wait()
+	})
+	s.Run("changing the result does not have any side effects", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "aeaedf82-2d9b-4e69-948b-c3ab92f893df", persistence.PromotionAttributes{
+			Type:     model.PromotionTypeBundle,
+			Name:     "北京市",
+			Bundle:   map[string]int{"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": 4},
+			Discount: 30,
+		})
+		s.Require().NoError(err)
+		promotion, err := r.FindPromotion(ctx, "aeaedf82-2d9b-4e69-948b-c3ab92f893df")
+		s.Require().NoError(err)
+		// changing the result ...
+		promotion.ID = "changed"
+		promotion.Name = "changed"
+		promotion.Bundle["5438bfe8-6bd2-4a88-ac36-ec29716eb6d7"] = 1
+		promotion.Bundle["changed"] = 1
+		promotion.Discount--
+		// ... does not have any side effects
+		promotion, err = r.FindPromotion(ctx, "aeaedf82-2d9b-4e69-948b-c3ab92f893df")
+		s.NoError(err)
+		s.Equal(&model.Promotion{
+			ID:       "aeaedf82-2d9b-4e69-948b-c3ab92f893df",
+			Type:     model.PromotionTypeBundle,
+			Name:     "北京市",
+			Bundle:   map[string]int{"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": 4},
+			Discount: 30,
+		}, promotion)
+	})
+}
+
+// TestDeletePromotion tests deleting a promotion.
+func (s *PromotionRepositoryTestSuite) TestDeletePromotion() {
+	s.Run("deletes promotion", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "7d1f1b7e-3b1a-4c6e-9e0f-5a2b3c4d5e6f", persistence.PromotionAttributes{Name: "name"})
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "7d1f1b7e-3b1a-4c6e-9e0f-5a2b3c4d5e6f")
+		s.NoError(err)
+		promotion, err := r.FindPromotion(ctx, "7d1f1b7e-3b1a-4c6e-9e0f-5a2b3c4d5e6f")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(promotion)
+	})
+	s.Run("does not delete other promotion", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "3e3b8d0c-0b8f-4f57-bd8e-0b3f2c8e2d7a", persistence.PromotionAttributes{Name: "name"})
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "1f0e2d3c-4b5a-4968-8776-a5b4c3d2e1f0")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		_, err = r.FindPromotion(ctx, "3e3b8d0c-0b8f-4f57-bd8e-0b3f2c8e2d7a")
+		s.NoError(err)
+	})
+	s.Run("cannot delete twice", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "9a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d", persistence.PromotionAttributes{Name: "name"})
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "9a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d")
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "9a8b7c6d-5e4f-4a3b-9c2d-1e0f9a8b7c6d")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("can store again after deletion", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "0f1e2d3c-4b5a-4697-a8b9-cadbecfd0e1f", persistence.PromotionAttributes{Name: "old"})
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "0f1e2d3c-4b5a-4697-a8b9-cadbecfd0e1f")
+		s.Require().NoError(err)
+		err = r.StorePromotion(ctx, "0f1e2d3c-4b5a-4697-a8b9-cadbecfd0e1f", persistence.PromotionAttributes{Name: "new"})
+		s.Require().NoError(err)
+		promotion, err := r.FindPromotion(ctx, "0f1e2d3c-4b5a-4697-a8b9-cadbecfd0e1f")
+		s.NoError(err)
+		s.Equal("new", promotion.Name)
+	})
+}
+
+// TestSeedPromotions tests seeding promotions.
+func (s *PromotionRepositoryTestSuite) TestSeedPromotions() {
+	seed := map[string]persistence.PromotionAttributes{
+		"4a0d5f6e-3f2c-4c3b-9b4e-2f5a3b1c7d21": {Name: "first", Discount: 10},
+		"0de17a66-ea59-4032-9383-2603c6c77d25": {
+			Type:     model.PromotionTypeBundle,
+			Name:     "second",
+			Bundle:   map[string]int{"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": 4},
+			Discount: 30,
+		},
+	}
+	s.Run("seeds promotions", func() {
+		r := s.NewRepository()
+		err := r.SeedPromotions(ctx, seed)
+		s.Require().NoError(err)
+		promotions, err := r.FindAllPromotions(ctx)
+		s.NoError(err)
+		s.ElementsMatch([]*model.Promotion{
+			{ID: "4a0d5f6e-3f2c-4c3b-9b4e-2f5a3b1c7d21", Name: "first", Discount: 10},
+			{
+				ID:       "0de17a66-ea59-4032-9383-2603c6c77d25",
+				Type:     model.PromotionTypeBundle,
+				Name:     "second",
+				Bundle:   map[string]int{"5438bfe8-6bd2-4a88-ac36-ec29716eb6d7": 4},
+				Discount: 30,
+			},
+		}, promotions)
+	})
+	s.Run("does not restore deleted promotions", func() {
+		r := s.NewRepository()
+		err := r.SeedPromotions(ctx, seed)
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "4a0d5f6e-3f2c-4c3b-9b4e-2f5a3b1c7d21")
+		s.Require().NoError(err)
+		err = r.DeletePromotion(ctx, "0de17a66-ea59-4032-9383-2603c6c77d25")
+		s.Require().NoError(err)
+		err = r.SeedPromotions(ctx, seed)
+		s.NoError(err)
+		promotions, err := r.FindAllPromotions(ctx)
+		s.NoError(err)
+		s.Equal([]*model.Promotion{}, promotions)
+	})
+	s.Run("does not overwrite changed promotions", func() {
+		r := s.NewRepository()
+		err := r.SeedPromotions(ctx, seed)
+		s.Require().NoError(err)
+		err = r.StorePromotion(ctx, "4a0d5f6e-3f2c-4c3b-9b4e-2f5a3b1c7d21", persistence.PromotionAttributes{Name: "changed"})
+		s.Require().NoError(err)
+		err = r.SeedPromotions(ctx, seed)
+		s.NoError(err)
+		promotion, err := r.FindPromotion(ctx, "4a0d5f6e-3f2c-4c3b-9b4e-2f5a3b1c7d21")
+		s.NoError(err)
+		s.Equal("changed", promotion.Name)
+	})
+	s.Run("does not seed into existing promotions", func() {
+		r := s.NewRepository()
+		err := r.StorePromotion(ctx, "b2c1d0e9-8f7a-4b6c-9d5e-4f3a2b1c0d9e", persistence.PromotionAttributes{Name: "name"})
+		s.Require().NoError(err)
+		err = r.SeedPromotions(ctx, seed)
+		s.NoError(err)
+		_, err = r.FindPromotion(ctx, "4a0d5f6e-3f2c-4c3b-9b4e-2f5a3b1c7d21")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
@@ -0,0 +1,258 @@
+package testsuite
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/stretchr/testify/suite"
+)
+
+// SessionRepositoryTestSuite is the suite that tests that a session repository
+// behaves as expected. Use RunSuite to run it.
+type SessionRepositoryTestSuite struct {
+	suite.Suite
+	NewRepository func() persistence.SessionRepository
+}
+
+// RunSuite runs the test suite.
+func (s *SessionRepositoryTestSuite) RunSuite(t *testing.T) {
+	suite.Run(t, s)
+}
+
+// TestCreateSession tests the session creation.
+func (s *SessionRepositoryTestSuite) TestCreateSession() {
+	s.Run("one", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx,
+			"4f1e8a0c-5b8e-4d5e-9a53-0b6f2f1d8c11", // id
+			"9b7e5d2c-1c3f-4a8d-8d6e-2e4b6a0c9f12", // user id
+			"refresh token",                        // refresh token
+			time.Now().Add(time.Hour),              // expires at
+		)
+		s.NoError(err)
+		session, err := r.FindSession(ctx, "4f1e8a0c-5b8e-4d5e-9a53-0b6f2f1d8c11")
+		s.NoError(err)
+		s.Equal("9b7e5d2c-1c3f-4a8d-8d6e-2e4b6a0c9f12", session.UserID)
+	})
+	s.Run("many of the same user", func() {
+		r := s.NewRepository()
+		for _, id := range []string{"session 1", "session 2", "session 3"} {
+			err := r.CreateSession(ctx, id, "user", "token", time.Now().Add(time.Hour))
+			s.Require().NoError(err)
+		}
+	})
+	s.Run("conflict on same id", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user 1", "token 1", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.CreateSession(ctx, "id", "user 2", "token 2", time.Now().Add(time.Hour))
+		s.True(errors.Is(err, persistence.ErrConflict))
+	})
+	s.Run("same id as expired session", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(-time.Second))
+		s.Require().NoError(err)
+		err = r.CreateSession(ctx, "id", "user", "token", time.Now().Add(time.Hour))
+		s.NoError(err)
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		ids := []string{"session 1", "session 2", "session 3", "session 4", "session 5", "session 6"}
+		do := func(ids []string) {
+			defer wg.Done()
+			for _, id := range ids {
+				err := r.CreateSession(ctx, id, "user", "token", time.Now().Add(time.Hour))
+				s.Require().NoError(err)
+			}
+		}
+		wg.Add(2)
+		go do(ids[:3])
+		go do(ids[3:])
+		wg.Wait()
+	})
+}
+
+// TestRotateSession tests replacing the refresh token of sessions.
+func (s *SessionRepositoryTestSuite) TestRotateSession() {
+	s.Run("rotates", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token 1", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		t := time.Now().Add(2 * time.Hour)
+		err = r.RotateSession(ctx, "id", "token 1", "token 2", t)
+		s.NoError(err)
+		session, err := r.FindSession(ctx, "id")
+		s.Require().NoError(err)
+		s.WithinDuration(t, session.ExpiresAt, time.Second)
+		// the new token is the current one
+		err = r.RotateSession(ctx, "id", "token 2", "token 3", t)
+		s.NoError(err)
+	})
+	s.Run("old token is rejected", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token 1", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.RotateSession(ctx, "id", "token 1", "token 2", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.RotateSession(ctx, "id", "token 1", "token 3", time.Now().Add(time.Hour))
+		s.True(errors.Is(err, persistence.ErrConflict))
+	})
+	s.Run("wrong token", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.RotateSession(ctx, "id", "Token", "token 2", time.Now().Add(time.Hour))
+		s.True(errors.Is(err, persistence.ErrConflict))
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.RotateSession(ctx, "id", "token", "token 2", time.Now().Add(time.Hour))
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("expired", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(-time.Second))
+		s.Require().NoError(err)
+		err = r.RotateSession(ctx, "id", "token", "token 2", time.Now().Add(time.Hour))
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		do := func(i int, newToken string) {
+			defer wg.Done()
+			errs[i] = r.RotateSession(ctx, "id", "token", newToken, time.Now().Add(time.Hour))
+		}
+		wg.Add(2)
+		go do(0, "token 2")
+		go do(1, "token 3")
+		wg.Wait()
+		// exactly one rotation succeeds
+		if errs[0] == nil {
+			s.True(errors.Is(errs[1], persistence.ErrConflict))
+		} else {
+			s.True(errors.Is(errs[0], persistence.ErrConflict))
+			s.NoError(errs[1])
+		}
+	})
+}
+
+// TestFindSession tests finding sessions.
+func (s *SessionRepositoryTestSuite) TestFindSession() {
+	s.Run("finds session", func() {
+		r := s.NewRepository()
+		t := time.Now().Add(time.Hour)
+		err := r.CreateSession(ctx, "id", "user", "token", t)
+		s.Require().NoError(err)
+		session, err := r.FindSession(ctx, "id")
+		s.Require().NoError(err)
+		s.WithinDuration(t, session.ExpiresAt, time.Second)
+		session.ExpiresAt = time.Time{}
+		s.Equal(&model.Session{
+			ID:     "id",
+			UserID: "user",
+		}, session)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		session, err := r.FindSession(ctx, "other id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(session)
+	})
+	s.Run("expired", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(-time.Second))
+		s.Require().NoError(err)
+		session, err := r.FindSession(ctx, "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(session)
+	})
+	s.Run("changing the result does not have any side effects", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		session, err := r.FindSession(ctx, "id")
+		s.Require().NoError(err)
+		// changing the result ...
+		session.ID = "changed"
+		session.UserID = "changed"
+		// ... does not have any side effects
+		session, err = r.FindSession(ctx, "id")
+		s.NoError(err)
+		s.Equal("id", session.ID)
+		s.Equal("user", session.UserID)
+	})
+}
+
+// TestDeleteSession tests deleting sessions.
+func (s *SessionRepositoryTestSuite) TestDeleteSession() {
+	s.Run("deletes session", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id 1", "user", "token", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.CreateSession(ctx, "id 2", "user", "token", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.DeleteSession(ctx, "id 1")
+		s.NoError(err)
+		_, err = r.FindSession(ctx, "id 1")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		err = r.RotateSession(ctx, "id 1", "token", "token 2", time.Now().Add(time.Hour))
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		// the other session is not affected
+		_, err = r.FindSession(ctx, "id 2")
+		s.NoError(err)
+	})
+	s.Run("not found", func() {
+		r := s.NewRepository()
+		err := r.DeleteSession(ctx, "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("twice", func() {
+		r := s.NewRepository()
+		err := r.CreateSession(ctx, "id", "user", "token", time.Now().Add(time.Hour))
+		s.Require().NoError(err)
+		err = r.DeleteSession(ctx, "id")
+		s.Require().NoError(err)
+		err = r.DeleteSession(ctx, "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
+
+// TestDeleteSessionsOfUser tests deleting all sessions of a user.
+func (s *SessionRepositoryTestSuite) TestDeleteSessionsOfUser() {
+	s.Run("deletes sessions of user", func() {
+		r := s.NewRepository()
+		for _, c := range []struct{ id, userID string }{
+			{"session 1", "user 1"},
+			{"session 2", "user 2"},
+			{"session 3", "user 1"},
+		} {
+			err := r.CreateSession(ctx, c.id, c.userID, "token", time.Now().Add(time.Hour))
+			s.Require().NoError(err)
+		}
+		err := r.DeleteSessionsOfUser(ctx, "user 1")
+		s.NoError(err)
+		_, err = r.FindSession(ctx, "session 1")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		_, err = r.FindSession(ctx, "session 3")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		// the sessions of other users are not affected
+		_, err = r.FindSession(ctx, "session 2")
+		s.NoError(err)
+	})
+	s.Run("user without sessions", func() {
+		r := s.NewRepository()
+		err := r.DeleteSessionsOfUser(ctx, "user")
+		s.NoError(err)
+	})
+}
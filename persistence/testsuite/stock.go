@@ -0,0 +1,358 @@
+package testsuite
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/Teelevision/excommerce/persistence"
+	"github.com/stretchr/testify/suite"
+)
+
+// StockRepositoryTestSuite is the suite that tests that a stock repository
+// behaves as expected. Use RunSuite to run it.
+type StockRepositoryTestSuite struct {
+	suite.Suite
+	NewRepository func() persistence.StockRepository
+}
+
+// RunSuite runs the test suite.
+func (s *StockRepositoryTestSuite) RunSuite(t *testing.T) {
+	suite.Run(t, s)
+}
+
+// TestSetStock tests setting the stock level.
+func (s *StockRepositoryTestSuite) TestSetStock() {
+	s.Run("new", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 10}, stock)
+	})
+	s.Run("existing", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.Require().NoError(err)
+		err = r.SetStock(ctx, "product", 3)
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 3}, stock)
+	})
+	s.Run("with empty everything", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "", 0)
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "")
+		s.NoError(err)
+		s.Equal(&model.Stock{}, stock)
+	})
+	s.Run("not below reserved", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.Require().NoError(err)
+		err = r.ReserveStock(ctx, "order", map[string]int{"product": 4})
+		s.Require().NoError(err)
+		err = r.SetStock(ctx, "product", 3)
+		s.True(errors.Is(err, persistence.ErrConflict))
+		err = r.SetStock(ctx, "product", 4)
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 4, Reserved: 4}, stock)
+	})
+}
+
+// TestAdjustStock tests adjusting the stock level.
+func (s *StockRepositoryTestSuite) TestAdjustStock() {
+	s.Run("up and down", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.Require().NoError(err)
+		err = r.AdjustStock(ctx, "product", 5)
+		s.NoError(err)
+		err = r.AdjustStock(ctx, "product", -12)
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 3}, stock)
+	})
+	s.Run("not tracked", func() {
+		r := s.NewRepository()
+		err := r.AdjustStock(ctx, "product", 5)
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("not below reserved", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.Require().NoError(err)
+		err = r.ReserveStock(ctx, "order", map[string]int{"product": 4})
+		s.Require().NoError(err)
+		err = r.AdjustStock(ctx, "product", -7)
+		s.True(errors.Is(err, persistence.ErrConflict))
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 10, Reserved: 4}, stock)
+	})
+	s.Run("concurrently", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 0)
+		s.Require().NoError(err)
+		var wg sync.WaitGroup
+		do := func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				err := r.AdjustStock(ctx, "product", 1)
+				s.Require().NoError(err)
+			}
+		}
+		wg.Add(2)
+		go do()
+		go do()
+		wg.Wait()
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(20, stock.Quantity)
+	})
+}
+
+// TestDeleteStock tests that products can stop being tracked.
+func (s *StockRepositoryTestSuite) TestDeleteStock() {
+	s.Run("existing", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.Require().NoError(err)
+		err = r.DeleteStock(ctx, "product")
+		s.NoError(err)
+		_, err = r.FindStock(ctx, "product")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("not tracked", func() {
+		r := s.NewRepository()
+		err := r.DeleteStock(ctx, "product")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("drops reservations", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.Require().NoError(err)
+		err = r.ReserveStock(ctx, "order", map[string]int{"product": 4})
+		s.Require().NoError(err)
+		err = r.DeleteStock(ctx, "product")
+		s.Require().NoError(err)
+		err = r.SetStock(ctx, "product", 5)
+		s.Require().NoError(err)
+		err = r.CommitStock(ctx, "order")
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 5}, stock)
+	})
+}
+
+// TestFindStock tests finding the stock level.
+func (s *StockRepositoryTestSuite) TestFindStock() {
+	s.Run("not tracked", func() {
+		r := s.NewRepository()
+		_, err := r.FindStock(ctx, "product")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("changing the result does not have any side effects", func() {
+		r := s.NewRepository()
+		err := r.SetStock(ctx, "product", 10)
+		s.Require().NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.Require().NoError(err)
+		stock.Quantity = 3
+		stock, err = r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(10, stock.Quantity)
+	})
+}
+
+// TestReserveStock tests reserving stock for orders.
+func (s *StockRepositoryTestSuite) TestReserveStock() {
+	s.Run("available", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product1", 10))
+		s.Require().NoError(r.SetStock(ctx, "product2", 2))
+		err := r.ReserveStock(ctx, "order1", map[string]int{"product1": 4, "product2": 2})
+		s.NoError(err)
+		err = r.ReserveStock(ctx, "order2", map[string]int{"product1": 6})
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product1")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product1", Quantity: 10, Reserved: 10}, stock)
+		s.Equal(0, stock.Available())
+		stock, err = r.FindStock(ctx, "product2")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product2", Quantity: 2, Reserved: 2}, stock)
+	})
+	s.Run("insufficient", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product1", 10))
+		s.Require().NoError(r.SetStock(ctx, "product2", 2))
+		err := r.ReserveStock(ctx, "order", map[string]int{"product1": 4, "product2": 3})
+		s.True(errors.Is(err, persistence.ErrInsufficientStock))
+		// nothing is reserved
+		stock, err := r.FindStock(ctx, "product1")
+		s.NoError(err)
+		s.Equal(0, stock.Reserved)
+		stock, err = r.FindStock(ctx, "product2")
+		s.NoError(err)
+		s.Equal(0, stock.Reserved)
+	})
+	s.Run("not tracked", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product1", 1))
+		err := r.ReserveStock(ctx, "order", map[string]int{"product1": 1, "product2": 1000})
+		s.NoError(err)
+		_, err = r.FindStock(ctx, "product2")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("replaces previous reservation", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product1", 10))
+		s.Require().NoError(r.SetStock(ctx, "product2", 10))
+		err := r.ReserveStock(ctx, "order", map[string]int{"product1": 8, "product2": 1})
+		s.Require().NoError(err)
+		err = r.ReserveStock(ctx, "order", map[string]int{"product1": 10})
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product1")
+		s.NoError(err)
+		s.Equal(10, stock.Reserved)
+		stock, err = r.FindStock(ctx, "product2")
+		s.NoError(err)
+		s.Equal(0, stock.Reserved)
+	})
+	s.Run("keeps previous reservation if insufficient", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product", 10))
+		err := r.ReserveStock(ctx, "order", map[string]int{"product": 8})
+		s.Require().NoError(err)
+		err = r.ReserveStock(ctx, "order", map[string]int{"product": 11})
+		s.True(errors.Is(err, persistence.ErrInsufficientStock))
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(8, stock.Reserved)
+	})
+	s.Run("concurrently", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product1", 5))
+		s.Require().NoError(r.SetStock(ctx, "product2", 5))
+		var wg sync.WaitGroup
+		var mx sync.Mutex
+		reserved := 0
+		do := func(orderIDs ...string) {
+			defer wg.Done()
+			for _, orderID := range orderIDs {
+				err := r.ReserveStock(ctx, orderID, map[string]int{"product1": 1, "product2": 1})
+				if errors.Is(err, persistence.ErrInsufficientStock) {
+					continue
+				}
+				s.Require().NoError(err)
+				mx.Lock()
+				reserved++
+				mx.Unlock()
+			}
+		}
+		wg.Add(2)
+		go do("order1", "order2", "order3", "order4")
+		go do("order5", "order6", "order7", "order8")
+		wg.Wait()
+		s.Equal(5, reserved)
+		stock, err := r.FindStock(ctx, "product2")
+		s.NoError(err)
+		s.Equal(5, stock.Reserved)
+	})
+	s.Run("changing the input does not have any side effects", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product", 10))
+		quantities := map[string]int{"product": 4}
+		err := r.ReserveStock(ctx, "order", quantities)
+		s.Require().NoError(err)
+		quantities["product"] = 6
+		err = r.CommitStock(ctx, "order")
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 6}, stock)
+	})
+}
+
+// TestReleaseStock tests releasing reservations.
+func (s *StockRepositoryTestSuite) TestReleaseStock() {
+	s.Run("reserved", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product", 10))
+		s.Require().NoError(r.ReserveStock(ctx, "order1", map[string]int{"product": 4}))
+		s.Require().NoError(r.ReserveStock(ctx, "order2", map[string]int{"product": 2}))
+		err := r.ReleaseStock(ctx, "order1")
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 10, Reserved: 2}, stock)
+	})
+	s.Run("twice", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product", 10))
+		s.Require().NoError(r.ReserveStock(ctx, "order", map[string]int{"product": 4}))
+		s.NoError(r.ReleaseStock(ctx, "order"))
+		s.NoError(r.ReleaseStock(ctx, "order"))
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(0, stock.Reserved)
+	})
+	s.Run("not reserved", func() {
+		r := s.NewRepository()
+		err := r.ReleaseStock(ctx, "order")
+		s.NoError(err)
+	})
+}
+
+// TestCommitStock tests taking reserved items out of stock.
+func (s *StockRepositoryTestSuite) TestCommitStock() {
+	s.Run("reserved", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product1", 10))
+		s.Require().NoError(r.SetStock(ctx, "product2", 3))
+		s.Require().NoError(r.ReserveStock(ctx, "order1", map[string]int{"product1": 4, "product2": 3}))
+		s.Require().NoError(r.ReserveStock(ctx, "order2", map[string]int{"product1": 2}))
+		err := r.CommitStock(ctx, "order1")
+		s.NoError(err)
+		stock, err := r.FindStock(ctx, "product1")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product1", Quantity: 6, Reserved: 2}, stock)
+		stock, err = r.FindStock(ctx, "product2")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product2", Quantity: 0, Reserved: 0}, stock)
+	})
+	s.Run("twice", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product", 10))
+		s.Require().NoError(r.ReserveStock(ctx, "order", map[string]int{"product": 4}))
+		s.NoError(r.CommitStock(ctx, "order"))
+		s.NoError(r.CommitStock(ctx, "order"))
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 6}, stock)
+	})
+	s.Run("not reserved", func() {
+		r := s.NewRepository()
+		err := r.CommitStock(ctx, "order")
+		s.NoError(err)
+	})
+	s.Run("released", func() {
+		r := s.NewRepository()
+		s.Require().NoError(r.SetStock(ctx, "product", 10))
+		s.Require().NoError(r.ReserveStock(ctx, "order", map[string]int{"product": 4}))
+		s.Require().NoError(r.ReleaseStock(ctx, "order"))
+		s.NoError(r.CommitStock(ctx, "order"))
+		stock, err := r.FindStock(ctx, "product")
+		s.NoError(err)
+		s.Equal(&model.Stock{ProductID: "product", Quantity: 10}, stock)
+	})
+}
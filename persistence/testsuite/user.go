@@ -343,4 +343,326 @@ func (s *UserRepositoryTestSuite) TestFindUserByIDAndPassword() {
 	})
 }
 
+// TestFindUser tests finding a user by id.
+func (s *UserRepositoryTestSuite) TestFindUser() {
+	s.Run("finds user", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "2b3b8b4e-0d36-4c8f-a2cf-1c2f4f31d0c4", "北京市", "广州市")
+		s.Require().NoError(err)
+		user, err := r.FindUser(ctx, "2b3b8b4e-0d36-4c8f-a2cf-1c2f4f31d0c4")
+		s.NoError(err)
+		s.Equal(&model.User{
+			ID:   "2b3b8b4e-0d36-4c8f-a2cf-1c2f4f31d0c4",
+			Name: "北京市",
+		}, user)
+	})
+	s.Run("user does not exist", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "0e6cf6a1-7d8d-4b06-b2c4-b7c0a2e9ad53", "marius", "ExCommerce")
+		s.Require().NoError(err)
+		user, err := r.FindUser(ctx, "a3f3a8b5-2f39-4ba1-9c55-3f0b0d1b9b76")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(user)
+	})
+	s.Run("changing the result does not have any side effects", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "c6a3e0b5-37a4-4e2b-9e0a-0d3b1b4f4c1e", "北京市", "广州市")
+		s.Require().NoError(err)
+		user, err := r.FindUser(ctx, "c6a3e0b5-37a4-4e2b-9e0a-0d3b1b4f4c1e")
+		s.Require().NoError(err)
+		// changing the result ...
+		user.ID = "changed"
+		user.Name = "changed"
+		// ... does not have any side effects
+		user, err = r.FindUser(ctx, "c6a3e0b5-37a4-4e2b-9e0a-0d3b1b4f4c1e")
+		s.NoError(err)
+		s.Equal(&model.User{
+			ID:   "c6a3e0b5-37a4-4e2b-9e0a-0d3b1b4f4c1e",
+			Name: "北京市",
+		}, user)
+	})
+}
+
+// TestSetUserRoles tests changing the roles of users.
+func (s *UserRepositoryTestSuite) TestSetUserRoles() {
+	s.Run("sets roles", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "f5b8c0a4-8f6e-4a4e-9c55-6a3f2c0f1b7d", "marius", "ExCommerce")
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "f5b8c0a4-8f6e-4a4e-9c55-6a3f2c0f1b7d", []model.Role{
+			model.RoleOrderManager, model.RoleAdmin,
+		})
+		s.NoError(err)
+		expected := &model.User{
+			ID:    "f5b8c0a4-8f6e-4a4e-9c55-6a3f2c0f1b7d",
+			Name:  "marius",
+			Roles: []model.Role{model.RoleAdmin, model.RoleOrderManager},
+		}
+		// all ways to find the user return the roles
+		user, err := r.FindUser(ctx, "f5b8c0a4-8f6e-4a4e-9c55-6a3f2c0f1b7d")
+		s.NoError(err)
+		s.Equal(expected, user)
+		user, err = r.FindUserByNameAndPassword(ctx, "marius", "ExCommerce")
+		s.NoError(err)
+		s.Equal(expected, user)
+		user, err = r.FindUserByIDAndPassword(ctx, "f5b8c0a4-8f6e-4a4e-9c55-6a3f2c0f1b7d", "ExCommerce")
+		s.NoError(err)
+		s.Equal(expected, user)
+	})
+	s.Run("replaces roles", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "password")
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "id", []model.Role{model.RoleAdmin})
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "id", []model.Role{model.RoleCatalogManager})
+		s.NoError(err)
+		user, err := r.FindUser(ctx, "id")
+		s.NoError(err)
+		s.Equal([]model.Role{model.RoleCatalogManager}, user.Roles)
+	})
+	s.Run("removes roles", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "password")
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "id", []model.Role{model.RoleAdmin})
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "id", nil)
+		s.NoError(err)
+		user, err := r.FindUser(ctx, "id")
+		s.NoError(err)
+		s.Equal(&model.User{ID: "id", Name: "name"}, user)
+	})
+	s.Run("user does not exist", func() {
+		r := s.NewRepository()
+		err := r.SetUserRoles(ctx, "id", []model.Role{model.RoleAdmin})
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("changing the input does not have any side effects", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "password")
+		s.Require().NoError(err)
+		roles := []model.Role{model.RoleAdmin}
+		err = r.SetUserRoles(ctx, "id", roles)
+		s.Require().NoError(err)
+		// changing the input ...
+		roles[0] = "changed"
+		// ... does not have any side effects
+		user, err := r.FindUser(ctx, "id")
+		s.NoError(err)
+		s.Equal([]model.Role{model.RoleAdmin}, user.Roles)
+	})
+	s.Run("changing the result does not have any side effects", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "password")
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "id", []model.Role{model.RoleAdmin})
+		s.Require().NoError(err)
+		user, err := r.FindUser(ctx, "id")
+		s.Require().NoError(err)
+		// changing the result ...
+		user.Roles[0] = "changed"
+		// ... does not have any side effects
+		user, err = r.FindUser(ctx, "id")
+		s.NoError(err)
+		s.Equal([]model.Role{model.RoleAdmin}, user.Roles)
+	})
+}
+
+// TestFindUsersWithRole tests finding the users that have a role.
+func (s *UserRepositoryTestSuite) TestFindUsersWithRole() {
+	s.Run("finds users", func() {
+		r := s.NewRepository()
+		for _, c := range []struct {
+			id    string
+			roles []model.Role
+		}{
+			{"user 1", []model.Role{model.RoleAdmin}},
+			{"user 2", nil},
+			{"user 3", []model.Role{model.RoleCatalogManager, model.RoleAdmin}},
+			{"user 4", []model.Role{model.RoleCatalogManager}},
+		} {
+			err := r.CreateUser(ctx, c.id, c.id, "password")
+			s.Require().NoError(err)
+			err = r.SetUserRoles(ctx, c.id, c.roles)
+			s.Require().NoError(err)
+		}
+		users, err := r.FindUsersWithRole(ctx, model.RoleAdmin)
+		s.NoError(err)
+		s.ElementsMatch([]*model.User{
+			{ID: "user 1", Name: "user 1", Roles: []model.Role{model.RoleAdmin}},
+			{ID: "user 3", Name: "user 3", Roles: []model.Role{model.RoleAdmin, model.RoleCatalogManager}},
+		}, users)
+	})
+	s.Run("none", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "password")
+		s.Require().NoError(err)
+		users, err := r.FindUsersWithRole(ctx, model.RoleAdmin)
+		s.NoError(err)
+		s.Empty(users)
+	})
+}
+
+// TestFindUserByName tests finding a user by name.
+func (s *UserRepositoryTestSuite) TestFindUserByName() {
+	s.Run("finds user", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "5e0c2c59-7b6f-4d8e-8f0f-3c1a9b2e4d6f", "北京市", "广州市")
+		s.Require().NoError(err)
+		user, err := r.FindUserByName(ctx, "北京市")
+		s.NoError(err)
+		s.Equal(&model.User{
+			ID:   "5e0c2c59-7b6f-4d8e-8f0f-3c1a9b2e4d6f",
+			Name: "北京市",
+		}, user)
+	})
+	s.Run("user does not exist", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "5e0c2c59-7b6f-4d8e-8f0f-3c1a9b2e4d6f", "marius", "ExCommerce")
+		s.Require().NoError(err)
+		user, err := r.FindUserByName(ctx, "Marius")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		s.Nil(user)
+	})
+}
+
+// TestSetUserPassword tests changing the password of users.
+func (s *UserRepositoryTestSuite) TestSetUserPassword() {
+	s.Run("sets password", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "old password")
+		s.Require().NoError(err)
+		err = r.SetUserPassword(ctx, "id", "new password")
+		s.NoError(err)
+		_, err = r.FindUserByIDAndPassword(ctx, "id", "old password")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		user, err := r.FindUserByIDAndPassword(ctx, "id", "new password")
+		s.NoError(err)
+		s.Equal(&model.User{ID: "id", Name: "name"}, user)
+		user, err = r.FindUserByNameAndPassword(ctx, "name", "new password")
+		s.NoError(err)
+		s.Equal(&model.User{ID: "id", Name: "name"}, user)
+	})
+	s.Run("keeps roles", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "old password")
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "id", []model.Role{model.RoleAdmin})
+		s.Require().NoError(err)
+		err = r.SetUserPassword(ctx, "id", "new password")
+		s.NoError(err)
+		user, err := r.FindUser(ctx, "id")
+		s.NoError(err)
+		s.Equal([]model.Role{model.RoleAdmin}, user.Roles)
+	})
+	s.Run("user does not exist", func() {
+		r := s.NewRepository()
+		err := r.SetUserPassword(ctx, "id", "password")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
+
+// TestDeleteUser tests deleting users.
+func (s *UserRepositoryTestSuite) TestDeleteUser() {
+	s.Run("deletes user", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id", "name", "password")
+		s.Require().NoError(err)
+		err = r.SetUserRoles(ctx, "id", []model.Role{model.RoleAdmin})
+		s.Require().NoError(err)
+		err = r.DeleteUser(ctx, "id")
+		s.NoError(err)
+		_, err = r.FindUser(ctx, "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		_, err = r.FindUserByName(ctx, "name")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		_, err = r.FindUserByIDAndPassword(ctx, "id", "password")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+		users, err := r.FindUsersWithRole(ctx, model.RoleAdmin)
+		s.NoError(err)
+		s.Empty(users)
+	})
+	s.Run("name can be used again", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id 1", "name", "password")
+		s.Require().NoError(err)
+		err = r.DeleteUser(ctx, "id 1")
+		s.Require().NoError(err)
+		err = r.CreateUser(ctx, "id 2", "name", "password")
+		s.NoError(err)
+		user, err := r.FindUserByName(ctx, "name")
+		s.NoError(err)
+		s.Equal(&model.User{ID: "id 2", Name: "name"}, user)
+	})
+	s.Run("does not affect other users", func() {
+		r := s.NewRepository()
+		err := r.CreateUser(ctx, "id 1", "name 1", "password")
+		s.Require().NoError(err)
+		err = r.CreateUser(ctx, "id 2", "name 2", "password")
+		s.Require().NoError(err)
+		err = r.DeleteUser(ctx, "id 1")
+		s.Require().NoError(err)
+		user, err := r.FindUser(ctx, "id 2")
+		s.NoError(err)
+		s.Equal(&model.User{ID: "id 2", Name: "name 2"}, user)
+	})
+	s.Run("user does not exist", func() {
+		r := s.NewRepository()
+		err := r.DeleteUser(ctx, "id")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+}
+
+// TestClaimGuest tests recording and finding claimed guests.
+func (s *UserRepositoryTestSuite) TestClaimGuest() {
+	s.Run("claims guest", func() {
+		r := s.NewRepository()
+		err := r.ClaimGuest(ctx, "guest id", "user id")
+		s.NoError(err)
+		userID, err := r.FindGuestClaim(ctx, "guest id")
+		s.NoError(err)
+		s.Equal("user id", userID)
+	})
+	s.Run("cannot claim twice", func() {
+		r := s.NewRepository()
+		err := r.ClaimGuest(ctx, "guest id", "user id 1")
+		s.Require().NoError(err)
+		err = r.ClaimGuest(ctx, "guest id", "user id 2")
+		s.True(errors.Is(err, persistence.ErrConflict))
+		userID, err := r.FindGuestClaim(ctx, "guest id")
+		s.NoError(err)
+		s.Equal("user id 1", userID)
+	})
+	s.Run("guest was not claimed", func() {
+		r := s.NewRepository()
+		err := r.ClaimGuest(ctx, "guest id 1", "user id")
+		s.Require().NoError(err)
+		_, err = r.FindGuestClaim(ctx, "guest id 2")
+		s.True(errors.Is(err, persistence.ErrNotFound))
+	})
+	s.Run("works concurrently", func() {
+		r := s.NewRepository()
+		var wg sync.WaitGroup
+		var mx sync.Mutex
+		var claimed int
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := r.ClaimGuest(ctx, "guest id", "user id")
+				if errors.Is(err, persistence.ErrConflict) {
+					return
+				}
+				s.NoError(err)
+				mx.Lock()
+				claimed++
+				mx.Unlock()
+			}()
+		}
+		wg.Wait()
+		s.Equal(1, claimed)
+	})
+}
+
 var ctx = context.Background()
@@ -0,0 +1,185 @@
+// Package promotion evaluates promotions on positions of carts and orders.
+// Promotions are stored as data, so that offers can be changed at runtime.
+package promotion
+
+import (
+	"sort"
+
+	"github.com/Teelevision/excommerce/model"
+)
+
+// Apply applies the given promotions to the positions and returns the new
+// positions. The positions are expected to be consolidated, so that there is
+// at most one position per product, and to have their prices calculated.
+// Bundles are applied first, so that the items that are part of a bundle do
+// not get any further discounts. Afterwards the discounts of the other
+// promotions are inserted as positions right after the position they apply
+// to.
+func Apply(positions []model.Position, promotions []*model.Promotion) []model.Position {
+	promotions = sortPromotions(promotions)
+	for _, promotion := range promotions {
+		if promotion.Type == model.PromotionTypeBundle {
+			positions = applyBundle(positions, promotion)
+		}
+	}
+	for _, promotion := range promotions {
+		switch promotion.Type {
+		case model.PromotionTypeQuantityThreshold:
+			positions = applyQuantityThreshold(positions, promotion)
+		case model.PromotionTypeBuyXGetY:
+			positions = applyBuyXGetY(positions, promotion)
+		}
+	}
+	return positions
+}
+
+// BundleProduct returns the virtual product of the given bundle promotion. The
+// items map product ids to products and must contain all products of the
+// bundle. The bundle weighs as much as its items together. It has the tax
+// class of its items if they all share one and the default tax class
+// otherwise. Nil is returned if the promotion is not a
+// bundle or an item is missing.
+func BundleProduct(promotion *model.Promotion, items map[string]*model.Product) *model.Product {
+	if promotion.Type != model.PromotionTypeBundle || len(promotion.Bundle) == 0 {
+		return nil
+	}
+	var price, weight int
+	var taxClass string
+	first := true
+	for productID, quantity := range promotion.Bundle {
+		product, ok := items[productID]
+		if !ok || product == nil {
+			return nil
+		}
+		price += quantity * product.Price
+		weight += quantity * product.Weight
+		if first {
+			taxClass, first = product.TaxClass, false
+		} else if taxClass != product.TaxClass {
+			taxClass = ""
+		}
+	}
+	savedPrice := promotion.Discount * price / 100
+	return &model.Product{
+		ID:         promotion.ID,
+		Name:       promotion.Name,
+		Price:      price - savedPrice,
+		SavedPrice: savedPrice,
+		TaxClass:   taxClass,
+		Weight:     weight,
+	}
+}
+
+// sorts the promotions by id, so that applying them is deterministic
+func sortPromotions(promotions []*model.Promotion) []*model.Promotion {
+	sorted := make([]*model.Promotion, len(promotions))
+	copy(sorted, promotions)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return sorted
+}
+
+// returns the index of the position of the given product or -1
+func findProductPosition(positions []model.Position, productID string) int {
+	for i, position := range positions {
+		if position.ProductID == productID && position.Coupon == nil && position.Promotion == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+func applyBundle(positions []model.Position, promotion *model.Promotion) []model.Position {
+	if len(promotion.Bundle) == 0 {
+		return positions
+	}
+
+	// get number of bundles
+	numBundles := -1
+	for productID, quantity := range promotion.Bundle {
+		i := findProductPosition(positions, productID)
+		if i < 0 || quantity < 1 {
+			return positions
+		}
+		if n := positions[i].Quantity / quantity; numBundles < 0 || n < numBundles {
+			numBundles = n
+		}
+	}
+	if numBundles < 1 {
+		return positions
+	}
+
+	// reduce items
+	items := make(map[string]*model.Product, len(promotion.Bundle))
+	for productID, quantity := range promotion.Bundle {
+		i := findProductPosition(positions, productID)
+		position := &positions[i]
+		position.Quantity -= numBundles * quantity
+		position.Price = position.Quantity * position.Product.Price
+		position.SavedPrice = position.Quantity * position.Product.SavedPrice
+		items[productID] = position.Product
+	}
+
+	// update bundle quantity or add position for bundles
+	bundle := BundleProduct(promotion, items)
+	if i := findProductPosition(positions, promotion.ID); i >= 0 {
+		positions[i].Quantity += numBundles
+		positions[i].Price += numBundles * bundle.Price
+		positions[i].SavedPrice += numBundles * bundle.SavedPrice
+	} else {
+		positions = append(positions, model.Position{
+			Quantity:   numBundles,
+			Price:      numBundles * bundle.Price,
+			SavedPrice: numBundles * bundle.SavedPrice,
+			ProductID:  bundle.ID,
+			Product:    bundle,
+		})
+	}
+
+	// drop all items that are completely part of bundles
+	for productID := range promotion.Bundle {
+		if i := findProductPosition(positions, productID); positions[i].Quantity == 0 {
+			positions = append(positions[:i], positions[i+1:]...)
+		}
+	}
+
+	return positions
+}
+
+func applyQuantityThreshold(positions []model.Position, promotion *model.Promotion) []model.Position {
+	i := findProductPosition(positions, promotion.ProductID)
+	if i < 0 || positions[i].Quantity < promotion.Quantity {
+		return positions
+	}
+	price := -promotion.Discount * positions[i].Price / 100
+	return insertDiscount(positions, i, promotion, price)
+}
+
+func applyBuyXGetY(positions []model.Position, promotion *model.Promotion) []model.Position {
+	i := findProductPosition(positions, promotion.ProductID)
+	if i < 0 || promotion.Quantity < 1 || promotion.FreeQuantity < 1 {
+		return positions
+	}
+	numDiscounted := positions[i].Quantity / (promotion.Quantity + promotion.FreeQuantity) * promotion.FreeQuantity
+	price := -promotion.Discount * numDiscounted * positions[i].Product.Price / 100
+	return insertDiscount(positions, i, promotion, price)
+}
+
+// inserts a position for the discount of the promotion after the position i
+func insertDiscount(positions []model.Position, i int, promotion *model.Promotion, price int) []model.Position {
+	if price == 0 {
+		return positions
+	}
+	discountPosition := model.Position{
+		Quantity:   1,
+		Price:      price,
+		SavedPrice: -price,
+		Promotion:  promotion,
+		Product: &model.Product{ // no id
+			Name:       promotion.Name,
+			Price:      price,
+			SavedPrice: -price,
+		},
+	}
+	return append(positions[:i+1],
+		append([]model.Position{discountPosition}, positions[i+1:]...)...)
+}
@@ -0,0 +1,162 @@
+package promotion
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	apple  = &model.Product{ID: "apple", Name: "Apple", Price: 49, Weight: 150, TaxClass: "reduced"}
+	banana = &model.Product{ID: "banana", Name: "Banana", Price: 25, Weight: 120, TaxClass: "reduced"}
+	melon  = &model.Product{ID: "melon", Name: "Melon", Price: 299, Weight: 1500}
+)
+
+func productPosition(product *model.Product, quantity int) model.Position {
+	return model.Position{
+		ProductID: product.ID,
+		Product:   product,
+		Quantity:  quantity,
+		Price:     quantity * product.Price,
+	}
+}
+
+// summarizes the positions as "<product or promotion id> <quantity> <price>"
+func summarize(positions []model.Position) []string {
+	summary := make([]string, len(positions))
+	for i, position := range positions {
+		id := position.ProductID
+		if position.Promotion != nil {
+			id = "promotion " + position.Promotion.ID
+		}
+		summary[i] = fmt.Sprintf("%s %d %d", id, position.Quantity, position.Price)
+	}
+	return summary
+}
+
+func TestApply(t *testing.T) {
+	threshold := &model.Promotion{ID: "1-threshold", Type: model.PromotionTypeQuantityThreshold,
+		ProductID: "apple", Quantity: 3, Discount: 10}
+	buyXGetY := &model.Promotion{ID: "2-buy-x-get-y", Type: model.PromotionTypeBuyXGetY,
+		ProductID: "apple", Quantity: 2, FreeQuantity: 1, Discount: 100}
+	halfPrice := &model.Promotion{ID: "3-half-price", Type: model.PromotionTypeBuyXGetY,
+		ProductID: "melon", Quantity: 1, FreeQuantity: 1, Discount: 50}
+	bundle := &model.Promotion{ID: "9-bundle", Type: model.PromotionTypeBundle,
+		Bundle: map[string]int{"apple": 2, "banana": 1}, Discount: 15}
+
+	for _, tt := range []struct {
+		name       string
+		positions  []model.Position
+		promotions []*model.Promotion
+		want       []string
+	}{{
+		name:      "no promotions",
+		positions: []model.Position{productPosition(apple, 3)},
+		want:      []string{"apple 3 147"},
+	}, {
+		name:       "threshold not reached",
+		positions:  []model.Position{productPosition(apple, 2), productPosition(banana, 5)},
+		promotions: []*model.Promotion{threshold},
+		want:       []string{"apple 2 98", "banana 5 125"},
+	}, {
+		name:       "threshold rounds towards zero",
+		positions:  []model.Position{productPosition(apple, 3), productPosition(banana, 5)},
+		promotions: []*model.Promotion{threshold},
+		want:       []string{"apple 3 147", "promotion 1-threshold 1 -14", "banana 5 125"},
+	}, {
+		name:       "buy x get y per complete group",
+		positions:  []model.Position{productPosition(apple, 8)},
+		promotions: []*model.Promotion{buyXGetY},
+		want:       []string{"apple 8 392", "promotion 2-buy-x-get-y 1 -98"},
+	}, {
+		name:       "buy x get y rounds towards zero",
+		positions:  []model.Position{productPosition(melon, 3)},
+		promotions: []*model.Promotion{halfPrice},
+		want:       []string{"melon 3 897", "promotion 3-half-price 1 -149"},
+	}, {
+		name:       "no discount position for a discount of zero",
+		positions:  []model.Position{productPosition(apple, 2)},
+		promotions: []*model.Promotion{buyXGetY},
+		want:       []string{"apple 2 98"},
+	}, {
+		name:       "stacking on the same product",
+		positions:  []model.Position{productPosition(apple, 3), productPosition(melon, 2)},
+		promotions: []*model.Promotion{threshold, buyXGetY, halfPrice},
+		want: []string{
+			"apple 3 147",
+			"promotion 2-buy-x-get-y 1 -49",
+			"promotion 1-threshold 1 -14",
+			"melon 2 598",
+			"promotion 3-half-price 1 -149",
+		},
+	}, {
+		name:       "ordered by id",
+		positions:  []model.Position{productPosition(apple, 3)},
+		promotions: []*model.Promotion{buyXGetY, threshold},
+		want:       []string{"apple 3 147", "promotion 2-buy-x-get-y 1 -49", "promotion 1-threshold 1 -14"},
+	}, {
+		name:       "bundle",
+		positions:  []model.Position{productPosition(apple, 5), productPosition(banana, 2)},
+		promotions: []*model.Promotion{bundle},
+		want:       []string{"apple 1 49", "9-bundle 2 210"},
+	}, {
+		name:       "bundles are applied first",
+		positions:  []model.Position{productPosition(apple, 4), productPosition(banana, 1)},
+		promotions: []*model.Promotion{threshold, buyXGetY, bundle},
+		want:       []string{"apple 2 98", "9-bundle 1 105"},
+	}, {
+		name:       "incomplete bundle",
+		positions:  []model.Position{productPosition(apple, 1), productPosition(banana, 1)},
+		promotions: []*model.Promotion{bundle},
+		want:       []string{"apple 1 49", "banana 1 25"},
+	}, {
+		name: "bundle already in cart",
+		positions: []model.Position{
+			productPosition(apple, 2), productPosition(banana, 1),
+			{ProductID: "9-bundle", Product: BundleProduct(bundle, map[string]*model.Product{
+				"apple": apple, "banana": banana}), Quantity: 1, Price: 105},
+		},
+		promotions: []*model.Promotion{bundle},
+		want:       []string{"9-bundle 2 210"},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, summarize(Apply(tt.positions, tt.promotions)))
+		})
+	}
+}
+
+func TestBundleProduct(t *testing.T) {
+	items := map[string]*model.Product{"apple": apple, "banana": banana, "melon": melon}
+
+	for _, tt := range []struct {
+		name      string
+		promotion *model.Promotion
+		want      *model.Product
+	}{{
+		name: "shared tax class",
+		promotion: &model.Promotion{ID: "fruits", Name: "Fruits", Type: model.PromotionTypeBundle,
+			Bundle: map[string]int{"apple": 2, "banana": 1}, Discount: 15},
+		// 15% of 123 are 18.45 and the saving is rounded down
+		want: &model.Product{ID: "fruits", Name: "Fruits", Price: 105, SavedPrice: 18,
+			TaxClass: "reduced", Weight: 420},
+	}, {
+		name: "mixed tax classes",
+		promotion: &model.Promotion{ID: "fruits", Name: "Fruits", Type: model.PromotionTypeBundle,
+			Bundle: map[string]int{"apple": 1, "melon": 1}, Discount: 10},
+		want: &model.Product{ID: "fruits", Name: "Fruits", Price: 314, SavedPrice: 34, Weight: 1650},
+	}, {
+		name: "missing item",
+		promotion: &model.Promotion{ID: "fruits", Type: model.PromotionTypeBundle,
+			Bundle: map[string]int{"apple": 1, "pear": 1}, Discount: 10},
+	}, {
+		name: "no bundle",
+		promotion: &model.Promotion{ID: "fruits", Type: model.PromotionTypeQuantityThreshold,
+			ProductID: "apple", Quantity: 3, Discount: 10},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BundleProduct(tt.promotion, items))
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a store that keeps the entries in memory. It is not shared
+// between instances of the service. Please use NewMemoryStore to create a new
+// instance. MemoryStore is safe for concurrent use.
+type MemoryStore struct {
+	mx          sync.Mutex
+	entries     map[string]*memoryEntry
+	lastCleanup time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+type memoryEntry struct {
+	Entry
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns a new memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:     make(map[string]*memoryEntry),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Reserve counts an attempt of the key as failed in advance, unless the key
+// is blocked. The key is then blocked for the delay that the given function
+// returns for the new number of failures. It returns the entry after the
+// reservation and whether the attempt was reserved. The key is forgotten if
+// there is no reservation for the given duration and it is not blocked.
+func (s *MemoryStore) Reserve(_ context.Context, key string, forgetAfter time.Duration, delay func(failures int) time.Duration) (Entry, bool, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.cleanup()
+
+	now := time.Now()
+	entry, ok := s.entries[key]
+	if !ok || entry.expiresAt.Before(now) {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	if entry.BlockedUntil.After(now) {
+		return entry.Entry, false, nil
+	}
+	entry.Failures++
+	entry.BlockedUntil = time.Time{}
+	if d := delay(entry.Failures); d > 0 {
+		entry.BlockedUntil = now.Add(d)
+	}
+	entry.expiresAt = now.Add(forgetAfter)
+	if entry.BlockedUntil.After(entry.expiresAt) {
+		entry.expiresAt = entry.BlockedUntil
+	}
+	return entry.Entry, true, nil
+}
+
+// Refund takes back a reserved attempt of the key that did not fail. The
+// block of the reservation, given by the time it ends, is lifted unless the
+// key was blocked again since.
+func (s *MemoryStore) Refund(_ context.Context, key string, blockedUntil time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil // forgotten or reset in the meantime
+	}
+	if entry.Failures > 0 {
+		entry.Failures--
+	}
+	if entry.BlockedUntil.Equal(blockedUntil) {
+		entry.BlockedUntil = time.Time{}
+	}
+	return nil
+}
+
+// Reset forgets the key.
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// cleanup deletes the expired entries at most once a minute.
+func (s *MemoryStore) cleanup() {
+	now := time.Now()
+	if now.Sub(s.lastCleanup) < time.Minute {
+		return
+	}
+	s.lastCleanup = now
+	for key, entry := range s.entries {
+		if entry.expiresAt.Before(now) {
+			delete(s.entries, key)
+		}
+	}
+}
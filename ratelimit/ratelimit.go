@@ -0,0 +1,182 @@
+// Package ratelimit protects against brute-force attacks. A limiter counts the
+// failed attempts of a key, like an IP address or an account. After a number of
+// free failures, the key is blocked for an exponentially growing delay, up to
+// a temporary lockout. Attempts are counted as failed while they are made, so
+// that concurrent attempts cannot exceed the free failures. Blocked requests
+// are rejected with 429 Too Many Requests and a Retry-After header.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Teelevision/excommerce/response"
+)
+
+// Store stores the failures of keys. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Reserve counts an attempt of the key as failed in advance, unless the
+	// key is blocked. The key is then blocked for the delay that the given
+	// function returns for the new number of failures, so that concurrent
+	// attempts are rejected as if the attempt had failed already. It returns
+	// the entry after the reservation and whether the attempt was reserved.
+	// The key is forgotten if there is no reservation for the given duration
+	// and it is not blocked.
+	Reserve(ctx context.Context, key string, forgetAfter time.Duration, delay func(failures int) time.Duration) (Entry, bool, error)
+	// Refund takes back a reserved attempt of the key that did not fail. The
+	// block of the reservation, given by the time it ends, is lifted unless
+	// the key was blocked again since.
+	Refund(ctx context.Context, key string, blockedUntil time.Time) error
+	// Reset forgets the key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Entry is the state of a key.
+type Entry struct {
+	Failures     int
+	BlockedUntil time.Time
+}
+
+// Limiter limits the failed attempts of keys. Limiters with different
+// policies can share a store if they have different prefixes. A nil limiter
+// does not limit anything.
+type Limiter struct {
+	Store Store
+	// Prefix is prepended to all keys.
+	Prefix string
+	// FreeFailures is the number of failed attempts before the key is
+	// blocked.
+	FreeFailures int
+	// BaseDelay is the time a key is blocked after the free failures. It
+	// doubles with every further failure.
+	BaseDelay time.Duration
+	// MaxDelay is the longest time a key is blocked. It is the duration of
+	// the lockout.
+	MaxDelay time.Duration
+	// ForgetAfter is the duration without failures after which the failures
+	// of a key are forgotten.
+	ForgetAfter time.Duration
+	// ResetOnSuccess forgets the failures of a key on a successful attempt.
+	ResetOnSuccess bool
+}
+
+// Reservation is an attempt that counts as failed until it is refunded.
+type Reservation struct {
+	key          string
+	blockedUntil time.Time
+}
+
+// Check reserves an attempt of the key. The attempt counts as failed until
+// it is refunded with Refund or Succeed, so that concurrent attempts cannot
+// exceed the free failures. If the key is blocked, nothing is reserved and the
+// time until it is not blocked anymore is returned.
+func (l *Limiter) Check(ctx context.Context, key string) (Reservation, time.Duration, error) {
+	entry, ok, err := l.Store.Reserve(ctx, l.Prefix+key, l.ForgetAfter, l.delay)
+	if err != nil {
+		return Reservation{}, 0, err
+	}
+	if !ok {
+		return Reservation{}, time.Until(entry.BlockedUntil), nil
+	}
+	return Reservation{key: l.Prefix + key, blockedUntil: entry.BlockedUntil}, 0, nil
+}
+
+// Refund takes back the reserved attempt, because it did not fail.
+func (l *Limiter) Refund(ctx context.Context, r Reservation) error {
+	return l.Store.Refund(ctx, r.key, r.blockedUntil)
+}
+
+// Succeed records that the reserved attempt succeeded. It is refunded, or all
+// failures of the key are forgotten if the limiter resets on success.
+func (l *Limiter) Succeed(ctx context.Context, r Reservation) error {
+	if !l.ResetOnSuccess {
+		return l.Refund(ctx, r)
+	}
+	return l.Store.Reset(ctx, r.key)
+}
+
+// delay returns the time a key is blocked after the given number of failures.
+func (l *Limiter) delay(failures int) time.Duration {
+	penalized := failures - l.FreeFailures
+	if penalized < 0 {
+		return 0
+	}
+	delay := float64(l.BaseDelay) * math.Pow(2, float64(penalized))
+	if delay > float64(l.MaxDelay) {
+		return l.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// Middleware returns a middleware that limits the requests by the key that
+// the given function returns. Requests with an empty key are not limited.
+// Requests of blocked keys are rejected with 429 Too Many Requests and a
+// Retry-After header. Responses with the failure status count as failed
+// attempts, and successful responses as successful attempts.
+func (l *Limiter) Middleware(key func(*http.Request) string, failureStatus int) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if l == nil {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			key := key(r)
+			if key == "" {
+				next(w, r)
+				return
+			}
+
+			reservation, wait, err := l.Check(ctx, key)
+			switch {
+			case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+				w.WriteHeader(499) // client closed request
+				return
+			case err != nil:
+				panic(err)
+			case wait > 0:
+				tooManyRequests(wait, w)
+				return
+			}
+
+			recorder := response.NewRecorder(w)
+			next(recorder, r)
+
+			// The attempt was made, so the reservation must be settled even
+			// if the request was cancelled. Failures keep it.
+			switch status := recorder.Status(); {
+			case status == failureStatus:
+				err = nil
+			case status < 300:
+				err = l.Succeed(context.Background(), reservation)
+			default:
+				err = l.Refund(context.Background(), reservation)
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// tooManyRequests writes a 429 Too Many Requests response.
+func tooManyRequests(wait time.Duration, w http.ResponseWriter) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	w.WriteHeader(http.StatusTooManyRequests) // 429
+}
+
+// RemoteIP returns the IP address of the client of the request. It can be used
+// as key function of a middleware.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
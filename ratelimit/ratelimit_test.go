@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{
+		Store:          NewMemoryStore(),
+		FreeFailures:   2,
+		BaseDelay:      20 * time.Millisecond,
+		MaxDelay:       60 * time.Millisecond,
+		ForgetAfter:    time.Hour,
+		ResetOnSuccess: true,
+	}
+	check := func(key string) (Reservation, time.Duration) {
+		r, wait, err := l.Check(ctx, key)
+		require.NoError(t, err)
+		return r, wait
+	}
+
+	// the first failure is free, the second one blocks the key
+	_, wait := check("key")
+	assert.Zero(t, wait)
+	_, wait = check("key")
+	assert.Zero(t, wait)
+	_, wait = check("key")
+	assert.InDelta(t, float64(20*time.Millisecond), float64(wait), float64(10*time.Millisecond))
+
+	// exponential backoff up to the lockout
+	for _, expected := range []time.Duration{40 * time.Millisecond, 60 * time.Millisecond, 60 * time.Millisecond} {
+		time.Sleep(wait)
+		_, wait = check("key")
+		require.Zero(t, wait)
+		_, wait = check("key")
+		assert.InDelta(t, float64(expected), float64(wait), float64(10*time.Millisecond))
+	}
+
+	// other keys are not affected
+	_, otherWait := check("other key")
+	assert.Zero(t, otherWait)
+
+	// success resets the key
+	time.Sleep(wait)
+	r, wait := check("key")
+	require.Zero(t, wait)
+	require.NoError(t, l.Succeed(ctx, r))
+	_, wait = check("key")
+	assert.Zero(t, wait)
+}
+
+func TestLimiterRefund(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{
+		Store:        NewMemoryStore(),
+		FreeFailures: 1,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Minute,
+		ForgetAfter:  time.Hour,
+	}
+
+	// the reservation blocks the key until it is refunded
+	for i := 0; i < 3; i++ {
+		r, wait, err := l.Check(ctx, "key")
+		require.NoError(t, err)
+		require.Zero(t, wait)
+		_, wait, err = l.Check(ctx, "key")
+		require.NoError(t, err)
+		assert.NotZero(t, wait)
+		require.NoError(t, l.Refund(ctx, r))
+	}
+}
+
+func TestLimiterForgetsFailures(t *testing.T) {
+	ctx := context.Background()
+	l := &Limiter{
+		Store:        NewMemoryStore(),
+		FreeFailures: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Second,
+		ForgetAfter:  10 * time.Millisecond,
+	}
+
+	_, _, err := l.Check(ctx, "key")
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, wait, err := l.Check(ctx, "key")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	_, wait, err = l.Check(ctx, "key")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestMiddleware(t *testing.T) {
+	l := &Limiter{
+		Store:        NewMemoryStore(),
+		Prefix:       "ip:",
+		FreeFailures: 2,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		ForgetAfter:  time.Hour,
+	}
+	status := http.StatusUnauthorized
+	handler := l.Middleware(RemoteIP, http.StatusUnauthorized)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = remoteAddr
+		handler(w, r)
+		return w
+	}
+
+	// successes and other errors do not count
+	status = http.StatusOK
+	assert.Equal(t, http.StatusOK, do("192.0.2.1:1234").Code)
+	status = http.StatusBadRequest
+	assert.Equal(t, http.StatusBadRequest, do("192.0.2.1:1234").Code)
+
+	status = http.StatusUnauthorized
+	assert.Equal(t, http.StatusUnauthorized, do("192.0.2.1:1234").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("192.0.2.1:1234").Code)
+
+	// blocked, even if the attempt would succeed
+	status = http.StatusOK
+	w := do("192.0.2.1:5678")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// other clients are not affected
+	assert.Equal(t, http.StatusOK, do("192.0.2.2:1234").Code)
+}
+
+func TestMiddlewareConcurrent(t *testing.T) {
+	const freeFailures = 3
+	l := &Limiter{
+		Store:        NewMemoryStore(),
+		FreeFailures: freeFailures,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		ForgetAfter:  time.Hour,
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := l.Middleware(RemoteIP, http.StatusUnauthorized)(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	do := func() int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		handler(w, r)
+		return w.Code
+	}
+
+	// the free attempts are in flight at the same time
+	var wg sync.WaitGroup
+	codes := make([]int, freeFailures)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = do()
+		}(i)
+		<-started
+	}
+
+	// the next attempt is rejected before any of them failed
+	assert.Equal(t, http.StatusTooManyRequests, do())
+
+	close(release)
+	wg.Wait()
+	for _, code := range codes {
+		assert.Equal(t, http.StatusUnauthorized, code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, do())
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	handler := l.Middleware(RemoteIP, http.StatusUnauthorized)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,48 @@
+// Package response provides helpers for middlewares that inspect responses,
+// like logging, metrics and rate limiting.
+package response
+
+import "net/http"
+
+// Recorder is a response writer that records the status and size of the
+// response it passes on. The status is 200 OK unless another one is written
+// before the body.
+type Recorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+// NewRecorder returns a recorder that passes the response on to w.
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status returns the status of the response.
+func (r *Recorder) Status() int {
+	return r.status
+}
+
+// Bytes returns the number of bytes of the body that were written.
+func (r *Recorder) Bytes() int {
+	return r.bytes
+}
+
+// WriteHeader records the status, unless the header was written before, and
+// passes it on.
+func (r *Recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the body and passes it on.
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
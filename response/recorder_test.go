@@ -0,0 +1,31 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Run("status and size", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := NewRecorder(w)
+		r.WriteHeader(http.StatusNotFound)
+		r.WriteHeader(http.StatusInternalServerError)
+		_, _ = r.Write([]byte("not "))
+		_, _ = r.Write([]byte("found"))
+		assert.Equal(t, http.StatusNotFound, r.Status())
+		assert.Equal(t, 9, r.Bytes())
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "not found", w.Body.String())
+	})
+	t.Run("defaults to ok", func(t *testing.T) {
+		r := NewRecorder(httptest.NewRecorder())
+		assert.Equal(t, http.StatusOK, r.Status())
+		_, _ = r.Write([]byte("ok"))
+		r.WriteHeader(http.StatusTeapot) // too late
+		assert.Equal(t, http.StatusOK, r.Status())
+	})
+}
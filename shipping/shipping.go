@@ -0,0 +1,215 @@
+// Package shipping calculates the shipping costs of orders. The shipping
+// methods, their zones and rates are read from a file, so that they can be
+// changed without a new release.
+package shipping
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/pariz/gountries"
+	"gopkg.in/yaml.v2"
+)
+
+// Methods are the shipping methods that orders can be shipped with.
+type Methods []Method
+
+// Method is a shipping method with its prices in one currency. It can only be
+// used for orders in that currency. Several methods may have the same id if
+// their currencies differ.
+type Method struct {
+	ID       string         `yaml:"id"`
+	Name     string         `yaml:"name"`
+	Currency model.Currency `yaml:"currency"` // the default currency if empty
+	// The zones that the method ships to. The first zone that contains the
+	// country of the recipient applies.
+	Zones []Zone `yaml:"zones"`
+}
+
+// Zone is a group of countries with the same rates.
+type Zone struct {
+	Countries []string `yaml:"countries"` // country codes (ISO 3166-1 alpha-2)
+	Regions   []string `yaml:"regions"`   // like Europe or Western Europe
+	// The rates of the zone. The first rate whose limits the order does not
+	// exceed applies. The method is not available if none does.
+	Rates []Rate `yaml:"rates"`
+	// Orders with at least this subtotal are shipped for free. Never if empty.
+	FreeFrom string `yaml:"freeFrom"`
+
+	freeFrom int // in cents
+}
+
+// Rate is the price of shipping orders up to a weight and subtotal.
+type Rate struct {
+	MaxWeight   int    `yaml:"maxWeight"`   // in grams, no limit if 0
+	MaxSubtotal string `yaml:"maxSubtotal"` // no limit if empty
+	Price       string `yaml:"price"`
+
+	maxSubtotal int // in cents
+	price       int // in cents
+}
+
+// Load reads the methods from the given YAML file and validates them.
+func Load(file string) (Methods, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read shipping file: %w", err)
+	}
+	var m Methods
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, fmt.Errorf("could not parse shipping file %s: %w", file, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate returns an error that lists all invalid methods, or nil if the
+// methods are valid. The amounts are parsed, the country codes are upper-cased
+// and empty currencies become the default currency.
+func (m Methods) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	parse := func(s string, currency model.Currency, what string, args ...interface{}) int {
+		money, err := model.ParseMoney(s, currency)
+		check(err == nil && money.Amount >= 0, "The %s must be a non-negative amount in %s.",
+			fmt.Sprintf(what, args...), currency)
+		return money.Amount
+	}
+
+	query := gountries.New()
+	regions := make(map[string]bool)
+	for _, country := range query.FindAllCountries() {
+		regions[country.Geo.Region] = true
+		regions[country.Geo.SubRegion] = true
+	}
+	delete(regions, "")
+
+	ids := make(map[string]bool, len(m))
+	for i := range m {
+		method := &m[i]
+		if method.Currency == "" {
+			method.Currency = model.DefaultCurrency
+		}
+		check(method.ID != "", "The method %d has no id.", i+1)
+		key := method.ID + "/" + string(method.Currency)
+		check(!ids[key], "The method %q is defined twice in %s.", method.ID, method.Currency)
+		ids[key] = true
+		check(utf8.RuneCountInString(method.Name) >= 1 && utf8.RuneCountInString(method.Name) <= 100,
+			"The name of method %q must be 1 to 100 characters long.", method.ID)
+		if !method.Currency.Valid() {
+			check(false, "The currency %q of method %q is not supported.", method.Currency, method.ID)
+			continue // amounts cannot be parsed
+		}
+		check(len(method.Zones) > 0, "The method %q has no zones.", method.ID)
+		for j := range method.Zones {
+			zone := &method.Zones[j]
+			check(len(zone.Countries)+len(zone.Regions) > 0,
+				"The zone %d of method %q has no countries or regions.", j+1, method.ID)
+			for k, country := range zone.Countries {
+				_, err := query.FindCountryByAlpha(country)
+				check(len(country) == 2 && err == nil, "The country code %q of method %q is unknown.", country, method.ID)
+				zone.Countries[k] = strings.ToUpper(country)
+			}
+			for _, region := range zone.Regions {
+				check(regions[region], "The region %q of method %q is unknown.", region, method.ID)
+			}
+			check(len(zone.Rates) > 0, "The zone %d of method %q has no rates.", j+1, method.ID)
+			for k := range zone.Rates {
+				rate := &zone.Rates[k]
+				check(rate.MaxWeight >= 0, "The maximum weight of rate %d in zone %d of method %q must not be negative.",
+					k+1, j+1, method.ID)
+				if rate.MaxSubtotal != "" {
+					rate.maxSubtotal = parse(rate.MaxSubtotal, method.Currency,
+						"maximum subtotal of rate %d in zone %d of method %q", k+1, j+1, method.ID)
+				}
+				rate.price = parse(rate.Price, method.Currency,
+					"price of rate %d in zone %d of method %q", k+1, j+1, method.ID)
+			}
+			if zone.FreeFrom != "" {
+				zone.freeFrom = parse(zone.FreeFrom, method.Currency,
+					"free shipping subtotal of zone %d of method %q", j+1, method.ID)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid shipping methods:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// Quote returns the methods that the positions can be shipped with to the
+// given country with their prices in the given currency, cheapest first and
+// then ordered by id. The subtotal is the sum of the prices of the positions,
+// so they must include the discounts, but no taxes. The weight is the sum of
+// the weights of the products. Orders are shipped for free if their subtotal
+// reaches the free shipping subtotal of the zone.
+func (m Methods) Quote(positions []model.Position, currency model.Currency, country string) []model.ShippingMethod {
+	var subtotal, weight int
+	for _, position := range positions {
+		subtotal += position.Price
+		if position.ProductID != "" && position.Product != nil {
+			weight += position.Quantity * position.Product.Weight
+		}
+	}
+
+	var quotes []model.ShippingMethod
+	for _, method := range m {
+		if method.Currency != currency {
+			continue
+		}
+		zone := method.zoneOf(country)
+		if zone == nil {
+			continue
+		}
+		for _, rate := range zone.Rates {
+			if (rate.MaxWeight > 0 && weight > rate.MaxWeight) ||
+				(rate.MaxSubtotal != "" && subtotal > rate.maxSubtotal) {
+				continue
+			}
+			quote := model.ShippingMethod{ID: method.ID, Name: method.Name, Price: rate.price}
+			if zone.FreeFrom != "" && subtotal >= zone.freeFrom {
+				quote.Price = 0
+			}
+			quotes = append(quotes, quote)
+			break
+		}
+	}
+	sort.Slice(quotes, func(i, j int) bool {
+		a, b := quotes[i], quotes[j]
+		return a.Price < b.Price || (a.Price == b.Price && a.ID < b.ID)
+	})
+	return quotes
+}
+
+// returns the first zone that contains the country, or nil
+func (m *Method) zoneOf(country string) *Zone {
+	country = strings.ToUpper(country)
+	found, err := gountries.New().FindCountryByAlpha(country)
+	for i, zone := range m.Zones {
+		for _, code := range zone.Countries {
+			if code == country {
+				return &m.Zones[i]
+			}
+		}
+		if err != nil {
+			continue
+		}
+		for _, region := range zone.Regions {
+			if region == found.Geo.Region || region == found.Geo.SubRegion {
+				return &m.Zones[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package shipping
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	m, err := Load("../config/shipping.example.yaml")
+	require.NoError(t, err)
+	require.Len(t, m, 3)
+	assert.Equal(t, "standard", m[0].ID)
+	assert.Equal(t, model.DefaultCurrency, m[0].Currency)
+	assert.Equal(t, 490, m[0].Zones[0].Rates[0].price)
+	assert.Equal(t, 5000, m[0].Zones[0].freeFrom)
+	assert.Equal(t, model.Currency("USD"), m[2].Currency)
+
+	dir, err := ioutil.TempDir("", "shipping")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "shipping.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+- id: standard
+  name: Standard
+  zones:
+    - countries: [de, XX]
+      regions: [Atlantis]
+      freeFrom: "1.234"
+      rates:
+        - price: "-1"
+- id: standard
+  name: ""
+  currency: ABC
+`), 0600))
+	_, err = Load(file)
+	assert.EqualError(t, err, `invalid shipping methods:
+The country code "XX" of method "standard" is unknown.
+The region "Atlantis" of method "standard" is unknown.
+The price of rate 1 in zone 1 of method "standard" must be a non-negative amount in EUR.
+The free shipping subtotal of zone 1 of method "standard" must be a non-negative amount in EUR.
+The name of method "standard" must be 1 to 100 characters long.
+The currency "ABC" of method "standard" is not supported.`)
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func productPosition(id string, quantity, price, weight int) model.Position {
+	return model.Position{
+		ProductID: id,
+		Product:   &model.Product{ID: id, Price: price, Weight: weight},
+		Quantity:  quantity,
+		Price:     quantity * price,
+	}
+}
+
+func TestQuote(t *testing.T) {
+	m, err := Load("../config/shipping.example.yaml")
+	require.NoError(t, err)
+	light := []model.Position{productPosition("apple", 3, 49, 150)}
+	heavy := []model.Position{productPosition("melon", 3, 299, 1500)}
+
+	t.Run("country", func(t *testing.T) {
+		assert.Equal(t, []model.ShippingMethod{
+			{ID: "standard", Name: "Standard shipping", Price: 490},
+			{ID: "express", Name: "Express shipping", Price: 1290},
+		}, m.Quote(light, "EUR", "de"))
+	})
+	t.Run("weight", func(t *testing.T) {
+		assert.Equal(t, []model.ShippingMethod{
+			{ID: "standard", Name: "Standard shipping", Price: 690},
+			{ID: "express", Name: "Express shipping", Price: 1290},
+		}, m.Quote(heavy, "EUR", "DE"))
+	})
+	t.Run("region", func(t *testing.T) {
+		assert.Equal(t, []model.ShippingMethod{
+			{ID: "standard", Name: "Standard shipping", Price: 1490},
+		}, m.Quote(heavy, "EUR", "FR"))
+	})
+	t.Run("free shipping", func(t *testing.T) {
+		positions := []model.Position{
+			productPosition("melon", 20, 300, 100),
+			{Quantity: 1, Price: -1000, Coupon: &model.Coupon{Code: "CART"}},
+		}
+		assert.Equal(t, []model.ShippingMethod{
+			{ID: "standard", Name: "Standard shipping", Price: 0},
+			{ID: "express", Name: "Express shipping", Price: 1290},
+		}, m.Quote(positions, "EUR", "DE"))
+		positions[1].Price = -1001 // below the threshold
+		assert.Equal(t, 490, m.Quote(positions, "EUR", "DE")[0].Price)
+	})
+	t.Run("subtotal", func(t *testing.T) {
+		assert.Equal(t, []model.ShippingMethod{
+			{ID: "standard", Name: "Standard shipping", Price: 799},
+		}, m.Quote(light, "USD", "US"))
+		assert.Equal(t, []model.ShippingMethod{
+			{ID: "standard", Name: "Standard shipping", Price: 499},
+		}, m.Quote([]model.Position{productPosition("melon", 10, 299, 0)}, "USD", "US"))
+	})
+	t.Run("not available", func(t *testing.T) {
+		tooHeavy := []model.Position{productPosition("piano", 1, 99999, 200000)}
+		assert.Empty(t, m.Quote(tooHeavy, "EUR", "DE"))
+		assert.Empty(t, m.Quote(light, "USD", "DE"))
+		assert.Empty(t, m.Quote(light, "JPY", "US"))
+		assert.Empty(t, m.Quote(light, "EUR", "AQ"))
+	})
+	t.Run("without methods", func(t *testing.T) {
+		var m Methods
+		assert.Empty(t, m.Quote(light, "EUR", "DE"))
+	})
+}
@@ -0,0 +1,267 @@
+// Package tax calculates the value added tax (VAT) of orders by the country of
+// the recipient and the tax classes of the products. The rates are read from a
+// file, so that they can be changed without a new release.
+package tax
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/pariz/gountries"
+	"gopkg.in/yaml.v2"
+)
+
+// Mode defines whether the prices of products include the tax.
+type Mode string
+
+// pricing modes
+const (
+	// ModeGross means that prices include the tax. The tax is only shown.
+	ModeGross Mode = "gross"
+	// ModeNet means that prices exclude the tax. The tax is added.
+	ModeNet Mode = "net"
+)
+
+// Rate is a tax rate in hundredths of a percent, like 1900 for 19 %. It is
+// written as percentage like 19 or 5.5 in YAML.
+type Rate int
+
+// UnmarshalYAML parses the percentage.
+func (r *Rate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value float64
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	*r = Rate(math.Round(value * 100))
+	return nil
+}
+
+// FormatRate returns the rate in hundredths of a percent as percentage without
+// the percent sign, like 19 or 5.5.
+func FormatRate(rate int) string {
+	return strconv.FormatFloat(float64(rate)/100, 'f', -1, 64)
+}
+
+// Rates are the tax rates of the tax classes by country.
+type Rates struct {
+	Mode Mode `yaml:"mode"`
+	// class of products without a class, every country must have a rate for it
+	DefaultClass string `yaml:"defaultClass"`
+	// country code (ISO 3166-1 alpha-2) to class to rate
+	Countries map[string]map[string]Rate `yaml:"countries"`
+}
+
+// Load reads the rates from the given YAML file and validates them.
+func Load(file string) (*Rates, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tax file: %w", err)
+	}
+	var r Rates
+	if err := yaml.UnmarshalStrict(data, &r); err != nil {
+		return nil, fmt.Errorf("could not parse tax file %s: %w", file, err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Validate returns an error that lists all invalid rates, or nil if the rates
+// are valid. The country codes are upper-cased.
+func (r *Rates) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(r.Mode == ModeGross || r.Mode == ModeNet, "The mode must be %s or %s.", ModeGross, ModeNet)
+	check(r.DefaultClass != "", "The default class must be set.")
+	query := gountries.New()
+	countries := make(map[string]map[string]Rate, len(r.Countries))
+	for country, rates := range r.Countries {
+		_, err := query.FindCountryByAlpha(country)
+		check(len(country) == 2 && err == nil, "The country code %q is unknown.", country)
+		_, ok := rates[r.DefaultClass]
+		check(ok, "The country %s has no rate for the default class %q.", country, r.DefaultClass)
+		for class, rate := range rates {
+			check(class != "", "The country %s has a rate without class.", country)
+			check(rate >= 0 && rate <= 10000, "The rate of class %q in %s must be between 0 and 100.", class, country)
+		}
+		countries[strings.ToUpper(country)] = rates
+	}
+	check(len(countries) == len(r.Countries), "The country codes must be unique regardless of case.")
+	r.Countries = countries
+
+	if len(problems) > 0 {
+		sort.Strings(problems) // the countries are iterated randomly
+		return fmt.Errorf("invalid tax rates:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// HasClass returns whether the class is the default class or has a rate in
+// any country. The empty class is always known, because it stands for the
+// default class. Without rates no other class is known.
+func (r *Rates) HasClass(class string) bool {
+	if class == "" {
+		return true
+	}
+	if r == nil {
+		return false
+	}
+	if class == r.DefaultClass {
+		return true
+	}
+	for _, rates := range r.Countries {
+		if _, ok := rates[class]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnknownCountry is returned by Rate if there are no rates for the country.
+var ErrUnknownCountry = errors.New("no tax rates for the country")
+
+// Rate returns the rate of the class in the given country. Classes without a
+// rate in the country have the rate of the default class. ErrUnknownCountry is
+// returned if there are no rates for the country.
+func (r *Rates) Rate(country, class string) (int, error) {
+	rates, ok := r.Countries[strings.ToUpper(country)]
+	if !ok {
+		return 0, ErrUnknownCountry
+	}
+	if rate, ok := rates[class]; ok {
+		return int(rate), nil
+	}
+	return int(rates[r.DefaultClass]), nil
+}
+
+// Apply returns the positions with a tax position appended for each tax class
+// of the positions, ordered by rate descending and class. The tax is
+// calculated on the sum of the prices per class in the given country.
+// Discounts of promotions and coupons of products belong to the class of their
+// product. Any other position that belongs to no product, like a cart-wide
+// coupon or the shipping, is split among the classes in proportion to their
+// sums. In gross mode the tax is included in the prices, so the tax positions
+// have no price. No tax is applied without rates or if the country has no rates.
+func (r *Rates) Apply(positions []model.Position, country string) []model.Position {
+	if r == nil {
+		return positions
+	}
+	if _, err := r.Rate(country, r.DefaultClass); err != nil {
+		return positions
+	}
+
+	bases := r.bases(positions)
+	classes := make([]string, 0, len(bases))
+	for class, base := range bases {
+		if base != 0 {
+			classes = append(classes, class)
+		}
+	}
+	taxes := make([]model.Position, len(classes))
+	for i, class := range classes {
+		rate, _ := r.Rate(country, class)
+		tax := model.Tax{Class: class, Rate: rate, Included: r.Mode == ModeGross}
+		if tax.Included {
+			tax.Amount = divRound(bases[class]*rate, 10000+rate)
+			tax.Net = bases[class] - tax.Amount
+		} else {
+			tax.Amount = divRound(bases[class]*rate, 10000)
+			tax.Net = bases[class]
+		}
+		taxes[i] = model.Position{Quantity: 1, Tax: &tax}
+		if !tax.Included {
+			taxes[i].Price = tax.Amount
+		}
+	}
+	sort.Slice(taxes, func(i, j int) bool {
+		a, b := taxes[i].Tax, taxes[j].Tax
+		return a.Rate > b.Rate || (a.Rate == b.Rate && a.Class < b.Class)
+	})
+	return append(positions, taxes...)
+}
+
+// returns the sum of the prices of the positions by class
+func (r *Rates) bases(positions []model.Position) map[string]int {
+	classOf := func(product *model.Product) string {
+		if product.TaxClass == "" {
+			return r.DefaultClass
+		}
+		return product.TaxClass
+	}
+	productClasses := make(map[string]string)
+	for _, position := range positions {
+		if position.ProductID != "" && position.Product != nil {
+			productClasses[position.ProductID] = classOf(position.Product)
+		}
+	}
+
+	bases := make(map[string]int)
+	unassigned := 0
+	for _, position := range positions {
+		var class string
+		switch {
+		case position.Tax != nil:
+			continue // already taxed
+		case position.ProductID != "" && position.Product != nil:
+			class = productClasses[position.ProductID]
+		case position.Promotion != nil:
+			class = productClasses[position.Promotion.ProductID]
+		case position.Coupon != nil && !position.Coupon.CartWide():
+			class = productClasses[position.Coupon.ProductID]
+		}
+		if class == "" {
+			unassigned += position.Price
+			continue
+		}
+		bases[class] += position.Price
+	}
+	if unassigned == 0 {
+		return bases
+	}
+
+	// split the unassigned sum in proportion, the rest goes to the largest
+	total := 0
+	for _, base := range bases {
+		total += base
+	}
+	if total <= 0 {
+		bases[r.DefaultClass] += unassigned
+		return bases
+	}
+	classes := make([]string, 0, len(bases))
+	for class := range bases {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		a, b := bases[classes[i]], bases[classes[j]]
+		return a > b || (a == b && classes[i] < classes[j])
+	})
+	rest := unassigned
+	for _, class := range classes[1:] {
+		share := unassigned * bases[class] / total
+		bases[class] += share
+		rest -= share
+	}
+	bases[classes[0]] += rest
+	return bases
+}
+
+// divides and rounds half away from zero, b must be positive
+func divRound(a, b int) int {
+	if a < 0 {
+		return -((-a + b/2) / b)
+	}
+	return (a + b/2) / b
+}
@@ -0,0 +1,145 @@
+package tax
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Teelevision/excommerce/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	r, err := Load("../config/taxes.example.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, ModeGross, r.Mode)
+	assert.Equal(t, "standard", r.DefaultClass)
+	assert.Equal(t, Rate(1900), r.Countries["DE"]["standard"])
+	assert.Equal(t, Rate(550), r.Countries["FR"]["reduced"])
+
+	dir, err := ioutil.TempDir("", "tax")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "taxes.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+mode: gross
+defaultClass: standard
+countries:
+  de:
+    standard: 19
+  XX:
+    standard: 101
+`), 0600))
+	_, err = Load(file)
+	assert.EqualError(t, err, `invalid tax rates:
+The country code "XX" is unknown.
+The rate of class "standard" in XX must be between 0 and 100.`)
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestHasClass(t *testing.T) {
+	r := &Rates{Mode: ModeGross, DefaultClass: "standard", Countries: map[string]map[string]Rate{
+		"DE": {"standard": 1900, "reduced": 700},
+	}}
+	assert.True(t, r.HasClass(""))
+	assert.True(t, r.HasClass("standard"))
+	assert.True(t, r.HasClass("reduced"))
+	assert.False(t, r.HasClass("books"))
+
+	r = nil
+	assert.True(t, r.HasClass(""))
+	assert.False(t, r.HasClass("standard"))
+}
+
+func newRates(mode Mode) *Rates {
+	return &Rates{Mode: mode, DefaultClass: "standard", Countries: map[string]map[string]Rate{
+		"DE": {"standard": 1900, "reduced": 700},
+		"FR": {"standard": 2000},
+	}}
+}
+
+func productPosition(id, taxClass string, quantity, price int) model.Position {
+	return model.Position{
+		ProductID: id,
+		Product:   &model.Product{ID: id, Price: price, TaxClass: taxClass},
+		Quantity:  quantity,
+		Price:     quantity * price,
+	}
+}
+
+func taxesOf(positions []model.Position) []model.Tax {
+	var taxes []model.Tax
+	for _, position := range positions {
+		if position.Tax != nil {
+			taxes = append(taxes, *position.Tax)
+		}
+	}
+	return taxes
+}
+
+func TestApply(t *testing.T) {
+	positions := []model.Position{
+		productPosition("apple", "reduced", 2, 107),
+		productPosition("pen", "", 1, 119),
+	}
+
+	t.Run("gross", func(t *testing.T) {
+		result := newRates(ModeGross).Apply(positions, "de")
+		require.Len(t, result, 4)
+		assert.Equal(t, 0, result[2].Price)
+		assert.Equal(t, 1, result[2].Quantity)
+		assert.Equal(t, []model.Tax{
+			{Class: "standard", Rate: 1900, Net: 100, Amount: 19, Included: true},
+			{Class: "reduced", Rate: 700, Net: 200, Amount: 14, Included: true},
+		}, taxesOf(result))
+	})
+	t.Run("net", func(t *testing.T) {
+		result := newRates(ModeNet).Apply(positions, "DE")
+		require.Len(t, result, 4)
+		assert.Equal(t, 23, result[2].Price)
+		assert.Equal(t, 15, result[3].Price)
+		assert.Equal(t, []model.Tax{
+			{Class: "standard", Rate: 1900, Net: 119, Amount: 23},
+			{Class: "reduced", Rate: 700, Net: 214, Amount: 15},
+		}, taxesOf(result))
+	})
+	t.Run("class without rate in country", func(t *testing.T) {
+		result := newRates(ModeNet).Apply(positions, "FR")
+		assert.Equal(t, []model.Tax{
+			{Class: "reduced", Rate: 2000, Net: 214, Amount: 43},
+			{Class: "standard", Rate: 2000, Net: 119, Amount: 24},
+		}, taxesOf(result))
+	})
+	t.Run("country without rates", func(t *testing.T) {
+		result := newRates(ModeNet).Apply(positions, "US")
+		assert.Equal(t, positions, result)
+	})
+	t.Run("without rates", func(t *testing.T) {
+		var r *Rates
+		assert.Equal(t, positions, r.Apply(positions, "DE"))
+	})
+}
+
+func TestApplyDiscounts(t *testing.T) {
+	appleCoupon := &model.Coupon{Code: "APPLE", ProductID: "apple"}
+	cartCoupon := &model.Coupon{Code: "CART"}
+	positions := []model.Position{
+		productPosition("apple", "reduced", 2, 150),
+		{Quantity: 1, Price: -100, Coupon: appleCoupon, CouponCode: appleCoupon.Code},
+		productPosition("pen", "", 1, 300),
+		{Quantity: 1, Price: -100, Promotion: &model.Promotion{ID: "pens", ProductID: "pen"}},
+		{Quantity: 1, Price: -101, Coupon: cartCoupon, CouponCode: cartCoupon.Code},
+	}
+
+	// 200 reduced and 200 standard, the cart coupon is split in half and the
+	// rest goes to the class that is first by name on a tie: 149 and 150
+	result := newRates(ModeGross).Apply(positions, "DE")
+	assert.Equal(t, []model.Tax{
+		{Class: "standard", Rate: 1900, Net: 126, Amount: 24, Included: true},
+		{Class: "reduced", Rate: 700, Net: 139, Amount: 10, Included: true},
+	}, taxesOf(result))
+}